@@ -0,0 +1,511 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/schwarzlichtbezirk/hms/config"
+	srv "github.com/schwarzlichtbezirk/hms/server"
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/spf13/cobra"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+const (
+	bkpformat   = 1               // version of backup archive format
+	bkpmanifest = "manifest.json" // name of archive entry with manifest
+	bkplayout   = "20060102-150405"
+)
+
+// Backup errors.
+var (
+	ErrBkpNoManifest = errors.New("backup archive has no manifest at the beginning")
+	ErrBkpFormat     = errors.New("backup archive format is unknown for this build")
+	ErrBkpEntry      = errors.New("backup archive has unexpected entry")
+	ErrBkpTorn       = errors.New("cache package is modified during snapshot, try again later")
+	ErrBkpSqlite     = errors.New("database is not SQLite, use database own tools to backup or restore it")
+)
+
+// BackupManifest describes content of backup archive.
+type BackupManifest struct {
+	Format  int       `json:"format"`  // version of archive format
+	Version string    `json:"version"` // version of application that makes the backup
+	Time    time.Time `json:"time"`    // time of backup creation
+	Storage int       `json:"storage"` // schema version of storage, zero if it is not in archive
+	Userlog int       `json:"userlog"` // schema version of user log, zero if it's not in archive
+	Caches  bool      `json:"caches"`  // archive has thumbnails and tiles caches
+	Files   []string  `json:"files"`   // list of archive entries
+}
+
+// bkpentry is file placed in backup archive.
+type bkpentry struct {
+	name  string // name of entry at archive
+	fpath string // path to file to archive
+	size  int64  // number of bytes to archive, all file if it's negative
+}
+
+const backupShort = "Make archive with server state"
+const backupLong = `Makes one archive with profiles, passlist, files properties storage, user log, and thumbnails and tiles caches. SQLite databases are copied by online backup, so server can work during backup. Backup fails if caches are compacted while they are copied. Caches can be left out from archive, they will be regenerated by scanning.`
+const backupExmp = `Make backup without caches at given file:
+  %s backup --no-caches hms-backup.tar.gz`
+
+var bkpNoCaches bool
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:     "backup [file]",
+	Aliases: []string{"bk"},
+	Short:   backupShort,
+	Long:    backupLong,
+	Example: fmt.Sprintf(backupExmp, config.AppName),
+	Args:    cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var fpath = fmt.Sprintf("hms-backup-%s.tar.gz", time.Now().Format(bkplayout))
+		if len(args) > 0 {
+			fpath = args[0]
+		}
+		var t0 = time.Now()
+		var mf BackupManifest
+		if mf, err = RunBackup(fpath, !bkpNoCaches); err != nil {
+			return
+		}
+		var d = time.Since(t0) / time.Millisecond * time.Millisecond
+		fmt.Fprintf(os.Stdout, "backup %s created, spent %v\n", fpath, d)
+		fmt.Fprintf(os.Stdout, "storage schema version %d, user log schema version %d, entries: %s\n",
+			mf.Storage, mf.Userlog, strings.Join(mf.Files, ", "))
+		return
+	},
+}
+
+const restoreShort = "Restore server state from archive"
+const restoreLong = `Restores profiles, passlist, files properties storage, user log, and thumbnails and tiles caches from archive made by backup command. Server should be stopped during restore. Archive can not be restored by build that does not know its schema versions. Schemas of older versions are upgraded on next server start.`
+const restoreExmp = `Restore all except caches:
+  %s restore --no-caches hms-backup.tar.gz`
+
+var rstNoCaches bool
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:     "restore file",
+	Aliases: []string{"rs"},
+	Short:   restoreShort,
+	Long:    restoreLong,
+	Example: fmt.Sprintf(restoreExmp, config.AppName),
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var t0 = time.Now()
+		var mf BackupManifest
+		var files []string
+		if mf, files, err = RunRestore(args[0], !rstNoCaches); err != nil {
+			return
+		}
+		var d = time.Since(t0) / time.Millisecond * time.Millisecond
+		fmt.Fprintf(os.Stdout, "backup made by version %s at %s restored, spent %v\n",
+			mf.Version, mf.Time.Format(time.DateTime), d)
+		fmt.Fprintf(os.Stdout, "restored entries: %s\n", strings.Join(files, ", "))
+		return
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+
+	backupCmd.Flags().BoolVar(&bkpNoCaches, "no-caches", false, "Leave out thumbnails and tiles caches that can be regenerated.")
+	restoreCmd.Flags().BoolVar(&rstNoCaches, "no-caches", false, "Do not restore thumbnails and tiles caches even if archive has them.")
+}
+
+// sqlitefile returns path to SQLite database file with given
+// data source name, or error if database is not SQLite.
+func sqlitefile(dsn, fname string) (fpath string, err error) {
+	if Cfg.XormDriverName != "sqlite3" && Cfg.XormDriverName != "sqlite" {
+		err = ErrBkpSqlite
+		return
+	}
+	if fpath, err = DataSource(dsn, fname); err != nil {
+		return
+	}
+	fpath = strings.TrimPrefix(fpath, "file:")
+	if i := strings.IndexByte(fpath, '?'); i >= 0 {
+		fpath = fpath[:i]
+	}
+	return
+}
+
+// dbsnapshot makes consistent copy of SQLite database at given file,
+// and returns its schema version.
+func dbsnapshot(dsn, fname string, ms srv.Migrations, dst string) (ver int, err error) {
+	var fpath string
+	if fpath, err = sqlitefile(dsn, fname); err != nil {
+		return
+	}
+	if ok, _ := config.FileExists(fpath); !ok {
+		err = os.ErrNotExist
+		return
+	}
+	var engine *xorm.Engine
+	if engine, err = NewEngine(dsn, fname); err != nil {
+		return
+	}
+	defer engine.Close()
+	if engine.Dialect().URI().DBType != schemas.SQLITE {
+		err = ErrBkpSqlite
+		return
+	}
+	if ver, err = ms.Version(engine); err != nil {
+		return
+	}
+	_, err = engine.Exec("VACUUM INTO ?", dst)
+	return
+}
+
+// cacheid is identity of files of cache package at the moment of snapshot.
+// Running server appends data part and rewrites tags part in place,
+// but compaction replaces both files by new ones.
+type cacheid struct {
+	tags, data os.FileInfo
+}
+
+// cacheident returns identity of files of cache package with given path.
+func cacheident(fpath string) (id cacheid, err error) {
+	if id.tags, err = os.Stat(wpk.MakeTagsPath(fpath)); err != nil {
+		return
+	}
+	id.data, err = os.Stat(wpk.MakeDataPath(fpath))
+	return
+}
+
+// same returns true if files of cache package with given path
+// are not replaced since identity was taken.
+func (id cacheid) same(fpath string) bool {
+	var cur, err = cacheident(fpath)
+	return err == nil && os.SameFile(id.tags, cur.tags) && os.SameFile(id.data, cur.data)
+}
+
+// cachesnap returns content of tags part of cache package with given path,
+// size of data part that is used by it, and identity of package files.
+// Tags part is rewritten by running server on sync, so it's read twice
+// to be sure it's not torn. Backup runs in separate process and can not
+// lock the cache, so identity should be verified again after data is copied.
+func cachesnap(fpath string) (tags []byte, datsize int64, id cacheid, err error) {
+	var pkgpath = wpk.MakeTagsPath(fpath)
+	for i := 0; i < 5; i++ {
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+		if id, err = cacheident(fpath); err != nil {
+			return
+		}
+		if tags, err = os.ReadFile(pkgpath); err != nil {
+			return
+		}
+		var pkg = wpk.NewPackage()
+		if err = pkg.OpenStream(bytes.NewReader(tags)); err != nil {
+			continue
+		}
+		var again []byte
+		if again, err = os.ReadFile(pkgpath); err != nil {
+			return
+		}
+		if !bytes.Equal(tags, again) || !id.same(fpath) {
+			continue
+		}
+		datsize = int64(pkg.DataSize())
+		return
+	}
+	err = ErrBkpTorn
+	return
+}
+
+// writeentry puts file into tar archive.
+func writeentry(tw *tar.Writer, be bkpentry) (err error) {
+	var f *os.File
+	if f, err = os.Open(be.fpath); err != nil {
+		return
+	}
+	defer f.Close()
+	var fi os.FileInfo
+	if fi, err = f.Stat(); err != nil {
+		return
+	}
+	var size = fi.Size()
+	if be.size >= 0 {
+		size = min(size, be.size)
+	}
+	if err = tw.WriteHeader(&tar.Header{
+		Name:    be.name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: fi.ModTime(),
+	}); err != nil {
+		return
+	}
+	_, err = io.CopyN(tw, f, size)
+	return
+}
+
+// RunBackup makes backup archive at given file path.
+func RunBackup(fpath string, caches bool) (mf BackupManifest, err error) {
+	mf.Format = bkpformat
+	mf.Version = config.BuildVers
+	mf.Time = time.Now()
+	mf.Caches = caches
+
+	var tmpdir string
+	if tmpdir, err = os.MkdirTemp("", "hms-backup-"); err != nil {
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var list []bkpentry
+	// configuration files
+	for _, fname := range []string{prffile, passlst} {
+		var fp = JoinPath(config.CfgPath, fname)
+		if ok, _ := config.FileExists(fp); ok {
+			list = append(list, bkpentry{fname, fp, -1})
+		}
+	}
+	// databases
+	for _, db := range []struct {
+		dsn, fname string
+		ms         srv.Migrations
+		ver        *int
+	}{
+		{Cfg.StorageDSN, dirfile, srv.StorageMigrations, &mf.Storage},
+		{Cfg.UserlogDSN, userlog, srv.UserlogMigrations, &mf.Userlog},
+	} {
+		var dst = filepath.Join(tmpdir, db.fname)
+		if *db.ver, err = dbsnapshot(db.dsn, db.fname, db.ms, dst); err != nil {
+			if errors.Is(err, ErrBkpSqlite) || errors.Is(err, os.ErrNotExist) {
+				Log.Warnf("%s is skipped: %s", db.fname, err.Error())
+				err = nil
+				continue
+			}
+			return
+		}
+		list = append(list, bkpentry{db.fname, dst, -1})
+	}
+	// caches
+	var ids = map[string]cacheid{}
+	if caches {
+		for _, fname := range []string{srv.TmbFile, srv.TilFile} {
+			var fp = JoinPath(config.TmbPath, fname)
+			if ok, _ := config.FileExists(fp); !ok {
+				continue
+			}
+			var tags []byte
+			var datsize int64
+			if tags, datsize, ids[fp], err = cachesnap(fp); err != nil {
+				return
+			}
+			var tmp = filepath.Join(tmpdir, fname)
+			if err = os.WriteFile(tmp, tags, 0644); err != nil {
+				return
+			}
+			list = append(list,
+				bkpentry{fname, tmp, -1},
+				bkpentry{wpk.MakeDataPath(fname), wpk.MakeDataPath(fp), datsize})
+		}
+	}
+	for _, be := range list {
+		mf.Files = append(mf.Files, be.name)
+	}
+
+	// write archive
+	var f *os.File
+	if f, err = os.Create(fpath); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(fpath)
+		}
+	}()
+	defer f.Close()
+	var gw = gzip.NewWriter(f)
+	var tw = tar.NewWriter(gw)
+
+	var b []byte
+	if b, err = json.MarshalIndent(mf, "", "  "); err != nil {
+		return
+	}
+	if err = tw.WriteHeader(&tar.Header{
+		Name:    bkpmanifest,
+		Mode:    0644,
+		Size:    int64(len(b)),
+		ModTime: mf.Time,
+	}); err != nil {
+		return
+	}
+	if _, err = tw.Write(b); err != nil {
+		return
+	}
+	for _, be := range list {
+		if err = writeentry(tw, be); err != nil {
+			return
+		}
+	}
+	// data part could be replaced by compaction while it was copied
+	for fp, id := range ids {
+		if !id.same(fp) {
+			err = fmt.Errorf("%w: %s", ErrBkpTorn, filepath.Base(fp))
+			return
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return
+	}
+	if err = gw.Close(); err != nil {
+		return
+	}
+	err = f.Sync()
+	return
+}
+
+// CheckManifest verifies that backup with given manifest
+// can be restored by this build.
+func CheckManifest(mf BackupManifest) error {
+	if mf.Format != bkpformat {
+		return fmt.Errorf("%w, format %d", ErrBkpFormat, mf.Format)
+	}
+	if mf.Storage > srv.StorageMigrations.Latest() {
+		return fmt.Errorf("storage: %w, version %d", srv.ErrMigrateNewer, mf.Storage)
+	}
+	if mf.Userlog > srv.UserlogMigrations.Latest() {
+		return fmt.Errorf("user log: %w, version %d", srv.ErrMigrateNewer, mf.Userlog)
+	}
+	return nil
+}
+
+// RunRestore restores server state from backup archive at given file path.
+// Entries are extracted to temporary files, and replace existing
+// files only when all of them are extracted.
+func RunRestore(fpath string, caches bool) (mf BackupManifest, files []string, err error) {
+	var f *os.File
+	if f, err = os.Open(fpath); err != nil {
+		return
+	}
+	defer f.Close()
+	var gr *gzip.Reader
+	if gr, err = gzip.NewReader(f); err != nil {
+		return
+	}
+	defer gr.Close()
+	var tr = tar.NewReader(gr)
+
+	// read and check manifest
+	var hdr *tar.Header
+	if hdr, err = tr.Next(); err != nil {
+		return
+	}
+	if hdr.Name != bkpmanifest {
+		err = ErrBkpNoManifest
+		return
+	}
+	if err = json.NewDecoder(tr).Decode(&mf); err != nil {
+		return
+	}
+	if err = CheckManifest(mf); err != nil {
+		return
+	}
+	if mf.Version != config.BuildVers {
+		Log.Warnf("backup is made by version %s, current version is %s", mf.Version, config.BuildVers)
+	}
+
+	// destination of each known entry
+	var dest = map[string]string{
+		prffile: JoinPath(config.CfgPath, prffile),
+		passlst: JoinPath(config.CfgPath, passlst),
+	}
+	for _, db := range []struct{ dsn, fname string }{
+		{Cfg.StorageDSN, dirfile},
+		{Cfg.UserlogDSN, userlog},
+	} {
+		if fp, err := sqlitefile(db.dsn, db.fname); err == nil {
+			dest[db.fname] = fp
+		} else {
+			Log.Warnf("%s is skipped: %s", db.fname, err.Error())
+		}
+	}
+	if caches {
+		for _, fname := range []string{srv.TmbFile, srv.TilFile} {
+			dest[fname] = JoinPath(config.TmbPath, fname)
+			dest[wpk.MakeDataPath(fname)] = wpk.MakeDataPath(dest[fname])
+		}
+	}
+
+	// extract entries to temporary files
+	var tmpfiles = map[string]string{}
+	defer func() {
+		for _, tmp := range tmpfiles {
+			os.Remove(tmp)
+		}
+	}()
+	for {
+		if hdr, err = tr.Next(); err != nil {
+			if err == io.EOF {
+				err = nil
+				break
+			}
+			return
+		}
+		if !slices.Contains(mf.Files, hdr.Name) {
+			err = fmt.Errorf("%w: %s", ErrBkpEntry, hdr.Name)
+			return
+		}
+		var dst, ok = dest[hdr.Name]
+		if !ok {
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return
+		}
+		var tmp = dst + "~"
+		var w *os.File
+		if w, err = os.Create(tmp); err != nil {
+			return
+		}
+		tmpfiles[hdr.Name] = tmp
+		_, err = io.Copy(w, tr)
+		if et := w.Close(); et != nil && err == nil {
+			err = et
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	// replace existing files
+	for _, name := range mf.Files {
+		var tmp, ok = tmpfiles[name]
+		if !ok {
+			continue
+		}
+		var dst = dest[name]
+		if name == dirfile || name == userlog {
+			// journal of replaced database is not valid anymore
+			os.Remove(dst + "-wal")
+			os.Remove(dst + "-shm")
+			os.Remove(dst + "-journal")
+		}
+		if err = os.Rename(tmp, dst); err != nil {
+			return
+		}
+		delete(tmpfiles, name)
+		files = append(files, name)
+	}
+	return
+}
+
+// The End.
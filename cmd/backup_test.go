@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/hms/config"
+	srv "github.com/schwarzlichtbezirk/hms/server"
+	"github.com/schwarzlichtbezirk/wpk"
+)
+
+// testCache creates cache package with one file at given path,
+// and keeps it opened while test is running.
+func testCache(t *testing.T, fpath string) *srv.FileCache {
+	t.Helper()
+	var fc, _, err = srv.InitCacheWriter(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		fc.Close()
+	})
+	if err = fc.PutFile("/photo/a.jpg", srv.MediaData{
+		Data: bytes.Repeat([]byte{1}, 4096),
+		Mime: srv.MimeWebp,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = fc.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
+func TestCacheSnap(t *testing.T) {
+	var tests = []struct {
+		name   string
+		change func(t *testing.T, fc *srv.FileCache)
+		same   bool // snapshot is still valid after change
+	}{
+		{"unchanged", func(t *testing.T, fc *srv.FileCache) {}, true},
+		{"appended", func(t *testing.T, fc *srv.FileCache) {
+			if err := fc.PutFile("/photo/b.jpg", srv.MediaData{
+				Data: bytes.Repeat([]byte{2}, 4096),
+				Mime: srv.MimeWebp,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if err := fc.Sync(); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"compacted", func(t *testing.T, fc *srv.FileCache) {
+			if _, err := fc.Compact(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var fpath = filepath.Join(t.TempDir(), srv.TmbFile)
+			var fc = testCache(t, fpath)
+			var tags, datsize, id, err = cachesnap(fpath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if datsize != int64(fc.DataSize()) {
+				t.Errorf("expected data size %d, got %d", fc.DataSize(), datsize)
+			}
+			var pkg = wpk.NewPackage()
+			if err = pkg.OpenStream(bytes.NewReader(tags)); err != nil {
+				t.Fatal(err)
+			}
+			if !pkg.HasTagset("/photo/a.jpg") {
+				t.Error("snapshot has no cached file")
+			}
+
+			test.change(t, fc)
+			if same := id.same(fpath); same != test.same {
+				t.Errorf("expected snapshot validity %v, got %v", test.same, same)
+			}
+		})
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	var prevcfg, prevsql, prevtmb = config.CfgPath, config.SqlPath, config.TmbPath
+	config.CfgPath, config.SqlPath, config.TmbPath = t.TempDir(), t.TempDir(), t.TempDir()
+	t.Cleanup(func() {
+		config.CfgPath, config.SqlPath, config.TmbPath = prevcfg, prevsql, prevtmb
+	})
+
+	var prfpath = filepath.Join(config.CfgPath, prffile)
+	if err := os.WriteFile(prfpath, []byte("profiles: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var engine, err = NewEngine("", dirfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = srv.StorageMigrations.Up(engine, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = engine.InsertOne(&srv.PathStore{Path: "/photo/a.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	engine.Close()
+	var tmbpath = filepath.Join(config.TmbPath, srv.TmbFile)
+	testCache(t, tmbpath)
+
+	var archive = filepath.Join(t.TempDir(), "backup.tar.gz")
+	var mf BackupManifest
+	if mf, err = RunBackup(archive, true); err != nil {
+		t.Fatal(err)
+	}
+	if mf.Storage != srv.StorageMigrations.Latest() || mf.Userlog != 0 {
+		t.Errorf("unexpected schema versions at manifest: storage %d, user log %d", mf.Storage, mf.Userlog)
+	}
+
+	// lose the state
+	var dbpath = filepath.Join(config.SqlPath, dirfile)
+	for _, fpath := range []string{prfpath, dbpath, wpk.MakeTagsPath(tmbpath), wpk.MakeDataPath(tmbpath)} {
+		if err = os.Remove(fpath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var files []string
+	if _, files, err = RunRestore(archive, true); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name  string
+		check func() bool
+	}{
+		{"profiles", func() bool {
+			var b, _ = os.ReadFile(prfpath)
+			return string(b) == "profiles: []\n"
+		}},
+		{"storage", func() bool {
+			var engine, err = NewEngine("", dirfile)
+			if err != nil {
+				return false
+			}
+			defer engine.Close()
+			var n, _ = engine.Where("path=?", "/photo/a.jpg").Count(&srv.PathStore{})
+			return n == 1
+		}},
+		{"thumbnails", func() bool {
+			var fc, _, err = srv.InitCacheWriter(tmbpath)
+			if err != nil {
+				return false
+			}
+			defer fc.Close()
+			var md, _ = fc.GetData("/photo/a.jpg")
+			return bytes.Equal(md.Data, bytes.Repeat([]byte{1}, 4096))
+		}},
+	}
+	for _, test := range tests {
+		if !test.check() {
+			t.Errorf("%s is not restored, restored entries %v", test.name, files)
+		}
+	}
+}
+
+// The End.
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	srv "github.com/schwarzlichtbezirk/hms/server"
+)
+
+// bgscanner throttles background scanning and
+// reflects its progress at server state.
+type bgscanner struct {
+	mux  sync.Mutex
+	next time.Time // time after which next file can be read
+}
+
+// Wait suspends scanning while clients are online, and holds
+// files reading to fit into reading speed limit.
+func (bs *bgscanner) Wait(ctx context.Context) bool {
+	var paused bool
+	for Cfg.BgScanPauseOnline && time.Since(srv.LastOnline()) < Cfg.OnlineTimeout {
+		if !paused {
+			paused = true
+			srv.BgScanUpdate(func(st *srv.BgScanStat) {
+				st.Paused = true
+			})
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(5 * time.Second):
+		}
+	}
+	if paused {
+		srv.BgScanUpdate(func(st *srv.BgScanStat) {
+			st.Paused = false
+		})
+	}
+
+	bs.mux.Lock()
+	var d = time.Until(bs.next)
+	bs.mux.Unlock()
+	if d > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(d):
+		}
+	}
+	return ctx.Err() == nil
+}
+
+// Stage reflects new stage of scanning at server state.
+func (bs *bgscanner) Stage(stage int, share string, total, size int64) {
+	srv.BgScanUpdate(func(st *srv.BgScanStat) {
+		st.Stage = stage
+		st.Path = share
+		st.Total, st.TotalSize = total, size
+		st.Done, st.DoneSize = 0, 0
+	})
+}
+
+// Done reflects processed file at server state, shifts time of next
+// reading by file size, and sleeps to fit into CPU duty cycle.
+func (bs *bgscanner) Done(ctx context.Context, size int64, spent time.Duration) {
+	srv.BgScanUpdate(func(st *srv.BgScanStat) {
+		st.Done++
+		st.DoneSize += size
+	})
+
+	if limit := Cfg.BgScanReadLimit; limit > 0 {
+		bs.mux.Lock()
+		if now := time.Now(); bs.next.Before(now) {
+			bs.next = now
+		}
+		bs.next = bs.next.Add(time.Duration(float64(size) / float64(limit) / 1e6 * float64(time.Second)))
+		bs.mux.Unlock()
+	}
+
+	if duty := Cfg.BgScanCpuDuty; duty > 0 && duty < 1 {
+		var d = time.Duration(float64(spent) * float64(1-duty) / float64(duty))
+		select {
+		case <-ctx.Done():
+		case <-time.After(d):
+		}
+	}
+}
+
+// Run performs one scanning of all shares.
+func (bs *bgscanner) Run(exitctx context.Context) {
+	var thrnum = Cfg.BgScanThreadsNum
+	if thrnum == 0 {
+		thrnum = srv.GetScanThreadsNum()
+	}
+	var ctl = &ScanCtl{
+		Out:     io.Discard,
+		Threads: thrnum,
+		Wait:    bs.Wait,
+		Stage:   bs.Stage,
+		Done:    bs.Done,
+	}
+
+	srv.BgScanUpdate(func(st *srv.BgScanStat) {
+		st.State = srv.BgScanRun
+		st.Start = srv.UnixJSNow()
+		st.Error = ""
+	})
+	Log.Info("background scanning started")
+
+	var shares = ScanRoots(Cfg.BgScanLocal)
+	var complete, err = ScanShares(exitctx, ctl, shares)
+	// sync file tags tables of caches
+	if err := srv.ThumbPkg.Sync(); err != nil {
+		Log.Error(err)
+	}
+	if err := srv.TilesPkg.Sync(); err != nil {
+		Log.Error(err)
+	}
+
+	srv.BgScanUpdate(func(st *srv.BgScanStat) {
+		st.State = srv.BgScanWait
+		st.Paused = false
+		st.Finish = srv.UnixJSNow()
+		if complete {
+			st.Runs++
+		}
+		if err != nil {
+			st.Error = err.Error()
+		}
+	})
+	switch {
+	case err != nil:
+		Log.Errorf("background scanning failed: %s", err.Error())
+	case complete:
+		Log.Info("background scanning complete")
+	default:
+		Log.Info("background scanning interrupted")
+	}
+}
+
+// cronunix returns given time in UNIX format in milliseconds,
+// or zero for zero time.
+func cronunix(t time.Time) srv.Unix_t {
+	if t.IsZero() {
+		return 0
+	}
+	return srv.UnixJS(t)
+}
+
+// RunBgScan runs scanning of shares in background at scheduled times,
+// or when no one client was online for a while. Returns when exit
+// context is done.
+func RunBgScan(exitctx context.Context) {
+	var crons []CronSpec
+	for _, spec := range Cfg.BgScanCron {
+		if cs, err := ParseCron(spec); err != nil {
+			Log.Errorf("background scanning schedule skipped: %s", err.Error())
+		} else {
+			crons = append(crons, cs)
+		}
+	}
+	var nextcron = func(t time.Time) (next time.Time) {
+		for _, cs := range crons {
+			if nt := cs.Next(t); !nt.IsZero() && (next.IsZero() || nt.Before(next)) {
+				next = nt
+			}
+		}
+		return
+	}
+
+	var bs bgscanner
+	var t0 = time.Now()
+	var last time.Time // finish time of last scanning
+	var next = nextcron(t0)
+	srv.BgScanUpdate(func(st *srv.BgScanStat) {
+		st.State = srv.BgScanWait
+		st.Next = cronunix(next)
+	})
+
+	var ticker = time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exitctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var now = time.Now()
+		var quiet = srv.LastOnline()
+		if quiet.Before(t0) {
+			quiet = t0
+		}
+		var due = !next.IsZero() && !now.Before(next)
+		var idle = Cfg.BgScanIdle > 0 &&
+			now.Sub(quiet) >= Cfg.BgScanIdle &&
+			(last.IsZero() || now.Sub(last) >= Cfg.BgScanPeriod)
+		if !due && !idle {
+			continue
+		}
+
+		bs.Run(exitctx)
+		last = time.Now()
+		next = nextcron(last)
+		srv.BgScanUpdate(func(st *srv.BgScanStat) {
+			st.Next = cronunix(next)
+		})
+	}
+}
+
+// The End.
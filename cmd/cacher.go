@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,26 +20,66 @@ import (
 	"github.com/rwcarlsen/goexif/tiff"
 )
 
-type FileMap = map[string]fs.FileInfo
-
 type CnvStat struct {
 	ErrCount  uint64
 	FileCount uint64
 	tilecount uint64
 	tmbcount  uint64
+	hashcount uint64
 	filesize  uint64
 	tilesize  uint64
 	tmbsize   uint64
 }
 
-// Tiles multipliers:
-var tilemult = [...]int{
-	2, 3, 4, 6, 8, 9, 10, 12, 15, 16, 18, 20, 24, 30, 36,
+// ScanCtl controls pace of scanning and receives its progress.
+type ScanCtl struct {
+	Out     io.Writer // output of progress messages
+	Threads int       // number of working threads
+	// Wait is called before processing of each directory or file,
+	// and returns false if scanning should be stopped.
+	Wait func(ctx context.Context) bool
+	// Stage is called at start of each stage with walked share path,
+	// or with number and total size of queued files.
+	Stage func(stage int, share string, total, size int64)
+	// Done is called after processing of each file
+	// with its size and spent time.
+	Done func(ctx context.Context, size int64, spent time.Duration)
+}
+
+// NewScanCtl returns scanning control to run scanning
+// at full speed with progress output to stdout.
+func NewScanCtl() *ScanCtl {
+	return &ScanCtl{
+		Out:     os.Stdout,
+		Threads: srv.GetScanThreadsNum(),
+	}
+}
+
+// Printf writes formatted progress message to output.
+func (ctl *ScanCtl) Printf(format string, a ...any) {
+	fmt.Fprintf(ctl.Out, format, a...)
 }
 
-type pathpair struct {
-	fpath string
-	fi    fs.FileInfo
+// wait calls Wait hook if it present.
+func (ctl *ScanCtl) wait(ctx context.Context) bool {
+	if ctl.Wait != nil {
+		return ctl.Wait(ctx)
+	}
+	return true
+}
+
+// stage calls Stage hook if it present.
+func (ctl *ScanCtl) stage(stage int, share string, total, size int64) {
+	if ctl.Stage != nil {
+		ctl.Stage(stage, share, total, size)
+	}
+}
+
+// done calls Done hook if it present.
+func (ctl *ScanCtl) done(ctx context.Context, size int64, spent time.Duration) {
+	if ctl.Done != nil {
+		ctl.Done(ctx, size, spent)
+	}
 }
 
 // IsCached returns "true" if thumbnail and all tiles are cached for given filename.
@@ -47,10 +88,8 @@ func IsCached(fpath string) bool {
 		return false
 	}
 
-	for _, tm := range tilemult {
-		var wdh, hgt = tm * 24, tm * 18
-		var tilepath = fmt.Sprintf("%s?%dx%d", fpath, wdh, hgt)
-		if !srv.TilesPkg.HasTagset(tilepath) {
+	for _, spec := range Cfg.TileSpecs {
+		if !srv.IsTileCached(fpath, spec) {
 			return false
 		}
 	}
@@ -58,45 +97,286 @@ func IsCached(fpath string) bool {
 	return true
 }
 
-// FileList forms list of files to process by caching algorithm.
-func FileList(fsys *jnt.SubPool, pathlist *[]string, extlist, cnvlist FileMap) (err error) {
-	var session = srv.XormStorage.NewSession()
-	defer session.Close()
+// ListStat is statistics of shares walking.
+type ListStat struct {
+	DirCount  int // number of listed directories
+	SkipCount int // number of directories not modified since last scanning
+	ExtCount  int // number of files queued to extract embedded info
+	CnvCount  int // number of files queued to prepare tiles and thumbnails
+}
 
-	fs.WalkDir(fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+// IsDirScanned returns "true" if directory was listed by complete
+// scanning after its last modification.
+func IsDirScanned(session *srv.Session, fsys *jnt.SubPool, fpath string) bool {
+	var fi, err = fsys.Stat(fpath)
+	if err != nil {
+		return false
+	}
+	var ws srv.WalkStore
+	var ok bool
+	if ok, err = session.Where("path=? AND done=?", JoinPath(fsys.Dir(), fpath), true).Get(&ws); err != nil || !ok {
+		return false
+	}
+	return ws.Time.After(fi.ModTime())
+}
+
+// InsertPaths puts to database system paths that have no PUIDs yet.
+func InsertPaths(session *srv.Session, pathlist []string) (err error) {
+	const limit = 256
+	for i := 0; i < len(pathlist); i += limit {
+		var pc = pathlist[i:min(i+limit, len(pathlist))]
+		var nps = make([]srv.PathStore, len(pc))
+		for i, fpath := range pc {
+			nps[i].Path = fpath
+			nps[i].Puid = 0
 		}
-		var fullpath = JoinPath(fsys.Dir(), fpath)
-		if d.Name() != "." && d.Name() != ".." {
-			if _, ok := srv.PathStorePUID(session, fullpath); !ok {
-				*pathlist = append(*pathlist, fullpath)
+		if _, err = session.Insert(&nps); err != nil {
+			return
+		}
+		nps = nil
+		if err = session.In("path", pc).Find(&nps); err != nil {
+			return
+		}
+		for _, ps := range nps {
+			if ps.Puid != 0 {
+				srv.PathCache.Set(ps.Puid, ps.Path)
 			}
 		}
+	}
+	return
+}
+
+// ListDir puts to scanning queue files of given directory that should be
+// processed by caching algorithm. Queued files and directory mark are
+// written in one transaction, so listing can be resumed after interruption.
+func ListDir(session *srv.Session, dir string, ents []fs.DirEntry, ls *ListStat) (err error) {
+	var ws = srv.WalkStore{
+		Path: dir,
+		Time: time.Now(),
+	}
+	var pathlist []string
+	for _, d := range ents {
+		var fpath = JoinPath(dir, d.Name())
 		if d.IsDir() {
-			return nil // file is directory
+			ws.FGrp.FGgroup++
+		} else {
+			*ws.FGrp.Field(srv.GetFileGroup(fpath))++
+		}
+		if _, ok := srv.PathStorePUID(session, fpath); !ok {
+			pathlist = append(pathlist, fpath)
 		}
+	}
+	if err = InsertPaths(session, pathlist); err != nil {
+		return
+	}
+
+	var tasks []srv.TaskStore
+	var extnum, cnvnum int
+	for _, d := range ents {
+		if d.IsDir() {
+			continue
+		}
+		var fpath = JoinPath(dir, d.Name())
 		var ext = srv.GetFileExt(fpath)
+		var puid, _ = srv.PathStorePUID(session, fpath)
+		var size int64
+		if fi, err := d.Info(); err == nil {
+			size = fi.Size()
+		}
 		if srv.IsTypeDecoded(ext) {
-			if !IsCached(fullpath) {
-				cnvlist[fullpath], _ = d.Info()
+			if ok, _ := session.ID(puid).Exist(&srv.HashStore{}); !ok || !IsCached(fpath) {
+				tasks = append(tasks, srv.TaskStore{Stage: srv.TaskCnv, Path: fpath, Size: size})
+				cnvnum++
 			}
 		}
 		if srv.IsTypeEXIF(ext) || srv.IsTypeDecoded(ext) || srv.IsTypeID3(ext) {
-			extlist[fullpath], _ = d.Info()
+			if ok, _ := session.ID(puid).Exist(&srv.ExtStore{}); !ok {
+				tasks = append(tasks, srv.TaskStore{Stage: srv.TaskExt, Path: fpath, Size: size})
+				extnum++
+			}
 		}
-		return nil
-	})
+	}
+
+	if err = session.Begin(); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			session.Rollback()
+		}
+	}()
+	// mark of previous complete scanning is replaced
+	if _, err = session.ID(dir).Delete(&srv.WalkStore{}); err != nil {
+		return
+	}
+	const limit = 128
+	for i := 0; i < len(tasks); i += limit {
+		var tc = tasks[i:min(i+limit, len(tasks))]
+		if _, err = session.Insert(&tc); err != nil {
+			return
+		}
+	}
+	if _, err = session.InsertOne(&ws); err != nil {
+		return
+	}
+	if err = session.Commit(); err != nil {
+		return
+	}
+
+	ls.DirCount++
+	ls.ExtCount += extnum
+	ls.CnvCount += cnvnum
+	return
+}
+
+// WalkShare walks directories tree of the share, and lists files of each
+// directory modified since last scanning. Files of directories that are
+// already listed by interrupted scanning are not queued again.
+func WalkShare(exitctx context.Context, ctl *ScanCtl, fsys *jnt.SubPool, walked map[string]struct{}, ls *ListStat) (err error) {
+	var session = srv.XormStorage.NewSession()
+	defer session.Close()
+
+	var walk func(fpath string) error
+	walk = func(fpath string) (err error) {
+		if !ctl.wait(exitctx) {
+			return
+		}
+
+		var dir = JoinPath(fsys.Dir(), fpath)
+		var ents []fs.DirEntry
+		if ents, err = fsys.ReadDir(fpath); err != nil {
+			Log.Warnf("can not read directory %s, error %v", dir, err)
+			return nil // skip unreadable directory
+		}
+		var _, listed = walked[dir]
+		if !listed && !FullScan && IsDirScanned(session, fsys, fpath) {
+			ls.SkipCount++
+			listed = true
+		}
+		if !listed {
+			if err = ListDir(session, dir, ents, ls); err != nil {
+				return
+			}
+		}
+		// subdirectories modifications do not change
+		// parent directory time, so walk them anyway
+		for _, d := range ents {
+			if d.IsDir() {
+				if err = walk(path.Join(fpath, d.Name())); err != nil {
+					return
+				}
+			}
+		}
+		return
+	}
+	return walk(".")
+}
+
+// FinishWalk marks all listed directories as scanned at their listing
+// time, and removes them from scanning state. Only complete scanning
+// sets these marks.
+func FinishWalk(session *srv.Session) (count int, err error) {
+	const limit = 256
+	for {
+		var wss []srv.WalkStore
+		if err = session.Where("done=?", false).Limit(limit).Find(&wss); err != nil {
+			return
+		}
+		if len(wss) == 0 {
+			break
+		}
+		var paths = make([]string, len(wss))
+		for i, ws := range wss {
+			var puid srv.Puid_t
+			if puid, err = srv.PathStoreCache(session, ws.Path); err != nil {
+				return
+			}
+			var dp, _ = srv.DirStoreGet(session, puid)
+			dp.Scan = ws.Time
+			dp.FGrp = ws.FGrp
+			if err = srv.DirStoreSet(session, puid, dp); err != nil {
+				return
+			}
+			paths[i] = ws.Path
+		}
+		if _, err = session.In("path", paths).Cols("done").Update(&srv.WalkStore{Done: true}); err != nil {
+			return
+		}
+		count += len(wss)
+	}
+	return
+}
+
+// ClearScanState removes saved state of interrupted scanning.
+// Marks of complete scanning are kept.
+func ClearScanState(session *srv.Session) (err error) {
+	if _, err = session.Where("done=?", false).Delete(&srv.WalkStore{}); err != nil {
+		return
+	}
+	_, err = session.Where("1=1").Delete(&srv.TaskStore{})
+	return
+}
+
+// NextTasks returns next portion of queued files of given stage
+// with identifiers greater than given.
+func NextTasks(session *srv.Session, stage int, last uint64) (tasks []srv.TaskStore, err error) {
+	const limit = 256
+	err = session.Where("stage=? AND id>?", stage, last).OrderBy("id").Limit(limit).Find(&tasks)
+	return
+}
+
+// TaskBuf collects identifiers of processed files,
+// to remove them from scanning queue by portions.
+type TaskBuf []uint64
+
+// Flush removes collected files from scanning queue.
+func (tb *TaskBuf) Flush(session *srv.Session) (err error) {
+	if len(*tb) == 0 {
+		return
+	}
+	if _, err = session.In("id", []uint64(*tb)).Delete(&srv.TaskStore{}); err != nil {
+		return
+	}
+	*tb = (*tb)[:0]
 	return
 }
 
-func Convert(fpath string, fi fs.FileInfo, cs *CnvStat) (err error) {
+// Remains returns estimated time to complete the work, if given part
+// of total work was done during given time.
+func Remains(done, total float64, spent time.Duration) (remain time.Duration) {
+	remain = time.Duration(float64(spent) / done * (total - done))
+	if remain < time.Hour {
+		remain = remain / time.Second * time.Second
+	} else {
+		remain = remain / time.Minute * time.Minute
+	}
+	return
+}
+
+// IsInterrupted checks up that scanning was interrupted,
+// and reports about it.
+func IsInterrupted(exitctx context.Context, ctl *ScanCtl) bool {
+	select {
+	case <-exitctx.Done():
+		ctl.Printf("\nscanning interrupted, its state is saved, run scan again to resume\n")
+		return true
+	default:
+		return false
+	}
+}
+
+// Convert prepares tiles and thumbnail of given image file, and
+// calculates its perceptual hash if it is absent. Hash is returned
+// to be stored by the caller, database is only read here.
+func Convert(session *srv.Session, fpath string, fi fs.FileInfo, cs *CnvStat) (hst *srv.HashStore, err error) {
 	defer func() {
 		if err != nil {
 			atomic.AddUint64(&cs.ErrCount, 1)
 		}
 	}()
 
+	var ext = srv.GetFileExt(fpath)
+
 	// lazy decode
 	var orientation = srv.OrientNormal
 	var src image.Image
@@ -112,7 +392,7 @@ func Convert(fpath string, fi fs.FileInfo, cs *CnvStat) (err error) {
 		}
 		defer file.Close()
 
-		if imc, _, err = image.DecodeConfig(file); err != nil {
+		if imc, _, err = srv.ImageDecodeConfig(file, ext); err != nil {
 			return // can not recognize format or decode config
 		}
 		if float32(imc.Width*imc.Height+5e5)/1e6 > Cfg.ImageMaxMpx {
@@ -123,17 +403,20 @@ func Convert(fpath string, fi fs.FileInfo, cs *CnvStat) (err error) {
 		if _, err = file.Seek(0, io.SeekStart); err != nil {
 			return // can not seek to start
 		}
-		if x, err := exif.Decode(file); err == nil {
+		if x, err := srv.ExifDecode(file); err == nil {
 			var t *tiff.Tag
 			if t, err = x.Get(exif.Orientation); err == nil {
 				orientation, _ = t.Int(0)
 			}
 		}
+		if srv.IsTypeHEIF(ext) {
+			orientation = srv.OrientNormal // image is already transformed by decoder
+		}
 
 		if _, err = file.Seek(0, io.SeekStart); err != nil {
 			return // can not seek to start
 		}
-		if src, _, err = image.Decode(file); err != nil {
+		if src, _, err = srv.ImageDecode(file, ext); err != nil {
 			if src == nil { // skip "short Huffman data" or others errors with partial results
 				return // can not decode file by any codec
 			}
@@ -143,29 +426,30 @@ func Convert(fpath string, fi fs.FileInfo, cs *CnvStat) (err error) {
 	var md srv.MediaData
 	md.Mime = srv.MimeWebp
 	md.Time = fi.ModTime()
+	md.SrcSize = fi.Size()
 	var size = fi.Size()
 
 	atomic.AddUint64(&cs.FileCount, 1)
 	atomic.AddUint64(&cs.filesize, uint64(size))
 
-	var ext = srv.GetFileExt(fpath)
 	if srv.IsTypeTileImg(ext) && size > 512*1024 {
-		for _, tm := range tilemult {
-			var wdh, hgt = tm * 24, tm * 18
-			var tilepath = fmt.Sprintf("%s?%dx%d", fpath, wdh, hgt)
-			if !srv.TilesPkg.HasTagset(tilepath) {
+		for _, spec := range Cfg.TileSpecs {
+			if !srv.IsTileCached(fpath, spec) {
 				if decode(); err != nil {
 					return
 				}
-				if md.Data, err = srv.DrawTile(src, wdh, hgt, orientation); err != nil {
+				var td = md
+				if td.Data, td.Mime, err = srv.DrawTile(src, spec, orientation); err != nil {
 					return
 				}
-				// push tile to package
-				if err = srv.TilesPkg.PutFile(tilepath, md); err != nil {
+				// push tile to package, replace tile in another format
+				var tilepath = srv.TileKey(fpath, spec.Width, spec.Height)
+				srv.TilesPkg.DelTagset(tilepath)
+				if err = srv.TilesPkg.PutFile(tilepath, td); err != nil {
 					return
 				}
 				atomic.AddUint64(&cs.tilecount, 1)
-				atomic.AddUint64(&cs.tilesize, uint64(len(md.Data)))
+				atomic.AddUint64(&cs.tilesize, uint64(len(td.Data)))
 			}
 		}
 	}
@@ -185,111 +469,77 @@ func Convert(fpath string, fi fs.FileInfo, cs *CnvStat) (err error) {
 		atomic.AddUint64(&cs.tmbsize, uint64(len(md.Data)))
 	}
 
-	return
-}
-
-func BatchPathList(pathlist []string) {
-	var err error
-	fmt.Fprintf(os.Stdout, "start caching %d file paths\n", len(pathlist))
-	var t0 = time.Now()
-
-	var session = srv.XormStorage.NewSession()
-	defer session.Close()
-
-	const limit = 256
-	for i := 0; i < len(pathlist); i += limit {
-		var pc []string
-		if len(pathlist)-i >= limit {
-			pc = pathlist[i : i+limit]
-		} else {
-			pc = pathlist[i:]
-		}
-		var nps = make([]srv.PathStore, len(pc))
-		for i, fpath := range pc {
-			nps[i].Path = fpath
-			nps[i].Puid = 0
-		}
-		if _, err = session.Insert(&nps); err != nil {
-			fmt.Fprintf(os.Stdout, "error received: %s\n", err.Error())
-		}
-		nps = nil
-		if err = session.In("path", pc).Find(&nps); err != nil {
-			return
-		}
-		for _, ps := range nps {
-			if ps.Puid != 0 {
-				srv.PathCache.Set(ps.Puid, ps.Path)
+	if puid, ok := srv.PathStorePUID(session, fpath); ok {
+		if _, ok := srv.HashStoreGet(session, puid); !ok {
+			if decode(); err != nil {
+				return
+			}
+			var hp = srv.HashProp{
+				DHash: int64(srv.DHash(src, orientation)),
 			}
+			hp.SrcProp.Setup(fi)
+			hst = &srv.HashStore{Puid: puid, Prop: hp}
+			atomic.AddUint64(&cs.hashcount, 1)
 		}
 	}
 
-	var d = time.Since(t0) / time.Second * time.Second
-	fmt.Fprintf(os.Stdout, "file paths caching complete, spent %v\n", d)
+	return
 }
 
-func UpdateExtList(extlist FileMap) {
+func BatchExtractor(exitctx context.Context, ctl *ScanCtl) {
+	var es srv.ExtStat
+	var thrnum = ctl.Threads
+
 	var session = srv.XormStorage.NewSession()
 	defer session.Close()
 
-	const limit = 256
-	var offset int
-	for {
-		var puids []uint64
-		if err := session.Table("ext_store").Cols("puid").Limit(limit, offset).Find(&puids); err != nil {
-			return
-		}
-		offset += limit
-		for _, puid := range puids {
-			if fpath, ok := srv.PathStorePath(session, srv.Puid_t(puid)); ok {
-				delete(extlist, fpath)
-			} else {
-				fmt.Fprintf(os.Stdout, "found unlinked PUID in ext_store: %d\n", puid)
-			}
-		}
-		if limit > len(puids) {
-			break
-		}
+	var total, _ = session.Where("stage=?", srv.TaskExt).Count(&srv.TaskStore{})
+	if total == 0 {
+		return
 	}
-}
-
-func BatchExtractor(exitctx context.Context, extlist FileMap) {
-	var es srv.ExtStat
-	var thrnum = srv.GetScanThreadsNum()
-
-	fmt.Fprintf(os.Stdout, "start processing %d files with %d threads...\n", len(extlist), thrnum)
+	var totalsize, _ = session.Where("stage=?", srv.TaskExt).SumInt(&srv.TaskStore{}, "size")
+	ctl.stage(srv.TaskExt, "", total, totalsize)
+	ctl.Printf("start processing %d files with %d threads...\n", total, thrnum)
 	var t0 = time.Now()
 
 	// manager thread that distributes task to extract emedded information
-	var pathchan = make(chan pathpair, thrnum)
+	var taskchan = make(chan srv.TaskStore, thrnum)
 	go func() {
-		defer close(pathchan)
+		defer close(taskchan)
 
-		var total = float64(len(extlist))
 		var tinfo = time.NewTicker(time.Second)
 		defer tinfo.Stop()
-		for fpath, fi := range extlist {
-			select {
-			case pathchan <- pathpair{fpath, fi}:
-				continue
-			case <-tinfo.C:
-				// information thread
-				if ready := atomic.LoadUint64(&es.FileCount); ready > 0 {
-					var remain = time.Duration(float64(time.Since(t0)) / float64(ready) * (total - float64(ready)))
-					if remain < time.Hour {
-						remain = remain / time.Second * time.Second
-					} else {
-						remain = remain / time.Minute * time.Minute
+		var last uint64
+		for {
+			var tasks, err = NextTasks(session, srv.TaskExt, last)
+			if err != nil {
+				Log.Error(err)
+				return
+			}
+			if len(tasks) == 0 {
+				return
+			}
+			last = tasks[len(tasks)-1].ID
+			for _, task := range tasks {
+				for sent := false; !sent; {
+					select {
+					case taskchan <- task:
+						sent = true
+					case <-tinfo.C:
+						// information thread
+						if ready := atomic.LoadUint64(&es.FileCount); ready > 0 {
+							ctl.Printf("processed %d files, remains about %v            \r",
+								ready, Remains(float64(ready), float64(total), time.Since(t0)))
+						}
+					case <-exitctx.Done():
+						return
 					}
-					fmt.Fprintf(os.Stdout, "processed %d files, remains about %v            \r",
-						ready, remain)
 				}
-			case <-exitctx.Done():
-				return
 			}
 		}
 	}()
 
-	// working threads, runs until 'pathchan' not closed
+	// working threads, runs until 'taskchan' not closed
 	var workwg sync.WaitGroup
 	workwg.Add(thrnum)
 	for i := 0; i < thrnum; i++ {
@@ -301,217 +551,376 @@ func BatchExtractor(exitctx context.Context, extlist FileMap) {
 
 			var buf srv.StoreBuf
 			buf.Init(256)
-			defer buf.Flush(session)
+			var done = make(TaskBuf, 0, 256)
+			defer func() {
+				// embedded info should be stored before files leave the queue
+				if err := buf.Flush(session); err != nil {
+					Log.Error(err)
+					return
+				}
+				if err := done.Flush(session); err != nil {
+					Log.Error(err)
+				}
+			}()
 
-			for c := range pathchan {
-				srv.TagsExtract(c.fpath, session, &buf, &es, false)
+			for task := range taskchan {
+				if !ctl.wait(exitctx) {
+					continue
+				}
+				var tstart = time.Now()
+				srv.TagsExtract(task.Path, session, &buf, &es, false)
+				ctl.done(exitctx, task.Size, time.Since(tstart))
+				if done = append(done, task.ID); len(done) == cap(done) {
+					if err := buf.Flush(session); err != nil {
+						Log.Error(err)
+						continue
+					}
+					if err := done.Flush(session); err != nil {
+						Log.Error(err)
+					}
+				}
 			}
 		}()
 	}
 	workwg.Wait()
 
 	var d = time.Since(t0) / time.Second * time.Second
-	fmt.Fprintf(os.Stdout, "processed %d files, spent %v, processing complete\n", es.FileCount, d)
-	fmt.Fprintf(os.Stdout, "total %d files with embedded info processed, %d of them with EXIF, %d of them with ID3 tags, %d embedded thumbnails, %d mp3-files\n",
+	ctl.Printf("processed %d files, spent %v, processing complete\n", es.FileCount, d)
+	ctl.Printf("total %d files with embedded info processed, %d of them with EXIF, %d of them with ID3 tags, %d embedded thumbnails, %d mp3-files\n",
 		es.ExtCount, es.ExifCount, es.Id3Count, es.TmbCount, es.Mp3Count)
 	if es.ErrCount > 0 {
-		fmt.Fprintf(os.Stdout, "gets %d failures on embedded info extract\n", es.ErrCount)
+		ctl.Printf("gets %d failures on embedded info extract\n", es.ErrCount)
 	}
 }
 
-func BatchCacher(exitctx context.Context, cnvlist FileMap) {
+func BatchCacher(exitctx context.Context, ctl *ScanCtl) {
 	var cs CnvStat
-	var thrnum = srv.GetScanThreadsNum()
+	var thrnum = ctl.Threads
 
-	fmt.Fprintf(os.Stdout, "start processing %d files with %d threads to prepare tiles and thumbnails...\n", len(cnvlist), thrnum)
+	var session = srv.XormStorage.NewSession()
+	defer session.Close()
+
+	var total, _ = session.Where("stage=?", srv.TaskCnv).Count(&srv.TaskStore{})
+	if total == 0 {
+		return
+	}
+	var totalsize, _ = session.Where("stage=?", srv.TaskCnv).SumInt(&srv.TaskStore{}, "size")
+	ctl.stage(srv.TaskCnv, "", total, totalsize)
+	ctl.Printf("start processing %d files with %d threads to prepare tiles and thumbnails...\n", total, thrnum)
 	var t0 = time.Now()
 
 	// manager thread that distributes task to convert images
-	var pathchan = make(chan pathpair, thrnum)
+	var taskchan = make(chan srv.TaskStore, thrnum)
 	go func() {
-		defer close(pathchan)
+		defer close(taskchan)
 
-		var total = float64(len(cnvlist))
 		var tsync = time.NewTicker(4 * time.Minute)
 		defer tsync.Stop()
 		var tinfo = time.NewTicker(time.Second)
 		defer tinfo.Stop()
-		for fpath, fi := range cnvlist {
-			select {
-			case pathchan <- pathpair{fpath, fi}:
-				continue
-			case <-tsync.C:
-				// sync file tags tables of caches
-				if err := srv.ThumbPkg.Sync(); err != nil {
-					Log.Error(err)
-					return
-				}
-				if err := srv.TilesPkg.Sync(); err != nil {
-					Log.Error(err)
-					return
-				}
-			case <-tinfo.C:
-				// information thread
-				if ready := atomic.LoadUint64(&cs.FileCount); ready > 0 {
-					var remain = time.Duration(float64(time.Since(t0)) / float64(ready) * (total - float64(ready)))
-					if remain < time.Hour {
-						remain = remain / time.Second * time.Second
-					} else {
-						remain = remain / time.Minute * time.Minute
+		var last uint64
+		for {
+			var tasks, err = NextTasks(session, srv.TaskCnv, last)
+			if err != nil {
+				Log.Error(err)
+				return
+			}
+			if len(tasks) == 0 {
+				return
+			}
+			last = tasks[len(tasks)-1].ID
+			for _, task := range tasks {
+				for sent := false; !sent; {
+					select {
+					case taskchan <- task:
+						sent = true
+					case <-tsync.C:
+						// sync file tags tables of caches
+						if err := srv.ThumbPkg.Sync(); err != nil {
+							Log.Error(err)
+							return
+						}
+						if err := srv.TilesPkg.Sync(); err != nil {
+							Log.Error(err)
+							return
+						}
+					case <-tinfo.C:
+						// information thread, estimates remained time
+						// by throughput of processed files size
+						if ready := atomic.LoadUint64(&cs.FileCount); ready > 0 {
+							var spent = time.Since(t0)
+							var size = atomic.LoadUint64(&cs.filesize)
+							var remain time.Duration
+							if size > 0 && totalsize > 0 {
+								remain = Remains(float64(size), float64(max(totalsize, int64(size))), spent)
+							} else {
+								remain = Remains(float64(ready), float64(total), spent)
+							}
+							ctl.Printf("processed %d files, %.1f files/s, %.2f MB/s, remains about %v            \r",
+								ready, float64(ready)/spent.Seconds(), float64(size)/spent.Seconds()/1e6, remain)
+						}
+					case <-exitctx.Done():
+						return
 					}
-					fmt.Fprintf(os.Stdout, "processed %d files, remains about %v            \r",
-						ready, remain)
 				}
-			case <-exitctx.Done():
+			}
+		}
+	}()
+
+	// writer thread, the only one that writes results to database,
+	// runs until 'donechan' not closed
+	type cnvDone struct {
+		ID  uint64
+		Hst *srv.HashStore
+	}
+	var donechan = make(chan cnvDone, thrnum)
+	var writewg sync.WaitGroup
+	writewg.Add(1)
+	go func() {
+		defer writewg.Done()
+
+		var session = srv.XormStorage.NewSession()
+		defer session.Close()
+
+		var buf srv.StoreBuf
+		buf.Init(64)
+		var done = make(TaskBuf, 0, 64)
+		var flush = func() {
+			// hashes should be stored before files leave the queue
+			if err := buf.Flush(session); err != nil {
+				Log.Error(err)
 				return
 			}
+			if err := done.Flush(session); err != nil {
+				Log.Error(err)
+			}
+		}
+		defer flush()
+
+		for cd := range donechan {
+			if cd.Hst != nil {
+				if err := buf.Push(session, *cd.Hst); err != nil {
+					Log.Error(err)
+				}
+			}
+			if done = append(done, cd.ID); len(done) == cap(done) {
+				flush()
+			}
 		}
 	}()
 
-	// working threads, runs until 'pathchan' not closed
+	// working threads, runs until 'taskchan' not closed
 	var workwg sync.WaitGroup
 	workwg.Add(thrnum)
 	for i := 0; i < thrnum; i++ {
 		go func() {
 			defer workwg.Done()
 
-			for c := range pathchan {
-				Convert(c.fpath, c.fi, &cs)
+			var session = srv.XormStorage.NewSession()
+			defer session.Close()
+
+			for task := range taskchan {
+				if !ctl.wait(exitctx) {
+					continue
+				}
+				var cd = cnvDone{ID: task.ID}
+				// file could be modified or deleted since listing
+				if fi, err := srv.JP.Stat(task.Path); err == nil {
+					var tstart = time.Now()
+					cd.Hst, _ = Convert(session, task.Path, fi, &cs)
+					ctl.done(exitctx, fi.Size(), time.Since(tstart))
+				}
+				donechan <- cd
 			}
 		}()
 	}
 	workwg.Wait()
+	close(donechan)
+	writewg.Wait()
 
 	var d = time.Since(t0) / time.Second * time.Second
-	fmt.Fprintf(os.Stdout, "processed %d files, spent %v, processing complete\n", cs.FileCount, d)
-	fmt.Fprintf(os.Stdout, "produced %d tiles and %d thumbnails\n", cs.tilecount, cs.tmbcount)
+	ctl.Printf("processed %d files, spent %v, processing complete\n", cs.FileCount, d)
+	ctl.Printf("produced %d tiles, %d thumbnails and %d perceptual hashes\n", cs.tilecount, cs.tmbcount, cs.hashcount)
 	if cs.tilesize > 0 {
-		fmt.Fprintf(os.Stdout, "tiles size: %d, ratio: %.4f\n", cs.tilesize, float64(cs.filesize)/float64(cs.tilesize))
+		ctl.Printf("tiles size: %d, ratio: %.4f\n", cs.tilesize, float64(cs.filesize)/float64(cs.tilesize))
 	}
 	if cs.tmbsize > 0 {
-		fmt.Fprintf(os.Stdout, "thumbnails size: %d, ratio: %.4f\n", cs.tmbsize, float64(cs.filesize)/float64(cs.tmbsize))
+		ctl.Printf("thumbnails size: %d, ratio: %.4f\n", cs.tmbsize, float64(cs.filesize)/float64(cs.tmbsize))
 	}
 	if cs.ErrCount > 0 {
-		fmt.Fprintf(os.Stdout, "gets %d failures on image conversions\n", cs.ErrCount)
+		ctl.Printf("gets %d failures on image conversions\n", cs.ErrCount)
 	}
 }
 
-func RunCacher(exitctx context.Context) {
-	fmt.Fprintf(os.Stdout, "starts caching processing\n")
+// AddRoot adds path to list of scanned roots, if it is not nested
+// into some root of list, and replaces roots nested into it.
+func AddRoot(roots []string, fpath string) []string {
+	for i, p := range roots {
+		if strings.HasPrefix(fpath, p) {
+			return roots
+		}
+		if strings.HasPrefix(p, fpath) {
+			roots[i] = fpath
+			return roots
+		}
+	}
+	if _, ok := srv.CatPathKey[fpath]; !ok {
+		roots = append(roots, fpath)
+	}
+	return roots
+}
 
-	var shares []string
+// ScanRoots returns list of unique shares of all profiles,
+// and also local roots of profiles if it is needed.
+func ScanRoots(withlocal bool) (roots []string) {
 	srv.Profiles.Range(func(id uint64, prf *srv.Profile) bool {
-		for _, shr := range prf.Shares {
-			var add = true
-			for i, p := range shares {
-				if strings.HasPrefix(shr.Path, p) {
-					add = false
-					break
-				}
-				if strings.HasPrefix(p, shr.Path) {
-					shares[i] = shr.Path
-					add = false
-					break
-				}
-			}
-			if add {
-				if _, ok := srv.CatPathKey[shr.Path]; !ok {
-					shares = append(shares, shr.Path)
-				}
+		for _, shr := range prf.GetShares() {
+			roots = AddRoot(roots, shr.Path)
+		}
+		if withlocal {
+			for _, dp := range prf.GetLocal() {
+				roots = AddRoot(roots, dp.Path)
 			}
 		}
 		return true
 	})
-	for _, fpath := range ExcludePath {
-		for i, p := range shares {
-			if strings.HasPrefix(p, fpath) {
-				shares = append(shares[:i], shares[i+1:]...)
-				break
-			}
-		}
+	return
+}
+
+// ScanShares performs scanning of given shares with saving its state
+// to database. Returns "true" if scanning is complete, or "false"
+// if it was interrupted and can be resumed later.
+func ScanShares(exitctx context.Context, ctl *ScanCtl, shares []string) (complete bool, err error) {
+	var session = srv.XormStorage.NewSession()
+	defer session.Close()
+
+	// load state of interrupted scanning
+	var walked = map[string]struct{}{}
+	var paths []string
+	if err = session.Table("walk_store").Where("done=?", false).Cols("path").Find(&paths); err != nil {
+		return
 	}
-	for _, fpath := range IncludePath {
-		var add = true
-		for i, p := range shares {
-			if strings.HasPrefix(fpath, p) {
-				add = false
-				break
-			}
-			if strings.HasPrefix(p, fpath) {
-				shares[i] = fpath
-				add = false
-				break
-			}
-		}
-		if add {
-			if _, ok := srv.CatPathKey[fpath]; !ok {
-				shares = append(shares, fpath)
-			}
-		}
+	for _, fpath := range paths {
+		walked[fpath] = struct{}{}
+	}
+	if queued, _ := session.Count(&srv.TaskStore{}); len(walked) > 0 || queued > 0 {
+		ctl.Printf("resumes interrupted scanning, %d directories already listed, %d files remains in queue\n", len(walked), queued)
 	}
 
-	fmt.Fprintf(os.Stdout, "found %d unical shares\n", len(shares))
-	var pathlist []string
-	var extlist, cnvlist = FileMap{}, FileMap{}
-	var extsum, cnvsum int
+	var ls ListStat
 	for i, p := range shares {
-		fmt.Fprintf(os.Stdout, "starts scan %d share with path %s\n", i+1, p)
+		ctl.Printf("starts scan %d share with path %s\n", i+1, p)
+		ctl.stage(srv.TaskWalk, p, 0, 0)
 		var t0 = time.Now()
-		var err error
+		var prev = ls
 		var sub fs.FS
 		if sub, err = srv.JP.Sub(p); err != nil {
-			Log.Fatal(err)
+			Log.Errorf("can not open share %s, error %v", p, err)
+			ctl.Printf("scan %d share skipped, can not open it\n", i+1)
+			err = nil
+			continue
 		}
-		if err = FileList(sub.(*jnt.SubPool), &pathlist, extlist, cnvlist); err != nil {
-			Log.Fatal(err)
+		if err = WalkShare(exitctx, ctl, sub.(*jnt.SubPool), walked, &ls); err != nil {
+			return
+		}
+		if IsInterrupted(exitctx, ctl) {
+			return
 		}
 		var d = time.Since(t0)
-		fmt.Fprintf(os.Stdout, "scan %d share complete, spent %v\n", i+1, d)
-		fmt.Fprintf(os.Stdout, "found %d files to extract embedded info\n", len(extlist)-extsum)
-		extsum = len(extlist)
-		fmt.Fprintf(os.Stdout, "found %d files to prepare tiles and thumbnails\n", len(cnvlist)-cnvsum)
-		cnvsum = len(cnvlist)
+		ctl.Printf("scan %d share complete, spent %v\n", i+1, d)
+		ctl.Printf("listed %d directories, skipped %d directories not modified since last scanning\n", ls.DirCount-prev.DirCount, ls.SkipCount-prev.SkipCount)
+		ctl.Printf("found %d files to extract embedded info\n", ls.ExtCount-prev.ExtCount)
+		ctl.Printf("found %d files to prepare tiles and thumbnails\n", ls.CnvCount-prev.CnvCount)
+	}
 
-		select {
-		case <-exitctx.Done():
+	BatchExtractor(exitctx, ctl)
+	if IsInterrupted(exitctx, ctl) {
+		return
+	}
+
+	BatchCacher(exitctx, ctl)
+	if IsInterrupted(exitctx, ctl) {
+		return
+	}
+
+	var count int
+	if count, err = FinishWalk(session); err != nil {
+		return
+	}
+	ctl.Printf("%d directories marked as scanned\n", count)
+	complete = true
+	return
+}
+
+// RunStalePurge periodically deletes database records of files which
+// cached data was found outdated by request handlers, until exit context
+// will be done. Remaining records are deleted on exit.
+func RunStalePurge(exitctx context.Context) {
+	var purge = func() {
+		if srv.StaleCount() == 0 {
 			return
-		default:
+		}
+		var session = srv.XormStorage.NewSession()
+		defer session.Close()
+		if n, err := srv.StalePurge(session); err != nil {
+			Log.Errorf("purge of stale records failed: %s", err.Error())
+		} else {
+			Log.Infof("purged stale records of %d files", n)
 		}
 	}
 
-	if len(pathlist) > 0 {
-		BatchPathList(pathlist)
-
+	var ticker = time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
 		select {
+		case <-ticker.C:
+			purge()
 		case <-exitctx.Done():
+			purge()
 			return
-		default:
 		}
 	}
+}
 
-	UpdateExtList(extlist)
-
-	if len(extlist) > 0 {
-		BatchExtractor(exitctx, extlist)
+func RunCacher(exitctx context.Context) {
+	fmt.Fprintf(os.Stdout, "starts caching processing\n")
 
-		select {
-		case <-exitctx.Done():
-			return
-		default:
+	if VerifyCache {
+		if err := VerifyCaches(exitctx); err != nil {
+			Log.Fatal(err)
 		}
 	}
 
-	if len(cnvlist) > 0 {
-		BatchCacher(exitctx, cnvlist)
+	var shares = ScanRoots(false)
+	for _, fpath := range ExcludePath {
+		for i, p := range shares {
+			if strings.HasPrefix(p, fpath) {
+				shares = append(shares[:i], shares[i+1:]...)
+				break
+			}
+		}
+	}
+	for _, fpath := range IncludePath {
+		shares = AddRoot(shares, fpath)
+	}
+	fmt.Fprintf(os.Stdout, "found %d unical shares\n", len(shares))
 
-		select {
-		case <-exitctx.Done():
+	if RestartScan {
+		if _, err := srv.SqlSession(func(session *srv.Session) (res any, err error) {
+			err = ClearScanState(session)
 			return
-		default:
+		}); err != nil {
+			Log.Fatal(err)
 		}
 	}
 
-	fmt.Fprintf(os.Stdout, "all processing complete\n")
+	var complete, err = ScanShares(exitctx, NewScanCtl(), shares)
+	if err != nil {
+		Log.Fatal(err)
+	}
+	if complete {
+		fmt.Fprintf(os.Stdout, "all processing complete\n")
+	}
 }
 
 // The End.
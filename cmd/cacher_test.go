@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	srv "github.com/schwarzlichtbezirk/hms/server"
+	jnt "github.com/schwarzlichtbezirk/joint"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+// testStorage opens new SQLite storage at temporary directory with
+// latest schema, and sets it as XormStorage while test is running.
+func testStorage(t *testing.T) *xorm.Engine {
+	t.Helper()
+	var engine, err = xorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "storage.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetMapper(names.GonicMapper{})
+	if _, err = srv.StorageMigrations.Up(engine, 0); err != nil {
+		engine.Close()
+		t.Fatal(err)
+	}
+	var prev, prevpc = srv.XormStorage, srv.PathCache
+	srv.XormStorage, srv.PathCache = engine, srv.NewBimap[srv.Puid_t, string]()
+	t.Cleanup(func() {
+		srv.XormStorage, srv.PathCache = prev, prevpc
+		engine.Close()
+	})
+	return engine
+}
+
+func TestScanState(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+
+	var root = t.TempDir()
+	var sysdir = filepath.Join(root, "photo")
+	if err := os.Mkdir(sysdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sysdir, "img.jpg"), []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var past = time.Now().Add(-time.Hour)
+	if err := os.Chtimes(sysdir, past, past); err != nil {
+		t.Fatal(err)
+	}
+	var sub, err = srv.JP.Sub(srv.ToSlash(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fsys = sub.(*jnt.SubPool)
+	var dir = JoinPath(fsys.Dir(), "photo")
+
+	var list = func(t *testing.T) {
+		var ents, err = os.ReadDir(sysdir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ls ListStat
+		if err = ListDir(session, dir, ents, &ls); err != nil {
+			t.Fatal(err)
+		}
+		if ls.DirCount != 1 || ls.ExtCount != 1 || ls.CnvCount != 1 {
+			t.Fatalf("unexpected listing statistics %+v", ls)
+		}
+	}
+	var finish = func(t *testing.T) {
+		if _, err := FinishWalk(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var reset = func(t *testing.T) {
+		if err := ClearScanState(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var touch = func(t *testing.T) {
+		var now = time.Now().Add(time.Hour)
+		if err := os.Chtimes(sysdir, now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		name    string
+		action  func(t *testing.T)
+		scanned bool  // directory is marked as scanned
+		pending int64 // number of directories of incomplete scanning
+		tasks   int64 // number of queued files
+	}{
+		{"listed", list, false, 1, 2},
+		{"complete", finish, true, 0, 2},
+		{"clear keeps marks", reset, true, 0, 0},
+		{"listed again", list, false, 1, 2},
+		{"clear interrupted", reset, false, 0, 0},
+		{"listed after clear", list, false, 1, 2},
+		{"complete again", finish, true, 0, 2},
+		{"modified", touch, false, 0, 2},
+	}
+	for _, test := range tests {
+		test.action(t)
+		if got := IsDirScanned(session, fsys, "photo"); got != test.scanned {
+			t.Errorf("%s: expected scanned %v, got %v", test.name, test.scanned, got)
+		}
+		if n, _ := session.Where("done=?", false).Count(&srv.WalkStore{}); n != test.pending {
+			t.Errorf("%s: expected %d pending directories, got %d", test.name, test.pending, n)
+		}
+		if n, _ := session.Count(&srv.TaskStore{}); n != test.tasks {
+			t.Errorf("%s: expected %d queued files, got %d", test.name, test.tasks, n)
+		}
+	}
+
+	// browsing of directory does not mark it as scanned
+	if err = os.Chtimes(sysdir, past, past); err != nil {
+		t.Fatal(err)
+	}
+	list(t)
+	var puid srv.Puid_t
+	if puid, err = srv.PathStoreCache(session, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.DirStoreSet(session, puid, srv.DirProp{Scan: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if IsDirScanned(session, fsys, "photo") {
+		t.Error("directory is marked as scanned by directory properties")
+	}
+}
+
+func TestRemains(t *testing.T) {
+	var tests = []struct {
+		done, total float64
+		spent       time.Duration
+		want        time.Duration
+	}{
+		{50, 100, time.Minute, time.Minute},
+		{25, 100, time.Minute, 3 * time.Minute},
+		{100, 100, time.Minute, 0},
+	}
+	for _, test := range tests {
+		if got := Remains(test.done, test.total, test.spent); got != test.want {
+			t.Errorf("%v of %v for %v: expected %v, got %v", test.done, test.total, test.spent, test.want, got)
+		}
+	}
+}
+
+// The End.
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/schwarzlichtbezirk/hms/config"
+	srv "github.com/schwarzlichtbezirk/hms/server"
+	"github.com/spf13/cobra"
+)
+
+const compactShort = "Remove orphaned thumbnails and tiles from cache packages"
+const compactLong = `Rewrites thumbnails and tiles cache packages without files made from modified or deleted sources, and without data of replaced files, so packages are shrinked to actual content.`
+const compactExmp = `Compact both thumbnails and tiles caches:
+  %s compact`
+
+// compactCmd represents the compact command
+var compactCmd = &cobra.Command{
+	Use:     "compact",
+	Aliases: []string{"gc"},
+	Short:   compactShort,
+	Long:    compactLong,
+	Example: fmt.Sprintf(compactExmp, config.AppName),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var exitctx context.Context
+		if exitctx, err = Init(); err != nil {
+			return
+		}
+		RunCompact(exitctx)
+		err = Done()
+		return
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compactCmd)
+}
+
+// RunCompact performs compaction of thumbnails and tiles packages.
+func RunCompact(exitctx context.Context) {
+	for _, pkg := range []struct {
+		name string
+		fc   *srv.FileCache
+	}{
+		{"thumbnails", srv.ThumbPkg},
+		{"tiles", srv.TilesPkg},
+	} {
+		fmt.Fprintf(os.Stdout, "starts compaction of %s cache\n", pkg.name)
+		var t0 = time.Now()
+		var cs, err = pkg.fc.Compact(exitctx)
+		if err != nil {
+			Log.Errorf("compaction of %s cache failed: %s", pkg.name, err.Error())
+			return
+		}
+		var d = time.Since(t0) / time.Millisecond * time.Millisecond
+		fmt.Fprintf(os.Stdout, "%s cache compacted, spent %v\n", pkg.name, d)
+		fmt.Fprintf(os.Stdout, "kept %d files, removed %d orphaned files, data size %d -> %d bytes\n",
+			cs.Count, cs.Removed, cs.OldSize, cs.NewSize)
+	}
+}
+
+// The End.
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule parsing errors.
+var (
+	ErrCronFields = errors.New("schedule should have 5 fields")
+	ErrCronValue  = errors.New("schedule field has bad value")
+)
+
+// CronSpec is schedule given in crontab format with five fields:
+// minute, hour, day of month, month and day of week.
+type CronSpec struct {
+	minute, hour, dom, month, dow uint64 // bit sets of allowed values
+	anydom, anydow                bool   // days fields are given by "*"
+}
+
+// cronlim is ranges of values for each field of schedule.
+var cronlim = [5]struct{ lo, hi int }{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 7},  // day of week, 0 and 7 is Sunday
+}
+
+// ParseCron parses schedule in crontab format. Each field can be given
+// by "*", number "n", range "a-b", step "*/n", "a/n" or "a-b/n",
+// or by comma-separated list of those values.
+func ParseCron(spec string) (cs CronSpec, err error) {
+	var fields = strings.Fields(spec)
+	if len(fields) != 5 {
+		err = fmt.Errorf("%w: %q", ErrCronFields, spec)
+		return
+	}
+	var sets [5]uint64
+	for i, field := range fields {
+		if sets[i], err = parseCronField(field, cronlim[i].lo, cronlim[i].hi); err != nil {
+			return
+		}
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1 // Sunday
+	}
+	cs.minute, cs.hour, cs.dom, cs.month, cs.dow = sets[0], sets[1], sets[2], sets[3], sets[4]
+	cs.anydom, cs.anydow = fields[2] == "*", fields[4] == "*"
+	return
+}
+
+// parseCronField returns bit set of values given by schedule field.
+func parseCronField(field string, lo, hi int) (set uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		var rng, step, hasstep = strings.Cut(part, "/")
+		var n = 1
+		if hasstep {
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				err = fmt.Errorf("%w: %q", ErrCronValue, part)
+				return
+			}
+		}
+		var a, b int
+		if rng == "*" {
+			a, b = lo, hi
+		} else if sa, sb, ok := strings.Cut(rng, "-"); ok {
+			var erra, errb error
+			a, erra = strconv.Atoi(sa)
+			b, errb = strconv.Atoi(sb)
+			if erra != nil || errb != nil {
+				err = fmt.Errorf("%w: %q", ErrCronValue, part)
+				return
+			}
+		} else {
+			if a, err = strconv.Atoi(rng); err != nil {
+				err = fmt.Errorf("%w: %q", ErrCronValue, part)
+				return
+			}
+			b = a
+			if hasstep {
+				b = hi
+			}
+		}
+		if a < lo || b > hi || a > b {
+			err = fmt.Errorf("%w: %q", ErrCronValue, part)
+			return
+		}
+		for v := a; v <= b; v += n {
+			set |= 1 << v
+		}
+	}
+	return
+}
+
+// matchDay checks up that day of given time fits to schedule.
+// If both days fields are restricted, day should fit any of them.
+func (cs *CronSpec) matchDay(t time.Time) bool {
+	var dom = cs.dom&(1<<t.Day()) != 0
+	var dow = cs.dow&(1<<t.Weekday()) != 0
+	if cs.anydom || cs.anydow {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns nearest time after given time that fits to schedule,
+// or zero time if there is no such time during 5 years.
+func (cs *CronSpec) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	var limit = t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		var y, m, d = t.Date()
+		var loc = t.Location()
+		if cs.month&(1<<m) == 0 {
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !cs.matchDay(t) {
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if cs.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if cs.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// The End.
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	var tests = []struct {
+		spec string
+		err  error
+	}{
+		{"* * * * *", nil},
+		{"0 3 * * *", nil},
+		{"*/15 0-6 1,15 * 1-5", nil},
+		{"30 2 * * 7", nil},
+		{"5-55/10 * * 1-12/3 *", nil},
+		{"* * * *", ErrCronFields},
+		{"* * * * * *", ErrCronFields},
+		{"60 * * * *", ErrCronValue},
+		{"* 24 * * *", ErrCronValue},
+		{"* * 0 * *", ErrCronValue},
+		{"* * * 13 *", ErrCronValue},
+		{"* * * * 8", ErrCronValue},
+		{"5-1 * * * *", ErrCronValue},
+		{"*/0 * * * *", ErrCronValue},
+		{"a * * * *", ErrCronValue},
+		{"1-b * * * *", ErrCronValue},
+	}
+	for _, test := range tests {
+		if _, err := ParseCron(test.spec); !errors.Is(err, test.err) {
+			t.Errorf("spec %q: expected error %v, got %v", test.spec, test.err, err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	var loc = time.UTC
+	var date = func(y int, m time.Month, d, h, min int) time.Time {
+		return time.Date(y, m, d, h, min, 0, 0, loc)
+	}
+	// 2026-10-19 is Monday
+	var from = time.Date(2026, 10, 19, 10, 20, 30, 0, loc)
+	var tests = []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", date(2026, 10, 19, 10, 21)},
+		{"20 10 * * *", date(2026, 10, 20, 10, 20)},
+		{"0 3 * * *", date(2026, 10, 20, 3, 0)},
+		{"*/15 * * * *", date(2026, 10, 19, 10, 30)},
+		{"0 0 1 * *", date(2026, 11, 1, 0, 0)},
+		{"0 0 * * 0", date(2026, 10, 25, 0, 0)},
+		{"0 0 * * 7", date(2026, 10, 25, 0, 0)},
+		{"0 12 * 2 *", date(2027, 2, 1, 12, 0)},
+		{"0 0 29 2 *", date(2028, 2, 29, 0, 0)},
+		// both days fields restricted, any of them fits
+		{"0 0 1 * 3", date(2026, 10, 21, 0, 0)},
+		// day of month restricted, day of week is any
+		{"0 0 31 * *", date(2026, 10, 31, 0, 0)},
+		// never happens
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		var cs, err = ParseCron(test.spec)
+		if err != nil {
+			t.Fatalf("spec %q: %v", test.spec, err)
+		}
+		if got := cs.Next(from); !got.Equal(test.want) {
+			t.Errorf("spec %q: expected %v, got %v", test.spec, test.want, got)
+		}
+	}
+}
+
+// The End.
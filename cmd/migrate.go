@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/schwarzlichtbezirk/hms/config"
+	srv "github.com/schwarzlichtbezirk/hms/server"
+	"github.com/spf13/cobra"
+	"xorm.io/xorm"
+)
+
+var (
+	ErrMigrateDB = errors.New("database should be 'storage', 'userlog' or 'all'")
+)
+
+const migrateShort = "Show, upgrade or downgrade databases schema versions"
+const migrateLong = `Performs versioned schema migrations of files properties storage and user log databases. "status" shows known and applied steps, "up" applies not applied steps up to given version or to latest, "down" reverts applied steps down to given version or the last one step, initial schema can not be reverted. Server upgrades schema to latest version on start, so "up" is needed only to prepare database in advance.`
+const migrateExmp = `Show schema versions of both databases:
+  %[1]s migrate status
+Upgrade storage to latest version:
+  %[1]s migrate up --db=storage
+Revert user log to version 1:
+  %[1]s migrate down --db=userlog --to=1`
+
+var migrateDB string
+var migrateTo int
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:       "migrate [status|up|down]",
+	Aliases:   []string{"mg"},
+	Short:     migrateShort,
+	Long:      migrateLong,
+	Example:   fmt.Sprintf(migrateExmp, config.AppName),
+	Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"status", "up", "down"},
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var action = "status"
+		if len(args) > 0 {
+			action = args[0]
+		}
+		type dbmig struct {
+			name  string
+			dsn   string
+			fname string
+			ms    srv.Migrations
+		}
+		var list []dbmig
+		if migrateDB == "storage" || migrateDB == "all" {
+			list = append(list, dbmig{"storage", Cfg.StorageDSN, dirfile, srv.StorageMigrations})
+		}
+		if migrateDB == "userlog" || migrateDB == "all" {
+			list = append(list, dbmig{"user log", Cfg.UserlogDSN, userlog, srv.UserlogMigrations})
+		}
+		if len(list) == 0 {
+			return ErrMigrateDB
+		}
+
+		for _, db := range list {
+			var engine *xorm.Engine
+			if engine, err = NewEngine(db.dsn, db.fname); err != nil {
+				return
+			}
+			err = RunMigrate(engine, db.name, db.ms, action)
+			engine.Close()
+			if err != nil {
+				return
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+
+	var flags = migrateCmd.Flags()
+	flags.StringVar(&migrateDB, "db", "all", "Database to migrate, 'storage', 'userlog' or 'all'.")
+	flags.IntVar(&migrateTo, "to", -1, "Target schema version. Latest version for 'up' and previous version for 'down' by default.")
+}
+
+// RunMigrate performs given migration action on database.
+func RunMigrate(engine *xorm.Engine, name string, ms srv.Migrations, action string) (err error) {
+	var ver int
+	if ver, err = ms.Version(engine); err != nil {
+		return
+	}
+	var done []srv.Migration
+	switch action {
+	case "status":
+		var list []srv.MigrateStat
+		if list, err = ms.Status(engine); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stdout, "%s schema version %d, latest known version %d\n", name, ver, ms.Latest())
+		for _, st := range list {
+			var state = "pending"
+			if st.Applied {
+				state = "applied at " + st.Time.Format("2006-01-02 15:04:05")
+			}
+			if !st.Known {
+				state += ", unknown for this build"
+			}
+			fmt.Fprintf(os.Stdout, "  %4d  %s - %s\n", st.Version, st.Name, state)
+		}
+		return
+	case "up":
+		var target = max(migrateTo, 0)
+		if done, err = ms.Up(engine, target); err != nil {
+			return
+		}
+	case "down":
+		var target = migrateTo
+		if target < 0 {
+			// revert last applied step
+			target = 0
+			for _, m := range ms.Steps {
+				if m.Version < ver {
+					target = m.Version
+				}
+			}
+		}
+		if done, err = ms.Down(engine, target); err != nil {
+			return
+		}
+	}
+	if len(done) == 0 {
+		fmt.Fprintf(os.Stdout, "%s schema version %d, nothing to do\n", name, ver)
+		return
+	}
+	for _, m := range done {
+		fmt.Fprintf(os.Stdout, "%s: %s version %d, %s\n", name, action, m.Version, m.Name)
+	}
+	if ver, err = ms.Version(engine); err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stdout, "%s schema version %d now\n", name, ver)
+	return
+}
+
+// The End.
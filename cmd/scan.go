@@ -9,9 +9,15 @@ import (
 )
 
 const scanShort = "Scan shared folders and cache thumbnails and tiles for founded images"
-const scanLong = `Prepare list of unique shared folders in all profiles. Then scan each shared folder and puts to cache thumbnails and tiles for founded images. Cache to database files embedded tags to make access faster.`
+const scanLong = `Prepare list of unique shared folders in all profiles. Then scan each shared folder and puts to cache thumbnails and tiles for founded images. Cache to database files embedded tags to make access faster. Directories not modified since last scanning are skipped. Scanning state is saved to database, so interrupted scanning continues from the place where it was stopped.`
 const scanExmp = `Start scanning with all shares at profiles:
-  %s scan`
+  %[1]s scan
+Regenerate cached data for files modified since last scanning:
+  %[1]s scan --verify
+Scan all directories including not modified since last scanning:
+  %[1]s scan --full
+Drop state of interrupted scanning and start it again:
+  %[1]s scan --restart`
 
 // scanCmd represents the scan command
 var scanCmd = &cobra.Command{
@@ -34,6 +40,9 @@ var scanCmd = &cobra.Command{
 var (
 	IncludePath []string
 	ExcludePath []string
+	VerifyCache bool
+	FullScan    bool
+	RestartScan bool
 )
 
 func init() {
@@ -42,4 +51,7 @@ func init() {
 	var flags = scanCmd.Flags()
 	flags.StringSliceVarP(&IncludePath, "include", "i", nil, "cache thumbnails and tiles at given paths in addition to shared paths")
 	flags.StringSliceVarP(&ExcludePath, "exclude", "e", nil, "paths to exclude from scanning")
+	flags.BoolVar(&VerifyCache, "verify", false, "purge cached thumbnails, tiles and tags of modified or deleted files before scanning")
+	flags.BoolVar(&FullScan, "full", false, "scan files of all directories, including directories not modified since last scanning")
+	flags.BoolVar(&RestartScan, "restart", false, "drop state of interrupted scanning and start it from the beginning")
 }
@@ -1,7 +1,7 @@
 package cmd
 
 import (
-	"fmt"
+	"errors"
 
 	cfg "github.com/schwarzlichtbezirk/hms/config"
 	srv "github.com/schwarzlichtbezirk/hms/server"
@@ -24,59 +24,79 @@ var (
 	Log      = cfg.Log
 )
 
+var (
+	ErrNoDSN = errors.New("data source name should be given for non-SQLite database driver")
+)
+
+// DataSource returns data source name for database engine. If DSN
+// is not given in configuration, SQLite file at databases path is used.
+func DataSource(dsn, fname string) (string, error) {
+	if dsn != "" {
+		return dsn, nil
+	}
+	if Cfg.XormDriverName != "sqlite3" && Cfg.XormDriverName != "sqlite" {
+		return "", ErrNoDSN
+	}
+	return JoinPath(cfg.SqlPath, fname), nil
+}
+
+// NewEngine creates database engine with given data source name,
+// or with SQLite file at databases path if DSN is not given.
+func NewEngine(dsn, fname string) (engine *xorm.Engine, err error) {
+	if dsn, err = DataSource(dsn, fname); err != nil {
+		return
+	}
+	if engine, err = xorm.NewEngine(Cfg.XormDriverName, dsn); err != nil {
+		return
+	}
+	engine.SetMapper(names.GonicMapper{})
+	if Cfg.XormMaxConns > 0 {
+		engine.SetMaxOpenConns(Cfg.XormMaxConns)
+		engine.SetMaxIdleConns(Cfg.XormMaxConns)
+	}
+	if err = engine.Ping(); err != nil {
+		engine.Close()
+		return
+	}
+	Log.Infof("%s database connected: %s", engine.Dialect().URI().DBType, engine.Dialect().URI().DBName)
+	return
+}
+
+// MigrateUp upgrades database schema to latest version.
+func MigrateUp(what string, engine *xorm.Engine, ms srv.Migrations) (err error) {
+	var done []srv.Migration
+	if done, err = ms.Up(engine, 0); err != nil {
+		return
+	}
+	for _, m := range done {
+		Log.Infof("%s schema upgraded to version %d: %s", what, m.Version, m.Name)
+	}
+	return
+}
+
 // InitStorage inits database caches engine.
 func InitStorage() (err error) {
-	if srv.XormStorage, err = xorm.NewEngine(Cfg.XormDriverName, JoinPath(cfg.SqlPath, dirfile)); err != nil {
+	if srv.XormStorage, err = NewEngine(Cfg.StorageDSN, dirfile); err != nil {
 		return
 	}
-	srv.XormStorage.SetMapper(names.GonicMapper{})
 	var xlb = cfg.XormLoggerBridge{
 		Logger: Log,
 	}
 	xlb.ShowSQL(cfg.DevMode)
 	srv.XormStorage.SetLogger(&xlb)
 
-	_, err = srv.SqlSession(func(session *xorm.Session) (res any, err error) {
-		if err = session.Sync(&srv.PathStore{}, &srv.DirStore{}, &srv.ExtStore{}, &srv.ExifStore{}, &srv.Id3Store{}); err != nil {
-			return
-		}
-
-		// fill path_store & file_store with predefined items
-		var ok bool
-		if ok, err = session.IsTableEmpty(&srv.PathStore{}); err != nil {
-			return
-		}
-		if ok {
-			var ctgrpath = make([]srv.PathStore, srv.PUIDcache-1)
-			for puid, path := range srv.CatKeyPath {
-				ctgrpath[puid-1].Puid = puid
-				ctgrpath[puid-1].Path = path
-				srv.PathCache.Set(puid, path)
-			}
-			for puid := srv.Puid_t(len(srv.CatKeyPath) + 1); puid < srv.PUIDcache; puid++ {
-				var path = fmt.Sprintf("<reserved%d>", puid)
-				ctgrpath[puid-1].Puid = puid
-				ctgrpath[puid-1].Path = path
-				srv.PathCache.Set(puid, path)
-			}
-			if _, err = session.Insert(&ctgrpath); err != nil {
-				return
-			}
-		}
-		return
-	})
+	err = MigrateUp("storage", srv.XormStorage, srv.StorageMigrations)
 	return
 }
 
 // InitUserlog inits database user log engine.
 func InitUserlog() (err error) {
-	if srv.XormUserlog, err = xorm.NewEngine(Cfg.XormDriverName, JoinPath(cfg.SqlPath, userlog)); err != nil {
+	if srv.XormUserlog, err = NewEngine(Cfg.UserlogDSN, userlog); err != nil {
 		return
 	}
-	srv.XormUserlog.SetMapper(names.GonicMapper{})
 	srv.XormUserlog.ShowSQL(false)
 
-	if err = srv.XormUserlog.Sync(&srv.AgentStore{}, &srv.OpenStore{}); err != nil {
+	if err = MigrateUp("user log", srv.XormUserlog, srv.UserlogMigrations); err != nil {
 		return
 	}
 
@@ -96,7 +116,7 @@ func LoadPathCache() (err error) {
 	var offset int
 	for {
 		var chunk []srv.PathStore
-		if err = session.Limit(limit, offset).Find(&chunk); err != nil {
+		if err = session.Asc("puid").Limit(limit, offset).Find(&chunk); err != nil {
 			return
 		}
 		offset += limit
@@ -121,7 +141,7 @@ func LoadGpsCache() (err error) {
 	var offset int
 	for {
 		var chunk []srv.ExifStore
-		if err = session.Where("latitude != 0").Cols("puid", "datetime", "latitude", "longitude", "altitude").Limit(limit, offset).Find(&chunk); err != nil {
+		if err = session.Where("latitude != 0").Cols("puid", "datetime", "latitude", "longitude", "altitude").Asc("puid").Limit(limit, offset).Find(&chunk); err != nil {
 			return
 		}
 		offset += limit
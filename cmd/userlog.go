@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/schwarzlichtbezirk/hms/config"
+	srv "github.com/schwarzlichtbezirk/hms/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const userlogShort = "Apply retention policy to user log"
+const userlogLong = `Removes records of opened files and folders, and records of user agents, which are out of retention policy given by "userlog" section of configuration, and rebuilds user log database file to free unused space.`
+const userlogExmp = `Remove records older than one year and vacuum database:
+  %s userlog --keep-age=8760h --vacuum`
+
+// userlogCmd represents the userlog command
+var userlogCmd = &cobra.Command{
+	Use:     "userlog",
+	Aliases: []string{"ul"},
+	Short:   userlogShort,
+	Long:    userlogLong,
+	Example: fmt.Sprintf(userlogExmp, config.AppName),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if _, err = Init(); err != nil {
+			return
+		}
+		var t0 = time.Now()
+		var st srv.UserlogStat
+		if st, err = srv.CleanUserlog(Cfg.UlVacuum); err != nil {
+			return
+		}
+		var d = time.Since(t0) / time.Millisecond * time.Millisecond
+		fmt.Fprintf(os.Stdout, "user log cleaned, spent %v\n", d)
+		fmt.Fprintf(os.Stdout, "removed %d records of opened files and folders, %d records of user agents, size %d -> %d bytes\n",
+			st.Opens, st.Agents, st.OldSize, st.NewSize)
+		err = Done()
+		return
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(userlogCmd)
+
+	var flags = userlogCmd.Flags()
+	flags.Duration("keep-age", 0, "Maximum age of user log records. Zero keeps records forever.")
+	viper.BindPFlag("userlog.keep-age", flags.Lookup("keep-age"))
+	flags.Int("keep-num", 0, "Maximum number of records of opened files and folders. Zero disables the limit.")
+	viper.BindPFlag("userlog.keep-num", flags.Lookup("keep-num"))
+	flags.Bool("vacuum", true, "Rebuilds SQLite database file after cleanup to free unused space.")
+	viper.BindPFlag("userlog.vacuum", flags.Lookup("vacuum"))
+}
+
+// RunUserlogClean periodically applies retention policy to user log
+// until exit context will be done.
+func RunUserlogClean(exitctx context.Context) {
+	var ticker = time.NewTicker(Cfg.UlCleanPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-exitctx.Done():
+			return
+		}
+		var st, err = srv.CleanUserlog(Cfg.UlVacuum)
+		if err != nil {
+			Log.Errorf("user log cleanup failed: %s", err.Error())
+			continue
+		}
+		Log.Infof("user log cleaned: %d opens and %d agents removed, size %d -> %d bytes",
+			st.Opens, st.Agents, st.OldSize, st.NewSize)
+	}
+}
+
+// The End.
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	srv "github.com/schwarzlichtbezirk/hms/server"
+	"github.com/schwarzlichtbezirk/wpk"
+)
+
+// Outdated is interface of cached records that keeps
+// size and modify time of source file.
+type Outdated interface {
+	IsOutdated(fi fs.FileInfo) bool
+}
+
+// statcache keeps results of file stat calls during verification.
+type statcache map[string]fs.FileInfo
+
+// Stat returns file info for given path, or nil if file is absent.
+func (sc statcache) Stat(fpath string) fs.FileInfo {
+	if fi, ok := sc[fpath]; ok {
+		return fi
+	}
+	var fi, _ = srv.JP.Stat(fpath)
+	sc[fpath] = fi
+	return fi
+}
+
+// VerifyPackage deletes from cache package all files made from
+// modified or deleted sources. Returns number of deleted files.
+func VerifyPackage(exitctx context.Context, fc *srv.FileCache, sc statcache) (count int) {
+	var keys []string
+	fc.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		keys = append(keys, fkey)
+		return true
+	})
+	for _, fkey := range keys {
+		if fc.IsOutdated(fkey, sc.Stat(srv.CacheSrcPath(fkey))) {
+			fc.DelTagset(fkey)
+			count++
+		}
+
+		select {
+		case <-exitctx.Done():
+			return
+		default:
+		}
+	}
+	return
+}
+
+// VerifyStore finds in given table records made from modified or deleted
+// sources, and adds their PUIDs to purge set.
+func VerifyStore[T Outdated](exitctx context.Context, session *srv.Session, table any, sc statcache, purge map[srv.Puid_t]struct{}) (err error) {
+	const limit = 256
+	var offset int
+	for {
+		var sts []srv.Store[T]
+		if err = session.Table(table).Limit(limit, offset).Find(&sts); err != nil {
+			return
+		}
+		offset += limit
+		for _, st := range sts {
+			if _, ok := purge[st.Puid]; ok {
+				continue
+			}
+			if fpath, ok := srv.PathStorePath(session, st.Puid); !ok || st.Prop.IsOutdated(sc.Stat(fpath)) {
+				purge[st.Puid] = struct{}{}
+			}
+		}
+		if limit > len(sts) {
+			break
+		}
+
+		select {
+		case <-exitctx.Done():
+			return
+		default:
+		}
+	}
+	return
+}
+
+// VerifyCaches removes thumbnails, tiles and database records
+// made from modified or deleted files, so they will be produced
+// again by following scanning.
+func VerifyCaches(exitctx context.Context) (err error) {
+	fmt.Fprintf(os.Stdout, "starts verification of cached data\n")
+	var t0 = time.Now()
+
+	var sc = statcache{}
+	var tmbcount = VerifyPackage(exitctx, srv.ThumbPkg, sc)
+	fmt.Fprintf(os.Stdout, "removed %d outdated thumbnails\n", tmbcount)
+	var tilecount = VerifyPackage(exitctx, srv.TilesPkg, sc)
+	fmt.Fprintf(os.Stdout, "removed %d outdated tiles\n", tilecount)
+
+	var session = srv.XormStorage.NewSession()
+	defer session.Close()
+
+	var purge = map[srv.Puid_t]struct{}{}
+	if err = VerifyStore[srv.ExtProp](exitctx, session, srv.ExtStore{}, sc, purge); err != nil {
+		return
+	}
+	if err = VerifyStore[srv.ExifProp](exitctx, session, srv.ExifStore{}, sc, purge); err != nil {
+		return
+	}
+	if err = VerifyStore[srv.Id3Prop](exitctx, session, srv.Id3Store{}, sc, purge); err != nil {
+		return
+	}
+	if err = VerifyStore[srv.HashProp](exitctx, session, srv.HashStore{}, sc, purge); err != nil {
+		return
+	}
+	var puids = make([]srv.Puid_t, 0, len(purge))
+	for puid := range purge {
+		puids = append(puids, puid)
+	}
+	if err = srv.StorePurge(session, puids...); err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stdout, "removed outdated database records for %d files\n", len(puids))
+
+	if err = srv.ThumbPkg.Sync(); err != nil {
+		return
+	}
+	if err = srv.TilesPkg.Sync(); err != nil {
+		return
+	}
+
+	var d = time.Since(t0) / time.Second * time.Second
+	fmt.Fprintf(os.Stdout, "verification complete, spent %v\n", d)
+	return
+}
+
+// The End.
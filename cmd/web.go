@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	cfg "github.com/schwarzlichtbezirk/hms/config"
@@ -31,6 +32,9 @@ var webCmd = &cobra.Command{
 		} else {
 			gin.SetMode(gin.ReleaseMode)
 		}
+		// pass gin messages to the logger
+		gin.DefaultWriter = cfg.NewLogWriter(Log, cfg.LLinfo)
+		gin.DefaultErrorWriter = cfg.NewLogWriter(Log, cfg.LLerror)
 
 		var exitctx context.Context
 		if exitctx, err = Init(); err != nil {
@@ -42,8 +46,35 @@ var webCmd = &cobra.Command{
 		r.HandleMethodNotAllowed = true
 		srv.Router(r)
 
+		// background jobs should be finished
+		// before storages will be closed
+		var bgwg sync.WaitGroup
+		bgwg.Add(1)
+		go func() {
+			defer bgwg.Done()
+			RunStalePurge(exitctx)
+		}()
+		if Cfg.BgScanEnable {
+			bgwg.Add(1)
+			go func() {
+				defer bgwg.Done()
+				RunBgScan(exitctx)
+			}()
+		}
+		if Cfg.UlCleanPeriod > 0 {
+			bgwg.Add(1)
+			go func() {
+				defer bgwg.Done()
+				RunUserlogClean(exitctx)
+			}()
+		}
+
+		// server events delivery
+		go srv.Events.Watch(exitctx)
+
 		RunWeb(exitctx, r)
 		srv.WaitHandlers()
+		bgwg.Wait()
 		err = Done()
 		return
 	},
@@ -62,4 +93,10 @@ func init() {
 	flags.StringP("xorm", "x", "sqlite3", "Provides XORM driver name. Binded to XORMDRIVER variable.")
 	viper.BindPFlag("xorm.xorm-driver-name", flags.Lookup("xorm"))
 	viper.BindEnv("xorm.xorm-driver-name", "XORMDRIVER")
+	flags.String("storage-dsn", "", "Data source name of files properties storage, SQLite file at databases path is used if it's empty. Binded to STORAGEDSN variable.")
+	viper.BindPFlag("xorm.storage-dsn", flags.Lookup("storage-dsn"))
+	viper.BindEnv("xorm.storage-dsn", "STORAGEDSN")
+	flags.String("userlog-dsn", "", "Data source name of user log, SQLite file at databases path is used if it's empty. Binded to USERLOGDSN variable.")
+	viper.BindPFlag("xorm.userlog-dsn", flags.Lookup("userlog-dsn"))
+	viper.BindEnv("xorm.userlog-dsn", "USERLOGDSN")
 }
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -59,6 +60,11 @@ func Init() (context.Context, error) {
 		signal.Stop(sigterm)
 	}()
 
+	// check up tiles specifications
+	if err = srv.CheckTileSpecs(); err != nil {
+		return exitctx, fmt.Errorf("bad tiles specification: %w", err)
+	}
+
 	// load package with data files
 	if err = srv.OpenPackage(); err != nil {
 		return exitctx, fmt.Errorf("can not load wpk-package: %w", err)
@@ -77,6 +83,8 @@ func Init() (context.Context, error) {
 		Log.Infof("found %d items at EXIF cache", exifcount)
 		var tagcount, _ = session.Count(&srv.Id3Store{})
 		Log.Infof("found %d items at ID3-tags cache", tagcount)
+		var hashcount, _ = session.Count(&srv.HashStore{})
+		Log.Infof("found %d items at perceptual hashes cache", hashcount)
 		return
 	})
 
@@ -156,6 +164,7 @@ func RunWeb(exitctx context.Context, r *gin.Engine) {
 					WriteTimeout:      Cfg.WriteTimeout,
 					IdleTimeout:       Cfg.IdleTimeout,
 					MaxHeaderBytes:    Cfg.MaxHeaderBytes,
+					ErrorLog:          slog.NewLogLogger(cfg.Slog.Handler(), slog.LevelWarn),
 				}
 				go func() {
 					httpwg.Done()
@@ -216,6 +225,7 @@ func RunWeb(exitctx context.Context, r *gin.Engine) {
 					WriteTimeout:      Cfg.WriteTimeout,
 					IdleTimeout:       Cfg.IdleTimeout,
 					MaxHeaderBytes:    Cfg.MaxHeaderBytes,
+					ErrorLog:          slog.NewLogLogger(cfg.Slog.Handler(), slog.LevelWarn),
 				}
 				go func() {
 					httpwg.Done()
@@ -328,6 +338,9 @@ func Done() (err error) {
 		return
 	}
 	Log.Info("shutting down complete.")
+	if cfg.LogFile != nil {
+		cfg.LogFile.Close()
+	}
 	return
 }
 
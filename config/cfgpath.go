@@ -2,6 +2,8 @@ package config
 
 import (
 	"errors"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -26,6 +28,8 @@ var (
 	TmbPath string
 	// PkgPath determines resources packages path.
 	PkgPath string
+	// LogFile is rotated log file, if it's opened.
+	LogFile *RotateWriter
 )
 
 var (
@@ -92,6 +96,9 @@ func InitConfig() {
 		Log.Infof("config path: %s", CfgPath)
 	}
 
+	// Setup log output.
+	cobra.CheckErr(InitLogger())
+
 	// Detect SQLite path.
 	if SqlPath == "" {
 		SqlPath = LookupInLocations("SQLPATH", "sqlite", "slot-club.sqlite")
@@ -116,6 +123,42 @@ func InitConfig() {
 	Log.Infof("package path: %s", PkgPath)
 }
 
+// InitLogger applies logging settings to global logger,
+// opens log file if it's given, and sets slog default handler.
+func InitLogger() (err error) {
+	var lev LL
+	if lev, err = ParseLevel(Cfg.LogLevel); err != nil {
+		return
+	}
+	Log.SetLevel(lev)
+	if err = Log.SetFormat(Cfg.LogFormat); err != nil {
+		return
+	}
+	if Cfg.LogFile != "" {
+		var fpath = Cfg.LogFile
+		if !filepath.IsAbs(fpath) {
+			if CfgPath != "" {
+				fpath = filepath.Join(CfgPath, fpath)
+			} else {
+				fpath = filepath.Join(ExePath, fpath)
+			}
+		}
+		if LogFile, err = NewRotateWriter(fpath,
+			int64(Cfg.LogMaxSize*(1<<20)), Cfg.LogRotatePeriod,
+			Cfg.LogKeepNum, Cfg.LogKeepAge); err != nil {
+			return
+		}
+		if Cfg.LogStderr {
+			Log.SetOutput(io.MultiWriter(os.Stderr, LogFile))
+		} else {
+			Log.SetOutput(LogFile)
+		}
+		Log.Infof("log file: %s", fpath)
+	}
+	slog.SetDefault(Slog)
+	return
+}
+
 // PathName returns name of file in given file path without extension.
 func PathName(fpath string) string {
 	var j = len(fpath)
@@ -54,6 +54,12 @@ type CfgWebServ struct {
 	OnlineTimeout time.Duration `json:"online-timeout" yaml:"online-timeout" mapstructure:"online-timeout"`
 	// Maximum duration to wait for graceful shutdown.
 	ShutdownTimeout time.Duration `json:"shutdown-timeout" yaml:"shutdown-timeout" mapstructure:"shutdown-timeout"`
+	// Serve server metrics in Prometheus format at "/metrics" route.
+	MetricsEnable bool `json:"metrics-enable" yaml:"metrics-enable" mapstructure:"metrics-enable"`
+	// Bearer token to scrape metrics. If it's empty, scraper should be authorized by any profile.
+	MetricsToken string `json:"metrics-token" yaml:"metrics-token" mapstructure:"metrics-token"`
+	// Minimum duration between counts of database tables rows for metrics.
+	MetricsRowsPeriod time.Duration `json:"metrics-rows-period" yaml:"metrics-rows-period" mapstructure:"metrics-rows-period"`
 }
 
 type CfgTlsCert struct {
@@ -73,8 +79,28 @@ type CfgNetwork struct {
 }
 
 type CfgXormDrv struct {
-	// Provides XORM driver name.
+	// Provides XORM driver name, "sqlite3", "postgres" or "mysql".
 	XormDriverName string `json:"xorm-driver-name" yaml:"xorm-driver-name" mapstructure:"xorm-driver-name"`
+	// Data source name of files properties storage. If it's empty for
+	// SQLite driver, database file is placed at sqlite databases path.
+	StorageDSN string `json:"storage-dsn" yaml:"storage-dsn" mapstructure:"storage-dsn"`
+	// Data source name of user log. If it's empty for SQLite driver,
+	// database file is placed at sqlite databases path.
+	UserlogDSN string `json:"userlog-dsn" yaml:"userlog-dsn" mapstructure:"userlog-dsn"`
+	// Maximum number of open connections to database, zero means unlimited.
+	XormMaxConns int `json:"xorm-max-conns" yaml:"xorm-max-conns" mapstructure:"xorm-max-conns"`
+}
+
+// CfgTileSpec is specification of one kind of tiles.
+type CfgTileSpec struct {
+	// Tile width in pixels.
+	Width int `json:"width" yaml:"width" mapstructure:"width"`
+	// Tile height in pixels.
+	Height int `json:"height" yaml:"height" mapstructure:"height"`
+	// Tile image format, can be "webp", "avif" or "jpeg".
+	Format string `json:"format" yaml:"format" mapstructure:"format"`
+	// Encoding quality, ranges from 1 to 100 inclusive.
+	Quality float32 `json:"quality" yaml:"quality" mapstructure:"quality"`
 }
 
 type CfgImgProp struct {
@@ -90,15 +116,74 @@ type CfgImgProp struct {
 	MediaWebpQuality float32 `json:"media-webp-quality" yaml:"media-webp-quality" mapstructure:"media-webp-quality"`
 	// WebP quality of converted to HD-resolution images, ranges from 1 to 100 inclusive.
 	HDWebpQuality float32 `json:"hd-webp-quality" yaml:"hd-webp-quality" mapstructure:"hd-webp-quality"`
-	// WebP quality of any tiles, ranges from 1 to 100 inclusive.
-	TileWebpQuality float32 `json:"tile-webp-quality" yaml:"tile-webp-quality" mapstructure:"tile-webp-quality"`
 	// WebP quality of thumbnails, ranges from 1 to 100 inclusive.
 	TmbWebpQuality float32 `json:"tmb-webp-quality" yaml:"tmb-webp-quality" mapstructure:"tmb-webp-quality"`
+	// List of tiles specifications, each tile is produced for images by scanning.
+	TileSpecs []CfgTileSpec `json:"tile-specs" yaml:"tile-specs" mapstructure:"tile-specs"`
 	// Number of image processing threads in which performs converting to
 	// tiles and thumbnails. Zero sets this number to GOMAXPROCS value.
 	ScanThreadsNum int `json:"scan-threads-num" yaml:"scan-threads-num" mapstructure:"scan-threads-num"`
 }
 
+// CfgBgScan is settings of background scanning by web server.
+type CfgBgScan struct {
+	// Enables scanning of shares in background of web server.
+	BgScanEnable bool `json:"enable" yaml:"enable" mapstructure:"enable"`
+	// Scan also local roots of profiles in addition to shares.
+	BgScanLocal bool `json:"with-local" yaml:"with-local" mapstructure:"with-local"`
+	// List of schedules in crontab format "minute hour day-of-month month day-of-week" to start scanning.
+	BgScanCron []string `json:"cron" yaml:"cron" mapstructure:"cron"`
+	// Starts scanning when no one client was online during this period. Zero disables scanning on idle.
+	BgScanIdle time.Duration `json:"idle-delay" yaml:"idle-delay" mapstructure:"idle-delay"`
+	// Minimum period between completion of scanning and next start of scanning on idle.
+	BgScanPeriod time.Duration `json:"min-period" yaml:"min-period" mapstructure:"min-period"`
+	// Suspends scanning while any client is online.
+	BgScanPauseOnline bool `json:"pause-online" yaml:"pause-online" mapstructure:"pause-online"`
+	// Number of scanning threads. Zero sets this number to "scan-threads-num" value.
+	BgScanThreadsNum int `json:"threads-num" yaml:"threads-num" mapstructure:"threads-num"`
+	// Part of time in which each scanning thread loads CPU, ranges from 0 to 1. Zero or one disables CPU throttling.
+	BgScanCpuDuty float32 `json:"cpu-duty" yaml:"cpu-duty" mapstructure:"cpu-duty"`
+	// Maximum speed of processed files reading in megabytes per second. Zero disables IO throttling.
+	BgScanReadLimit float32 `json:"read-limit" yaml:"read-limit" mapstructure:"read-limit"`
+}
+
+// CfgLogging is settings of log output.
+type CfgLogging struct {
+	// Minimum level of log entries to output, "debug", "info", "warn" or "error".
+	// Entries with lower level are not written and are not kept at log ring.
+	LogLevel string `json:"level" yaml:"level" mapstructure:"level"`
+	// Format of log entries, "text", "json" or "logfmt".
+	LogFormat string `json:"format" yaml:"format" mapstructure:"format"`
+	// Path to log file. Relative path is counted from configuration path. Empty value disables writing to file.
+	LogFile string `json:"file" yaml:"file" mapstructure:"file"`
+	// Writes log to stderr in addition to the file.
+	LogStderr bool `json:"stderr" yaml:"stderr" mapstructure:"stderr"`
+	// Maximum size of log file in megabytes to rotate it. Zero disables size-based rotation.
+	LogMaxSize float32 `json:"max-size" yaml:"max-size" mapstructure:"max-size"`
+	// Period of log file rotation. Zero disables time-based rotation.
+	LogRotatePeriod time.Duration `json:"rotate-period" yaml:"rotate-period" mapstructure:"rotate-period"`
+	// Maximum number of rotated log files to keep. Zero keeps all files.
+	LogKeepNum int `json:"keep-num" yaml:"keep-num" mapstructure:"keep-num"`
+	// Maximum age of rotated log files to keep. Zero keeps all files.
+	LogKeepAge time.Duration `json:"keep-age" yaml:"keep-age" mapstructure:"keep-age"`
+	// Writes log entry for each served HTTP request.
+	LogRequests bool `json:"requests" yaml:"requests" mapstructure:"requests"`
+}
+
+// CfgUserlog is settings of user log retention and anonymization.
+type CfgUserlog struct {
+	// Maximum age of user log records. Zero keeps records forever.
+	UlKeepAge time.Duration `json:"keep-age" yaml:"keep-age" mapstructure:"keep-age"`
+	// Maximum number of records of opened files and folders. Zero disables the limit.
+	UlKeepNum int `json:"keep-num" yaml:"keep-num" mapstructure:"keep-num"`
+	// Representation of client address on insert, "raw", "truncate" to zero host part, or "hash".
+	UlAddrMode string `json:"addr-mode" yaml:"addr-mode" mapstructure:"addr-mode"`
+	// Period of retention policy applying by web server. Zero disables periodic cleanup.
+	UlCleanPeriod time.Duration `json:"clean-period" yaml:"clean-period" mapstructure:"clean-period"`
+	// Rebuilds SQLite database file after cleanup to free unused space.
+	UlVacuum bool `json:"vacuum" yaml:"vacuum" mapstructure:"vacuum"`
+}
+
 // CfgAppSets is settings for application-specific logic.
 type CfgAppSets struct {
 	// Name of wpk-file with program resources.
@@ -113,6 +198,8 @@ type CfgAppSets struct {
 	RangeSearchAny int `json:"range-search-any" yaml:"range-search-any" mapstructure:"range-search-any"`
 	// Limit of range search.
 	RangeSearchLimit int `json:"range-search-limit" yaml:"range-search-limit" mapstructure:"range-search-limit"`
+	// Maximum number of files in recently played category. Zero disables the limit.
+	RecentNum int `json:"recent-num" yaml:"recent-num" mapstructure:"recent-num"`
 }
 
 // Config is common service settings.
@@ -123,9 +210,31 @@ type Config struct {
 	*jnt.Config `json:"network" yaml:"network" mapstructure:"network"`
 	CfgXormDrv  `json:"xorm" yaml:"xorm" mapstructure:"xorm"`
 	CfgImgProp  `json:"images-prop" yaml:"images-prop" mapstructure:"images-prop"`
+	CfgBgScan   `json:"background-scan" yaml:"background-scan" mapstructure:"background-scan"`
+	CfgLogging  `json:"logging" yaml:"logging" mapstructure:"logging"`
+	CfgUserlog  `json:"userlog" yaml:"userlog" mapstructure:"userlog"`
 	CfgAppSets  `json:"specification" yaml:"specification" mapstructure:"specification"`
 }
 
+// DefTileSpecs returns default tiles specifications, with tiles
+// of 24x18 cell multiplied to 2, 3, 4, 6, 8, 9, 10, 12, 15, 16,
+// 18, 20, 24, 30, 36 in WebP format.
+func DefTileSpecs() []CfgTileSpec {
+	var tilemult = [...]int{
+		2, 3, 4, 6, 8, 9, 10, 12, 15, 16, 18, 20, 24, 30, 36,
+	}
+	var specs = make([]CfgTileSpec, len(tilemult))
+	for i, tm := range tilemult {
+		specs[i] = CfgTileSpec{
+			Width:   tm * 24,
+			Height:  tm * 18,
+			Format:  "webp",
+			Quality: 60,
+		}
+	}
+	return specs
+}
+
 // Instance of common service settings.
 // Inits default values if config is not found.
 var Cfg = &Config{
@@ -148,6 +257,9 @@ var Cfg = &Config{
 		MaxHeaderBytes:    1 << 20,
 		OnlineTimeout:     3 * 60 * time.Second,
 		ShutdownTimeout:   15 * time.Second,
+		MetricsEnable:     false,
+		MetricsToken:      "",
+		MetricsRowsPeriod: 5 * time.Minute,
 	},
 	CfgTlsCert: CfgTlsCert{
 		UseAutoCert:   false,
@@ -164,10 +276,39 @@ var Cfg = &Config{
 		TmbResolution:    [2]int{256, 256},
 		MediaWebpQuality: 80,
 		HDWebpQuality:    75,
-		TileWebpQuality:  60,
 		TmbWebpQuality:   75,
+		TileSpecs:        DefTileSpecs(),
 		ScanThreadsNum:   4,
 	},
+	CfgBgScan: CfgBgScan{
+		BgScanEnable:      false,
+		BgScanLocal:       false,
+		BgScanCron:        []string{"0 3 * * *"},
+		BgScanIdle:        30 * time.Minute,
+		BgScanPeriod:      24 * time.Hour,
+		BgScanPauseOnline: true,
+		BgScanThreadsNum:  1,
+		BgScanCpuDuty:     0.5,
+		BgScanReadLimit:   20,
+	},
+	CfgLogging: CfgLogging{
+		LogLevel:        "debug",
+		LogFormat:       "text",
+		LogFile:         "",
+		LogStderr:       true,
+		LogMaxSize:      20,
+		LogRotatePeriod: 24 * time.Hour,
+		LogKeepNum:      10,
+		LogKeepAge:      30 * 24 * time.Hour,
+		LogRequests:     false,
+	},
+	CfgUserlog: CfgUserlog{
+		UlKeepAge:     0,
+		UlKeepNum:     0,
+		UlAddrMode:    "raw",
+		UlCleanPeriod: 24 * time.Hour,
+		UlVacuum:      true,
+	},
 	CfgAppSets: CfgAppSets{
 		WPKName:           []string{"hms-app.wpk", "hms-edge.wpk"},
 		WPKmmap:           false,
@@ -175,6 +316,7 @@ var Cfg = &Config{
 		ImgCacheMaxSize:   256,
 		RangeSearchAny:    20,
 		RangeSearchLimit:  100,
+		RecentNum:         100,
 	},
 }
 
@@ -2,12 +2,17 @@ package config
 
 import (
 	"container/ring"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	xlog "xorm.io/xorm/log"
 )
@@ -46,6 +51,44 @@ const (
 	LLpanic
 )
 
+// Log output formats.
+const (
+	LFtext   = "text"   // plain text lines with header defined by flags
+	LFjson   = "json"   // one JSON object per line
+	LFlogfmt = "logfmt" // key=value pairs per line
+)
+
+var llname = [...]string{"debug", "info", "warn", "error", "fatal", "panic"}
+
+// String returns name of log level.
+func (lev LL) String() string {
+	if lev >= 0 && int(lev) < len(llname) {
+		return llname[lev]
+	}
+	return "LL" + strconv.Itoa(int(lev))
+}
+
+// ParseLevel returns log level by its name.
+func ParseLevel(s string) (LL, error) {
+	for i, name := range llname {
+		if strings.EqualFold(s, name) {
+			return LL(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrBadLevel, s)
+}
+
+var (
+	ErrBadLevel  = errors.New("unknown log level")
+	ErrBadFormat = errors.New("unknown log format")
+)
+
+// LogField is one structured field of log entry.
+type LogField struct {
+	Key string
+	Val any
+}
+
 // LogStore represents structured log fields for each log entry.
 // It's used to transmit the log items by network.
 type LogStore struct {
@@ -55,6 +98,8 @@ type LogStore struct {
 	Msg   string    `json:"msg" yaml:"msg" xml:"msg"`
 	Line  int       `json:"line,omitempty" yaml:"line,omitempty" xml:"line,omitempty"`
 	File  string    `json:"file,omitempty" yaml:"file,omitempty" xml:"file,omitempty"`
+	// Structured fields of entry, such as profile ID, PUID, route or latency.
+	Fields map[string]any `xorm:"-" json:"fields,omitempty" yaml:"fields,omitempty" xml:"-"`
 }
 
 // A Logger represents an active logging object that generates lines of
@@ -62,13 +107,15 @@ type LogStore struct {
 // the Writer's Write method. A Logger can be used simultaneously from
 // multiple goroutines; it guarantees to serialize access to the Writer.
 type Logger struct {
-	mux   sync.Mutex // ensures atomic writes; protects the following fields
-	out   io.Writer  // destination for output
-	ring  *ring.Ring // for accumulating last log items
-	lim   int        // maximum log size
-	size  int        // current log size
-	flag  int        // properties
-	level LL         // log level
+	mux   sync.Mutex     // ensures atomic writes; protects the following fields
+	out   io.Writer      // destination for output
+	ring  *ring.Ring     // for accumulating last log items
+	lim   int            // maximum log size
+	size  int            // current log size
+	flag  int            // properties
+	level LL             // log level
+	frmt  string         // output format
+	hook  func(LogStore) // called for each written entry
 }
 
 // Log is global static ring logger object.
@@ -82,6 +129,7 @@ func NewLogger(out io.Writer, flag int, lim int) *Logger {
 		out:  out,
 		flag: flag,
 		lim:  lim,
+		frmt: LFtext,
 	}
 }
 
@@ -142,14 +190,7 @@ func formatHeader(buf *[]byte, t time.Time, flag int, file string, line int) {
 	}
 	if flag&(Lshortfile|Llongfile) != 0 {
 		if flag&Lshortfile != 0 {
-			var short = file
-			for i := len(file) - 1; i > 0; i-- {
-				if file[i] == '/' {
-					short = file[i+1:]
-					break
-				}
-			}
-			file = short
+			file = shortfile(file)
 		}
 		*buf = append(*buf, file...)
 		*buf = append(*buf, ':')
@@ -166,10 +207,12 @@ func formatHeader(buf *[]byte, t time.Time, flag int, file string, line int) {
 // paths it will be 2.
 func (l *Logger) Output(calldepth int, lev LL, s string) error {
 	var now = time.Now() // get this early.
-	var flag = l.Flags()
+	if lev < l.Level() {
+		return nil
+	}
 	var file string
 	var line int
-	if flag&(Lshortfile|Llongfile) != 0 {
+	if l.Flags()&(Lshortfile|Llongfile) != 0 {
 		var ok bool
 		_, file, line, ok = runtime.Caller(calldepth)
 		if !ok {
@@ -177,13 +220,33 @@ func (l *Logger) Output(calldepth int, lev LL, s string) error {
 			line = 0
 		}
 	}
+	return l.output(now, lev, s, file, line, nil)
+}
+
+// output formats log entry with given fields by the logger format,
+// puts it to the ring and writes to output destination.
+func (l *Logger) output(now time.Time, lev LL, s string, file string, line int, fields []LogField) error {
+	var flag = l.Flags()
+	if len(s) > 0 && s[len(s)-1] == '\n' {
+		s = s[:len(s)-1]
+	}
 
 	var buf []byte
-	formatHeader(&buf, now, flag, file, line)
-	buf = append(buf, s...)
-	if len(s) == 0 || s[len(s)-1] != '\n' {
-		buf = append(buf, '\n')
+	switch l.Format() {
+	case LFjson:
+		formatJSON(&buf, now, flag, lev, s, file, line, fields)
+	case LFlogfmt:
+		formatLogfmt(&buf, now, flag, lev, s, file, line, fields)
+	default:
+		formatHeader(&buf, now, flag, file, line)
+		buf = append(buf, s...)
+		for _, f := range fields {
+			buf = append(buf, ' ')
+			appendLogfmt(&buf, f.Key, f.Val)
+		}
 	}
+	buf = append(buf, '\n')
+
 	var li = LogStore{
 		Time:  now,
 		Level: lev,
@@ -191,8 +254,17 @@ func (l *Logger) Output(calldepth int, lev LL, s string) error {
 		Line:  line,
 		File:  file,
 	}
+	if len(fields) > 0 {
+		li.Fields = make(map[string]any, len(fields))
+		for _, f := range fields {
+			if err, ok := f.Val.(error); ok {
+				li.Fields[f.Key] = err.Error()
+			} else {
+				li.Fields[f.Key] = f.Val
+			}
+		}
+	}
 
-	defer l.mux.Unlock()
 	l.mux.Lock()
 	if l.ring != nil {
 		if l.size < l.lim {
@@ -212,9 +284,121 @@ func (l *Logger) Output(calldepth int, lev LL, s string) error {
 		l.size++
 	}
 	var _, err = l.out.Write(buf)
+	var hook = l.hook
+	l.mux.Unlock()
+
+	if hook != nil {
+		hook(li)
+	}
 	return err
 }
 
+// shortfile returns final file name element.
+func shortfile(file string) string {
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '/' {
+			return file[i+1:]
+		}
+	}
+	return file
+}
+
+// fieldstr returns representation of field value for text formats.
+func fieldstr(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// appendLogfmt writes key=value pair, value is quoted if it's necessary.
+func appendLogfmt(buf *[]byte, key string, val any) {
+	*buf = append(*buf, key...)
+	*buf = append(*buf, '=')
+	var s = fieldstr(val)
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") || !utf8.ValidString(s) {
+		*buf = strconv.AppendQuote(*buf, s)
+	} else {
+		*buf = append(*buf, s...)
+	}
+}
+
+// formatLogfmt writes log entry as logfmt line.
+func formatLogfmt(buf *[]byte, t time.Time, flag int, lev LL, s string, file string, line int, fields []LogField) {
+	if flag&LUTC != 0 {
+		t = t.UTC()
+	}
+	appendLogfmt(buf, "time", t)
+	*buf = append(*buf, ' ')
+	appendLogfmt(buf, "level", lev)
+	*buf = append(*buf, ' ')
+	appendLogfmt(buf, "msg", s)
+	if file != "" {
+		if flag&Lshortfile != 0 {
+			file = shortfile(file)
+		}
+		*buf = append(*buf, ' ')
+		appendLogfmt(buf, "file", file+":"+strconv.Itoa(line))
+	}
+	for _, f := range fields {
+		*buf = append(*buf, ' ')
+		appendLogfmt(buf, f.Key, f.Val)
+	}
+}
+
+// appendJSON writes JSON-encoded key and value.
+func appendJSON(buf *[]byte, key string, val any) {
+	var b []byte
+	var err error
+	*buf = strconv.AppendQuote(*buf, key)
+	*buf = append(*buf, ':')
+	switch v := val.(type) {
+	case error:
+		b, err = json.Marshal(v.Error())
+	default:
+		b, err = json.Marshal(v)
+	}
+	if err != nil {
+		b, _ = json.Marshal(fieldstr(val))
+	}
+	*buf = append(*buf, b...)
+}
+
+// formatJSON writes log entry as JSON object.
+func formatJSON(buf *[]byte, t time.Time, flag int, lev LL, s string, file string, line int, fields []LogField) {
+	if flag&LUTC != 0 {
+		t = t.UTC()
+	}
+	*buf = append(*buf, '{')
+	appendJSON(buf, "time", t)
+	*buf = append(*buf, ',')
+	appendJSON(buf, "level", lev.String())
+	*buf = append(*buf, ',')
+	appendJSON(buf, "msg", s)
+	if file != "" {
+		if flag&Lshortfile != 0 {
+			file = shortfile(file)
+		}
+		*buf = append(*buf, ',')
+		appendJSON(buf, "file", file)
+		*buf = append(*buf, ',')
+		appendJSON(buf, "line", line)
+	}
+	for _, f := range fields {
+		*buf = append(*buf, ',')
+		appendJSON(buf, f.Key, f.Val)
+	}
+	*buf = append(*buf, '}')
+}
+
 // Logf calls l.Output to print to the logger with specified level.
 // Arguments are handled in the manner of fmt.Printf.
 func (l *Logger) Logf(level LL, format string, v ...interface{}) {
@@ -325,6 +509,36 @@ func (l *Logger) SetLevel(lev LL) {
 	l.level = lev
 }
 
+// Format returns output format of the logger.
+func (l *Logger) Format() string {
+	defer l.mux.Unlock()
+	l.mux.Lock()
+	return l.frmt
+}
+
+// SetFormat sets output format of the logger, "text", "json" or "logfmt".
+func (l *Logger) SetFormat(frmt string) error {
+	switch frmt {
+	case LFtext, LFjson, LFlogfmt:
+	case "":
+		frmt = LFtext
+	default:
+		return fmt.Errorf("%w: %q", ErrBadFormat, frmt)
+	}
+	defer l.mux.Unlock()
+	l.mux.Lock()
+	l.frmt = frmt
+	return nil
+}
+
+// SetHook sets function that is called for each written log entry.
+// Function should not write to the logger.
+func (l *Logger) SetHook(f func(LogStore)) {
+	defer l.mux.Unlock()
+	l.mux.Lock()
+	l.hook = f
+}
+
 // Writer returns the output destination for the logger.
 func (l *Logger) Writer() io.Writer {
 	defer l.mux.Unlock()
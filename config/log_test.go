@@ -0,0 +1,117 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	var tests = []struct {
+		name string
+		lev  LL
+		err  error
+	}{
+		{"debug", LLdebug, nil},
+		{"INFO", LLinfo, nil},
+		{"Warn", LLwarn, nil},
+		{"error", LLerror, nil},
+		{"trace", 0, ErrBadLevel},
+		{"", 0, ErrBadLevel},
+	}
+	for _, test := range tests {
+		var lev, err = ParseLevel(test.name)
+		if !errors.Is(err, test.err) {
+			t.Errorf("level %q: expected error %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if err == nil && lev != test.lev {
+			t.Errorf("level %q: expected %v, got %v", test.name, test.lev, lev)
+		}
+	}
+}
+
+func TestDefaultLevel(t *testing.T) {
+	// default configuration outputs all entries as it was before levels
+	if lev, err := ParseLevel(Cfg.LogLevel); err != nil || lev != LLdebug {
+		t.Fatalf("expected default level debug, got %q", Cfg.LogLevel)
+	}
+}
+
+func TestLevelFilter(t *testing.T) {
+	var tests = []struct {
+		lev  LL
+		want []string
+	}{
+		{LLdebug, []string{"d", "i", "w", "e"}},
+		{LLinfo, []string{"i", "w", "e"}},
+		{LLwarn, []string{"w", "e"}},
+		{LLerror, []string{"e"}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		var l = NewLogger(&buf, 0, 10)
+		l.SetLevel(test.lev)
+		l.Debug("d")
+		l.Info("i")
+		l.Warn("w")
+		l.Error("e")
+		var got = strings.Fields(buf.String())
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("level %v: expected %v, got %v", test.lev, test.want, got)
+		}
+		if l.Size() != len(test.want) {
+			t.Errorf("level %v: expected %d entries at ring, got %d", test.lev, len(test.want), l.Size())
+		}
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	var tests = []struct {
+		frmt string
+		want string
+		err  error
+	}{
+		{LFtext, `message with fields puid=12 path="/a b/c"` + "\n", nil},
+		{LFlogfmt, `level=info msg="message with fields" puid=12 path="/a b/c"` + "\n", nil},
+		{LFjson, "", nil},
+		{"", `message with fields puid=12 path="/a b/c"` + "\n", nil},
+		{"xml", "", ErrBadFormat},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		var l = NewLogger(&buf, 0, 10)
+		if err := l.SetFormat(test.frmt); !errors.Is(err, test.err) {
+			t.Errorf("format %q: expected error %v, got %v", test.frmt, test.err, err)
+			continue
+		} else if err != nil {
+			continue
+		}
+		slog.New(NewSlogHandler(l)).Info("message with fields", "puid", 12, "path", "/a b/c")
+		var out = buf.String()
+		switch test.frmt {
+		case LFjson:
+			var v map[string]any
+			if err := json.Unmarshal([]byte(out), &v); err != nil {
+				t.Fatalf("format %q: %v", test.frmt, err)
+			}
+			if v["level"] != "info" || v["msg"] != "message with fields" || v["puid"] != 12.0 || v["path"] != "/a b/c" {
+				t.Errorf("format %q: unexpected entry %s", test.frmt, out)
+			}
+		case LFlogfmt:
+			// time field is first
+			if !strings.HasPrefix(out, "time=") || !strings.HasSuffix(out, test.want) {
+				t.Errorf("format %q: unexpected entry %s", test.frmt, out)
+			}
+		default:
+			if out != test.want {
+				t.Errorf("format %q: expected %q, got %q", test.frmt, test.want, out)
+			}
+		}
+	}
+}
+
+// The End.
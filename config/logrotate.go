@@ -0,0 +1,222 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time layout of rotated log files names suffix.
+const rotlayout = "20060102-150405"
+
+// RotateWriter is io.Writer to log file that rotates it when file
+// reaches maximum size or at the end of rotation period. Rotated files
+// are renamed with time suffix and removed when they are out of retention.
+type RotateWriter struct {
+	mux     sync.Mutex
+	fpath   string        // path to current log file
+	maxsize int64         // maximum size of file, zero disables size-based rotation
+	maxage  time.Duration // rotation period, zero disables time-based rotation
+	keepnum int           // maximum number of rotated files to keep, zero keeps all
+	keepage time.Duration // maximum age of rotated files to keep, zero keeps all
+	file    *os.File
+	size    int64
+	period  time.Time // start of current rotation period
+}
+
+// NewRotateWriter opens or creates log file at given path
+// and returns writer with given rotation and retention settings.
+func NewRotateWriter(fpath string, maxsize int64, maxage time.Duration, keepnum int, keepage time.Duration) (w *RotateWriter, err error) {
+	w = &RotateWriter{
+		fpath:   fpath,
+		maxsize: maxsize,
+		maxage:  maxage,
+		keepnum: keepnum,
+		keepage: keepage,
+	}
+	if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		return
+	}
+	if err = w.open(); err != nil {
+		return
+	}
+	w.cleanup()
+	return
+}
+
+// Path returns path to current log file.
+func (w *RotateWriter) Path() string {
+	return w.fpath
+}
+
+// periodof returns start of rotation period to which belongs given time.
+// Periods are counted from local midnight, so daily rotation happens at
+// local midnight. Periods longer than a day are counted by whole days.
+func (w *RotateWriter) periodof(t time.Time) time.Time {
+	if w.maxage <= 0 {
+		return time.Time{}
+	}
+	var y, m, d = t.In(time.Local).Date()
+	if w.maxage < 24*time.Hour {
+		var midnight = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+		return midnight.Add(t.Sub(midnight) / w.maxage * w.maxage)
+	}
+	// number of local day since epoch, independent of daylight saving
+	var day = time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	var days = int64(w.maxage / (24 * time.Hour))
+	return time.Date(1970, 1, 1+int(day/days*days), 0, 0, 0, 0, time.Local)
+}
+
+func (w *RotateWriter) open() (err error) {
+	if w.file, err = os.OpenFile(w.fpath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return
+	}
+	var fi os.FileInfo
+	if fi, err = w.file.Stat(); err != nil {
+		w.file.Close()
+		w.file = nil
+		return
+	}
+	w.size = fi.Size()
+	if w.size > 0 {
+		// continue period of existing file
+		w.period = w.periodof(fi.ModTime())
+	} else {
+		w.period = w.periodof(time.Now())
+	}
+	return
+}
+
+// backupname returns unused name for rotated file with given time suffix.
+func (w *RotateWriter) backupname(t time.Time) string {
+	var ext = filepath.Ext(w.fpath)
+	var base = strings.TrimSuffix(w.fpath, ext) + "-" + t.Format(rotlayout)
+	var fpath = base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Stat(fpath); err != nil {
+			return fpath
+		}
+		fpath = base + "." + strconv.Itoa(i) + ext
+	}
+}
+
+// rotate closes current file, renames it, and opens new one.
+func (w *RotateWriter) rotate(now time.Time) (err error) {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	if w.size > 0 {
+		if err = os.Rename(w.fpath, w.backupname(now)); err != nil {
+			return
+		}
+	}
+	if err = w.open(); err != nil {
+		return
+	}
+	w.period = w.periodof(now)
+	go w.cleanup()
+	return
+}
+
+// rotated returns paths of rotated files of current log file,
+// sorted from newest to oldest. Files are recognized by time suffix
+// that is given on rotation, other files are ignored.
+func (w *RotateWriter) rotated() []string {
+	var ext = filepath.Ext(w.fpath)
+	var base = strings.TrimSuffix(w.fpath, ext)
+	var matches, _ = filepath.Glob(base + "-*" + ext)
+	type rotfile struct {
+		fpath string
+		t     time.Time
+		idx   int
+	}
+	var list = make([]rotfile, 0, len(matches))
+	for _, fpath := range matches {
+		var suffix = strings.TrimSuffix(strings.TrimPrefix(fpath, base+"-"), ext)
+		var ts, idx, hasidx = strings.Cut(suffix, ".")
+		var rf = rotfile{fpath: fpath}
+		var err error
+		if len(ts) != len(rotlayout) {
+			continue
+		}
+		if rf.t, err = time.ParseInLocation(rotlayout, ts, time.Local); err != nil {
+			continue
+		}
+		if hasidx {
+			if rf.idx, err = strconv.Atoi(idx); err != nil || rf.idx <= 0 {
+				continue
+			}
+		}
+		list = append(list, rf)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].t.Equal(list[j].t) {
+			return list[i].idx > list[j].idx
+		}
+		return list[i].t.After(list[j].t)
+	})
+	var paths = make([]string, len(list))
+	for i, rf := range list {
+		paths[i] = rf.fpath
+	}
+	return paths
+}
+
+// cleanup removes rotated files that are out of retention.
+func (w *RotateWriter) cleanup() {
+	if w.keepnum <= 0 && w.keepage <= 0 {
+		return
+	}
+	var now = time.Now()
+	for i, fpath := range w.rotated() {
+		var fi, err = os.Stat(fpath)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		if (w.keepnum > 0 && i >= w.keepnum) ||
+			(w.keepage > 0 && now.Sub(fi.ModTime()) > w.keepage) {
+			os.Remove(fpath)
+		}
+	}
+}
+
+// Write implements io.Writer interface. It rotates log file
+// before writing if file size or rotation period is exceeded.
+func (w *RotateWriter) Write(p []byte) (n int, err error) {
+	defer w.mux.Unlock()
+	w.mux.Lock()
+
+	if w.file == nil {
+		if err = w.open(); err != nil {
+			return
+		}
+	}
+	var now = time.Now()
+	if (w.maxsize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxsize) ||
+		(w.maxage > 0 && !w.periodof(now).Equal(w.period)) {
+		if err = w.rotate(now); err != nil {
+			return
+		}
+	}
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return
+}
+
+// Close closes current log file. Next writing will reopen it.
+func (w *RotateWriter) Close() (err error) {
+	defer w.mux.Unlock()
+	w.mux.Lock()
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	return
+}
+
+// The End.
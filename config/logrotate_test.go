@@ -0,0 +1,190 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLocal sets local time zone while test is running.
+func testLocal(t *testing.T, loc *time.Location) {
+	t.Helper()
+	var prev = time.Local
+	time.Local = loc
+	t.Cleanup(func() {
+		time.Local = prev
+	})
+}
+
+func TestPeriodOf(t *testing.T) {
+	// local midnight differs from UTC midnight
+	var loc = time.FixedZone("UTC+3", 3*60*60)
+	testLocal(t, loc)
+	var date = func(y int, m time.Month, d, h, min int) time.Time {
+		return time.Date(y, m, d, h, min, 0, 0, loc)
+	}
+	var tests = []struct {
+		maxage time.Duration
+		t      time.Time
+		want   time.Time
+	}{
+		{0, date(2026, 10, 19, 1, 30), time.Time{}},
+		{24 * time.Hour, date(2026, 10, 19, 1, 30), date(2026, 10, 19, 0, 0)},
+		{24 * time.Hour, date(2026, 10, 19, 23, 59), date(2026, 10, 19, 0, 0)},
+		{24 * time.Hour, date(2026, 10, 19, 0, 0).UTC(), date(2026, 10, 19, 0, 0)},
+		{6 * time.Hour, date(2026, 10, 19, 13, 10), date(2026, 10, 19, 12, 0)},
+		{time.Hour, date(2026, 10, 19, 2, 59), date(2026, 10, 19, 2, 0)},
+		// 2026-10-19 is 20745 day since epoch
+		{48 * time.Hour, date(2026, 10, 19, 1, 30), date(2026, 10, 18, 0, 0)},
+		{48 * time.Hour, date(2026, 10, 20, 23, 0), date(2026, 10, 20, 0, 0)},
+	}
+	for _, test := range tests {
+		var w = RotateWriter{maxage: test.maxage}
+		if got := w.periodof(test.t); !got.Equal(test.want) {
+			t.Errorf("period %v of %v: expected %v, got %v", test.maxage, test.t, test.want, got)
+		}
+	}
+}
+
+// testFiles creates empty files with given names at given directory.
+func testFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testNames returns names of files at given directory.
+func testNames(t *testing.T, dir string) []string {
+	t.Helper()
+	var ents, err = os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names = make([]string, len(ents))
+	for i, de := range ents {
+		names[i] = de.Name()
+	}
+	return names
+}
+
+func TestRotated(t *testing.T) {
+	var dir = t.TempDir()
+	testFiles(t, dir,
+		"hms.log",
+		"hms-20261017-120000.log",
+		"hms-20261018-000000.log",
+		"hms-20261018-000000.1.log",
+		"hms-20261018-000000.2.log",
+		// not rotated files
+		"hms-backup.log",
+		"hms-2026.log",
+		"hms-20261018-000000.x.log",
+		"hms-20261018-000000.0.log",
+		"hms-20261018-000000.txt",
+		"other-20261018-000000.log",
+	)
+	var w = RotateWriter{fpath: filepath.Join(dir, "hms.log")}
+	var want = []string{
+		"hms-20261018-000000.2.log",
+		"hms-20261018-000000.1.log",
+		"hms-20261018-000000.log",
+		"hms-20261017-120000.log",
+	}
+	var got = w.rotated()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d rotated files, got %v", len(want), got)
+	}
+	for i := range want {
+		if filepath.Base(got[i]) != want[i] {
+			t.Errorf("#%d: expected %s, got %s", i, want[i], filepath.Base(got[i]))
+		}
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	var rotated = []string{
+		"hms-20261019-000000.log",
+		"hms-20261018-000000.log",
+		"hms-20261017-000000.log",
+		"hms-20261016-000000.log",
+	}
+	var others = []string{"hms.log", "hms-backup.log", "other.log"}
+	var tests = []struct {
+		name    string
+		keepnum int
+		keepage time.Duration
+		kept    int // number of kept rotated files
+	}{
+		{"keep all", 0, 0, 4},
+		{"by number", 2, 0, 2},
+		{"by age", 0, 36 * time.Hour, 2},
+		{"by number and age", 1, 36 * time.Hour, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var dir = t.TempDir()
+			testFiles(t, dir, rotated...)
+			testFiles(t, dir, others...)
+			// each next file is one day older
+			for i, name := range rotated {
+				var mt = time.Now().Add(-time.Duration(i) * 24 * time.Hour)
+				if err := os.Chtimes(filepath.Join(dir, name), mt, mt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var w = RotateWriter{
+				fpath:   filepath.Join(dir, "hms.log"),
+				keepnum: test.keepnum,
+				keepage: test.keepage,
+			}
+			w.cleanup()
+			var names = strings.Join(testNames(t, dir), ",")
+			for i, name := range rotated {
+				if kept := strings.Contains(names, name); kept != (i < test.kept) {
+					t.Errorf("%s: expected kept %v, got %v", name, i < test.kept, kept)
+				}
+			}
+			for _, name := range others {
+				if !strings.Contains(names, name) {
+					t.Errorf("not rotated file %s is removed", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRotateWriter(t *testing.T) {
+	var dir = t.TempDir()
+	var fpath = filepath.Join(dir, "hms.log")
+	var w, err = NewRotateWriter(fpath, 16, 0, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	var line = []byte("0123456789\n")
+	for range 5 {
+		if _, err = w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond) // wait for cleanup at background
+
+	var fi os.FileInfo
+	if fi, err = os.Stat(fpath); err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(len(line)) {
+		t.Errorf("expected size %d of current file, got %d", len(line), fi.Size())
+	}
+	if n := len(w.rotated()); n != 2 {
+		t.Errorf("expected 2 rotated files, got %d: %v", n, testNames(t, dir))
+	}
+}
+
+// The End.
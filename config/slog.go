@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// SlogLevel converts slog level to log level of the Logger.
+func SlogLevel(lev slog.Level) LL {
+	switch {
+	case lev < slog.LevelInfo:
+		return LLdebug
+	case lev < slog.LevelWarn:
+		return LLinfo
+	case lev < slog.LevelError:
+		return LLwarn
+	default:
+		return LLerror
+	}
+}
+
+// SlogHandler is slog.Handler bridge that passes records
+// with theirs attributes to the Logger.
+type SlogHandler struct {
+	l      *Logger
+	attrs  []LogField // fields added by WithAttrs
+	prefix string     // keys prefix of opened groups
+}
+
+// NewSlogHandler returns slog.Handler that writes to given logger.
+func NewSlogHandler(l *Logger) *SlogHandler {
+	return &SlogHandler{l: l}
+}
+
+// Slog is structured logger that writes to global ring logger.
+var Slog = slog.New(NewSlogHandler(Log))
+
+// appendAttr appends attribute to fields list with flattened groups.
+func appendAttr(fields []LogField, prefix string, a slog.Attr) []LogField {
+	var v = a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		var attrs = v.Group()
+		if len(attrs) == 0 {
+			return fields
+		}
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range attrs {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	if a.Key == "" {
+		return fields
+	}
+	return append(fields, LogField{
+		Key: prefix + a.Key,
+		Val: v.Any(),
+	})
+}
+
+// Enabled implements slog.Handler interface.
+func (h *SlogHandler) Enabled(_ context.Context, lev slog.Level) bool {
+	return SlogLevel(lev) >= h.l.Level()
+}
+
+// Handle implements slog.Handler interface.
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	var file string
+	var line int
+	if r.PC != 0 && h.l.Flags()&(Lshortfile|Llongfile) != 0 {
+		var frame, _ = runtime.CallersFrames([]uintptr{r.PC}).Next()
+		file, line = frame.File, frame.Line
+	}
+	var fields = make([]LogField, len(h.attrs), len(h.attrs)+r.NumAttrs())
+	copy(fields, h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, a)
+		return true
+	})
+	var t = r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return h.l.output(t, SlogLevel(r.Level), r.Message, file, line, fields)
+}
+
+// WithAttrs implements slog.Handler interface.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var h2 = *h
+	h2.attrs = make([]LogField, len(h.attrs), len(h.attrs)+len(attrs))
+	copy(h2.attrs, h.attrs)
+	for _, a := range attrs {
+		h2.attrs = appendAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+// WithGroup implements slog.Handler interface.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	var h2 = *h
+	h2.prefix += name + "."
+	return &h2
+}
+
+// LogWriter is io.Writer that passes each written line
+// to the logger with given level. It's used to catch
+// output of libraries that writes to io.Writer, such as gin.
+type LogWriter struct {
+	mux sync.Mutex
+	l   *Logger
+	lev LL
+	buf []byte
+}
+
+// NewLogWriter returns writer to given logger with given level.
+func NewLogWriter(l *Logger, lev LL) *LogWriter {
+	return &LogWriter{l: l, lev: lev}
+}
+
+// Write implements io.Writer interface.
+func (w *LogWriter) Write(p []byte) (int, error) {
+	defer w.mux.Unlock()
+	w.mux.Lock()
+	w.buf = append(w.buf, p...)
+	for {
+		var i = bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if line := bytes.TrimSpace(w.buf[:i]); len(line) > 0 && w.lev >= w.l.Level() {
+			w.l.output(time.Now(), w.lev, string(line), "", 0, nil)
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// The End.
@@ -55,15 +55,17 @@ const mm = {
 
 // typeEXIF checks that file extension belongs to images with EXIF tags.
 const typeEXIF = {
-	".tif": true, ".tiff": true, ".dng": true,
+	".tif": true, ".tiff": true, ".dng": true, ".cr2": true, ".nef": true, ".arw": true,
 	".jpg": true, ".jpe": true, ".jpeg": true, ".jfif": true,
-	".png": true, ".webp": true,
+	".png": true, ".webp": true, ".avif": true, ".heic": true, ".heif": true,
 };
 
 // typeTile checks that file with this extension can be used to build tiles sheet.
 const typeTile = {
 	".jpg": true, ".jpe": true, ".jpeg": true, ".jfif": true,
-	/*".avif": true,*/ ".png": true, ".webp": true, ".gif": true,
+	".avif": true, ".png": true, ".webp": true, ".gif": true,
+	".heic": true, ".heif": true,
+	".dng": true, ".cr2": true, ".nef": true, ".arw": true,
 }
 
 const gpxcolors = [
@@ -1168,7 +1170,7 @@ const VueFileCard = {
 			const gen = (async function* () {
 				const mlist = [];
 				for (const file of flist) {
-					if ((self.$root.access || file.free) && file.type === FT.file) {
+					if ((self.$root.access || file.free) && file.type === FT.file && file.puid) {
 						mlist.push(file);
 					}
 				}
@@ -1239,7 +1241,7 @@ const VueFileCard = {
 				const muncached = [];
 				for (const file of mlist) {
 					if (!file.mtmb) {
-						muncached.push({ puid: file.puid, tm: 0 });
+						muncached.push({ puid: file.puid, vis: isvisible(file.puid) });
 					}
 				}
 				if (muncached.length) {
@@ -1800,9 +1802,9 @@ const VueTileCard = {
 			// not cached tiles
 			const uncached = [];
 			for (const tile of this.tiles) {
-				const fld = 'mt' + (tile.sx * wdhmult < 10 ? '0' : '') + tile.sx * wdhmult;
-				if ((this.$root.access || tile.file.free) && tile.file.type === FT.file && !tile.file[fld]) {
-					uncached.push({ puid: tile.file.puid, tm: tile.sx * wdhmult });
+				const dim = tiledim(tile.sx, tile.sy);
+				if ((this.$root.access || tile.file.free) && tile.file.type === FT.file && !gettile(tile.file, dim)) {
+					uncached.push({ puid: tile.file.puid, dim: dim, vis: isvisible(tile.file.puid) });
 				}
 			}
 			if (!uncached.length) {
@@ -1854,8 +1856,7 @@ const VueTileCard = {
 						if (tp.mime) {
 							for (const tile of self.tiles) {
 								if (tile.file.puid === tp.puid) {
-									const fld = 'mt' + (tp.tm < 10 ? '0' : '') + tp.tm;
-									tile.file[fld] = tp.mime; // Vue.set
+									settile(tile.file, tp.dim, tp.mime); // Vue.set
 									break;
 								}
 							}
@@ -2289,7 +2290,7 @@ const VueMapCard = {
 				const muncached = [];
 				for (const file of mlist) {
 					if (!file.mtmb) {
-						muncached.push({ puid: file.puid, tm: 0 });
+						muncached.push({ puid: file.puid, vis: isvisible(file.puid) });
 					}
 				}
 				if (muncached.length) {
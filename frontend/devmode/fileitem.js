@@ -2,14 +2,15 @@
 
 const isTypeImage = ext => ({
 	".tga": true, ".bmp": true, ".dib": true, ".rle": true, ".dds": true,
-	".tif": true, ".tiff": true, ".dng": true, ".jpg": true, ".jpe": true, ".jpeg": true, ".jfif": true,
+	".tif": true, ".tiff": true, ".dng": true, ".cr2": true, ".nef": true, ".arw": true, ".jpg": true, ".jpe": true, ".jpeg": true, ".jfif": true,
 	".gif": true, ".png": true, ".avif": true, ".webp": true, ".psd": true, ".psb": true,
+	".heic": true, ".heif": true,
 })[ext];
 
 const isTypeEXIF = ext => ({
-	".tif": true, ".tiff": true, ".dng": true,
+	".tif": true, ".tiff": true, ".dng": true, ".cr2": true, ".nef": true, ".arw": true,
 	".jpg": true, ".jpe": true, ".jpeg": true, ".jfif": true,
-	".png": true, ".webp": true,
+	".png": true, ".webp": true, ".avif": true, ".heic": true, ".heif": true,
 })[ext];
 
 const isTypeAudio = ext => ({
@@ -21,17 +22,35 @@ const isTypeVideo = ext => ({
 	".mp4": true, ".webm": true,
 })[ext];
 
+// Returns true if any item of file is displayed on screen now.
+const isvisible = puid => {
+	for (const el of document.querySelectorAll(`[data-puid="${puid}"]`)) {
+		const rc = el.getBoundingClientRect();
+		if (rc.width && rc.bottom > 0 && rc.right > 0 && rc.top < window.innerHeight && rc.left < window.innerWidth) {
+			return true;
+		}
+	}
+	return false;
+};
+
 const imagefilter = file => file.type === FT.file && file.size && file.view && isTypeImage(pathext(file.name));
-const audiofilter = file => file.type === FT.file && file.size && file.view && isTypeAudio(pathext(file.name));
+const audiofilter = file => file.type === FT.file && (file.size || file.link) && file.view && isTypeAudio(pathext(file.link ?? file.name));
 const videofilter = file => file.type === FT.file && file.size && file.view && isTypeVideo(pathext(file.name));
 
 const filehint = file => {
 	const lst = [];
 	// Std properties
 	lst.push(['name', file.name.length > 31 ? file.name.substring(0, 32) + "..." : file.name]);
-	if (file.type === FT.file) {
+	if (file.type === FT.file && file.puid) {
 		lst.push(['size', fmtitemsize(file.size ?? 0)]);
 	}
+	// Playlist track placeholder properties
+	if (file.link) {
+		lst.push(['link', file.link]);
+	}
+	if (file.missing) {
+		lst.push(['state', 'file is absent']);
+	}
 	if (file.time > "0001-01-01T00:00:00Z") {
 		lst.push(['time', (new Date(file.time)).toLocaleString('en-GB')]);
 	}
@@ -425,11 +444,14 @@ const VueIconMenu = {
 				'active': this.file.shared,
 			};
 		},
+		isholder() { // playlist track placeholder
+			return !this.file.puid;
+		},
 		showinfo() {
-			return this.file.type === FT.file;
+			return this.file.type === FT.file && !this.isholder;
 		},
 		shownewtab() {
-			if (this.file.type !== FT.file) {
+			if (this.file.type !== FT.file || this.isholder) {
 				return false;
 			}
 			const ext = pathext(this.file.name);
@@ -438,7 +460,7 @@ const VueIconMenu = {
 				|| (extfmt.audio[ext] && Number(this.file.etmb) > 0);
 		},
 		showview() {
-			if (this.file.type !== FT.file) {
+			if (this.file.type !== FT.file || this.isholder) {
 				return false;
 			}
 			const ext = pathext(this.file.name);
@@ -446,7 +468,20 @@ const VueIconMenu = {
 				ext == ".gpx";
 		},
 		showcopy() {
-			return this.file.type === FT.file || this.file.type === FT.dir;
+			return !this.isholder && (this.file.type === FT.file || this.file.type === FT.dir);
+		},
+		showlink() {
+			return !this.isholder || !!this.file.link;
+		},
+		showshare() {
+			return !this.isholder;
+		},
+		showfav() {
+			return !this.isholder && this.$root.isadmin
+				&& (this.file.type === FT.file || this.file.type === FT.dir);
+		},
+		iconfav() {
+			return this.file.fav ? 'star' : 'star_border';
 		},
 		showcutdel() {
 			return !this.file.static;
@@ -497,6 +532,10 @@ const VueIconMenu = {
 			this.file.view = !this.file.view;
 		},
 		onlink() {
+			if (this.isholder) {
+				navigator.clipboard.writeText(this.file.link);
+				return;
+			}
 			navigator.clipboard.writeText(window.location.origin + `/id${this.$root.aid}/file/${this.file.puid}`);
 		},
 		onshare() {
@@ -515,6 +554,18 @@ const VueIconMenu = {
 				}
 			})();
 		},
+		onfav() {
+			(async () => {
+				eventHub.emit('ajax', +1);
+				try {
+					await this.$root.fetchstatefav(this.file, !this.file.fav);
+				} catch (e) {
+					ajaxfail(e);
+				} finally {
+					eventHub.emit('ajax', -1);
+				}
+			})();
+		},
 		oncopy() {
 			this.$root.copied = this.file;
 			this.$root.cuted = null;
@@ -534,7 +585,7 @@ const VueIconMenu = {
 		}
 	},
 	mounted() {
-		if (this.file.type === FT.file) {
+		if (this.showinfo) {
 			this.popover = new bootstrap.Popover(this.$refs.info, {
 				title: this.file.name,
 				content: fileinfo(this.file).map(e => `<b>${e[0]}</b>: ${e[1]}`).join('<br>'),
@@ -611,7 +662,7 @@ const VueListItem = {
 			}
 		},
 		itemview() {
-			return { 'selected': this.file.selected };
+			return { 'selected': this.file.selected, 'opacity-50': this.file.missing };
 		},
 		filesize() {
 			return fmtfilesize(this.file.size ?? 0);
@@ -687,7 +738,7 @@ const VueFileItem = {
 
 		// manage items classes
 		itemview() {
-			return { 'selected': this.file.selected };
+			return { 'selected': this.file.selected, 'opacity-50': this.file.missing };
 		}
 	},
 	methods: {
@@ -736,7 +787,7 @@ const VueImgItem = {
 
 		// manage items classes
 		itemview() {
-			return { 'selected': this.file.selected };
+			return { 'selected': this.file.selected, 'opacity-50': this.file.missing };
 		}
 	},
 	methods: {
@@ -802,6 +853,24 @@ let wdhmult = 4; // lg by default
 	mqlhd.addEventListener('change', hhd);
 })();
 
+// Returns dimensions of tile with given cells numbers and multiplier.
+const tiledim = (sx, sy, mult = wdhmult) => `${24 * mult * sx}x${18 * mult * sy}`;
+
+// Returns MIME type of tile with given dimensions.
+const gettile = (file, dim) => file.tiles?.find(tm => tm.dim === dim)?.mime;
+
+// Updates MIME type of tile with given dimensions.
+const settile = (file, dim, mime) => {
+	const tm = file.tiles?.find(tm => tm.dim === dim);
+	if (tm) {
+		tm.mime = mime;
+	} else if (file.tiles) {
+		file.tiles.push({ dim: dim, mime: mime });
+	} else {
+		file.tiles = [{ dim: dim, mime: mime }];
+	}
+};
+
 const VueTileItem = {
 	template: '#tile-item-tpl',
 	props: ["file", "sx", "sy"],
@@ -817,17 +886,16 @@ const VueTileItem = {
 			return pathext(this.file.name);
 		},
 		istile() {
-			const fld = 'mt' + (this.wdhmult * this.sx < 10 ? '0' : '') + this.wdhmult * this.sx;
-			return Number(this.file[fld]) > 0;
+			return Number(gettile(this.file, tiledim(this.sx, this.sy, this.wdhmult))) > 0;
 		},
 		fmttitle() {
 			return filehint(this.file).map(e => `${e[0]}: ${e[1]}`).join('\n');
 		},
 		iconsrc() {
-			return `/id${this.$root.aid}/tile/${this.file.puid}/${24 * this.wdhmult * this.sx}x${18 * this.wdhmult * this.sy}`;
+			return `/id${this.$root.aid}/tile/${this.file.puid}/${tiledim(this.sx, this.sy, this.wdhmult)}`;
 		},
 		iconblank() {
-			return `/fs/assets/blank-tile/${24 * this.wdhmult * this.sx}x${18 * this.wdhmult * this.sy}.svg`;
+			return `/fs/assets/blank-tile/${tiledim(this.sx, this.sy, this.wdhmult)}.svg`;
 		}
 	},
 	methods: {
@@ -37,6 +37,9 @@ const CNID = {
 	books: "14",
 	texts: "18",
 	map: "1C",
+	favorites: "1G",
+	recent: "1K",
+	tags: "1O",
 
 	reserved: 32
 };
@@ -54,6 +57,9 @@ const CIDN = {
 	"14": "books",
 	"18": "texts",
 	"1C": "map",
+	"1G": "favorites",
+	"1K": "recent",
+	"1O": "tags",
 };
 
 // Category properties.
@@ -69,6 +75,9 @@ const CP = {
 	"14": "Books",
 	"18": "Text files",
 	"1C": "Map",
+	"1G": "Favorites",
+	"1K": "Recently played",
+	"1O": "Tags",
 };
 
 // MIME enum values.
@@ -80,6 +89,7 @@ const Mime = {
 	png: 3,
 	jpeg: 4,
 	webp: 5,
+	avif: 6,
 };
 
 // MIME type string by value.
@@ -90,6 +100,7 @@ const MimeStr = {
 	[Mime.png]: "image/png",
 	[Mime.jpeg]: "image/jpeg",
 	[Mime.webp]: "image/webp",
+	[Mime.avif]: "image/avif",
 };
 
 // MIME type value by string.
@@ -99,6 +110,7 @@ const MimeVal = {
 	"image/png": Mime.png,
 	"image/jpeg": Mime.jpeg,
 	"image/webp": Mime.webp,
+	"image/avif": Mime.avif,
 };
 
 // File types
@@ -134,7 +146,7 @@ const extfmt = {
 		".tga": 1, ".bmp": 1, ".dib": 1, ".rle": 1, ".dds": 1
 	},
 	"tiff": {
-		".tiff": 1, ".tif": 1, ".dng": 1
+		".tiff": 1, ".tif": 1, ".dng": 1, ".cr2": 1, ".nef": 1, ".arw": 1
 	},
 	"jpeg": {
 		".jpg": 1, ".jpe": 1, ".jpeg": 1, ".jfif": 1
@@ -217,13 +229,13 @@ const extfmt = {
 		".wpk": 1
 	},
 	"playlist": {
-		".m3u": 1, ".m3u8": 1, ".wpl": 1, ".pls": 1, ".asx": 1, ".xspf": 1
+		".m3u": 1, ".m3u8": 1, ".wpl": 1, ".pls": 1, ".asx": 1, ".xspf": 1, ".cue": 1
 	},
 
 	"image": {
 		".tga": 1, ".bmp": 1, ".dib": 1, ".rle": 1, ".dds": 1,
-		".tif": 1, ".tiff": 1, ".dng": 1, ".jpg": 1, ".jpe": 1, ".jpeg": 1, ".jfif": 1,
-		".gif": 1, ".png": 1, ".webp": 1, ".avif": 1, ".psd": 1, ".psb": 1,
+		".tif": 1, ".tiff": 1, ".dng": 1, ".cr2": 1, ".nef": 1, ".arw": 1, ".jpg": 1, ".jpe": 1, ".jpeg": 1, ".jfif": 1,
+		".gif": 1, ".png": 1, ".webp": 1, ".avif": 1, ".heic": 1, ".heif": 1, ".psd": 1, ".psb": 1,
 		".jp2": 1, ".jpg2": 1, ".jpx": 1, ".jpm": 1, ".jxr": 1
 	},
 	"audio": {
@@ -264,7 +276,7 @@ const extfmt = {
 		".img": 1, ".ima": 1, ".imz": 1, ".ccd": 1, ".vc4": 1, ".dmg": 1,
 		".daa": 1, ".uif": 1, ".vhd": 1, ".vhdx": 1, ".vmdk": 1,
 		".wpk": 1,
-		".m3u": 1, ".m3u8": 1, ".wpl": 1, ".pls": 1, ".asx": 1, ".xspf": 1
+		".m3u": 1, ".m3u8": 1, ".wpl": 1, ".pls": 1, ".asx": 1, ".xspf": 1, ".cue": 1
 	}
 };
 
@@ -776,6 +788,73 @@ const VueMainApp = {
 			document.title = `hms - ${this.curbasename}`;
 			// scroll page to top
 			this.$refs.page.scrollTop = 0;
+
+			// get favorite flags and playback positions at background
+			(async () => {
+				try {
+					await this.fetchstateget();
+				} catch (e) {
+					console.error(e);
+				}
+			})();
+		},
+
+		async fetchstateget() {
+			const list = [];
+			for (const file of this.flist) {
+				if (file.puid) { // skip playlist tracks placeholders
+					list.push(file.puid);
+				}
+			}
+			if (!this.isadmin || !list.length) {
+				return;
+			}
+			const response = await fetchjsonauth("POST", `/id${this.aid}/api/state/get`, {
+				list: list
+			});
+			const data = await response.json();
+			traceajax(response, data);
+			if (!response.ok) {
+				throw new HttpError(response.status, data);
+			}
+
+			const sm = {};
+			for (const st of data.list) {
+				sm[st.puid] = st;
+			}
+			for (const file of this.flist) {
+				const st = sm[file.puid];
+				if (st) {
+					file.fav = st.fav; // Vue.set
+					file.pos = st.pos; // Vue.set
+				}
+			}
+		},
+
+		async fetchstatefav(file, fav) {
+			const response = await fetchjsonauth("POST", `/id${this.aid}/api/state/fav`, {
+				puid: file.puid,
+				fav: fav
+			});
+			const data = await response.json();
+			traceajax(response, data);
+			if (!response.ok) {
+				throw new HttpError(response.status, data);
+			}
+			file.fav = data.fav; // Vue.set
+		},
+
+		async fetchstateplay(file, pos) {
+			const response = await fetchjsonauth("POST", `/id${this.aid}/api/state/play`, {
+				puid: file.puid,
+				pos: pos
+			});
+			const data = await response.json();
+			traceajax(response, data);
+			if (!response.ok) {
+				throw new HttpError(response.status, data);
+			}
+			file.pos = data.pos ?? 0; // Vue.set
 		},
 
 		async fetchshareadd(file) {
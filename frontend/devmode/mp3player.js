@@ -18,6 +18,7 @@ const VuePlayer = {
 			timecur: 0,
 			timebuf: 0,
 			timeend: 0,
+			trkbeg: 0, // beginning of CUE track at whole audio file
 			ratevals: [ // rate predefined values
 				1 / 2.50, 1 / 2.00, 1 / 1.75, 1 / 1.50, 1 / 1.25, 1 / 1.15, 1, 1.15, 1.25, 1.50, 1.75, 2.00, 2.50
 			],
@@ -109,17 +110,46 @@ const VuePlayer = {
 	},
 	methods: {
 		setup(file) {
-			if (this.selfile.puid === file.puid) { // do not set again same file
+			if (this.selfile === file || file.puid && this.selfile.puid === file.puid) { // do not set again same file
 				return;
 			}
 			this.selfile = file;
 
-			const media = new Audio(`/id${this.$root.aid}/file/${file.puid}`); // API HTMLMediaElement, HTMLAudioElement
+			// remote playlist tracks are played by their links
+			const media = new Audio(file.link ?? `/id${this.$root.aid}/file/${file.puid}`); // API HTMLMediaElement, HTMLAudioElement
 			media.volume = this.volval / 100;
 			media.playbackRate = this.ratevals[this.ratval];
 			media.loop = this.repeatmode === 1;
 			media.autoplay = this.autoplay;
 
+			// CUE track of audio file that can not be cut on server
+			// is played as range of whole audio file
+			const beg = file.track && !file.cut ? file.start / 1e9 : 0;
+			const end = file.track && !file.cut && file.end ? file.end / 1e9 : 0;
+			this.trkbeg = beg;
+
+			// playback position is saved for owner of files,
+			// and playback is continued from saved position
+			const cansave = !!file.puid && this.$root.isadmin;
+			let reported = 0; // time of last position report
+			let finished = false; // track is played up to end
+			const report = pos => {
+				const ms = Math.max(Math.round(pos * 1000), 0);
+				// skip not changed position, so preloading
+				// of selected file does not mark it as played
+				if (!cansave || ms === (file.pos ?? 0)) {
+					return;
+				}
+				reported = Date.now();
+				(async () => {
+					try {
+						await this.$root.fetchstateplay(file, ms);
+					} catch (e) {
+						console.error(e);
+					}
+				})();
+			};
+
 			// reassign media current content
 			if (this.media && !this.media.paused) {
 				this.media.pause();
@@ -131,11 +161,11 @@ const VuePlayer = {
 
 			const updateprogress = () => {
 				if (!this.seeking) {
-					this.timecur = media.currentTime;
+					this.timecur = media.currentTime - beg;
 				}
 
 				if (media.buffered.length > 0) {
-					const cur = this.timecur;
+					const cur = media.currentTime;
 					const pos1 = media.buffered.start(0);
 					const pos2 = media.buffered.end(0);
 					if (pos1 <= cur && pos2 > cur) { // buffered in current pos
@@ -150,9 +180,14 @@ const VuePlayer = {
 
 			// media interface responders
 			media.addEventListener('loadedmetadata', () => {
-				this.timecur = media.currentTime;
+				const len = (end || media.duration) - beg;
+				const pos = file.pos > 0 && file.pos / 1000 < len - 1 ? file.pos / 1000 : 0;
+				if (beg + pos > 0) {
+					media.currentTime = beg + pos;
+				}
+				this.timecur = media.currentTime - beg;
 				this.timebuf = 0;
-				this.timeend = media.duration;
+				this.timeend = (end || media.duration) - beg;
 
 				updateprogress();
 			});
@@ -166,20 +201,47 @@ const VuePlayer = {
 				}
 			});
 			media.addEventListener('timeupdate', updateprogress);
+			media.addEventListener('timeupdate', () => {
+				if (!media.paused && Date.now() - reported > 15000) {
+					report(media.currentTime - beg);
+				}
+			});
+			if (end) {
+				media.addEventListener('timeupdate', () => {
+					if (media.currentTime < end) {
+						return;
+					}
+					if (media.loop) {
+						media.currentTime = beg;
+					} else {
+						finished = true;
+						report(0);
+						media.pause();
+						this.autoplay = true;
+						this.onnext();
+					}
+				});
+			}
 			media.addEventListener('seeked', updateprogress);
 			media.addEventListener('progress', updateprogress);
 			media.addEventListener('durationchange', updateprogress);
 			media.addEventListener('play', () => {
+				finished = false;
+				report(media.currentTime - beg);
 				this.autoplay = true;
 				media.autoplay = true;
 				eventHub.emit('playback', file, true);
 			});
 			media.addEventListener('pause', () => {
+				if (!media.ended && !finished) {
+					report(media.currentTime - beg);
+				}
 				this.autoplay = false;
 				media.autoplay = false;
 				eventHub.emit('playback', file, false);
 			});
 			media.addEventListener('ended', () => {
+				report(0);
 				this.autoplay = true;
 				this.onnext();
 			});
@@ -255,7 +317,7 @@ const VuePlayer = {
 		},
 
 		onseekerchange(e) {
-			this.media.currentTime = e.target.value;
+			this.media.currentTime = Number(e.target.value) + this.trkbeg;
 			this.seeking = false;
 		},
 		onseekerinput(e) {
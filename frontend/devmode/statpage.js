@@ -16,6 +16,62 @@ const LLC = {
 // Extract SQL-query from log message.
 const sqllogregex = /^(\[SQL\] (.*) (\[.*\]))/i;
 
+// Shared stream of server events, it's opened while any card listens it.
+// Events of opened files and log entries come only with authorization.
+const srvevents = {
+	source: null,
+	listeners: new Map(), // event type => set of callbacks
+	anon: false, // token was rejected, stream is opened without it
+
+	on(type, fn) {
+		if (!this.listeners.has(type)) {
+			this.listeners.set(type, new Set());
+		}
+		this.listeners.get(type).add(fn);
+		this.reopen();
+	},
+	off(type, fn) {
+		const set = this.listeners.get(type);
+		if (set?.delete(fn)) {
+			if (!set.size) {
+				this.listeners.delete(type);
+			}
+			this.reopen();
+		}
+	},
+	reopen() {
+		if (this.source) {
+			this.source.close();
+			this.source = null;
+		}
+		if (!this.listeners.size) {
+			return;
+		}
+		const types = [...this.listeners.keys()];
+		let url = `/api/stat/events?types=${types.join(',')}`;
+		const token = !this.anon && auth.access;
+		if (token) {
+			url += `&token=${token}`;
+		}
+		this.source = new EventSource(url);
+		this.source.onerror = () => {
+			// stream is closed on response with error status
+			if (token && this.source?.readyState === EventSource.CLOSED) {
+				this.anon = true;
+				this.reopen();
+			}
+		};
+		for (const type of types) {
+			this.source.addEventListener(type, e => {
+				const data = JSON.parse(e.data);
+				for (const fn of this.listeners.get(type) ?? []) {
+					fn(data);
+				}
+			});
+		}
+	},
+};
+
 // User Agent structure sample:
 // {"Browser":{"Name":1,"Version":{"Major":86,"Minor":0,"Patch":4240}},"OS":{"Platform":1,"Name":2,"Version":{"Major":10,"Minor":0,"Patch":0}},"DeviceType":1}
 
@@ -543,16 +599,239 @@ const VueCchinfCard = {
 	},
 };
 
+const VueImgscnCard = {
+	template: '#imgscn-card-tpl',
+	data() {
+		return {
+			imgscn: {},
+			upmode: true,
+			expanded: false,
+			iid: makestrid(10), // instance ID
+		};
+	},
+	computed: {
+		clsupdate() {
+			return { active: !!this.upmode };
+		},
+
+		queued() {
+			return (this.imgscn.queued ?? []).reduce((sum, n) => sum + n, 0);
+		},
+		queuedvis() {
+			return (this.imgscn.queued ?? [])[0] ?? 0;
+		},
+		queuedpage() {
+			return (this.imgscn.queued ?? [])[1] ?? 0;
+		},
+		queuedback() {
+			return (this.imgscn.queued ?? [])[2] ?? 0;
+		},
+
+		expandchevron() {
+			return this.expanded ? 'expand_more' : 'chevron_right';
+		},
+	},
+	methods: {
+		onupdate() {
+			this.collapse();
+			this.upmode = !this.upmode;
+			if (this.expanded && this.upmode) {
+				this.onrefresh();
+				this.update();
+			}
+		},
+		onrefresh() {
+			(async () => {
+				try {
+					const response = await fetch("/api/stat/imgscn");
+					if (response.ok) {
+						this.imgscn = await response.json();
+					}
+				} catch (e) { console.error(e); }
+			})();
+		},
+		update() {
+			srvevents.on("imgscn", this.onevent);
+		},
+		onevent(data) {
+			this.imgscn = data;
+		},
+
+
+		onexpand(e) {
+			this.expanded = true;
+			storageSetItem("card.imgscn.expanded", this.expanded);
+			this.expand();
+		},
+		oncollapse(e) {
+			this.expanded = false;
+			storageSetItem("card.imgscn.expanded", this.expanded);
+			this.collapse();
+		},
+		expand() {
+			this.onrefresh();
+			if (this.upmode) {
+				this.update();
+			}
+		},
+		collapse() {
+			srvevents.off("imgscn", this.onevent);
+		},
+	},
+	created() {
+		this.expanded = storageGetItem("card.imgscn.expanded", this.expanded);
+	},
+	mounted() {
+		const el = document.getElementById('card' + this.iid);
+		if (el) {
+			if (this.expanded) { 
+				el.classList.add('show');
+				this.expand();
+			} else {
+				this.collapse();
+			}
+			el.addEventListener('show.bs.collapse', this.onexpand);
+			el.addEventListener('hide.bs.collapse', this.oncollapse);
+		}
+	},
+	unmounted() {
+		const el = document.getElementById('card' + this.iid);
+		if (el) {
+			el.removeEventListener('shown.bs.collapse', this.onexpand);
+			el.removeEventListener('hidden.bs.collapse', this.oncollapse);
+		}
+	},
+};
+
+const VueBgscanCard = {
+	template: '#bgscan-card-tpl',
+	data() {
+		return {
+			bgscan: {},
+			upmode: true,
+			expanded: false,
+			iid: makestrid(10), // instance ID
+		};
+	},
+	computed: {
+		clsupdate() {
+			return { active: !!this.upmode };
+		},
+
+		isrun() {
+			return this.bgscan.state === 'run';
+		},
+		statename() {
+			switch (this.bgscan.state) {
+				case 'off': return "disabled";
+				case 'wait': return "waits for start";
+				case 'run': return this.bgscan.paused ? "paused while clients are online" : "in progress";
+				default: return "unknown";
+			}
+		},
+		stagename() {
+			switch (this.bgscan.stage) {
+				case 0: return "walking shares";
+				case 1: return "embedded info extracting";
+				case 2: return "tiles and thumbnails preparing";
+				default: return "unknown";
+			}
+		},
+		fmtremain() {
+			return fmtduration((this.bgscan.remain ?? 0) * dur_ms, dur_sec);
+		},
+
+		expandchevron() {
+			return this.expanded ? 'expand_more' : 'chevron_right';
+		},
+	},
+	methods: {
+		fmtsize(size) {
+			return fmtfilesize(size ?? 0);
+		},
+		fmtunix(t) {
+			return t ? (new Date(t)).toLocaleString('en-GB') : "never";
+		},
+
+		onupdate() {
+			this.collapse();
+			this.upmode = !this.upmode;
+			if (this.expanded && this.upmode) {
+				this.onrefresh();
+				this.update();
+			}
+		},
+		onrefresh() {
+			(async () => {
+				try {
+					const response = await fetch("/api/stat/bgscan");
+					if (response.ok) {
+						this.bgscan = await response.json();
+					}
+				} catch (e) { console.error(e); }
+			})();
+		},
+		update() {
+			srvevents.on("bgscan", this.onevent);
+		},
+		onevent(data) {
+			this.bgscan = data;
+		},
+
+
+		onexpand(e) {
+			this.expanded = true;
+			storageSetItem("card.bgscan.expanded", this.expanded);
+			this.expand();
+		},
+		oncollapse(e) {
+			this.expanded = false;
+			storageSetItem("card.bgscan.expanded", this.expanded);
+			this.collapse();
+		},
+		expand() {
+			this.onrefresh();
+			if (this.upmode) {
+				this.update();
+			}
+		},
+		collapse() {
+			srvevents.off("bgscan", this.onevent);
+		},
+	},
+	created() {
+		this.expanded = storageGetItem("card.bgscan.expanded", this.expanded);
+	},
+	mounted() {
+		const el = document.getElementById('card' + this.iid);
+		if (el) {
+			if (this.expanded) { 
+				el.classList.add('show');
+				this.expand();
+			} else {
+				this.collapse();
+			}
+			el.addEventListener('show.bs.collapse', this.onexpand);
+			el.addEventListener('hide.bs.collapse', this.oncollapse);
+		}
+	},
+	unmounted() {
+		const el = document.getElementById('card' + this.iid);
+		if (el) {
+			el.removeEventListener('shown.bs.collapse', this.onexpand);
+			el.removeEventListener('hidden.bs.collapse', this.oncollapse);
+		}
+	},
+};
+
 const VueConsoleCard = {
 	template: '#console-card-tpl',
 	data() {
 		return {
 			log: [],
-			last: Date.now(),
 			timemode: 1,
 			fitwdh: false,
-			upmode: 2500,
-			upid: 0,
+			upmode: true,
 			expanded: false,
 			iid: makestrid(10), // instance ID
 		};
@@ -628,9 +907,8 @@ const VueConsoleCard = {
 		},
 
 		onupdate() {
-			clearInterval(this.upid);
-			this.upid = 0;
-			this.upmode = this.upmode ? 0 : 2500;
+			this.collapse();
+			this.upmode = !this.upmode;
 			if (this.expanded && this.upmode) {
 				this.onrefresh();
 				this.update();
@@ -643,23 +921,17 @@ const VueConsoleCard = {
 					if (response.ok) {
 						const data = await response.json();
 						this.log = data.list;
-						this.last = Date.now();
 					}
 				} catch (e) { console.error(e); }
 			})();
 		},
 		update() {
-			this.upid = setInterval(() => (async () => {
-				try {
-					const response = fetchjson("POST", `/api/stat/getlog?unixms=${this.last}`);
-					if (response.ok) {
-						const data = await response.json();
-						this.log.push(...data.list);
-						this.last = Date.now();
-					}
-				} catch (e) { console.error(e); }
-			})(), this.upmode);
+			srvevents.on("log", this.onevent);
 		},
+		onevent(data) {
+			this.log.push(data);
+		},
+
 
 		onexpand(e) {
 			this.expanded = true;
@@ -678,8 +950,7 @@ const VueConsoleCard = {
 			}
 		},
 		collapse() {
-			clearInterval(this.upid);
-			this.upid = 0;
+			srvevents.off("log", this.onevent);
 		},
 	},
 	created() {
@@ -716,8 +987,8 @@ const VueUsercCard = {
 			usrlst: {},
 			usrlstpage: 0,
 			usrlstsize: 20,
-			upmode: 5000,
-			upid: 0,
+			upmode: true,
+			evid: 0,
 			expanded: false,
 			iid: makestrid(10), // instance ID
 		};
@@ -741,9 +1012,8 @@ const VueUsercCard = {
 		},
 
 		onupdate() {
-			clearInterval(this.upid);
-			this.upid = 0;
-			this.upmode = this.upmode ? 0 : 5000;
+			this.collapse();
+			this.upmode = !this.upmode;
 			if (this.expanded && this.upmode) {
 				this.onrefresh();
 				this.update();
@@ -762,9 +1032,20 @@ const VueUsercCard = {
 			})();
 		},
 		update() {
-			this.upid = setInterval(() => this.onrefresh(), this.upmode);
+			srvevents.on("online", this.onevent);
+			srvevents.on("open", this.onevent);
+		},
+		onevent(data) {
+			// several events may come at once, so refresh list once for them
+			if (!this.evid) {
+				this.evid = setTimeout(() => {
+					this.evid = 0;
+					this.onrefresh();
+				}, 500);
+			}
 		},
 
+
 		onexpand(e) {
 			this.expanded = true;
 			storageSetItem("card.users.expanded", this.expanded);
@@ -782,8 +1063,10 @@ const VueUsercCard = {
 			}
 		},
 		collapse() {
-			clearInterval(this.upid);
-			this.upid = 0;
+			srvevents.off("online", this.onevent);
+			srvevents.off("open", this.onevent);
+			clearTimeout(this.evid);
+			this.evid = 0;
 		},
 	},
 	created() {
@@ -811,6 +1094,13 @@ const VueUsercCard = {
 	},
 };
 
+// reopen events stream with actual token
+auth.signload();
+eventHub.on('auth', () => {
+	srvevents.anon = false;
+	srvevents.reopen();
+});
+
 // Create application view model
 const appws = Vue.createApp(VueStatApp)
 	.component('catitem-tag', VueCatItem)
@@ -819,6 +1109,8 @@ const appws = Vue.createApp(VueStatApp)
 	.component('srvinf-card-tag', VueSrvinfCard)
 	.component('memgc-card-tag', VueMemgcCard)
 	.component('cchinf-card-tag', VueCchinfCard)
+	.component('imgscn-card-tag', VueImgscnCard)
+	.component('bgscan-card-tag', VueBgscanCard)
 	.component('console-card-tag', VueConsoleCard)
 	.component('users-card-tag', VueUsercCard)
 	.mount('#app');
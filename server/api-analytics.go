@@ -0,0 +1,386 @@
+package hms
+
+import (
+	"cmp"
+	"encoding/xml"
+	"slices"
+	"strings"
+	"time"
+
+	uas "github.com/avct/uasurfer"
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+const (
+	anlimitdef = 20  // default number of items in top lists
+	anlimitmax = 500 // maximum number of items in top lists
+)
+
+// AnRange is common arguments of analytics queries,
+// date range in unix milliseconds and number of items.
+// Zero bounds of range are not applied.
+type AnRange struct {
+	From int64 `json:"from,omitempty" yaml:"from,omitempty" xml:"from,omitempty" form:"from"`
+	To   int64 `json:"to,omitempty" yaml:"to,omitempty" xml:"to,omitempty" form:"to"`
+	Num  int   `json:"num,omitempty" yaml:"num,omitempty" xml:"num,omitempty" form:"num"`
+}
+
+// Where adds range conditions for given time column to session.
+func (ar *AnRange) Where(session *xorm.Session, col string) *xorm.Session {
+	if ar.From > 0 {
+		session.And(col+">=?", time.UnixMilli(ar.From))
+	}
+	if ar.To > 0 {
+		session.And(col+"<?", time.UnixMilli(ar.To))
+	}
+	return session
+}
+
+// Limit returns number of items bounded by defaults.
+func (ar *AnRange) Limit() int {
+	if ar.Num <= 0 {
+		return anlimitdef
+	}
+	return min(ar.Num, anlimitmax)
+}
+
+// Escapes special characters of LIKE operator with '!' escape character.
+var likeescaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// likeprefix returns pattern for LIKE operator with '!' escape
+// character that matches all strings with given prefix.
+func likeprefix(prefix string) string {
+	return likeescaper.Replace(prefix) + "%"
+}
+
+// likesuffix returns pattern for LIKE operator with '!' escape
+// character that matches all strings with given suffix.
+func likesuffix(suffix string) string {
+	return "%" + likeescaper.Replace(suffix)
+}
+
+// timebucket returns SQL expression that groups time column by given
+// unit for database of userlog. "hour" unit gives hour of day, so all
+// days of range are summed up into 24 buckets, "day" unit gives date.
+func timebucket(col, unit string) (string, error) {
+	var dbtype = XormUserlog.Dialect().URI().DBType
+	switch unit {
+	case "hour":
+		switch dbtype {
+		case schemas.MYSQL:
+			return "DATE_FORMAT(" + col + ", '%H')", nil
+		case schemas.POSTGRES:
+			return "to_char(" + col + ", 'HH24')", nil
+		default:
+			return "strftime('%H', " + col + ")", nil
+		}
+	case "day":
+		switch dbtype {
+		case schemas.MYSQL:
+			return "DATE_FORMAT(" + col + ", '%Y-%m-%d')", nil
+		case schemas.POSTGRES:
+			return "to_char(" + col + ", 'YYYY-MM-DD')", nil
+		default:
+			return "strftime('%Y-%m-%d', " + col + ")", nil
+		}
+	}
+	return "", ErrBadUnit
+}
+
+// AnPathItem is aggregated statistics of some path opening.
+type AnPathItem struct {
+	Path    string    `json:"path" yaml:"path" xml:"path"`
+	Num     int64     `json:"num" yaml:"num" xml:"num,attr"`             // number of openings
+	Clients int64     `json:"clients" yaml:"clients" xml:"clients,attr"` // number of distinct clients
+	Last    time.Time `json:"last" yaml:"last" xml:"last,attr"`          // time of last opening
+}
+
+// APIHANDLER
+// SpiTopFiles returns most served files, optionally filtered by file groups.
+func SpiTopFiles(c *gin.Context) {
+	var err error
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+		AnRange `yaml:",inline"`
+
+		Groups []FG_t `json:"groups,omitempty" yaml:"groups,omitempty" xml:"groups>grp,omitempty"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List []AnPathItem `json:"list" yaml:"list" xml:"list>item"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_topfiles_nobind, err)
+		return
+	}
+
+	var session = XormUserlog.NewSession()
+	defer session.Close()
+
+	session.Table(&OpenStore{}).
+		Select("path, COUNT(*) AS num, COUNT(DISTINCT uaid) AS clients, MAX(time) AS last").
+		Where("latency<0")
+	arg.Where(session, "time")
+	if len(arg.Groups) > 0 {
+		var conds []string
+		var args []any
+		for ext, grp := range extgrp {
+			for _, g := range arg.Groups {
+				if grp == g {
+					conds = append(conds, "LOWER(path) LIKE ? ESCAPE '!'")
+					args = append(args, likesuffix(ext))
+					break
+				}
+			}
+		}
+		if len(conds) == 0 {
+			RetOk(c, ret)
+			return
+		}
+		session.And("("+strings.Join(conds, " OR ")+")", args...)
+	}
+	ret.List = []AnPathItem{}
+	if err = session.GroupBy("path").OrderBy("num DESC").Limit(arg.Limit()).Find(&ret.List); err != nil {
+		Ret500(c, AEC_topfiles_query, err)
+		return
+	}
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiTopDirs returns most viewed folders.
+func SpiTopDirs(c *gin.Context) {
+	var err error
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+		AnRange `yaml:",inline"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List []AnPathItem `json:"list" yaml:"list" xml:"list>item"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_topdirs_nobind, err)
+		return
+	}
+
+	var session = XormUserlog.NewSession()
+	defer session.Close()
+
+	session.Table(&OpenStore{}).
+		Select("path, COUNT(*) AS num, COUNT(DISTINCT uaid) AS clients, MAX(time) AS last").
+		Where("latency>=0")
+	arg.Where(session, "time")
+	ret.List = []AnPathItem{}
+	if err = session.GroupBy("path").OrderBy("num DESC").Limit(arg.Limit()).Find(&ret.List); err != nil {
+		Ret500(c, AEC_topdirs_query, err)
+		return
+	}
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiSharesTraffic returns number of served files and viewed
+// folders for each share of each profile.
+func SpiSharesTraffic(c *gin.Context) {
+	type item struct {
+		AID     uint64 `json:"aid" yaml:"aid" xml:"aid,attr"`
+		Path    string `json:"path" yaml:"path" xml:"path"`
+		Name    string `json:"name" yaml:"name" xml:"name"`
+		Files   int64  `json:"files" yaml:"files" xml:"files"`       // number of served files
+		Folders int64  `json:"folders" yaml:"folders" xml:"folders"` // number of viewed folders
+		Clients int64  `json:"clients" yaml:"clients" xml:"clients"` // number of distinct clients
+	}
+
+	var err error
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+		AnRange `yaml:",inline"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List []item `json:"list" yaml:"list" xml:"list>item"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_shares_nobind, err)
+		return
+	}
+
+	var session = XormUserlog.NewSession()
+	defer session.Close()
+
+	var prfs []*Profile
+	Profiles.Range(func(id uint64, prf *Profile) bool {
+		prfs = append(prfs, prf)
+		return true
+	})
+	slices.SortFunc(prfs, func(a, b *Profile) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	ret.List = []item{}
+	for _, prf := range prfs {
+		for _, dp := range prf.GetShares() {
+			var prefix = dp.Path
+			if !strings.HasSuffix(prefix, "/") {
+				prefix += "/"
+			}
+			var row struct {
+				Files   int64
+				Folders int64
+				Clients int64
+			}
+			session.Table(&OpenStore{}).
+				Select("COALESCE(SUM(CASE WHEN latency<0 THEN 1 ELSE 0 END), 0) AS files, COALESCE(SUM(CASE WHEN latency>=0 THEN 1 ELSE 0 END), 0) AS folders, COUNT(DISTINCT uaid) AS clients").
+				Where("(path=? OR path LIKE ? ESCAPE '!')", dp.Path, likeprefix(prefix))
+			arg.Where(session, "time")
+			if _, err = session.Get(&row); err != nil {
+				Ret500(c, AEC_shares_query, err)
+				return
+			}
+			ret.List = append(ret.List, item{
+				AID:     prf.ID,
+				Path:    dp.Path,
+				Name:    dp.Name,
+				Files:   row.Files,
+				Folders: row.Folders,
+				Clients: row.Clients,
+			})
+		}
+	}
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiActivity returns number of openings grouped by hours of day or by days.
+func SpiActivity(c *gin.Context) {
+	type item struct {
+		Period  string `json:"period" yaml:"period" xml:"period,attr"` // hour of day "HH", or date "YYYY-MM-DD"
+		Files   int64  `json:"files" yaml:"files" xml:"files"`         // number of served files
+		Folders int64  `json:"folders" yaml:"folders" xml:"folders"`   // number of viewed folders
+		Clients int64  `json:"clients" yaml:"clients" xml:"clients"`   // number of distinct clients
+	}
+
+	var err error
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+		AnRange `yaml:",inline"`
+
+		Unit string `json:"unit" yaml:"unit" xml:"unit" form:"unit"` // "hour" or "day"
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List []item `json:"list" yaml:"list" xml:"list>item"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_activity_nobind, err)
+		return
+	}
+	if arg.Unit == "" {
+		arg.Unit = "day"
+	}
+	var bucket string
+	if bucket, err = timebucket("time", arg.Unit); err != nil {
+		Ret400(c, AEC_activity_unit, err)
+		return
+	}
+
+	var session = XormUserlog.NewSession()
+	defer session.Close()
+
+	session.Table(&OpenStore{}).
+		Select(bucket + " AS period, SUM(CASE WHEN latency<0 THEN 1 ELSE 0 END) AS files, SUM(CASE WHEN latency>=0 THEN 1 ELSE 0 END) AS folders, COUNT(DISTINCT uaid) AS clients")
+	arg.Where(session, "time")
+	ret.List = []item{}
+	if err = session.GroupBy("period").OrderBy("period").Find(&ret.List); err != nil {
+		Ret500(c, AEC_activity_query, err)
+		return
+	}
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiTopClients returns most active clients with theirs user agents.
+func SpiTopClients(c *gin.Context) {
+	type row struct {
+		CID  uint64
+		Addr string
+		UA   string
+		Lang string
+		Num  int64
+		Last time.Time
+	}
+	type item struct {
+		CID  uint64        `json:"cid" yaml:"cid" xml:"cid,attr"`
+		Addr string        `json:"addr" yaml:"addr" xml:"addr"`
+		UA   uas.UserAgent `json:"ua" yaml:"ua" xml:"ua"`
+		Lang string        `json:"lang" yaml:"lang" xml:"lang"`
+		Num  int64         `json:"num" yaml:"num" xml:"num"`    // number of openings
+		Last time.Time     `json:"last" yaml:"last" xml:"last"` // time of last opening
+	}
+
+	var err error
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+		AnRange `yaml:",inline"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List []item `json:"list" yaml:"list" xml:"list>item"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_topclients_nobind, err)
+		return
+	}
+
+	var session = XormUserlog.NewSession()
+	defer session.Close()
+
+	session.Table(&OpenStore{}).Alias("o").
+		Join("INNER", []string{"agent_store", "a"}, "a.uaid=o.uaid").
+		Select("a.cid AS cid, a.addr AS addr, a.ua AS ua, a.lang AS lang, COUNT(*) AS num, MAX(o.time) AS last")
+	arg.Where(session, "o.time")
+	var rows []row
+	if err = session.GroupBy("a.uaid, a.cid, a.addr, a.ua, a.lang").OrderBy("num DESC").Limit(arg.Limit()).Find(&rows); err != nil {
+		Ret500(c, AEC_topclients_query, err)
+		return
+	}
+
+	ret.List = make([]item, len(rows))
+	for i, r := range rows {
+		var ci = item{
+			CID:  r.CID,
+			Addr: r.Addr,
+			Lang: r.Lang,
+			Num:  r.Num,
+			Last: r.Last,
+		}
+		uas.ParseUserAgent(r.UA, &ci.UA)
+		ret.List[i] = ci
+	}
+
+	RetOk(c, ret)
+}
+
+// The End.
@@ -0,0 +1,195 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testProfile makes new profile with given credentials
+// while test is running.
+func testProfile(t *testing.T, login, password string) *Profile {
+	t.Helper()
+	if Profiles.Len() == 0 {
+		Profiles.Init(4)
+	}
+	var prf = NewProfile(login, password)
+	t.Cleanup(func() {
+		Profiles.Delete(prf.ID)
+	})
+	return prf
+}
+
+// testPost sends POST request with JSON body to given router
+// and decodes JSON reply. Credentials are used if login is given.
+func testPost(t *testing.T, r http.Handler, url, login, password string, arg string, ret any) int {
+	t.Helper()
+	var req = httptest.NewRequest("POST", url, bytes.NewBufferString(arg))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if login != "" {
+		req.Header.Set("Authorization", "Basic "+base64.RawURLEncoding.EncodeToString([]byte(login+":"+password)))
+	}
+	var w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code == http.StatusOK && ret != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), ret); err != nil {
+			t.Fatalf("%s: %v", url, err)
+		}
+	}
+	return w.Code
+}
+
+func TestTimeBucket(t *testing.T) {
+	testUserlog(t)
+	var tests = []struct {
+		unit string
+		want string
+		err  error
+	}{
+		{"hour", "strftime('%H', time)", nil},
+		{"day", "strftime('%Y-%m-%d', time)", nil},
+		{"week", "", ErrBadUnit},
+	}
+	for _, test := range tests {
+		var got, err = timebucket("time", test.unit)
+		if err != test.err || got != test.want {
+			t.Errorf("unit %q: expected %q, %v, got %q, %v", test.unit, test.want, test.err, got, err)
+		}
+	}
+}
+
+func TestLikeEscape(t *testing.T) {
+	var tests = []struct {
+		s, prefix, suffix string
+	}{
+		{"/music/", "/music/%", "%/music/"},
+		{"/50%_off!/", "/50!%!_off!!/%", "%/50!%!_off!!/"},
+	}
+	for _, test := range tests {
+		if got := likeprefix(test.s); got != test.prefix {
+			t.Errorf("prefix of %q: expected %q, got %q", test.s, test.prefix, got)
+		}
+		if got := likesuffix(test.s); got != test.suffix {
+			t.Errorf("suffix of %q: expected %q, got %q", test.s, test.suffix, got)
+		}
+	}
+}
+
+func TestSpiActivity(t *testing.T) {
+	var engine = testUserlog(t)
+	testProfile(t, "admin", "secret")
+
+	var at = func(d, h, m int) time.Time {
+		return time.Date(2026, 10, d, h, m, 0, 0, time.Local)
+	}
+	for _, ost := range []OpenStore{
+		{UAID: 1, Path: "/music/a.mp3", Latency: -1, Time: at(17, 10, 15)},
+		{UAID: 2, Path: "/music/b.mp3", Latency: -1, Time: at(18, 10, 40)},
+		{UAID: 1, Path: "/music/", Latency: 5, Time: at(18, 12, 0)},
+		{UAID: 1, Path: "/music/a.mp3", Latency: -1, Time: at(19, 23, 59)},
+	} {
+		if _, err := engine.NoAutoTime().InsertOne(&ost); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	var r = gin.New()
+	r.POST("/api/stat/activity", Auth(true), SpiActivity)
+
+	type item struct {
+		Period  string `json:"period"`
+		Files   int64  `json:"files"`
+		Folders int64  `json:"folders"`
+		Clients int64  `json:"clients"`
+	}
+	var tests = []struct {
+		name string
+		arg  string
+		want []item
+	}{
+		{"hours of day", `{"unit":"hour"}`, []item{
+			{"10", 2, 0, 2},
+			{"12", 0, 1, 1},
+			{"23", 1, 0, 1},
+		}},
+		{"days", `{"unit":"day"}`, []item{
+			{"2026-10-17", 1, 0, 1},
+			{"2026-10-18", 1, 1, 2},
+			{"2026-10-19", 1, 0, 1},
+		}},
+		{"hours in range", `{"unit":"hour","from":` + strconv.FormatInt(at(18, 0, 0).UnixMilli(), 10) + `}`, []item{
+			{"10", 1, 0, 1},
+			{"12", 0, 1, 1},
+			{"23", 1, 0, 1},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ret struct {
+				List []item `json:"list"`
+			}
+			if code := testPost(t, r, "/api/stat/activity", "admin", "secret", test.arg, &ret); code != http.StatusOK {
+				t.Fatalf("unexpected status %d", code)
+			}
+			if len(ret.List) != len(test.want) {
+				t.Fatalf("expected %v, got %v", test.want, ret.List)
+			}
+			for i := range ret.List {
+				if ret.List[i] != test.want[i] {
+					t.Fatalf("expected %v, got %v", test.want, ret.List)
+				}
+			}
+		})
+	}
+
+	if code := testPost(t, r, "/api/stat/activity", "admin", "secret", `{"unit":"week"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected status %d for bad unit, got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestAnalyticsAuth(t *testing.T) {
+	testUserlog(t)
+	testProfile(t, "admin", "secret")
+
+	// client is known, so it is not written to user log
+	var uaid = CalcUAID("192.0.2.1", "")
+	uamux.Lock()
+	UaMap[uaid] = 1
+	uamux.Unlock()
+	t.Cleanup(func() {
+		uamux.Lock()
+		delete(UaMap, uaid)
+		delete(UserOnline, uaid)
+		uamux.Unlock()
+	})
+
+	gin.SetMode(gin.TestMode)
+	var r = gin.New()
+	ApiRouter(r)
+
+	var tests = []string{
+		"/api/stat/topfiles",
+		"/api/stat/topdirs",
+		"/api/stat/shares",
+		"/api/stat/activity",
+		"/api/stat/topclients",
+	}
+	for _, url := range tests {
+		if code := testPost(t, r, url, "", "", `{}`, nil); code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status %d without authorization, got %d", url, http.StatusUnauthorized, code)
+		}
+		if code := testPost(t, r, url, "admin", "secret", `{}`, nil); code != http.StatusOK {
+			t.Errorf("%s: expected status %d with authorization, got %d", url, http.StatusOK, code)
+		}
+	}
+}
+
+// The End.
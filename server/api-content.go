@@ -3,7 +3,6 @@ package hms
 import (
 	"bytes"
 	"errors"
-	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
@@ -13,6 +12,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	cfg "github.com/schwarzlichtbezirk/hms/config"
 )
 
 // Distributes static pages.
@@ -83,6 +83,13 @@ func SpiFile(c *gin.Context) {
 		return
 	}
 
+	if cuepath, n, ok := CueTrackSplit(syspath); ok {
+		if fi, _ := JP.Stat(cuepath); fi != nil && !fi.IsDir() {
+			ServeCueTrack(c, acc, uid, cuepath, n)
+			return
+		}
+	}
+
 	var grp = GetFileGroup(syspath)
 	if hd && grp == FGimage {
 		var md MediaData
@@ -103,8 +110,8 @@ func SpiFile(c *gin.Context) {
 
 			if HasRangeBegin(c.Request) { // beginning of content
 				Log.Infof("id%d: media-hd %s", acc.ID, path.Base(syspath))
-				go XormUserlog.InsertOne(&OpenStore{
-					UAID:    RequestUAID(c),
+				go InsertOpen(&OpenStore{
+					UAID:    int64(RequestUAID(c)),
 					AID:     aid,
 					UID:     uid,
 					Path:    syspath,
@@ -136,8 +143,8 @@ func SpiFile(c *gin.Context) {
 
 			if HasRangeBegin(c.Request) { // beginning of content
 				Log.Infof("id%d: media %s", acc.ID, path.Base(syspath))
-				go XormUserlog.InsertOne(&OpenStore{
-					UAID:    RequestUAID(c),
+				go InsertOpen(&OpenStore{
+					UAID:    int64(RequestUAID(c)),
 					AID:     aid,
 					UID:     uid,
 					Path:    syspath,
@@ -152,8 +159,8 @@ func SpiFile(c *gin.Context) {
 
 	if HasRangeBegin(c.Request) { // beginning of content
 		Log.Infof("id%d: serve %s", acc.ID, path.Base(syspath))
-		go XormUserlog.InsertOne(&OpenStore{
-			UAID:    RequestUAID(c),
+		go InsertOpen(&OpenStore{
+			UAID:    int64(RequestUAID(c)),
 			AID:     aid,
 			UID:     uid,
 			Path:    syspath,
@@ -191,6 +198,78 @@ func SpiFile(c *gin.Context) {
 	http.ServeContent(c.Writer, c.Request, syspath, t, content)
 }
 
+// ServeCueTrack hands out track of CUE sheet with given number.
+// Track is cut from audio file if its format allows it (WAV and FLAC),
+// or whole audio file is served otherwise, and the player seeks to
+// the track start by CueProp.Start and stops at CueProp.End.
+func ServeCueTrack(c *gin.Context, acc *Profile, uid uint64, cuepath string, n int) {
+	var err error
+
+	var cs CueSheet
+	if cs, err = CueRead(cuepath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			RetErr(c, http.StatusGone, AEC_media_cuegone, err)
+			return
+		}
+		RetErr(c, http.StatusUnsupportedMediaType, AEC_media_cueread, err)
+		return
+	}
+	var ct, ok = cs.Track(n)
+	if !ok {
+		Ret404(c, AEC_media_cuetrack, ErrCueTrack)
+		return
+	}
+	if Hidden.Fits(ct.File) {
+		Ret403(c, AEC_media_cuehidden, ErrHidden)
+		return
+	}
+	if !acc.PathAccess(ct.File, uid == acc.ID) {
+		Ret403(c, AEC_media_cueaccess, ErrNoAccess)
+		return
+	}
+
+	var content RFile
+	if content, err = OpenFile(ct.File); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			RetErr(c, http.StatusGone, AEC_media_cuegone, err)
+			return
+		}
+		Ret500(c, AEC_media_cueopen, err)
+		return
+	}
+	defer content.Close()
+
+	var fi fs.FileInfo
+	if fi, err = content.Stat(); err != nil {
+		Ret500(c, AEC_media_cueopen, err)
+		return
+	}
+
+	var vpath = CueTrackPath(cuepath, &ct)
+	if HasRangeBegin(c.Request) { // beginning of content
+		Log.Infof("id%d: serve track %d of %s", acc.ID, ct.Number, path.Base(cuepath))
+		go InsertOpen(&OpenStore{
+			UAID:    int64(RequestUAID(c)),
+			AID:     acc.ID,
+			UID:     uid,
+			Path:    vpath,
+			Latency: -1,
+		})
+	}
+
+	var ext = GetFileExt(ct.File)
+	if !IsTypeCut(ext) {
+		http.ServeContent(c.Writer, c.Request, ct.File, fi.ModTime(), content)
+		return
+	}
+	var rs io.ReadSeeker
+	if rs, err = AudioCut(content, fi.Size(), ext, ct.Start, ct.End); err != nil {
+		RetErr(c, http.StatusUnsupportedMediaType, AEC_media_cuecut, err)
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, vpath, fi.ModTime(), rs)
+}
+
 // Hands out embedded thumbnails for given files if any.
 func SpiEtmb(c *gin.Context) {
 	var err error
@@ -230,7 +309,7 @@ func SpiEtmb(c *gin.Context) {
 	}
 
 	var md MediaData
-	if md, err = ExtractThmub(syspath); err != nil {
+	if md, err = ExtractThumb(syspath); err != nil {
 		if errors.Is(err, ErrNoThumb) {
 			RetErr(c, http.StatusNoContent, AEC_etmb_notmb, err)
 			return
@@ -281,6 +360,11 @@ func SpiMtmb(c *gin.Context) {
 		return
 	}
 
+	// drop all cached data if file was modified or deleted
+	if fi, _ := JP.Stat(syspath); ThumbPkg.IsOutdated(syspath, fi) {
+		CacheStale(puid, syspath, fi)
+	}
+
 	var file io.ReadSeekCloser
 	var mime string
 	var t time.Time
@@ -338,6 +422,13 @@ func SpiTile(c *gin.Context) {
 		Ret400(c, AEC_tile_zero, ErrArgZDim)
 		return
 	}
+	// serve tile of nearest configured dimensions
+	var spec cfg.CfgTileSpec
+	if spec, ok = NearestTileSpec(wdh, hgt); !ok {
+		Ret404(c, AEC_tile_nospec, ErrNoTileSpec)
+		return
+	}
+	wdh, hgt = spec.Width, spec.Height
 
 	var syspath string
 	if syspath, ok = PathCache.GetDir(puid); !ok {
@@ -354,7 +445,13 @@ func SpiTile(c *gin.Context) {
 		return
 	}
 
-	var tilepath = fmt.Sprintf("%s?%dx%d", syspath, wdh, hgt)
+	var tilepath = TileKey(syspath, wdh, hgt)
+
+	// drop all cached data if file was modified or deleted
+	if fi, _ := JP.Stat(syspath); TilesPkg.IsOutdated(tilepath, fi) {
+		CacheStale(puid, syspath, fi)
+	}
+
 	var file io.ReadSeekCloser
 	var mime string
 	var t time.Time
@@ -246,7 +246,10 @@ func SpiEditRename(c *gin.Context) {
 		Ret500(c, AEC_edtren_stat, err)
 		return
 	}
-	ret.Prop.PuidProp.Setup(session, dstpath)
+	if err = ret.Prop.PuidProp.Setup(session, dstpath); err != nil {
+		Ret500(c, AEC_edtren_store, err)
+		return
+	}
 	ret.Prop.FileProp.Setup(fi)
 	if tp, ok := tilecache.Peek(ret.Prop.PUID); ok {
 		ret.Prop.TileProp = tp
@@ -0,0 +1,99 @@
+package hms
+
+import (
+	"encoding/xml"
+	"io/fs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DupGroup is cluster of near-identical images.
+type DupGroup struct {
+	Paths []string `json:"paths" yaml:"paths" xml:"paths>path"`
+	List  []any    `json:"list" yaml:"list" xml:"list>prop"`
+}
+
+// APIHANDLER
+func SpiDupList(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		Dist *int `json:"dist,omitempty" yaml:"dist,omitempty" xml:"dist,omitempty"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List []DupGroup `json:"list" yaml:"list" xml:"list>group"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_duplist_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_duplist_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_duplist_noacc, ErrNoAcc)
+		return
+	}
+
+	if uid != aid {
+		Ret403(c, AEC_duplist_deny, ErrDeny)
+		return
+	}
+
+	var dist = HashDistDef
+	if arg.Dist != nil {
+		dist = *arg.Dist
+	}
+	if dist < 0 || dist > HashDistMax {
+		Ret400(c, AEC_duplist_baddist, ErrHashDist)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var hss []HashStore
+	if err = session.Find(&hss); err != nil {
+		Ret500(c, AEC_duplist_hashes, err)
+		return
+	}
+
+	for _, cluster := range HashClusters(hss, dist) {
+		var vfiles []fs.FileInfo // verified file infos
+		var vpaths []DiskPath    // verified paths
+		var grp DupGroup
+		for _, puid := range cluster {
+			var fpath, ok = PathStorePath(session, puid)
+			if !ok || Hidden.Fits(fpath) || !acc.PathAccess(fpath, true) {
+				continue
+			}
+			if fi, _ := JP.Stat(fpath); fi != nil {
+				vfiles = append(vfiles, fi)
+				vpaths = append(vpaths, MakeFilePath(fpath))
+				grp.Paths = append(grp.Paths, fpath)
+			}
+		}
+		if len(vfiles) < 2 {
+			continue // file was deleted, or not accessible
+		}
+		if grp.List, _, err = ScanFileInfoList(acc, session, vfiles, vpaths, RequestUAID(c), true); err != nil {
+			Ret500(c, AEC_duplist_list, err)
+			return
+		}
+		ret.List = append(ret.List, grp)
+	}
+
+	RetOk(c, ret)
+}
+
+// The End.
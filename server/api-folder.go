@@ -6,7 +6,6 @@ import (
 	"io/fs"
 	"net"
 	"net/http"
-	"path"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -104,9 +103,50 @@ func SpiFolder(c *gin.Context) {
 	}
 	var ip = net.ParseIP(c.RemoteIP())
 	ret.Access = InPasslist(ip)
+	var cid = RequestUAID(c)
 
 	var t = time.Now()
-	if puid < PUIDcache {
+	if id, ok := SmartPathID(syspath); ok {
+		var sl SmartList
+		if sl, ok = acc.GetSmart(id); !ok {
+			Ret404(c, AEC_folder_nosmart, ErrSmartNone)
+			return
+		}
+		var list []string
+		if list, err = sl.Find(session); err != nil {
+			Ret500(c, AEC_folder_smart, err)
+			return
+		}
+		var vpaths = make([]DiskPath, 0, len(list))
+		for _, fpath := range list {
+			if !Hidden.Fits(fpath) && acc.PathAccess(fpath, uid == aid) {
+				vpaths = append(vpaths, MakeFilePath(fpath))
+			}
+		}
+		ret.Skipped = len(list) - len(vpaths)
+		if ret.List, _, err = ScanFileNameList(acc, session, vpaths, cid, arg.Scan); err != nil {
+			Ret500(c, AEC_folder_smart, err)
+			return
+		}
+		ret.Static = true
+	} else if tid, ok := TagPathID(syspath); ok {
+		if _, ok = TagName(session, tid); !ok {
+			Ret404(c, AEC_folder_notag, ErrTagNone)
+			return
+		}
+		var list []Puid_t
+		if list, err = TagFiles(session, tid); err != nil {
+			Ret500(c, AEC_folder_tag, err)
+			return
+		}
+		var vpaths []DiskPath
+		vpaths, ret.Skipped = StatePaths(session, acc, list, uid == aid)
+		if ret.List, _, err = ScanFileNameList(acc, session, vpaths, cid, arg.Scan); err != nil {
+			Ret500(c, AEC_folder_tag, err)
+			return
+		}
+		ret.Static = true
+	} else if puid < PUIDcache {
 		if uid != aid && !acc.IsShared(syspath) {
 			Ret403(c, AEC_folder_noshr, ErrNotShared)
 			return
@@ -124,9 +164,14 @@ func SpiFolder(c *gin.Context) {
 					}
 				}
 			}
+			if uid == aid {
+				for _, sl := range acc.GetSmartList() {
+					vfiles = append(vfiles, DiskPath{SmartPath(sl.ID), sl.Name})
+				}
+			}
 
 			var dp DirProp
-			if ret.List, dp, err = ScanFileNameList(acc, session, vfiles, arg.Scan); err != nil {
+			if ret.List, dp, err = ScanFileNameList(acc, session, vfiles, cid, arg.Scan); err != nil {
 				Ret500(c, AEC_folder_home, err)
 				return
 			}
@@ -136,22 +181,22 @@ func SpiFolder(c *gin.Context) {
 				return
 			})
 		case PUIDlocal:
-			if ret.List, err = acc.ScanLocal(session, arg.Scan); err != nil {
+			if ret.List, err = acc.ScanLocal(session, cid, arg.Scan); err != nil {
 				Ret500(c, AEC_folder_drives, err)
 				return
 			}
 		case PUIDremote:
-			if ret.List, err = acc.ScanRemote(session, arg.Scan); err != nil {
+			if ret.List, err = acc.ScanRemote(session, cid, arg.Scan); err != nil {
 				Ret500(c, AEC_folder_remote, err)
 				return
 			}
 		case PUIDshares:
-			if ret.List, err = acc.ScanShares(session, arg.Scan); err != nil {
+			if ret.List, err = acc.ScanShares(session, cid, arg.Scan); err != nil {
 				Ret500(c, AEC_folder_shares, err)
 				return
 			}
 		case PUIDmedia, PUIDvideo, PUIDaudio, PUIDimage, PUIDbooks, PUIDtexts:
-			if ret.List, err = ScanCat(acc, session, puid, catcolumn[puid], 0.5, arg.Scan); err != nil {
+			if ret.List, err = ScanCat(acc, session, puid, catcolumn[puid], 0.5, cid, arg.Scan); err != nil {
 				Ret500(c, AEC_folder_media, err)
 				return
 			}
@@ -171,10 +216,48 @@ func SpiFolder(c *gin.Context) {
 				}
 				return Cfg.RangeSearchAny <= 0 || n < Cfg.RangeSearchAny
 			})
-			if ret.List, _, err = ScanFileInfoList(acc, session, vfiles, vpaths, arg.Scan); err != nil {
+			if ret.List, _, err = ScanFileInfoList(acc, session, vfiles, vpaths, cid, arg.Scan); err != nil {
 				Ret500(c, AEC_folder_map, err)
 				return
 			}
+		case PUIDfavs:
+			var list []Puid_t
+			if list, err = FavList(session, aid); err != nil {
+				Ret500(c, AEC_folder_favs, err)
+				return
+			}
+			var vpaths []DiskPath
+			vpaths, ret.Skipped = StatePaths(session, acc, list, uid == aid)
+			if ret.List, _, err = ScanFileNameList(acc, session, vpaths, cid, arg.Scan); err != nil {
+				Ret500(c, AEC_folder_favs, err)
+				return
+			}
+		case PUIDrecent:
+			var list []Puid_t
+			if list, err = RecentList(session, aid, Cfg.RecentNum); err != nil {
+				Ret500(c, AEC_folder_recent, err)
+				return
+			}
+			var vpaths []DiskPath
+			vpaths, ret.Skipped = StatePaths(session, acc, list, uid == aid)
+			if ret.List, _, err = ScanFileNameList(acc, session, vpaths, cid, arg.Scan); err != nil {
+				Ret500(c, AEC_folder_recent, err)
+				return
+			}
+		case PUIDtags:
+			var tags []TagCount
+			if tags, err = TagCloud(session, acc, uid == aid); err != nil {
+				Ret500(c, AEC_folder_tags, err)
+				return
+			}
+			var vpaths = make([]DiskPath, len(tags))
+			for i, tc := range tags {
+				vpaths[i] = DiskPath{TagPath(tc.TID), tc.Name}
+			}
+			if ret.List, _, err = ScanFileNameList(acc, session, vpaths, cid, arg.Scan); err != nil {
+				Ret500(c, AEC_folder_tags, err)
+				return
+			}
 		default:
 			Ret404(c, AEC_folder_nocat, ErrNoCat)
 			return
@@ -194,7 +277,7 @@ func SpiFolder(c *gin.Context) {
 		}
 
 		if fi.IsDir() || IsTypeISO(ext) {
-			if ret.List, ret.Skipped, err = ScanDir(acc, session, syspath, uid == aid, arg.Scan); err != nil && len(ret.List) == 0 {
+			if ret.List, ret.Skipped, err = ScanDir(acc, session, syspath, uid == aid, cid, arg.Scan); err != nil && len(ret.List) == 0 {
 				if errors.Is(err, fs.ErrNotExist) {
 					Ret404(c, AEC_folder_absent, err)
 				} else {
@@ -203,69 +286,38 @@ func SpiFolder(c *gin.Context) {
 				return
 			}
 		} else if IsTypePlaylist(ext) {
-			var file fs.File
-			if file, err = JP.Open(syspath); err != nil {
-				Ret500(c, AEC_folder_open, err)
-				return
-			}
-			defer file.Close()
-
 			var pl Playlist
-			pl.Dest = path.Dir(syspath)
-			switch ext {
-			case ".m3u", ".m3u8":
-				if _, err = pl.ReadM3U(file); err != nil {
-					RetErr(c, http.StatusUnsupportedMediaType, AEC_folder_m3u, err)
-					return
-				}
-			case ".wpl":
-				if _, err = pl.ReadWPL(file); err != nil {
-					RetErr(c, http.StatusUnsupportedMediaType, AEC_folder_wpl, err)
+			if pl, err = PlaylistRead(session, syspath); err != nil {
+				var pe *fs.PathError
+				if errors.As(err, &pe) {
+					Ret500(c, AEC_folder_open, err)
 					return
 				}
-			case ".pls":
-				if _, err = pl.ReadPLS(file); err != nil {
-					RetErr(c, http.StatusUnsupportedMediaType, AEC_folder_pls, err)
-					return
-				}
-			case ".asx":
-				if _, err = pl.ReadASX(file); err != nil {
-					RetErr(c, http.StatusUnsupportedMediaType, AEC_folder_asx, err)
-					return
-				}
-			case ".xspf":
-				if _, err = pl.ReadXSPF(file); err != nil {
-					RetErr(c, http.StatusUnsupportedMediaType, AEC_folder_xspf, err)
-					return
-				}
-			default:
-				RetErr(c, http.StatusUnsupportedMediaType, AEC_folder_format, ErrNotPlay)
+				RetErr(c, http.StatusUnsupportedMediaType, AEC_folder_format, err)
 				return
 			}
 
-			var vfiles []fs.FileInfo // verified file infos
-			var vpaths []DiskPath    // verified paths
-			for _, track := range pl.Tracks {
-				var fpath = ToSlash(track.Location)
-				if !Hidden.Fits(fpath) && acc.PathAccess(fpath, uid == aid) {
-					if fi, _ := JP.Stat(fpath); fi != nil {
-						vfiles = append(vfiles, fi)
-						vpaths = append(vpaths, MakeFilePath(fpath))
-					}
-				}
-			}
-			if ret.List, _, err = ScanFileInfoList(acc, session, vfiles, vpaths, arg.Scan); err != nil {
+			if ret.List, ret.Skipped, err = ScanPlaylist(acc, session, syspath, &pl, uid == aid, cid, arg.Scan); err != nil {
 				Ret500(c, AEC_folder_tracks, err)
 				return
 			}
-			ret.Skipped = len(pl.Tracks) - len(ret.List)
+		} else if IsTypeCue(ext) {
+			var cs CueSheet
+			if cs, err = CueRead(syspath); err != nil {
+				RetErr(c, http.StatusUnsupportedMediaType, AEC_folder_cue, err)
+				return
+			}
+			if ret.List, ret.Skipped, err = ScanCue(acc, session, syspath, &cs, uid == aid); err != nil {
+				Ret500(c, AEC_folder_cuetracks, err)
+				return
+			}
 		}
 	}
 
 	var latency = time.Since(t)
 	Log.Infof("id%d: navigate to %s, items %d, timeout %s", acc.ID, syspath, len(ret.List), latency)
-	go XormUserlog.InsertOne(&OpenStore{
-		UAID:    RequestUAID(c),
+	go InsertOpen(&OpenStore{
+		UAID:    int64(cid),
 		AID:     aid,
 		UID:     uid,
 		Path:    syspath,
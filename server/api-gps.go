@@ -157,7 +157,7 @@ func SpiGpsRange(c *gin.Context) {
 		}
 		return arg.Limit == 0 || len(ret.List) < arg.Limit
 	})
-	if ret.List, _, err = ScanFileInfoList(acc, session, vfiles, vpaths, true); err != nil {
+	if ret.List, _, err = ScanFileInfoList(acc, session, vfiles, vpaths, RequestUAID(c), true); err != nil {
 		Ret500(c, AEC_gpsrange_list, err)
 		return
 	}
@@ -0,0 +1,657 @@
+package hms
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlaylistTrack makes playlist track for file with given system path.
+// Title and duration are taken from cached tags if they are present.
+func PlaylistTrack(session *Session, syspath string) (track Track) {
+	track.Location = syspath
+	var name = path.Base(syspath)
+	track.Title = strings.TrimSuffix(name, path.Ext(name))
+	if puid, ok := PathStorePUID(session, syspath); ok {
+		if tp, ok := Id3StoreGet(session, puid); ok && tp.Title != "" {
+			if tp.Artist != "" {
+				track.Title = tp.Artist + " - " + tp.Title
+			} else {
+				track.Title = tp.Title
+			}
+		}
+		if xp, ok := ExtStoreGet(session, puid); ok && xp.PBLen > 0 {
+			track.Duration = int64(xp.PBLen / time.Millisecond)
+		}
+	}
+	return
+}
+
+// PlaylistCache is parsed playlist with properties
+// of its file content at the moment of reading.
+type PlaylistCache struct {
+	SrcProp
+	Playlist
+}
+
+// PlaylistRead reads playlist file with given system path
+// in format given by its extension. Parsed playlist is cached
+// until file size or modification time is changed.
+func PlaylistRead(session *Session, syspath string) (pl Playlist, err error) {
+	var fi fs.FileInfo
+	if fi, err = JP.Stat(syspath); err != nil {
+		return
+	}
+	var puid, ok = PathStorePUID(session, syspath)
+	if ok {
+		if pc, ok := plcache.Peek(puid); ok && !pc.IsOutdated(fi) {
+			pl = pc.Playlist
+			pl.Tracks = slices.Clone(pl.Tracks)
+			return
+		}
+	}
+
+	var file fs.File
+	if file, err = JP.Open(syspath); err != nil {
+		return
+	}
+	defer file.Close()
+
+	pl.Dest = path.Dir(syspath)
+	if _, err = pl.ReadFormat(file, GetFileExt(syspath)); err != nil {
+		return
+	}
+	if ok {
+		var pc = PlaylistCache{Playlist: pl}
+		pc.SrcProp.Setup(fi)
+		pc.Tracks = slices.Clone(pl.Tracks)
+		plcache.Poke(puid, pc)
+	}
+	return
+}
+
+// PlaylistWrite writes playlist to file with given system path in format
+// given by its extension. Playlist is written to temporary file at first,
+// and then it replaces the original file. Only files at local file system
+// can be written, remote and packed paths are rejected.
+func PlaylistWrite(syspath string, pl *Playlist) (err error) {
+	if IsRemote(syspath) {
+		return ErrPlRemote
+	}
+	var dirpath = path.Dir(syspath)
+	var fi fs.FileInfo
+	if fi, err = os.Stat(dirpath); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%w: %s", ErrPlRemote, dirpath)
+	}
+
+	var dst *os.File
+	if dst, err = os.CreateTemp(dirpath, "~hms-*"+path.Ext(syspath)); err != nil {
+		return
+	}
+	var tmppath = dst.Name()
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(tmppath)
+		}
+	}()
+
+	pl.Dest = dirpath
+	var w = bufio.NewWriter(dst)
+	if _, err = pl.WriteFormat(w, GetFileExt(syspath)); err != nil {
+		return
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	if err = dst.Close(); err != nil {
+		return
+	}
+	os.Chmod(tmppath, 0644)
+	if err = os.Rename(tmppath, syspath); err != nil {
+		return
+	}
+	if puid, ok := PathCache.GetRev(syspath); ok {
+		plcache.Remove(puid)
+	}
+	return
+}
+
+// playlisttracks returns tracks for files with given shared paths.
+// Each file should be accessible for given profile.
+func playlisttracks(acc *Profile, session *Session, list []string) (tracks []Track, err error) {
+	tracks = make([]Track, len(list))
+	for i, shrpath := range list {
+		var syspath string
+		if syspath, _, err = UnfoldPath(session, ToSlash(shrpath)); err != nil {
+			return
+		}
+		if Hidden.Fits(syspath) {
+			err = fmt.Errorf("%w: %s", ErrHidden, shrpath)
+			return
+		}
+		if !acc.PathAccess(syspath, true) {
+			err = fmt.Errorf("%w: %s", ErrNoAccess, shrpath)
+			return
+		}
+		var fi fs.FileInfo
+		if fi, err = JP.Stat(syspath); err != nil {
+			return
+		}
+		if fi.IsDir() {
+			err = fmt.Errorf("%w: %s", ErrPlTrack, shrpath)
+			return
+		}
+		tracks[i] = PlaylistTrack(session, syspath)
+	}
+	return
+}
+
+// APIHANDLER
+// SpiPlaylistSave creates new playlist, or overwrites existing one,
+// in given folder with given list of tracks.
+func SpiPlaylistSave(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		Path  string   `json:"path" yaml:"path" xml:"path" binding:"required"` // destination folder
+		Name  string   `json:"name" yaml:"name" xml:"name" binding:"required"` // playlist file name with extension
+		Title string   `json:"title,omitempty" yaml:"title,omitempty" xml:"title,omitempty"`
+		List  []string `json:"list" yaml:"list" xml:"list>path"` // tracks shared paths
+		Ovw   bool     `json:"overwrite,omitempty" yaml:"overwrite,omitempty" xml:"overwrite,omitempty,attr"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		Prop    FileKit `json:"prop" yaml:"prop" xml:"prop"`
+		List    []any   `json:"list" yaml:"list" xml:"list>prop"`
+		Skipped int     `json:"skipped" yaml:"skipped" xml:"skipped,attr"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_plsave_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_plsave_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_plsave_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_plsave_deny, ErrDeny)
+		return
+	}
+	var ext = GetFileExt(arg.Name)
+	if arg.Name != path.Base(arg.Name) || strings.ContainsAny(arg.Name, `/\`) || PlaylistMime[ext] == "" {
+		Ret400(c, AEC_plsave_badname, ErrPlName)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var dirpath string
+	if dirpath, _, err = UnfoldPath(session, ToSlash(arg.Path)); err != nil {
+		Ret400(c, AEC_plsave_badpath, err)
+		return
+	}
+	if Hidden.Fits(dirpath) {
+		Ret403(c, AEC_plsave_hidden, ErrHidden)
+		return
+	}
+	if !acc.PathAccess(dirpath, true) {
+		Ret403(c, AEC_plsave_access, ErrNoAccess)
+		return
+	}
+	var fi fs.FileInfo
+	if fi, err = JP.Stat(dirpath); err != nil {
+		Ret404(c, AEC_plsave_stat, err)
+		return
+	}
+	if !fi.IsDir() {
+		Ret400(c, AEC_plsave_notdir, ErrNotDir)
+		return
+	}
+
+	var pl = Playlist{
+		Title: arg.Title,
+	}
+	if pl.Tracks, err = playlisttracks(acc, session, arg.List); err != nil {
+		Ret400(c, AEC_plsave_badtrack, err)
+		return
+	}
+
+	// generate unique playlist filename
+	var syspath = JoinPath(dirpath, arg.Name)
+	if !arg.Ovw {
+		var org = syspath[:len(syspath)-len(path.Ext(syspath))]
+		var i = 1
+		for {
+			if _, err = os.Stat(syspath); errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			i++
+			syspath = fmt.Sprintf("%s (%d)%s", org, i, path.Ext(arg.Name))
+			if i > 100 {
+				err = ErrFileOver
+				Ret500(c, AEC_plsave_over, err)
+				return
+			}
+		}
+	}
+
+	if err = PlaylistWrite(syspath, &pl); err != nil {
+		if errors.Is(err, ErrPlRemote) {
+			Ret403(c, AEC_plsave_remote, err)
+			return
+		}
+		Ret500(c, AEC_plsave_write, err)
+		return
+	}
+	if fi, err = JP.Stat(syspath); err != nil {
+		Ret500(c, AEC_plsave_write, err)
+		return
+	}
+	if err = ret.Prop.PuidProp.Setup(session, syspath); err != nil {
+		Ret500(c, AEC_plsave_store, err)
+		return
+	}
+	ret.Prop.FileProp.Setup(fi)
+	if ret.List, ret.Skipped, err = ScanPlaylist(acc, session, syspath, &pl, true, RequestUAID(c), false); err != nil {
+		Ret500(c, AEC_plsave_tracks, err)
+		return
+	}
+	Log.Infof("id%d: playlist %s saved with %d tracks", acc.ID, syspath, len(pl.Tracks))
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiPlaylistEdit modifies tracks list of existing playlist. At first
+// tracks at given indexes are removed, then remained tracks are reordered,
+// and then new tracks are inserted at given position.
+func SpiPlaylistEdit(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		Path   string   `json:"path" yaml:"path" xml:"path" binding:"required"`               // playlist file
+		Title  *string  `json:"title,omitempty" yaml:"title,omitempty" xml:"title,omitempty"` // new title if it given
+		Remove []int    `json:"remove,omitempty" yaml:"remove,omitempty" xml:"remove>idx"`    // indexes of tracks to remove
+		Order  []int    `json:"order,omitempty" yaml:"order,omitempty" xml:"order>idx"`       // new order of remained tracks
+		Add    []string `json:"add,omitempty" yaml:"add,omitempty" xml:"add>path"`            // shared paths of tracks to insert
+		Pos    *int     `json:"pos,omitempty" yaml:"pos,omitempty" xml:"pos,omitempty,attr"`  // insert position, tracks are appended if it's absent
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List    []any `json:"list" yaml:"list" xml:"list>prop"`
+		Skipped int   `json:"skipped" yaml:"skipped" xml:"skipped,attr"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_pledit_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_pledit_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_pledit_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_pledit_deny, ErrDeny)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var syspath string
+	if syspath, _, err = UnfoldPath(session, ToSlash(arg.Path)); err != nil {
+		Ret400(c, AEC_pledit_badpath, err)
+		return
+	}
+	if Hidden.Fits(syspath) {
+		Ret403(c, AEC_pledit_hidden, ErrHidden)
+		return
+	}
+	if !acc.PathAccess(syspath, true) {
+		Ret403(c, AEC_pledit_access, ErrNoAccess)
+		return
+	}
+
+	var pl Playlist
+	if pl, err = PlaylistRead(session, syspath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			Ret404(c, AEC_pledit_read, err)
+			return
+		}
+		RetErr(c, http.StatusUnsupportedMediaType, AEC_pledit_read, err)
+		return
+	}
+	if arg.Title != nil {
+		pl.Title = *arg.Title
+	}
+
+	// remove tracks
+	if len(arg.Remove) > 0 {
+		var del = make([]bool, len(pl.Tracks))
+		for _, i := range arg.Remove {
+			if i < 0 || i >= len(pl.Tracks) {
+				Ret400(c, AEC_pledit_remove, ErrPlIndex)
+				return
+			}
+			del[i] = true
+		}
+		var tracks = make([]Track, 0, len(pl.Tracks))
+		for i, track := range pl.Tracks {
+			if !del[i] {
+				tracks = append(tracks, track)
+			}
+		}
+		pl.Tracks = tracks
+	}
+
+	// reorder tracks
+	if len(arg.Order) > 0 {
+		if len(arg.Order) != len(pl.Tracks) {
+			Ret400(c, AEC_pledit_order, ErrPlOrder)
+			return
+		}
+		var used = make([]bool, len(pl.Tracks))
+		var tracks = make([]Track, len(pl.Tracks))
+		for i, j := range arg.Order {
+			if j < 0 || j >= len(pl.Tracks) || used[j] {
+				Ret400(c, AEC_pledit_order, ErrPlOrder)
+				return
+			}
+			used[j] = true
+			tracks[i] = pl.Tracks[j]
+		}
+		pl.Tracks = tracks
+	}
+
+	// insert new tracks
+	if len(arg.Add) > 0 {
+		var tracks []Track
+		if tracks, err = playlisttracks(acc, session, arg.Add); err != nil {
+			Ret400(c, AEC_pledit_badtrack, err)
+			return
+		}
+		var pos = len(pl.Tracks)
+		if arg.Pos != nil && *arg.Pos >= 0 && *arg.Pos < pos {
+			pos = *arg.Pos
+		}
+		pl.Tracks = slices.Insert(pl.Tracks, pos, tracks...)
+	}
+
+	if err = PlaylistWrite(syspath, &pl); err != nil {
+		if errors.Is(err, ErrPlRemote) {
+			Ret403(c, AEC_pledit_remote, err)
+			return
+		}
+		Ret500(c, AEC_pledit_write, err)
+		return
+	}
+	if ret.List, ret.Skipped, err = ScanPlaylist(acc, session, syspath, &pl, true, RequestUAID(c), false); err != nil {
+		Ret500(c, AEC_pledit_tracks, err)
+		return
+	}
+	Log.Infof("id%d: playlist %s edited, %d tracks", acc.ID, syspath, len(pl.Tracks))
+
+	RetOk(c, ret)
+}
+
+// mediafiles returns media files of given directory
+// that are accessible for given profile.
+func mediafiles(acc *Profile, dir string, self bool) (list []string, err error) {
+	var files []fs.DirEntry
+	if files, err = JP.ReadDir(dir); err != nil && len(files) == 0 {
+		return
+	}
+	err = nil
+	for _, de := range files {
+		if de.IsDir() {
+			continue
+		}
+		var fpath = JoinPath(dir, de.Name())
+		if grp := GetFileGroup(fpath); grp != FGaudio && grp != FGvideo {
+			continue
+		}
+		if !Hidden.Fits(fpath) && acc.PathAccess(fpath, self) {
+			list = append(list, fpath)
+		}
+	}
+	return
+}
+
+// APIHANDLER
+// SpiPlaylistDownload converts playlist, folder or media category
+// to playlist of given format with absolute URLs of tracks, so it
+// can be opened by external players to stream files from server.
+func SpiPlaylistDownload(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		Path   string `json:"path" yaml:"path" xml:"path" form:"path" binding:"required"`
+		Format string `json:"format" yaml:"format" xml:"format" form:"format"` // extension of playlist format, "m3u8" by default
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_pldown_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_pldown_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_pldown_noacc, ErrNoAcc)
+		return
+	}
+	var ext = "." + strings.TrimPrefix(ToLower(arg.Format), ".")
+	if arg.Format == "" {
+		ext = ".m3u8"
+	}
+	var mime string
+	if mime, ok = PlaylistMime[ext]; !ok {
+		Ret400(c, AEC_pldown_format, ErrPlName)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var syspath string
+	var puid Puid_t
+	if syspath, puid, err = UnfoldPath(session, ToSlash(arg.Path)); err != nil {
+		Ret400(c, AEC_pldown_badpath, err)
+		return
+	}
+	if Hidden.Fits(syspath) {
+		Ret403(c, AEC_pldown_hidden, ErrHidden)
+		return
+	}
+	if !acc.PathAccess(syspath, uid == aid) {
+		Ret403(c, AEC_pldown_access, ErrNoAccess)
+		return
+	}
+
+	var pl Playlist
+	if id, ok := SmartPathID(syspath); ok {
+		var sl SmartList
+		if sl, ok = acc.GetSmart(id); !ok {
+			Ret404(c, AEC_pldown_nosmart, ErrSmartNone)
+			return
+		}
+		pl.Title = sl.Name
+		var list []string
+		if list, err = sl.Find(session); err != nil {
+			Ret500(c, AEC_pldown_smart, err)
+			return
+		}
+		for _, fpath := range list {
+			if !Hidden.Fits(fpath) && acc.PathAccess(fpath, uid == aid) {
+				pl.Tracks = append(pl.Tracks, PlaylistTrack(session, fpath))
+			}
+		}
+	} else if puid < PUIDcache {
+		if uid != aid && !acc.IsShared(syspath) {
+			Ret403(c, AEC_pldown_noshr, ErrNotShared)
+			return
+		}
+		var cat string
+		switch puid {
+		case PUIDmedia, PUIDvideo, PUIDaudio:
+			cat = catcolumn[puid]
+		default:
+			Ret404(c, AEC_pldown_nocat, ErrNoCat)
+			return
+		}
+		pl.Title = CatNames[syspath]
+		var dss []DirStore
+		if err = session.Where(fmt.Sprintf("(%s) > ? * (other+video+audio+image+books+texts+packs)", cat), 0.5).Find(&dss); err != nil {
+			Ret500(c, AEC_pldown_list, err)
+			return
+		}
+		for _, ds := range dss {
+			var dir string
+			if dir, ok = PathStorePath(session, ds.Puid); !ok || Hidden.Fits(dir) || !acc.PathAccess(dir, uid == aid) {
+				continue
+			}
+			var files, _ = mediafiles(acc, dir, uid == aid)
+			for _, fpath := range files {
+				pl.Tracks = append(pl.Tracks, PlaylistTrack(session, fpath))
+			}
+		}
+	} else {
+		var fi fs.FileInfo
+		if fi, err = JP.Stat(syspath); err != nil {
+			Ret404(c, AEC_pldown_stat, err)
+			return
+		}
+		pl.Title = path.Base(syspath)
+		if fi.IsDir() || IsTypeISO(GetFileExt(syspath)) {
+			var files []string
+			if files, err = mediafiles(acc, syspath, uid == aid); err != nil {
+				Ret500(c, AEC_pldown_list, err)
+				return
+			}
+			for _, fpath := range files {
+				pl.Tracks = append(pl.Tracks, PlaylistTrack(session, fpath))
+			}
+		} else if IsTypeCue(GetFileExt(syspath)) {
+			var cs CueSheet
+			if cs, err = CueRead(syspath); err != nil {
+				RetErr(c, http.StatusUnsupportedMediaType, AEC_pldown_read, err)
+				return
+			}
+			if cs.Title != "" {
+				pl.Title = cs.Title
+			}
+			for _, ct := range cs.Tracks {
+				if Hidden.Fits(ct.File) || !acc.PathAccess(ct.File, uid == aid) {
+					continue
+				}
+				var title = ct.Title
+				if ct.Performer != "" && title != "" {
+					title = ct.Performer + " - " + title
+				}
+				pl.Tracks = append(pl.Tracks, Track{
+					Title:    title,
+					Location: CueTrackPath(syspath, &ct),
+					Duration: int64(ct.Duration() / time.Millisecond),
+				})
+			}
+		} else {
+			var src Playlist
+			if src, err = PlaylistRead(session, syspath); err != nil {
+				RetErr(c, http.StatusUnsupportedMediaType, AEC_pldown_read, err)
+				return
+			}
+			if src.Title != "" {
+				pl.Title = src.Title
+			}
+			for _, track := range src.Tracks {
+				if isURL(track.Location) {
+					pl.Tracks = append(pl.Tracks, track)
+					continue
+				}
+				var fpath = ToSlash(track.Location)
+				if !Hidden.Fits(fpath) && acc.PathAccess(fpath, uid == aid) {
+					if fi, _ := JP.Stat(fpath); fi != nil && !fi.IsDir() {
+						track.Location = fpath
+						pl.Tracks = append(pl.Tracks, track)
+					}
+				}
+			}
+		}
+	}
+
+	// make absolute URLs of tracks
+	var scheme = "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	for i, track := range pl.Tracks {
+		if isURL(track.Location) {
+			continue
+		}
+		var fpuid Puid_t
+		if fpuid, err = PathStoreCache(session, track.Location); err != nil {
+			Ret500(c, AEC_pldown_store, err)
+			return
+		}
+		pl.Tracks[i].Location = fmt.Sprintf("%s://%s/id%d/file/%s", scheme, c.Request.Host, aid, fpuid)
+	}
+
+	var name = strings.TrimSuffix(path.Base(syspath), path.Ext(syspath))
+	if _, ok := SmartPathID(syspath); ok || puid < PUIDcache {
+		name = pl.Title
+	}
+	c.Header("Server", serverhdr)
+	c.Header("Content-Type", mime+"; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s%s"`, strings.ReplaceAll(name, `"`, `'`), ext))
+	c.Status(http.StatusOK)
+	if _, err = pl.WriteFormat(c.Writer, ext); err != nil {
+		Log.Errorf("id%d: playlist %s download failed: %s", acc.ID, syspath, err.Error())
+		return
+	}
+	Log.Infof("id%d: playlist of %s downloaded in %s format, %d tracks", acc.ID, syspath, ext, len(pl.Tracks))
+}
+
+// The End.
@@ -68,7 +68,10 @@ func SpiDriveAdd(c *gin.Context) {
 		if syspath[len(syspath)-1] == ':' { // syspath here is always have non zero length
 			syspath += "/"
 		}
-		puid = PathStoreCache(session, syspath)
+		if puid, err = PathStoreCache(session, syspath); err != nil {
+			Ret500(c, AEC_drvadd_store, err)
+			return
+		}
 	} else {
 		if syspath, puid, err = UnfoldPath(session, fpath); err != nil {
 			Ret400(c, AEC_drvadd_badpath, err)
@@ -298,7 +301,10 @@ func SpiCloudAdd(c *gin.Context) {
 	}
 
 	var fk FileKit
-	fk.PUID = PathStoreCache(session, surl)
+	if fk.PUID, err = PathStoreCache(session, surl); err != nil {
+		Ret500(c, AEC_cldadd_store, err)
+		return
+	}
 	fk.Free = acc.PathAccess(surl, false)
 	fk.Shared = acc.IsShared(surl)
 	fk.Static = false
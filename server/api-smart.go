@@ -0,0 +1,167 @@
+package hms
+
+import (
+	"encoding/xml"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SmartKit is smart playlist with PUID of its virtual folder.
+type SmartKit struct {
+	PUID      Puid_t `json:"puid" yaml:"puid" xml:"puid,attr"`
+	SmartList `yaml:",inline"`
+}
+
+// APIHANDLER
+// SpiSmartList returns smart playlists of profile.
+func SpiSmartList(c *gin.Context) {
+	var err error
+	var ok bool
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List []SmartKit `json:"list" yaml:"list" xml:"list>smart"`
+	}
+
+	// get arguments
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_smartlist_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_smartlist_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_smartlist_deny, ErrDeny)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var list = acc.GetSmartList()
+	ret.List = make([]SmartKit, len(list))
+	for i, sl := range list {
+		var puid Puid_t
+		if puid, err = PathStoreCache(session, SmartPath(sl.ID)); err != nil {
+			Ret500(c, AEC_smartlist_store, err)
+			return
+		}
+		ret.List[i] = SmartKit{
+			PUID:      puid,
+			SmartList: sl,
+		}
+	}
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiSmartSet creates new smart playlist if ID is zero,
+// or replaces existing smart playlist with given ID.
+func SpiSmartSet(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		SmartList `yaml:",inline"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		SmartKit `yaml:",inline"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_smartset_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_smartset_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_smartset_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_smartset_deny, ErrDeny)
+		return
+	}
+	if err = arg.Check(); err != nil {
+		Ret400(c, AEC_smartset_rules, err)
+		return
+	}
+
+	if arg.ID, ok = acc.SetSmart(arg.SmartList); !ok {
+		Ret404(c, AEC_smartset_nosmart, ErrSmartNone)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	if ret.PUID, err = PathStoreCache(session, SmartPath(arg.ID)); err != nil {
+		Ret500(c, AEC_smartset_store, err)
+		return
+	}
+	ret.SmartList = arg.SmartList
+	Log.Infof("id%d: set smart playlist %d '%s'", acc.ID, arg.ID, arg.Name)
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiSmartDel deletes smart playlist with given ID.
+func SpiSmartDel(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		ID uint64 `json:"id" yaml:"id" xml:"id,attr" binding:"required"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		Deleted bool `json:"deleted" yaml:"deleted" xml:"deleted"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_smartdel_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_smartdel_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_smartdel_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_smartdel_deny, ErrDeny)
+		return
+	}
+
+	if ret.Deleted = acc.DelSmart(arg.ID); ret.Deleted {
+		Log.Infof("id%d: delete smart playlist %d", acc.ID, arg.ID)
+	}
+
+	RetOk(c, ret)
+}
+
+// The End.
@@ -0,0 +1,241 @@
+package hms
+
+import (
+	"encoding/xml"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIHANDLER
+// SpiStateGet returns favorite flags and playback positions of given files.
+func SpiStateGet(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		List []Puid_t `json:"list" yaml:"list" xml:"list>puid" binding:"required"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List []FileState `json:"list" yaml:"list" xml:"list>state"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_stateget_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_stateget_badacc, ErrNoAcc)
+		return
+	}
+	if _, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_stateget_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_stateget_deny, ErrDeny)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	if ret.List, err = StateGet(session, aid, arg.List); err != nil {
+		Ret500(c, AEC_stateget_fail, err)
+		return
+	}
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiStateFav stars or unstars file or folder with given PUID.
+func SpiStateFav(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		PUID Puid_t `json:"puid" yaml:"puid" xml:"puid,attr" binding:"required"`
+		Fav  bool   `json:"fav" yaml:"fav" xml:"fav,attr"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		PUID Puid_t `json:"puid" yaml:"puid" xml:"puid,attr"`
+		Fav  bool   `json:"fav" yaml:"fav" xml:"fav,attr"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_statefav_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_statefav_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_statefav_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_statefav_deny, ErrDeny)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	if arg.Fav {
+		var syspath string
+		if syspath, ok = PathStorePath(session, arg.PUID); !ok {
+			Ret404(c, AEC_statefav_nopath, ErrNoPath)
+			return
+		}
+		if Hidden.Fits(syspath) {
+			Ret403(c, AEC_statefav_hidden, ErrHidden)
+			return
+		}
+		if !acc.PathAccess(syspath, true) {
+			Ret403(c, AEC_statefav_access, ErrNoAccess)
+			return
+		}
+	}
+
+	if err = FavSet(session, aid, arg.PUID, arg.Fav); err != nil {
+		Ret500(c, AEC_statefav_fail, err)
+		return
+	}
+	ret.PUID, ret.Fav = arg.PUID, arg.Fav
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiStatePlay saves playback position of media file with given PUID,
+// and puts it to recently played files.
+func SpiStatePlay(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		PUID Puid_t `json:"puid" yaml:"puid" xml:"puid,attr" binding:"required"`
+		Pos  int64  `json:"pos" yaml:"pos" xml:"pos,attr"` // playback position, in milliseconds
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		FileState `yaml:",inline"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_stateplay_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_stateplay_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_stateplay_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_stateplay_deny, ErrDeny)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var syspath string
+	if syspath, ok = PathStorePath(session, arg.PUID); !ok {
+		Ret404(c, AEC_stateplay_nopath, ErrNoPath)
+		return
+	}
+	if Hidden.Fits(syspath) {
+		Ret403(c, AEC_stateplay_hidden, ErrHidden)
+		return
+	}
+	if !acc.PathAccess(syspath, true) {
+		Ret403(c, AEC_stateplay_access, ErrNoAccess)
+		return
+	}
+
+	if err = PlaySet(session, aid, arg.PUID, max(arg.Pos, 0), Cfg.RecentNum); err != nil {
+		Ret500(c, AEC_stateplay_fail, err)
+		return
+	}
+	var list []FileState
+	if list, err = StateGet(session, aid, []Puid_t{arg.PUID}); err != nil {
+		Ret500(c, AEC_stateplay_fail, err)
+		return
+	}
+	ret.FileState = list[0]
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiStateForget removes given files from recently played files
+// with their playback positions, or removes all files if list is empty.
+func SpiStateForget(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		List []Puid_t `json:"list" yaml:"list" xml:"list>puid"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		Deleted int64 `json:"deleted" yaml:"deleted" xml:"deleted"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_stateforget_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_stateforget_badacc, ErrNoAcc)
+		return
+	}
+	if _, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_stateforget_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_stateforget_deny, ErrDeny)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	if ret.Deleted, err = PlayDel(session, aid, arg.List); err != nil {
+		Ret500(c, AEC_stateforget_fail, err)
+		return
+	}
+
+	RetOk(c, ret)
+}
+
+// The End.
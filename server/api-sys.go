@@ -1,6 +1,7 @@
 package hms
 
 import (
+	"context"
 	"encoding/xml"
 	"errors"
 	"io"
@@ -42,6 +43,42 @@ func SpiReload(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+// APIHANDLER
+func SpiCompact(c *gin.Context) {
+	var err error
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		Thumb CompactStat `json:"thumb" yaml:"thumb" xml:"thumb"`
+		Tiles CompactStat `json:"tiles" yaml:"tiles" xml:"tiles"`
+	}
+
+	// run in background context to finish it if client disconnects
+	var ctx = context.Background()
+	if ret.Thumb, err = ThumbPkg.Compact(ctx); err != nil {
+		if errors.Is(err, ErrCompactRun) {
+			RetErr(c, http.StatusConflict, AEC_compact_run, err)
+			return
+		}
+		Ret500(c, AEC_compact_thumb, err)
+		return
+	}
+	Log.Infof("package '%s' compacted: %d files kept, %d removed, size %d -> %d bytes",
+		TmbFile, ret.Thumb.Count, ret.Thumb.Removed, ret.Thumb.OldSize, ret.Thumb.NewSize)
+	if ret.Tiles, err = TilesPkg.Compact(ctx); err != nil {
+		if errors.Is(err, ErrCompactRun) {
+			RetErr(c, http.StatusConflict, AEC_compact_run, err)
+			return
+		}
+		Ret500(c, AEC_compact_tiles, err)
+		return
+	}
+	Log.Infof("package '%s' compacted: %d files kept, %d removed, size %d -> %d bytes",
+		TilFile, ret.Tiles.Count, ret.Tiles.Removed, ret.Tiles.OldSize, ret.Tiles.NewSize)
+
+	RetOk(c, ret)
+}
+
 // Static service system information.
 func SpiServInfo(c *gin.Context) {
 	var ret = gin.H{
@@ -147,6 +184,16 @@ func SpiCachesInfo(c *gin.Context) {
 	RetOk(c, ret)
 }
 
+// Get images processing queue state snapshot.
+func SpiScanQueue(c *gin.Context) {
+	RetOk(c, ImgScanner.Stat())
+}
+
+// Get background scanning state snapshot.
+func SpiBgScan(c *gin.Context) {
+	RetOk(c, BgScanState())
+}
+
 // Returns log items.
 func SpiGetLog(c *gin.Context) {
 	var err error
@@ -0,0 +1,186 @@
+package hms
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIHANDLER
+func SpiEditTags(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		PUID Puid_t   `json:"puid" yaml:"puid" xml:"puid,attr" binding:"required"`
+		Tags TagsEdit `json:"tags" yaml:"tags" xml:"tags"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		Prop any `json:"prop" yaml:"prop" xml:"prop"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_edttags_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_edttags_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_edttags_noacc, ErrNoAcc)
+		return
+	}
+
+	if uid != aid {
+		Ret403(c, AEC_edttags_deny, ErrDeny)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var syspath string
+	if syspath, ok = PathStorePath(session, arg.PUID); !ok {
+		Ret400(c, AEC_edttags_badpath, ErrNoPath)
+		return
+	}
+
+	if Hidden.Fits(syspath) {
+		Ret403(c, AEC_edttags_hidden, ErrHidden)
+		return
+	}
+	if !acc.PathAccess(syspath, true) {
+		Ret403(c, AEC_edttags_access, ErrNoAccess)
+		return
+	}
+
+	if err = TagsWrite(syspath, &arg.Tags); err != nil {
+		if errors.Is(err, ErrTagsFmt) || errors.Is(err, ErrCoverFmt) {
+			Ret400(c, AEC_edttags_format, err)
+			return
+		}
+		if errors.Is(err, ErrTagsNum) || errors.Is(err, ErrTagsSum) {
+			Ret400(c, AEC_edttags_number, err)
+			return
+		}
+		Ret500(c, AEC_edttags_write, err)
+		return
+	}
+
+	// drop outdated thumbnails and refresh database
+	CacheDrop(arg.PUID, syspath)
+	if _, err = session.ID(arg.PUID).Delete(&Id3Store{}); err != nil {
+		Ret500(c, AEC_edttags_extract, err)
+		return
+	}
+
+	var buf StoreBuf
+	buf.Init(1) // flush on every push
+
+	if ret.Prop, _, err = TagsExtract(syspath, session, &buf, &ExtStat{}, true); err != nil {
+		if !errors.Is(err, io.EOF) {
+			Ret500(c, AEC_edttags_extract, err)
+			return
+		}
+	}
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+func SpiEditExif(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		PUID Puid_t   `json:"puid" yaml:"puid" xml:"puid,attr" binding:"required"`
+		Exif ExifEdit `json:"exif" yaml:"exif" xml:"exif"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		Prop any `json:"prop" yaml:"prop" xml:"prop"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_edtexif_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_edtexif_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_edtexif_noacc, ErrNoAcc)
+		return
+	}
+
+	if uid != aid {
+		Ret403(c, AEC_edtexif_deny, ErrDeny)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var syspath string
+	if syspath, ok = PathStorePath(session, arg.PUID); !ok {
+		Ret400(c, AEC_edtexif_badpath, ErrNoPath)
+		return
+	}
+
+	if Hidden.Fits(syspath) {
+		Ret403(c, AEC_edtexif_hidden, ErrHidden)
+		return
+	}
+	if !acc.PathAccess(syspath, true) {
+		Ret403(c, AEC_edtexif_access, ErrNoAccess)
+		return
+	}
+
+	if err = ExifWrite(syspath, &arg.Exif); err != nil {
+		if errors.Is(err, ErrExifFmt) || errors.Is(err, ErrExifOrint) || errors.Is(err, ErrExifGps) {
+			Ret400(c, AEC_edtexif_format, err)
+			return
+		}
+		Ret500(c, AEC_edtexif_write, err)
+		return
+	}
+
+	// drop outdated thumbnails, tiles, GPS and refresh database
+	CacheDrop(arg.PUID, syspath)
+	GpsCache.Remove(arg.PUID)
+	if _, err = session.ID(arg.PUID).Delete(&ExifStore{}); err != nil {
+		Ret500(c, AEC_edtexif_extract, err)
+		return
+	}
+
+	var buf StoreBuf
+	buf.Init(1) // flush on every push
+
+	if ret.Prop, _, err = TagsExtract(syspath, session, &buf, &ExtStat{}, true); err != nil {
+		if !errors.Is(err, io.EOF) {
+			Ret500(c, AEC_edtexif_extract, err)
+			return
+		}
+	}
+
+	RetOk(c, ret)
+}
+
+// The End.
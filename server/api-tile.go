@@ -67,6 +67,7 @@ func SpiTagsStart(c *gin.Context) {
 	var arg struct {
 		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
 		List    []Puid_t `json:"list" yaml:"list" xml:"list>tiletm" binding:"required"`
+		Vis     bool     `json:"vis,omitempty" yaml:"vis,omitempty" xml:"vis,omitempty,attr"`
 	}
 
 	// get arguments
@@ -75,8 +76,13 @@ func SpiTagsStart(c *gin.Context) {
 		return
 	}
 
+	var cid = RequestUAID(c)
+	var prio = PrioPage
+	if arg.Vis {
+		prio = PrioVisible
+	}
 	for _, puid := range arg.List {
-		ImgScanner.AddTags(puid)
+		ImgScanner.AddTags(puid, cid, prio)
 	}
 
 	c.Status(http.StatusOK)
@@ -104,21 +110,22 @@ func SpiTagsBreak(c *gin.Context) {
 }
 
 // Check whether tiles of pointed images prepared.
+// Empty dimensions refers to thumbnail.
 func SpiTileCheck(c *gin.Context) {
-	type tiletm struct {
+	type tiledim struct {
 		PUID Puid_t `json:"puid" yaml:"puid" xml:"puid,attr"`
-		TM   TM_t   `json:"tm" yaml:"tm" xml:"tm,omitempty,attr"`
+		Dim  string `json:"dim,omitempty" yaml:"dim,omitempty" xml:"dim,omitempty,attr"`
 	}
 	type tilemime struct {
 		PUID Puid_t `json:"puid" yaml:"puid" xml:"puid,attr"`
-		TM   TM_t   `json:"tm" yaml:"tm" xml:"tm,omitempty,attr"`
+		Dim  string `json:"dim,omitempty" yaml:"dim,omitempty" xml:"dim,omitempty,attr"`
 		Mime Mime_t `json:"mime,omitempty" yaml:"mime,omitempty" xml:"mime,omitempty,attr"`
 	}
 	var err error
 	var ok bool
 	var arg struct {
-		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
-		List    []tiletm `json:"list" yaml:"list" xml:"list>puid" binding:"required"`
+		XMLName xml.Name  `json:"-" yaml:"-" xml:"arg"`
+		List    []tiledim `json:"list" yaml:"list" xml:"list>puid" binding:"required"`
 	}
 	var ret struct {
 		XMLName xml.Name   `json:"-" yaml:"-" xml:"ret"`
@@ -146,33 +153,40 @@ func SpiTileCheck(c *gin.Context) {
 	defer session.Close()
 
 	ret.List = make([]tilemime, len(arg.List))
-	for i, ttm := range arg.List {
+	for i, td := range arg.List {
 		var mime = MimeDis // disable if no access
-		if syspath, ok := PathStorePath(session, ttm.PUID); ok {
+		if syspath, ok := PathStorePath(session, td.PUID); ok {
 			if acc.PathAccess(syspath, uid == aid) {
-				if tp, ok := tilecache.Peek(ttm.PUID); ok {
-					mime, _ = tp.Tile(ttm.TM)
+				if tp, ok := tilecache.Peek(td.PUID); ok {
+					if td.Dim == "" {
+						mime = tp.Thumb()
+					} else if wdh, hgt, err := ParseTileDim(td.Dim); err == nil {
+						mime, _ = tp.Tile(wdh, hgt)
+					}
 				} else {
 					mime = MimeNil // not cached yet
 				}
 			}
 		}
-		ret.List[i].PUID, ret.List[i].TM, ret.List[i].Mime = ttm.PUID, ttm.TM, mime
+		ret.List[i].PUID, ret.List[i].Dim, ret.List[i].Mime = td.PUID, td.Dim, mime
 	}
 
 	RetOk(c, ret)
 }
 
 // Start to preparing tiles of pointed images.
+// Empty dimensions refers to thumbnail. Images displayed
+// on client screen are processed at first.
 func SpiTileStart(c *gin.Context) {
-	type tiletm struct {
+	type tiledim struct {
 		PUID Puid_t `json:"puid" yaml:"puid" xml:"puid,attr"`
-		TM   TM_t   `json:"tm,omitempty" yaml:"tm,omitempty" xml:"tm,omitempty,attr"`
+		Dim  string `json:"dim,omitempty" yaml:"dim,omitempty" xml:"dim,omitempty,attr"`
+		Vis  bool   `json:"vis,omitempty" yaml:"vis,omitempty" xml:"vis,omitempty,attr"`
 	}
 	var err error
 	var arg struct {
-		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
-		List    []tiletm `json:"list" yaml:"list" xml:"list>tiletm" binding:"required"`
+		XMLName xml.Name  `json:"-" yaml:"-" xml:"arg"`
+		List    []tiledim `json:"list" yaml:"list" xml:"list>tiledim" binding:"required"`
 	}
 
 	// get arguments
@@ -181,23 +195,35 @@ func SpiTileStart(c *gin.Context) {
 		return
 	}
 
-	for _, ttm := range arg.List {
-		ImgScanner.AddTile(ttm.PUID, ttm.TM)
+	var cid = RequestUAID(c)
+	for _, td := range arg.List {
+		var prio = PrioPage
+		if td.Vis {
+			prio = PrioVisible
+		}
+		if td.Dim == "" {
+			ImgScanner.AddThumb(td.PUID, cid, prio)
+		} else if wdh, hgt, err := ParseTileDim(td.Dim); err == nil {
+			if _, ok := GetTileSpec(wdh, hgt); ok {
+				ImgScanner.AddTile(td.PUID, wdh, hgt, cid, prio)
+			}
+		}
 	}
 
 	c.Status(http.StatusOK)
 }
 
 // Break preparing tiles of pointed images.
+// Empty dimensions refers to thumbnail.
 func SpiTileBreak(c *gin.Context) {
-	type tiletm struct {
+	type tiledim struct {
 		PUID Puid_t `json:"puid" yaml:"puid" xml:"puid,attr"`
-		TM   TM_t   `json:"tm,omitempty" yaml:"tm,omitempty" xml:"tm,omitempty,attr"`
+		Dim  string `json:"dim,omitempty" yaml:"dim,omitempty" xml:"dim,omitempty,attr"`
 	}
 	var err error
 	var arg struct {
-		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
-		List    []tiletm `json:"list" yaml:"list" xml:"list>tiletm" binding:"required"`
+		XMLName xml.Name  `json:"-" yaml:"-" xml:"arg"`
+		List    []tiledim `json:"list" yaml:"list" xml:"list>tiledim" binding:"required"`
 	}
 
 	// get arguments
@@ -206,8 +232,14 @@ func SpiTileBreak(c *gin.Context) {
 		return
 	}
 
-	for _, ttm := range arg.List {
-		ImgScanner.RemoveTile(ttm.PUID, ttm.TM)
+	for _, td := range arg.List {
+		if td.Dim == "" {
+			ImgScanner.RemoveThumb(td.PUID)
+		} else if wdh, hgt, err := ParseTileDim(td.Dim); err == nil {
+			if _, ok := GetTileSpec(wdh, hgt); ok {
+				ImgScanner.RemoveTile(td.PUID, wdh, hgt)
+			}
+		}
 	}
 
 	c.Status(http.StatusOK)
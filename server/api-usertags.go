@@ -0,0 +1,287 @@
+package hms
+
+import (
+	"encoding/xml"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tagaccess returns PUIDs of files from given list that are present
+// at storage and accessible by profile, and number of skipped files.
+func tagaccess(session *Session, prf *Profile, list []Puid_t, isadmin bool) (vlist []Puid_t, skipped int) {
+	vlist = make([]Puid_t, 0, len(list))
+	for _, puid := range list {
+		var fpath, ok = PathStorePath(session, puid)
+		if !ok || puid < PUIDcache || Hidden.Fits(fpath) || !prf.PathAccess(fpath, isadmin) {
+			skipped++
+			continue
+		}
+		vlist = append(vlist, puid)
+	}
+	return
+}
+
+// APIHANDLER
+// SpiTagAdd links given tags to given files.
+func SpiTagAdd(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		List []Puid_t `json:"list" yaml:"list" xml:"list>puid" binding:"required"`
+		Tags []string `json:"tags" yaml:"tags" xml:"tags>tag" binding:"required"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		Added   int64 `json:"added" yaml:"added" xml:"added"`
+		Skipped int   `json:"skipped,omitempty" yaml:"skipped,omitempty" xml:"skipped,omitempty"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_tagadd_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_tagadd_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_tagadd_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_tagadd_deny, ErrDeny)
+		return
+	}
+	var names []string
+	if names, err = TagNames(arg.Tags); err != nil {
+		Ret400(c, AEC_tagadd_name, err)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var list []Puid_t
+	list, ret.Skipped = tagaccess(session, acc, arg.List, true)
+	if len(list) > 0 {
+		if ret.Added, err = TagsAdd(session, list, names); err != nil {
+			Ret500(c, AEC_tagadd_fail, err)
+			return
+		}
+	}
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiTagDel unlinks given tags from given files.
+func SpiTagDel(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		List []Puid_t `json:"list" yaml:"list" xml:"list>puid" binding:"required"`
+		Tags []string `json:"tags" yaml:"tags" xml:"tags>tag" binding:"required"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		Deleted int64 `json:"deleted" yaml:"deleted" xml:"deleted"`
+		Skipped int   `json:"skipped,omitempty" yaml:"skipped,omitempty" xml:"skipped,omitempty"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_tagdel_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_tagdel_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_tagdel_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_tagdel_deny, ErrDeny)
+		return
+	}
+	var names []string
+	if names, err = TagNames(arg.Tags); err != nil {
+		Ret400(c, AEC_tagdel_name, err)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var list []Puid_t
+	list, ret.Skipped = tagaccess(session, acc, arg.List, true)
+	if len(list) > 0 {
+		if ret.Deleted, err = TagsDel(session, list, names); err != nil {
+			Ret500(c, AEC_tagdel_fail, err)
+			return
+		}
+	}
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiTagRate puts rating to given files, zero rating removes it.
+func SpiTagRate(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		List   []Puid_t `json:"list" yaml:"list" xml:"list>puid" binding:"required"`
+		Rating int      `json:"rating" yaml:"rating" xml:"rating"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		Rated   int `json:"rated" yaml:"rated" xml:"rated"`
+		Skipped int `json:"skipped,omitempty" yaml:"skipped,omitempty" xml:"skipped,omitempty"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_tagrate_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_tagrate_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_tagrate_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid {
+		Ret403(c, AEC_tagrate_deny, ErrDeny)
+		return
+	}
+	if arg.Rating < 0 || arg.Rating > 5 {
+		Ret400(c, AEC_tagrate_range, ErrTagRating)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var list []Puid_t
+	list, ret.Skipped = tagaccess(session, acc, arg.List, true)
+	if len(list) > 0 {
+		if err = RateSet(session, list, arg.Rating); err != nil {
+			Ret500(c, AEC_tagrate_fail, err)
+			return
+		}
+	}
+	ret.Rated = len(list)
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiTagGet returns tags and ratings of given files.
+func SpiTagGet(c *gin.Context) {
+	var err error
+	var ok bool
+	var arg struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"arg"`
+
+		List []Puid_t `json:"list" yaml:"list" xml:"list>puid" binding:"required"`
+	}
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List    []FileTags `json:"list" yaml:"list" xml:"list>file"`
+		Skipped int        `json:"skipped,omitempty" yaml:"skipped,omitempty" xml:"skipped,omitempty"`
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_tagget_nobind, err)
+		return
+	}
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_tagget_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_tagget_noacc, ErrNoAcc)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	var list []Puid_t
+	list, ret.Skipped = tagaccess(session, acc, arg.List, uid == aid)
+	if ret.List, err = TagsGet(session, list); err != nil {
+		Ret500(c, AEC_tagget_fail, err)
+		return
+	}
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiTagCloud returns tags with numbers of accessible linked files.
+func SpiTagCloud(c *gin.Context) {
+	var err error
+	var ok bool
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		List []TagCount `json:"list" yaml:"list" xml:"list>tag"`
+	}
+
+	// get arguments
+	var uid = GetUID(c)
+	var aid uint64
+	if aid, err = GetAID(c); err != nil {
+		Ret400(c, AEC_tagcloud_badacc, ErrNoAcc)
+		return
+	}
+	var acc *Profile
+	if acc, ok = Profiles.Get(aid); !ok {
+		Ret404(c, AEC_tagcloud_noacc, ErrNoAcc)
+		return
+	}
+	if uid != aid && !acc.IsShared(CPtags) {
+		Ret403(c, AEC_tagcloud_noshr, ErrNotShared)
+		return
+	}
+
+	var session = XormStorage.NewSession()
+	defer session.Close()
+
+	if ret.List, err = TagCloud(session, acc, uid == aid); err != nil {
+		Ret500(c, AEC_tagcloud_fail, err)
+		return
+	}
+
+	RetOk(c, ret)
+}
+
+// The End.
@@ -0,0 +1,383 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// Audio cutting errors.
+var (
+	ErrCutFormat = errors.New("audio format can not be cut")
+	ErrCutWav    = errors.New("WAV file has no format or data chunk")
+	ErrCutFlac   = errors.New("FLAC file has no stream info")
+)
+
+// AudioCut returns fragment of audio file between given positions
+// as standalone audio file content. Zero end position means end of file.
+// WAV files are cut with sample precision, FLAC files are cut
+// on frames bounds.
+func AudioCut(ra io.ReaderAt, size int64, ext string, start, end time.Duration) (io.ReadSeeker, error) {
+	switch ext {
+	case ".wav":
+		return WavCut(ra, size, start, end)
+	case ".flac":
+		return FlacCut(ra, size, start, end)
+	}
+	return nil, ErrCutFormat
+}
+
+// IsTypeCut checks that audio file can be cut by AudioCut.
+func IsTypeCut(ext string) bool {
+	switch ext {
+	case ".wav", ".flac":
+		return true
+	}
+	return false
+}
+
+// timesample returns number of sample at given position.
+func timesample(pos time.Duration, rate int64) int64 {
+	return int64(pos) / int64(time.Millisecond) * rate / 1000
+}
+
+// HeadReader is seekable reader of content with replaced head.
+type HeadReader struct {
+	head []byte
+	body *io.SectionReader
+	pos  int64
+}
+
+// NewHeadReader makes reader with given head followed by given body.
+func NewHeadReader(head []byte, body *io.SectionReader) *HeadReader {
+	return &HeadReader{
+		head: head,
+		body: body,
+	}
+}
+
+// Size returns content size.
+func (hr *HeadReader) Size() int64 {
+	return int64(len(hr.head)) + hr.body.Size()
+}
+
+// Read is io.Reader implementation.
+func (hr *HeadReader) Read(b []byte) (n int, err error) {
+	var hl = int64(len(hr.head))
+	if hr.pos < hl {
+		n = copy(b, hr.head[hr.pos:])
+		hr.pos += int64(n)
+		return
+	}
+	n, err = hr.body.ReadAt(b, hr.pos-hl)
+	hr.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return
+}
+
+// Seek is io.Seeker implementation.
+func (hr *HeadReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += hr.pos
+	case io.SeekEnd:
+		offset += hr.Size()
+	default:
+		return 0, errors.New("HeadReader.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("HeadReader.Seek: negative position")
+	}
+	hr.pos = offset
+	return offset, nil
+}
+
+// WavCut returns fragment of PCM WAV file between given positions.
+func WavCut(ra io.ReaderAt, size int64, start, end time.Duration) (io.ReadSeeker, error) {
+	var hdr [12]byte
+	if _, err := ra.ReadAt(hdr[:], 0); err != nil {
+		return nil, err
+	}
+	if string(hdr[0:4]) != "RIFF" || string(hdr[8:12]) != "WAVE" {
+		return nil, ErrCutWav
+	}
+
+	var fmtchunk []byte
+	var dataoff, datasize int64
+	for off := int64(12); off+8 <= size; {
+		var ch [8]byte
+		if _, err := ra.ReadAt(ch[:], off); err != nil {
+			return nil, err
+		}
+		var chsize = int64(binary.LittleEndian.Uint32(ch[4:]))
+		switch string(ch[0:4]) {
+		case "fmt ":
+			if chsize < 16 || chsize > 1024 {
+				return nil, ErrCutWav
+			}
+			fmtchunk = make([]byte, 8+chsize)
+			if _, err := ra.ReadAt(fmtchunk, off); err != nil {
+				return nil, err
+			}
+		case "data":
+			dataoff, datasize = off+8, min(chsize, size-off-8)
+		}
+		if dataoff > 0 {
+			break
+		}
+		off += 8 + chsize + chsize&1
+	}
+	if fmtchunk == nil || dataoff == 0 {
+		return nil, ErrCutWav
+	}
+
+	var rate = int64(binary.LittleEndian.Uint32(fmtchunk[12:]))
+	var align = int64(binary.LittleEndian.Uint16(fmtchunk[20:]))
+	if rate == 0 || align == 0 {
+		return nil, ErrCutWav
+	}
+	var total = datasize / align
+	var from = min(timesample(start, rate), total)
+	var to = total
+	if end > 0 {
+		to = min(max(timesample(end, rate), from), total)
+	}
+	var length = (to - from) * align
+
+	var head bytes.Buffer
+	head.WriteString("RIFF")
+	binary.Write(&head, binary.LittleEndian, uint32(4+len(fmtchunk)+8+int(length)))
+	head.WriteString("WAVE")
+	head.Write(fmtchunk)
+	head.WriteString("data")
+	binary.Write(&head, binary.LittleEndian, uint32(length))
+	return NewHeadReader(head.Bytes(), io.NewSectionReader(ra, dataoff+from*align, length)), nil
+}
+
+// crc8 is table for CRC-8 with polynomial x^8 + x^2 + x^1 + x^0
+// used at FLAC frames headers.
+var crc8 = func() (t [256]byte) {
+	for i := range 256 {
+		var c = byte(i)
+		for range 8 {
+			if c&0x80 != 0 {
+				c = c<<1 ^ 0x07
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return
+}()
+
+// flacstream is FLAC file with parsed stream info.
+type flacstream struct {
+	ra    io.ReaderAt
+	size  int64
+	info  [34]byte // STREAMINFO block content
+	first int64    // offset of first frame
+	minbs int64    // minimum block size, it's block size of fixed-blocksize stream
+	maxbs int64    // maximum block size
+	rate  int64    // sample rate
+	total int64    // total samples, zero if unknown
+}
+
+// frameSample checks up frame header at the beginning of given buffer,
+// and returns number of first sample of frame.
+func (st *flacstream) frameSample(b []byte) (sample int64, ok bool) {
+	if len(b) < 16 || b[0] != 0xFF || b[1]&0xFE != 0xF8 {
+		return
+	}
+	var bscode, srcode = b[2] >> 4, b[2] & 0x0F
+	var chcode, sscode = b[3] >> 4, b[3] >> 1 & 0x07
+	if bscode == 0 || srcode == 15 || chcode > 10 || sscode == 3 || b[3]&1 != 0 {
+		return
+	}
+	// UTF-8 coded frame or sample number
+	var pos = 4
+	var num = int64(b[pos])
+	var n int
+	switch {
+	case num&0x80 == 0:
+		n = 0
+	case num&0xE0 == 0xC0:
+		n, num = 1, num&0x1F
+	case num&0xF0 == 0xE0:
+		n, num = 2, num&0x0F
+	case num&0xF8 == 0xF0:
+		n, num = 3, num&0x07
+	case num&0xFC == 0xF8:
+		n, num = 4, num&0x03
+	case num&0xFE == 0xFC:
+		n, num = 5, num&0x01
+	case num == 0xFE:
+		n, num = 6, 0
+	default:
+		return
+	}
+	pos++
+	for range n {
+		if b[pos]&0xC0 != 0x80 {
+			return
+		}
+		num = num<<6 | int64(b[pos]&0x3F)
+		pos++
+	}
+	// block size of this frame
+	var bs int64
+	switch {
+	case bscode == 1:
+		bs = 192
+	case bscode <= 5:
+		bs = 576 << (bscode - 2)
+	case bscode == 6:
+		bs = int64(b[pos]) + 1
+		pos++
+	case bscode == 7:
+		bs = int64(b[pos])<<8 | int64(b[pos+1]) + 1
+		pos += 2
+	default:
+		bs = 256 << (bscode - 8)
+	}
+	switch srcode {
+	case 12:
+		pos++
+	case 13, 14:
+		pos += 2
+	}
+	var crc byte
+	for _, c := range b[:pos] {
+		crc = crc8[crc^c]
+	}
+	if crc != b[pos] {
+		return
+	}
+	if bs > st.maxbs { // false sync code
+		return
+	}
+	if b[1]&1 != 0 { // variable block size, number of sample is coded
+		return num, true
+	}
+	// fixed block size, number of frame is coded; all frames
+	// have the same size except the last one, that can be shorter
+	if bs < st.minbs {
+		bs = st.minbs
+	}
+	return num * bs, true
+}
+
+// frameAt returns offset and first sample of first frame
+// that starts at given offset or after it.
+func (st *flacstream) frameAt(off int64) (int64, int64) {
+	const chunk = 16 * 1024
+	const limit = 4 * 1024 * 1024 // stop search on broken stream
+	var buf = make([]byte, chunk+16)
+	for end := off + limit; off < st.size && off < end; off += chunk {
+		var n, _ = st.ra.ReadAt(buf, off)
+		for i := 0; i < min(n, chunk); i++ {
+			if buf[i] == 0xFF {
+				if sample, ok := st.frameSample(buf[i:n]); ok {
+					return off + int64(i), sample
+				}
+			}
+		}
+	}
+	return st.size, st.total
+}
+
+// seek returns offset and first sample of frame that contains given sample.
+func (st *flacstream) seek(sample int64) (int64, int64) {
+	// find greatest offset that is followed by frame
+	// with first sample not greater than given
+	var lo, hi = st.first, st.size
+	for hi-lo > 1 {
+		var mid = lo + (hi-lo)/2
+		if off, s := st.frameAt(mid); off < st.size && s <= sample {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return st.frameAt(lo)
+}
+
+// FlacCut returns fragment of FLAC file between given positions.
+// Fragment begins from frame that contains start position, and ends
+// with frame that contains end position.
+func FlacCut(ra io.ReaderAt, size int64, start, end time.Duration) (io.ReadSeeker, error) {
+	var st = flacstream{
+		ra:   ra,
+		size: size,
+	}
+	var sign [4]byte
+	if _, err := ra.ReadAt(sign[:], 0); err != nil {
+		return nil, err
+	}
+	if string(sign[:]) != "fLaC" {
+		return nil, ErrCutFlac
+	}
+	var hasinfo bool
+	for off := int64(4); off+4 <= size; {
+		var bh [4]byte
+		if _, err := ra.ReadAt(bh[:], off); err != nil {
+			return nil, err
+		}
+		var length = int64(bh[1])<<16 | int64(bh[2])<<8 | int64(bh[3])
+		if bh[0]&0x7F == 0 && length == 34 {
+			if _, err := ra.ReadAt(st.info[:], off+4); err != nil {
+				return nil, err
+			}
+			hasinfo = true
+		}
+		off += 4 + length
+		if bh[0]&0x80 != 0 { // last metadata block
+			st.first = off
+			break
+		}
+	}
+	if !hasinfo || st.first == 0 || st.first >= size {
+		return nil, ErrCutFlac
+	}
+	var info = st.info[:]
+	st.minbs = int64(binary.BigEndian.Uint16(info[0:]))
+	st.maxbs = int64(binary.BigEndian.Uint16(info[2:]))
+	st.rate = int64(info[10])<<12 | int64(info[11])<<4 | int64(info[12])>>4
+	st.total = int64(info[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(info[14:]))
+	if st.rate == 0 || st.minbs < 16 || st.maxbs < st.minbs {
+		return nil, ErrCutFlac
+	}
+
+	var from, fromsmp = st.seek(timesample(start, st.rate))
+	var to, tosmp = st.size, st.total
+	if end > 0 {
+		var endsmp = timesample(end, st.rate)
+		if to, tosmp = st.seek(endsmp); tosmp < endsmp {
+			to, tosmp = st.frameAt(to + 1)
+		}
+	}
+	if to < from {
+		to, tosmp = from, fromsmp
+	}
+
+	// stream info with fragment samples number and without MD5
+	var head = make([]byte, 4+4+34)
+	copy(head, "fLaC")
+	head[4], head[5], head[6], head[7] = 0x80, 0, 0, 34
+	copy(head[8:], info)
+	var length = max(tosmp-fromsmp, 0)
+	if st.total == 0 && end == 0 {
+		length = 0 // unknown
+	}
+	head[8+13] = head[8+13]&0xF0 | byte(length>>32&0x0F)
+	binary.BigEndian.PutUint32(head[8+14:], uint32(length))
+	clear(head[8+18:])
+	return NewHeadReader(head, io.NewSectionReader(ra, from, to-from)), nil
+}
+
+// The End.
@@ -0,0 +1,106 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// flachdr makes FLAC frame header with given second byte, block size code,
+// coded number and block size bytes, and appends valid CRC-8 to it.
+func flachdr(sync, bscode byte, num []byte, bs ...byte) []byte {
+	var b = []byte{0xFF, sync, bscode<<4 | 0x00, 0x08}
+	b = append(b, num...)
+	b = append(b, bs...)
+	var crc byte
+	for _, c := range b {
+		crc = crc8[crc^c]
+	}
+	b = append(b, crc)
+	return append(b, make([]byte, 16)...) // subframe data
+}
+
+func TestFlacFrameSample(t *testing.T) {
+	var st = flacstream{minbs: 1152, maxbs: 1152}
+	var badcrc = flachdr(0xF8, 3, []byte{2})
+	badcrc[5] ^= 0xFF
+	var tests = []struct {
+		name   string
+		hdr    []byte
+		sample int64
+		ok     bool
+	}{
+		{"fixed block", flachdr(0xF8, 3, []byte{2}), 2 * 1152, true},
+		{"8-bit block size", flachdr(0xF8, 6, []byte{5}, 191), 5 * 1152, true},
+		{"16-bit block size", flachdr(0xF8, 7, []byte{5}, 0x04, 0x7F), 5 * 1152, true},
+		{"last shorter frame", flachdr(0xF8, 7, []byte{32}, 0x00, 99), 32 * 1152, true},
+		{"greater than maximum", flachdr(0xF8, 7, []byte{3}, 0x0F, 0xFF), 0, false},
+		{"greater code", flachdr(0xF8, 12, []byte{3}), 0, false},
+		{"reserved code", flachdr(0xF8, 0, []byte{3}), 0, false},
+		{"variable block", flachdr(0xF9, 3, []byte{0xCE, 0x88}), 904, true},
+		{"broken number", flachdr(0xF9, 3, []byte{0xCE, 0x08}), 0, false},
+		{"bad crc", badcrc, 0, false},
+		{"no sync", append([]byte{0xFE}, flachdr(0xF8, 3, []byte{2})[1:]...), 0, false},
+	}
+	for _, test := range tests {
+		var sample, ok = st.frameSample(test.hdr)
+		if ok != test.ok || sample != test.sample {
+			t.Errorf("%s: expected sample %d, %v, got %d, %v", test.name, test.sample, test.ok, sample, ok)
+		}
+	}
+}
+
+func TestFlacCut(t *testing.T) {
+	var data, err = os.ReadFile(filepath.Join("testdata", "sample.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sample.flac has 37478 samples at 11025 Hz in frames of 1152 samples
+	const total, bs = 37478, 1152
+	var tests = []struct {
+		name       string
+		start, end time.Duration
+		from       int64 // first sample of fragment
+		length     int64 // number of samples at fragment
+	}{
+		{"whole", 0, 0, 0, total},
+		{"middle", time.Second, 2 * time.Second, 9 * bs, 20*bs - 9*bs},
+		{"up to end", 3 * time.Second, 0, 28 * bs, total - 28*bs},
+		{"short", 210 * time.Millisecond, 420 * time.Millisecond, 2 * bs, 3 * bs},
+		{"after end", 5 * time.Second, 6 * time.Second, 32 * bs, total - 32*bs}, // last frame
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var rs, err = FlacCut(bytes.NewReader(data), int64(len(data)), test.start, test.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var frag []byte
+			if frag, err = io.ReadAll(rs); err != nil {
+				t.Fatal(err)
+			}
+			if string(frag[:4]) != "fLaC" || frag[4] != 0x80 {
+				t.Fatal("fragment has no stream info")
+			}
+			var info = frag[8 : 8+34]
+			var length = int64(info[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(info[14:]))
+			if length != test.length {
+				t.Errorf("expected %d samples, got %d", test.length, length)
+			}
+			var st = flacstream{minbs: bs, maxbs: bs}
+			if sample, ok := st.frameSample(frag[8+34:]); !ok || sample != test.from {
+				t.Errorf("expected first frame sample %d, got %d, %v", test.from, sample, ok)
+			}
+		})
+	}
+
+	if _, err = FlacCut(bytes.NewReader(data[:100]), 100, 0, 0); err != ErrCutFlac {
+		t.Errorf("expected error %v for truncated file, got %v", ErrCutFlac, err)
+	}
+}
+
+// The End.
@@ -0,0 +1,72 @@
+package hms
+
+import (
+	"sync"
+	"time"
+)
+
+// Background scanning states.
+const (
+	BgScanOff  = "off"  // background scanning is disabled by configuration
+	BgScanWait = "wait" // waits for scheduled time or for idle server
+	BgScanRun  = "run"  // scanning in progress
+)
+
+// BgScanStat is state snapshot of background scanning by web server.
+type BgScanStat struct {
+	State     string `json:"state" yaml:"state" xml:"state"`                               // one of "off", "wait" or "run"
+	Paused    bool   `json:"paused" yaml:"paused" xml:"paused"`                            // scanning is suspended while clients are online
+	Stage     int    `json:"stage" yaml:"stage" xml:"stage"`                               // current stage of scanning: walk, embedded info extract or images convert
+	Path      string `json:"path,omitempty" yaml:"path,omitempty" xml:"path,omitempty"`    // currently walked share
+	Next      Unix_t `json:"next" yaml:"next" xml:"next"`                                  // time of next scheduled start, or zero if it is absent
+	Start     Unix_t `json:"start" yaml:"start" xml:"start"`                               // start time of current or last scanning
+	Finish    Unix_t `json:"finish" yaml:"finish" xml:"finish"`                            // finish time of last scanning
+	Runs      int    `json:"runs" yaml:"runs" xml:"runs"`                                  // number of complete scannings since server start
+	Total     int64  `json:"total" yaml:"total" xml:"total"`                               // number of files queued at current stage
+	Done      int64  `json:"done" yaml:"done" xml:"done"`                                  // number of processed files at current stage
+	TotalSize int64  `json:"totalsize" yaml:"totalsize" xml:"totalsize"`                   // size of files queued at current stage
+	DoneSize  int64  `json:"donesize" yaml:"donesize" xml:"donesize"`                      // size of processed files at current stage
+	Remain    int64  `json:"remain" yaml:"remain" xml:"remain"`                            // estimated time in milliseconds to complete current stage
+	Error     string `json:"error,omitempty" yaml:"error,omitempty" xml:"error,omitempty"` // error of last scanning
+}
+
+var bgscan struct {
+	mux sync.Mutex
+	st  BgScanStat
+	t0  time.Time // start time of current stage
+}
+
+// BgScanUpdate modifies state of background scanning by given function.
+func BgScanUpdate(f func(st *BgScanStat)) {
+	bgscan.mux.Lock()
+	defer bgscan.mux.Unlock()
+
+	var stage = bgscan.st.Stage
+	f(&bgscan.st)
+	if bgscan.st.Stage != stage {
+		bgscan.t0 = time.Now()
+	}
+}
+
+// BgScanState returns state snapshot of background scanning.
+func BgScanState() (st BgScanStat) {
+	bgscan.mux.Lock()
+	defer bgscan.mux.Unlock()
+
+	st = bgscan.st
+	if !Cfg.BgScanEnable {
+		st.State = BgScanOff
+	}
+	if st.State == BgScanRun && st.Stage != TaskWalk {
+		// estimate remained time by throughput of processed files size
+		var spent = time.Since(bgscan.t0)
+		if st.DoneSize > 0 && st.TotalSize > st.DoneSize {
+			st.Remain = (time.Duration(float64(spent) / float64(st.DoneSize) * float64(st.TotalSize-st.DoneSize))).Milliseconds()
+		} else if st.Done > 0 && st.Total > st.Done {
+			st.Remain = (time.Duration(float64(spent) / float64(st.Done) * float64(st.Total-st.Done))).Milliseconds()
+		}
+	}
+	return
+}
+
+// The End.
@@ -9,8 +9,11 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	cfg "github.com/schwarzlichtbezirk/hms/config"
 	"github.com/schwarzlichtbezirk/wpk"
@@ -18,13 +21,15 @@ import (
 
 	"github.com/chai2010/webp"
 	"github.com/disintegration/gift"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"xorm.io/xorm"
 )
 
 const (
-	tmbfile = "thumb.wpt"
-	tilfile = "tiles.wpt"
+	TmbFile = "thumb.wpt"
+	TilFile = "tiles.wpt"
 )
 
 var (
@@ -36,6 +41,7 @@ var (
 	ToKey    = wpk.ToKey
 	Cfg      = cfg.Cfg
 	Log      = cfg.Log
+	Slog     = cfg.Slog
 )
 
 type (
@@ -51,6 +57,9 @@ var (
 	TilesPkg *FileCache
 )
 
+// TIDsrcsize is tag ID of cached file with size of source file.
+const TIDsrcsize wpk.TID = 120
+
 var XormStorage *xorm.Engine
 
 // Error messages
@@ -63,6 +72,7 @@ var (
 	ErrNoMime      = errors.New("MIME tag does not found")
 	ErrEmptyExif   = errors.New("EXIF metadata is empty")
 	ErrEmptyID3    = errors.New("ID3 metadata is empty")
+	ErrPathLong    = errors.New("path is too long to be stored")
 )
 
 // PathStarts check up that given file path has given parental path.
@@ -109,10 +119,14 @@ type TempCell[T any] struct {
 	Wait *time.Timer
 }
 
+// PathStoreLen is maximum length of stored path in characters.
+// Path length is limited by maximum key length of MySQL unique index.
+const PathStoreLen = 768
+
 // PathStore sqlite3 item of unlimited cache with puid/syspath values.
 type PathStore struct {
 	Puid Puid_t `xorm:"pk autoincr"`
-	Path string `xorm:"notnull unique index"`
+	Path string `xorm:"varchar(768) notnull unique index"`
 }
 
 // Store is struct of sqlite3 item for cache with puid/T values.
@@ -126,13 +140,41 @@ type (
 	ExtStore  Store[ExtProp]
 	ExifStore Store[ExifProp]
 	Id3Store  Store[Id3Prop]
+	HashStore Store[HashProp]
 )
 
+// Stages of files processing by scanning.
+const (
+	TaskWalk = 0 // list files of shares
+	TaskExt  = 1 // extract embedded info
+	TaskCnv  = 2 // prepare tiles, thumbnails and perceptual hashes
+)
+
+// WalkStore is sqlite3 item with directory which files are listed
+// to scanning queue. Items of incomplete scanning allows to resume
+// interrupted scanning. Items of complete scanning are kept as marks
+// of directories that are not modified since it.
+type WalkStore struct {
+	Path string    `xorm:"varchar(768) pk"`
+	Time time.Time `xorm:"notnull"`               // directory listing time
+	FGrp FileGroup `xorm:"extends"`               // directory file groups counters
+	Done bool      `xorm:"notnull default false"` // scanning with this listing is complete
+}
+
+// TaskStore is sqlite3 item with file queued for processing by scanning.
+type TaskStore struct {
+	ID    uint64 `xorm:"pk autoincr"`
+	Stage int    `xorm:"notnull index"`
+	Path  string `xorm:"text notnull"`
+	Size  int64  `xorm:"notnull default 0"`
+}
+
 var (
-	PathCache = NewBimap[Puid_t, string]()   // Bidirectional map for PUIDs and system paths.
-	GpsCache  = NewCache[Puid_t, GpsInfo]()  // FIFO cache with GPS coordinates.
-	tilecache = NewCache[Puid_t, TileProp]() // FIFO cache with set of available tiles.
-	extcache  = NewCache[Puid_t, ExtProp]()  // FIFO cache with set of base extension properties.
+	PathCache = NewBimap[Puid_t, string]()        // Bidirectional map for PUIDs and system paths.
+	GpsCache  = NewCache[Puid_t, GpsInfo]()       // FIFO cache with GPS coordinates.
+	tilecache = NewCache[Puid_t, TileProp]()      // FIFO cache with set of available tiles.
+	extcache  = NewCache[Puid_t, ExtProp]()       // FIFO cache with set of base extension properties.
+	plcache   = NewCache[Puid_t, PlaylistCache]() // FIFO cache with parsed playlists.
 
 	etmbcache = NewCache[Puid_t, MediaData]() // FIFO cache with files embedded thumbnails.
 	imgcache  = NewCache[Puid_t, MediaData]() // FIFO cache with converted to HD resolution images, processed media files and embedded thumbnails.
@@ -175,18 +217,28 @@ func PathStorePath(session *Session, puid Puid_t) (fpath string, ok bool) {
 }
 
 // PathStoreCache returns cached PUID for specified system path, or make it and put into cache.
-func PathStoreCache(session *Session, fpath string) (puid Puid_t) {
+// Error returned if path can not be stored.
+func PathStoreCache(session *Session, fpath string) (puid Puid_t, err error) {
 	var ok bool
 	if puid, ok = PathStorePUID(session, fpath); ok {
 		return
 	}
+	if utf8.RuneCountInString(fpath) > PathStoreLen {
+		err = fmt.Errorf("%w: %d characters", ErrPathLong, utf8.RuneCountInString(fpath))
+		return
+	}
 
 	// set to database
 	var pst = PathStore{
 		Path: fpath,
 	}
-	if _, err := session.InsertOne(&pst); err != nil {
-		panic(err)
+	if _, err = session.InsertOne(&pst); err != nil {
+		// path can be inserted by other server with shared database
+		if puid, ok = PathStorePUID(session, fpath); ok {
+			err = nil
+			return
+		}
+		return
 	}
 	puid = pst.Puid
 	// set to memory cache
@@ -194,6 +246,17 @@ func PathStoreCache(session *Session, fpath string) (puid Puid_t) {
 	return
 }
 
+// DirStoreGet returns value from directories cache.
+func DirStoreGet(session *Session, puid Puid_t) (dp DirProp, ok bool) {
+	// try to get from database
+	var dst DirStore
+	if ok, _ = session.ID(puid).Get(&dst); ok {
+		dp = dst.Prop
+		return
+	}
+	return
+}
+
 // DirStoreSet puts value to directories cache.
 func DirStoreSet(session *Session, puid Puid_t, dp DirProp) (err error) {
 	var dst = &DirStore{
@@ -218,6 +281,12 @@ func ExtStoreGet(session *Session, puid Puid_t) (xp ExtProp, ok bool) {
 	return
 }
 
+// ExtStoreHas checks that embedded info database has record for given PUID.
+func ExtStoreHas(session *Session, puid Puid_t) (ok bool) {
+	ok, _ = session.Table(&ExtStore{}).Where("puid=?", puid).Exist() // skip errors
+	return
+}
+
 // ExtStoreSet puts value to embedded info database.
 func ExtStoreSet(session *Session, puid Puid_t, xp ExtProp) (err error) {
 	var xst = &ExtStore{
@@ -239,11 +308,15 @@ func GpsCachePut(puid Puid_t, tp ExifProp) {
 	}
 }
 
-// ExifStoreGet returns value from EXIF database.
-func ExifStoreGet(session *Session, puid Puid_t) (tp ExifProp, ok bool) {
+// ExifStoreGet returns value from EXIF database. Record that was made
+// from another content of file with given info is treated as absent.
+func ExifStoreGet(session *Session, puid Puid_t, fi fs.FileInfo) (tp ExifProp, ok bool) {
 	// try to get from database
 	var est ExifStore
 	if ok, _ = session.ID(puid).Get(&est); ok {
+		if est.Prop.IsOutdated(fi) {
+			return ExifProp{}, false
+		}
 		tp = est.Prop
 		return
 	}
@@ -289,6 +362,30 @@ func Id3StoreSet(session *Session, puid Puid_t, tp Id3Prop) (err error) {
 	return
 }
 
+// HashStoreGet returns value from perceptual hashes database.
+func HashStoreGet(session *Session, puid Puid_t) (hp HashProp, ok bool) {
+	// try to get from database
+	var hst HashStore
+	if ok, _ = session.ID(puid).Get(&hst); ok {
+		hp = hst.Prop
+		return
+	}
+	return
+}
+
+// HashStoreSet puts value to perceptual hashes database.
+func HashStoreSet(session *Session, puid Puid_t, hp HashProp) (err error) {
+	var hst = &HashStore{
+		Puid: puid,
+		Prop: hp,
+	}
+	// set to database
+	if affected, _ := session.InsertOne(hst); affected == 0 {
+		_, err = session.ID(hst.Puid).AllCols().Omit("puid").Update(hst)
+	}
+	return
+}
+
 var tmbmux, imgmux sync.Mutex
 
 func ThumbCacheTrim() {
@@ -313,6 +410,117 @@ func ImgCacheTrim() {
 	})
 }
 
+// CacheDrop removes all cached thumbnails, tiles and converted images
+// of the file with given PUID, so they will be produced again on next request.
+func CacheDrop(puid Puid_t, syspath string) {
+	etmbcache.Remove(puid)
+	imgcache.Remove(puid | PuidHD)
+	imgcache.Remove(puid | PuidImg)
+	tilecache.Remove(puid)
+	ThumbPkg.DelTagset(syspath)
+
+	var prefix = ToSlash(syspath) + "?"
+	var keys []string
+	TilesPkg.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		if strings.HasPrefix(fkey, prefix) {
+			keys = append(keys, fkey)
+		}
+		return true
+	})
+	for _, fkey := range keys {
+		TilesPkg.DelTagset(fkey)
+	}
+}
+
+// StorePurge deletes from database all records with embedded info,
+// EXIF, tags and perceptual hashes for files with given PUIDs.
+func StorePurge(session *Session, puids ...Puid_t) (err error) {
+	for _, puid := range puids {
+		extcache.Remove(puid)
+		GpsCache.Remove(puid)
+	}
+	const limit = 256
+	for i := 0; i < len(puids); i += limit {
+		var chunk = puids[i:min(i+limit, len(puids))]
+		for _, table := range []any{&ExtStore{}, &ExifStore{}, &Id3Store{}, &HashStore{}} {
+			if _, err = session.In("puid", chunk).Delete(table); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Files which cached data was dropped at request handlers, with
+// properties of their actual content. Database records of these
+// files are purged by StalePurge in background.
+var (
+	stalemap = map[Puid_t]SrcProp{}
+	stalemux sync.Mutex
+)
+
+// CacheStale removes all cached data made from the file with given PUID
+// in memory and in packages, and marks its database records as stale.
+// File info is nil if file was deleted.
+func CacheStale(puid Puid_t, syspath string, fi fs.FileInfo) {
+	CacheDrop(puid, syspath)
+	extcache.Remove(puid)
+	plcache.Remove(puid)
+	GpsCache.Remove(puid)
+
+	var sp SrcProp
+	if fi != nil {
+		sp.Setup(fi)
+	}
+	stalemux.Lock()
+	defer stalemux.Unlock()
+	stalemap[puid] = sp
+}
+
+// StaleCount returns number of files with stale database records.
+func StaleCount() int {
+	stalemux.Lock()
+	defer stalemux.Unlock()
+	return len(stalemap)
+}
+
+// StalePurge deletes from database records of stale files that were
+// made from another content than file has at CacheStale call, so records
+// made after it are kept. Returns number of purged files.
+func StalePurge(session *Session) (n int, err error) {
+	stalemux.Lock()
+	var sm = stalemap
+	stalemap = map[Puid_t]SrcProp{}
+	stalemux.Unlock()
+
+	defer func() {
+		if err != nil { // put back not purged files
+			stalemux.Lock()
+			defer stalemux.Unlock()
+			for puid, sp := range sm {
+				if _, ok := stalemap[puid]; !ok {
+					stalemap[puid] = sp
+				}
+			}
+		}
+	}()
+
+	for puid, sp := range sm {
+		for _, table := range []any{&ExtStore{}, &ExifStore{}, &Id3Store{}, &HashStore{}} {
+			var s = session.Where("puid=?", puid)
+			if sp != (SrcProp{}) { // file is present
+				s = s.And("(srcsize<>? OR srctime<>?)", sp.SrcSize, sp.SrcTime.String())
+			}
+			if _, err = s.Delete(table); err != nil {
+				return
+			}
+		}
+		delete(sm, puid)
+		n++
+	}
+	return
+}
+
 // MediaCacheGet returns media file with given PUID converted to acceptable
 // for browser format from memory cache.
 func MediaCacheGet(session *Session, puid Puid_t) (md MediaData, err error) {
@@ -333,14 +541,14 @@ func MediaCacheGet(session *Session, puid Puid_t) (md MediaData, err error) {
 		return // uncacheable type
 	}
 
-	var file fs.File
-	if file, err = JP.Open(syspath); err != nil {
+	var file RFile
+	if file, err = OpenFile(syspath); err != nil {
 		return // can not open file
 	}
 	defer file.Close()
 
 	var src image.Image
-	if src, _, err = image.Decode(file); err != nil {
+	if src, _, err = ImageDecode(file, ext); err != nil {
 		if src == nil { // skip "short Huffman data" or others errors with partial results
 			return // can not decode file by any codec
 		}
@@ -371,6 +579,7 @@ func HdCacheGet(session *Session, puid Puid_t) (md MediaData, err error) {
 		err = ErrNoPUID
 		return // file path not found
 	}
+	var ext = GetFileExt(syspath)
 
 	var file RFile
 	if file, err = OpenFile(syspath); err != nil {
@@ -379,7 +588,7 @@ func HdCacheGet(session *Session, puid Puid_t) (md MediaData, err error) {
 	defer file.Close()
 
 	var imc image.Config
-	if imc, _, err = image.DecodeConfig(file); err != nil {
+	if imc, _, err = ImageDecodeConfig(file, ext); err != nil {
 		return // can not recognize format or decode config
 	}
 	if float32(imc.Width*imc.Height+5e5)/1e6 > Cfg.ImageMaxMpx {
@@ -403,17 +612,21 @@ func HdCacheGet(session *Session, puid Puid_t) (md MediaData, err error) {
 
 	// try to extract orientation from EXIF
 	var orientation = OrientNormal
-	if tp, ok := ExifStoreGet(session, puid); ok && tp.Orientation > 0 {
+	var fi, _ = file.Stat()
+	if tp, ok := ExifStoreGet(session, puid, fi); ok && tp.Orientation > 0 {
 		orientation = tp.Orientation
 	} else if tp, err = ExifExtract(session, file, puid); err == nil && tp.Orientation > 0 {
 		orientation = tp.Orientation
 	}
+	if IsTypeHEIF(ext) {
+		orientation = OrientNormal // image is already transformed by decoder
+	}
 	if _, err = file.Seek(0, io.SeekStart); err != nil {
 		return
 	}
 
 	var src, dst image.Image
-	if src, _, err = image.Decode(file); err != nil {
+	if src, _, err = ImageDecode(file, ext); err != nil {
 		if src == nil { // skip "short Huffman data" or others errors with partial results
 			return // can not decode file by any codec
 		}
@@ -450,6 +663,10 @@ type FileCache struct {
 	*wpk.Package
 	wpt wpk.WriteSeekCloser // package tags part
 	wpf wpk.WriteSeekCloser // package files part
+
+	fpath string       // path to package tags part
+	mux   sync.RWMutex // locks package replacement at compaction
+	cmpct atomic.Bool  // compaction is in progress
 }
 
 // InitCacheWriter opens existing cache with given file path placed in
@@ -464,6 +681,7 @@ func InitCacheWriter(fpath string) (fc *FileCache, d time.Duration, err error) {
 	var datpath = wpk.MakeDataPath(fpath)
 	fc = &FileCache{
 		Package: wpk.NewPackage(),
+		fpath:   fpath,
 	}
 	defer func() {
 		if err != nil {
@@ -518,14 +736,47 @@ func InitCacheWriter(fpath string) (fc *FileCache, d time.Duration, err error) {
 	return
 }
 
+// HasTagset check up that file with given key is present in the cache.
+func (fc *FileCache) HasTagset(fpath string) bool {
+	fc.mux.RLock()
+	defer fc.mux.RUnlock()
+	return fc.Package.HasTagset(fpath)
+}
+
+// GetTagset returns tagset of the file with given key, if it found.
+func (fc *FileCache) GetTagset(fpath string) (wpk.TagsetRaw, bool) {
+	fc.mux.RLock()
+	defer fc.mux.RUnlock()
+	return fc.Package.GetTagset(fpath)
+}
+
+// DelTagset deletes the file with given key from the cache.
+func (fc *FileCache) DelTagset(fpath string) (wpk.TagsetRaw, bool) {
+	fc.mux.RLock()
+	defer fc.mux.RUnlock()
+	return fc.Package.DelTagset(fpath)
+}
+
+// Enum calls given closure for each file in the cache.
+func (fc *FileCache) Enum(f func(string, wpk.TagsetRaw) bool) {
+	fc.mux.RLock()
+	defer fc.mux.RUnlock()
+	fc.Package.Enum(f)
+}
+
 // Sync writes actual file tags table and true signature with settings.
 func (fc *FileCache) Sync() error {
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
 	return fc.Package.Sync(fc.wpt, fc.wpf)
 }
 
 // Close saves actual tags table and closes opened cache.
 func (fc *FileCache) Close() (err error) {
-	if et := fc.Sync(); et != nil && err == nil {
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+
+	if et := fc.Package.Sync(fc.wpt, fc.wpf); et != nil && err == nil {
 		err = et
 	}
 	if et := fc.wpt.Close(); et != nil && err == nil {
@@ -540,7 +791,10 @@ func (fc *FileCache) Close() (err error) {
 
 // GetFile extracts file from the cache with given file name.
 func (fc *FileCache) GetFile(fpath string) (file wpk.RFile, mime string, t time.Time, err error) {
-	if ts, ok := fc.GetTagset(fpath); ok {
+	fc.mux.RLock()
+	defer fc.mux.RUnlock()
+
+	if ts, ok := fc.Package.GetTagset(fpath); ok {
 		if t, ok = ts.TagTime(wpk.TIDmtime); !ok {
 			err = ErrNoMTime
 			return
@@ -558,7 +812,10 @@ func (fc *FileCache) GetFile(fpath string) (file wpk.RFile, mime string, t time.
 
 // GetData extracts file from the cache with given file name.
 func (fc *FileCache) GetData(fpath string) (md MediaData, err error) {
-	if ts, ok := fc.GetTagset(fpath); ok {
+	fc.mux.RLock()
+	defer fc.mux.RUnlock()
+
+	if ts, ok := fc.Package.GetTagset(fpath); ok {
 		var t time.Time
 		if t, ok = ts.TagTime(wpk.TIDmtime); !ok {
 			err = ErrNoMTime
@@ -591,19 +848,53 @@ func (fc *FileCache) GetData(fpath string) (md MediaData, err error) {
 	return
 }
 
+// IsOutdated returns true if file with given key is present in the cache,
+// but was made from another content of source file, or source file
+// was deleted (fi is nil).
+func (fc *FileCache) IsOutdated(fpath string, fi fs.FileInfo) bool {
+	var ts, ok = fc.GetTagset(fpath)
+	return ok && IsTagsetOutdated(ts, fi)
+}
+
+// IsTagsetOutdated returns true if cached file with given tagset was made
+// from another content of source file, or source file was deleted.
+// Files cached without source size are checked by modify time only.
+func IsTagsetOutdated(ts wpk.TagsetRaw, fi fs.FileInfo) bool {
+	var ok bool
+	if fi == nil {
+		return true
+	}
+	var ms int64
+	if ms, ok = ts.TagUnixms(wpk.TIDmtime); !ok || ms != fi.ModTime().UnixMilli() {
+		return true
+	}
+	var size uint64
+	if size, ok = ts.TagUint64(TIDsrcsize); ok && size != uint64(fi.Size()) {
+		return true
+	}
+	return false
+}
+
 // PutFile puts file to package.
 func (fc *FileCache) PutFile(fpath string, md MediaData) (err error) {
+	fc.mux.RLock()
+	defer fc.mux.RUnlock()
+
 	var ts wpk.TagsetRaw
-	if ts, err = fc.PackData(fc.wpf, bytes.NewReader(md.Data), fpath); err != nil {
+	if ts, err = fc.Package.PackData(fc.wpf, bytes.NewReader(md.Data), fpath); err != nil {
 		return
 	}
 	if md.Time.IsZero() {
 		md.Time = time.Now()
 	}
-	fc.SetTagset(fpath, ts.
+	ts = ts.
 		Put(wpk.TIDmtime, wpk.UnixmsTag(md.Time)).
 		Put(wpk.TIDatime, wpk.UnixmsTag(md.Time)).
-		Put(wpk.TIDmime, wpk.StrTag(MimeStr[md.Mime])))
+		Put(wpk.TIDmime, wpk.StrTag(MimeStr[md.Mime]))
+	if md.SrcSize > 0 {
+		ts = ts.Put(TIDsrcsize, wpk.Uint64Tag(uint64(md.SrcSize)))
+	}
+	fc.Package.SetTagset(fpath, ts)
 	return
 }
 
@@ -615,17 +906,17 @@ func PackInfo(fname string, pkg *wpk.Package, d time.Duration) {
 // InitPackages opens all existing caches.
 func InitPackages() (err error) {
 	var d time.Duration
-	if ThumbPkg, d, err = InitCacheWriter(JoinPath(cfg.TmbPath, tmbfile)); err != nil {
+	if ThumbPkg, d, err = InitCacheWriter(JoinPath(cfg.TmbPath, TmbFile)); err != nil {
 		err = fmt.Errorf("inits thumbnails database: %w", err)
 		return
 	}
-	PackInfo(tmbfile, ThumbPkg.Package, d)
+	PackInfo(TmbFile, ThumbPkg.Package, d)
 
-	if TilesPkg, d, err = InitCacheWriter(JoinPath(cfg.TmbPath, tilfile)); err != nil {
+	if TilesPkg, d, err = InitCacheWriter(JoinPath(cfg.TmbPath, TilFile)); err != nil {
 		err = fmt.Errorf("inits tiles database: %w", err)
 		return
 	}
-	PackInfo(tilfile, TilesPkg.Package, d)
+	PackInfo(TilFile, TilesPkg.Package, d)
 
 	return nil
 }
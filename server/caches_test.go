@@ -0,0 +1,194 @@
+package hms
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cfg "github.com/schwarzlichtbezirk/hms/config"
+)
+
+// testPackages opens new thumbnails and tiles packages
+// at temporary directory while test is running.
+func testPackages(t *testing.T) {
+	t.Helper()
+	var prev = cfg.TmbPath
+	cfg.TmbPath = t.TempDir()
+	var prevtmb, prevtil = ThumbPkg, TilesPkg
+	if err := InitPackages(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ClosePackages()
+		cfg.TmbPath = prev
+		ThumbPkg, TilesPkg = prevtmb, prevtil
+	})
+}
+
+// testPathStore checks that paths are stored at path store
+// and are loaded back by PUIDs, and that too long paths are rejected.
+func testPathStore(t *testing.T, session *Session) {
+	t.Helper()
+	var tests = []struct {
+		name  string
+		fpath string
+		err   error
+	}{
+		{"short", "/music/a.mp3", nil},
+		{"unicode", "/музыка/песня.mp3", nil},
+		{"limit", "/" + strings.Repeat("a", PathStoreLen-1), nil},
+		{"limit of unicode", "/" + strings.Repeat("я", PathStoreLen-1), nil},
+		{"too long", "/" + strings.Repeat("a", PathStoreLen), ErrPathLong},
+	}
+	for _, test := range tests {
+		var puid, err = PathStoreCache(session, test.fpath)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if puid < PUIDcache {
+			t.Errorf("%s: got reserved PUID %d", test.name, puid)
+		}
+		if again, _ := PathStoreCache(session, test.fpath); again != puid {
+			t.Errorf("%s: PUID %d is changed to %d", test.name, puid, again)
+		}
+		PathCache.DeleteDir(puid) // read from database
+		if fpath, ok := PathStorePath(session, puid); !ok || fpath != test.fpath {
+			t.Errorf("%s: expected path %q, got %q, %v", test.name, test.fpath, fpath, ok)
+		}
+	}
+}
+
+func TestPathStore(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+	testPathStore(t, session)
+}
+
+func TestStalePurge(t *testing.T) {
+	var engine = testStorage(t)
+	testPackages(t)
+	var session = engine.NewSession()
+	defer session.Close()
+
+	var dir = t.TempDir()
+	var fpath = filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(fpath, testJpeg(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var fi, err = os.Stat(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual, outdated SrcProp
+	actual.Setup(fi)
+	outdated = actual
+	outdated.SrcSize++
+
+	const (
+		puidOld  = PUIDcache + 1 // records made from previous content
+		puidNew  = PUIDcache + 2 // records already made from actual content
+		puidGone = PUIDcache + 3 // file was deleted
+	)
+	var tests = []struct {
+		puid Puid_t
+		sp   SrcProp
+		fi   os.FileInfo
+		kept bool
+	}{
+		{puidOld, outdated, fi, false},
+		{puidNew, actual, fi, true},
+		{puidGone, actual, nil, false},
+	}
+	for _, test := range tests {
+		if _, err = session.Insert(&ExtStore{Puid: test.puid, Prop: ExtProp{SrcProp: test.sp}}); err != nil {
+			t.Fatal(err)
+		}
+		if err = HashStoreSet(session, test.puid, HashProp{DHash: 1, SrcProp: test.sp}); err != nil {
+			t.Fatal(err)
+		}
+		extcache.Poke(test.puid, ExtProp{SrcProp: test.sp})
+		CacheStale(test.puid, fpath, test.fi)
+		if _, ok := extcache.Peek(test.puid); ok {
+			t.Errorf("puid %d: memory cache is not dropped", test.puid)
+		}
+	}
+	if n := StaleCount(); n != len(tests) {
+		t.Fatalf("expected %d stale files, got %d", len(tests), n)
+	}
+	// records stay at database until purge
+	if n, _ := session.Count(&ExtStore{}); n != int64(len(tests)) {
+		t.Fatalf("expected %d records before purge, got %d", len(tests), n)
+	}
+
+	var n int
+	if n, err = StalePurge(session); err != nil {
+		t.Fatal(err)
+	}
+	if n != len(tests) || StaleCount() != 0 {
+		t.Fatalf("expected %d purged files and no stale, got %d and %d", len(tests), n, StaleCount())
+	}
+	for _, test := range tests {
+		var ok1, _ = session.ID(test.puid).Exist(&ExtStore{})
+		var _, ok2 = HashStoreGet(session, test.puid)
+		if ok1 != test.kept || ok2 != test.kept {
+			t.Errorf("puid %d: expected kept %v, got ext %v, hash %v", test.puid, test.kept, ok1, ok2)
+		}
+	}
+}
+
+func TestExifStoreGet(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+
+	var fpath = filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(fpath, testJpeg(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var fi, err = os.Stat(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual, resized, touched SrcProp
+	actual.Setup(fi)
+	resized, touched = actual, actual
+	resized.SrcSize++
+	touched.SrcTime--
+
+	var tests = []struct {
+		name string
+		puid Puid_t
+		sp   SrcProp
+		fi   os.FileInfo
+		ok   bool
+	}{
+		{"actual", PUIDcache + 1, actual, fi, true},
+		{"size changed", PUIDcache + 2, resized, fi, false},
+		{"time changed", PUIDcache + 3, touched, fi, false},
+		{"file deleted", PUIDcache + 4, actual, nil, false},
+		{"no source", PUIDcache + 5, SrcProp{}, fi, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ExifStoreSet(session, test.puid, ExifProp{Orientation: OrientCw, SrcProp: test.sp}); err != nil {
+				t.Fatal(err)
+			}
+			var tp, ok = ExifStoreGet(session, test.puid, test.fi)
+			if ok != test.ok {
+				t.Fatalf("expected found %v, got %v", test.ok, ok)
+			}
+			if ok && tp.Orientation != OrientCw || !ok && tp.Orientation != 0 {
+				t.Errorf("unexpected orientation %d", tp.Orientation)
+			}
+		})
+	}
+}
+
+// The End.
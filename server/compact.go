@@ -0,0 +1,243 @@
+package hms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/schwarzlichtbezirk/wpk"
+)
+
+// Compaction errors.
+var (
+	ErrCompactRun = errors.New("compaction of this cache is already in progress")
+)
+
+// CompactStat is the result of cache compaction.
+type CompactStat struct {
+	Count   int   `json:"count" yaml:"count" xml:"count"`       // number of files kept in cache
+	Removed int   `json:"removed" yaml:"removed" xml:"removed"` // number of removed orphaned files
+	OldSize int64 `json:"oldsize" yaml:"oldsize" xml:"oldsize"` // size of data file before compaction
+	NewSize int64 `json:"newsize" yaml:"newsize" xml:"newsize"` // size of data file after compaction
+}
+
+// CacheSrcPath returns path of source file for given cache key.
+// Tiles keys have dimensions suffix after '?' sign.
+func CacheSrcPath(fkey string) string {
+	if i := strings.LastIndexByte(fkey, '?'); i >= 0 {
+		return fkey[:i]
+	}
+	return fkey
+}
+
+// copyTagset copies file with given tagset from one package to another,
+// with all tags except of position and path.
+func copyTagset(dst *FileCache, src *wpk.Package, fkey string, ts wpk.TagsetRaw) (err error) {
+	var data []byte
+	if err = func() (err error) {
+		var file wpk.RFile
+		if file, err = src.OpenTagset(ts); err != nil {
+			return
+		}
+		defer file.Close()
+		data, err = io.ReadAll(file)
+		return
+	}(); err != nil {
+		return
+	}
+
+	var nts wpk.TagsetRaw
+	if nts, err = dst.Package.PackData(dst.wpf, bytes.NewReader(data), fkey); err != nil {
+		return
+	}
+	var tsi = ts.Iterator()
+	for tsi.Next() {
+		switch tsi.TID() {
+		case wpk.TIDoffset, wpk.TIDsize, wpk.TIDpath:
+			continue
+		}
+		nts = nts.Put(tsi.TID(), tsi.Tag())
+	}
+	dst.Package.SetTagset(fkey, nts)
+	return
+}
+
+// Compact rewrites the cache without files that were deleted, replaced,
+// or made from modified or deleted sources. The cache remains available
+// during compaction, new package replaces old one on completion.
+func (fc *FileCache) Compact(ctx context.Context) (cs CompactStat, err error) {
+	if !fc.cmpct.CompareAndSwap(false, true) {
+		err = ErrCompactRun
+		return
+	}
+	defer fc.cmpct.Store(false)
+
+	var pkgpath = wpk.MakeTagsPath(fc.fpath)
+	var datpath = wpk.MakeDataPath(fc.fpath)
+	var tmppath = path.Join(path.Dir(fc.fpath), "~"+path.Base(fc.fpath))
+	var tmppkg = wpk.MakeTagsPath(tmppath)
+	var tmpdat = wpk.MakeDataPath(tmppath)
+	if fi, err := os.Stat(datpath); err == nil {
+		cs.OldSize = fi.Size()
+	}
+
+	// create new package
+	var t0 = time.Now()
+	var nc = &FileCache{
+		Package: wpk.NewPackage(),
+	}
+	var swapped bool
+	defer func() {
+		if !swapped {
+			if nc.wpt != nil {
+				nc.wpt.Close()
+			}
+			if nc.wpf != nil {
+				nc.wpf.Close()
+			}
+			os.Remove(tmppkg)
+			os.Remove(tmpdat)
+		}
+	}()
+	if nc.wpt, err = os.OpenFile(tmppkg, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755); err != nil {
+		return
+	}
+	if nc.wpf, err = os.OpenFile(tmpdat, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755); err != nil {
+		return
+	}
+	nc.Init(&wpk.Header{})
+	if err = nc.Begin(nc.wpt, nc.wpf); err != nil {
+		return
+	}
+	nc.SetInfo(wpk.CopyTagset(fc.GetInfo()).
+		Set(wpk.TIDmtime, wpk.UnixmsTag(t0)))
+
+	// copy actual files while old package is available
+	var stats = map[string]fs.FileInfo{}
+	var actual = func(fkey string, ts wpk.TagsetRaw) bool {
+		var fpath = CacheSrcPath(fkey)
+		var fi, ok = stats[fpath]
+		if !ok {
+			fi, _ = JP.Stat(fpath)
+			stats[fpath] = fi
+		}
+		return !IsTagsetOutdated(ts, fi)
+	}
+	var copied = map[string]wpk.TagsetRaw{}
+	var keys []string
+	fc.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		keys = append(keys, fkey)
+		return true
+	})
+	for _, fkey := range keys {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		default:
+		}
+
+		var ts, ok = fc.GetTagset(fkey)
+		if !ok || !actual(fkey, ts) {
+			continue
+		}
+		if err = func() error {
+			fc.mux.RLock()
+			defer fc.mux.RUnlock()
+			return copyTagset(nc, fc.Package, fkey, ts)
+		}(); err != nil {
+			return
+		}
+		copied[fkey] = ts
+	}
+
+	// replace old package by new one
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+
+	// take files changed during compaction
+	var live = map[string]struct{}{}
+	fc.Package.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		live[fkey] = struct{}{}
+		if cts, ok := copied[fkey]; ok {
+			if bytes.Equal(cts, ts) {
+				return true
+			}
+			nc.Package.DelTagset(fkey)
+		}
+		if !actual(fkey, ts) {
+			return true
+		}
+		if err = copyTagset(nc, fc.Package, fkey, ts); err != nil {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	var deleted []string
+	nc.Package.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		if _, ok := live[fkey]; !ok {
+			deleted = append(deleted, fkey) // was deleted during compaction
+		}
+		return true
+	})
+	for _, fkey := range deleted {
+		nc.Package.DelTagset(fkey)
+	}
+	cs.Count = nc.TagsetNum()
+	cs.Removed = len(live) - cs.Count
+
+	if err = nc.Package.Sync(nc.wpt, nc.wpf); err != nil {
+		return
+	}
+	var errs [4]error
+	errs[0] = nc.wpt.Close()
+	errs[1] = nc.wpf.Close()
+	nc.wpt, nc.wpf = nil, nil
+	if err = errors.Join(errs[:2]...); err != nil {
+		return
+	}
+
+	// old package should be consistent if it will be reopened on failure
+	if err = fc.Package.Sync(fc.wpt, fc.wpf); err != nil {
+		return
+	}
+	errs[0] = fc.wpt.Close()
+	errs[1] = fc.wpf.Close()
+	if errs[2] = os.Rename(tmpdat, datpath); errs[2] == nil {
+		errs[3] = os.Rename(tmppkg, pkgpath)
+	}
+	swapped = errs[2] == nil && errs[3] == nil
+	if errs[2] == nil && errs[3] != nil {
+		// data part is replaced, but tags part is not,
+		// so drop the cache at all to make it again
+		os.Remove(pkgpath)
+		os.Remove(datpath)
+	}
+
+	// reopen package at old place in any case
+	var oc *FileCache
+	if oc, _, err = InitCacheWriter(fc.fpath); err != nil {
+		err = errors.Join(append(errs[:], err)...)
+		return
+	}
+	fc.Package, fc.wpt, fc.wpf = oc.Package, oc.wpt, oc.wpf
+	if err = errors.Join(errs[:]...); err != nil {
+		return
+	}
+
+	if fi, err := os.Stat(datpath); err == nil {
+		cs.NewSize = fi.Size()
+	}
+	return
+}
+
+// The End.
@@ -0,0 +1,123 @@
+package hms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheSrcPath(t *testing.T) {
+	var tests = []struct {
+		fkey, want string
+	}{
+		{"/music/cover.jpg", "/music/cover.jpg"},
+		{"/photo/img.jpg?1920x1080", "/photo/img.jpg"},
+		{"/photo/what?.jpg?640x360", "/photo/what?.jpg"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := CacheSrcPath(test.fkey); got != test.want {
+			t.Errorf("key %q: expected %q, got %q", test.fkey, test.want, got)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	testPackages(t)
+	var dir = t.TempDir()
+
+	// source files with cached thumbnails
+	var names = []string{"keep.jpg", "modified.jpg", "deleted.jpg", "replaced.jpg"}
+	var data = map[string][]byte{}
+	for i, name := range names {
+		var fpath = filepath.Join(dir, name)
+		if err := os.WriteFile(fpath, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var fi, _ = os.Stat(fpath)
+		data[fpath] = bytes.Repeat([]byte{byte(i + 1)}, 4096)
+		if err := ThumbPkg.PutFile(fpath, MediaData{
+			Data:    data[fpath],
+			Mime:    MimeWebp,
+			Time:    fi.ModTime(),
+			SrcSize: fi.Size(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var keep = filepath.Join(dir, "keep.jpg")
+	var replaced = filepath.Join(dir, "replaced.jpg")
+
+	// make cached files outdated
+	if err := os.WriteFile(filepath.Join(dir, "modified.jpg"), []byte("new content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "deleted.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	// replaced thumbnail leaves dead data in package
+	var fi, _ = os.Stat(replaced)
+	ThumbPkg.DelTagset(replaced)
+	data[replaced] = []byte("replaced thumbnail")
+	if err := ThumbPkg.PutFile(replaced, MediaData{
+		Data:    data[replaced],
+		Mime:    MimeWebp,
+		Time:    fi.ModTime(),
+		SrcSize: fi.Size(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ThumbPkg.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	var cs, err = ThumbPkg.Compact(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs.Count != 2 || cs.Removed != 2 {
+		t.Errorf("expected 2 kept and 2 removed files, got %d and %d", cs.Count, cs.Removed)
+	}
+	if cs.NewSize >= cs.OldSize {
+		t.Errorf("package is not compacted: %d -> %d", cs.OldSize, cs.NewSize)
+	}
+	for _, fpath := range []string{keep, replaced} {
+		var md MediaData
+		if md, err = ThumbPkg.GetData(fpath); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(md.Data, data[fpath]) {
+			t.Errorf("%s: content mismatch after compaction", filepath.Base(fpath))
+		}
+		if md.Mime != MimeWebp {
+			t.Errorf("%s: tags are lost after compaction", filepath.Base(fpath))
+		}
+	}
+	if ThumbPkg.HasTagset(filepath.Join(dir, "modified.jpg")) || ThumbPkg.HasTagset(filepath.Join(dir, "deleted.jpg")) {
+		t.Error("outdated files are kept")
+	}
+
+	// package is usable after compaction
+	var fpath = filepath.Join(dir, "new.jpg")
+	if err = ThumbPkg.PutFile(fpath, MediaData{Data: []byte("new"), Mime: MimeWebp, Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if !ThumbPkg.HasTagset(fpath) {
+		t.Error("can not put file after compaction")
+	}
+}
+
+func TestCompactRun(t *testing.T) {
+	testPackages(t)
+	ThumbPkg.cmpct.Store(true)
+	defer ThumbPkg.cmpct.Store(false)
+	if _, err := ThumbPkg.Compact(context.Background()); !errors.Is(err, ErrCompactRun) {
+		t.Fatalf("expected error %v, got %v", ErrCompactRun, err)
+	}
+}
+
+// The End.
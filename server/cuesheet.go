@@ -0,0 +1,249 @@
+package hms
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CUE sheet errors.
+var (
+	ErrCueTrack = errors.New("CUE sheet track number is out of range")
+	ErrCueIndex = errors.New("CUE sheet index has bad time format")
+	ErrCueFile  = errors.New("CUE sheet track has no file")
+	ErrCueNone  = errors.New("CUE sheet has no tracks")
+)
+
+// CueFrames is number of CD frames per second used at CUE sheet time positions.
+const CueFrames = 75
+
+// CueTrack is audio track of CUE sheet.
+type CueTrack struct {
+	Number    int
+	Title     string
+	Performer string
+	File      string        // system path of audio file
+	Start     time.Duration // position of track in audio file
+	End       time.Duration // position of next track in the same file, or zero for track up to end of file
+}
+
+// Duration returns track duration, or zero if track lasts up to end of file.
+func (ct *CueTrack) Duration() time.Duration {
+	if ct.End > 0 {
+		return ct.End - ct.Start
+	}
+	return 0
+}
+
+// CueSheet is CD layout description with tracks at single-file album images.
+type CueSheet struct {
+	Tracks []CueTrack
+	Dest   string // CUE sheet file destination
+	// album description
+	Title     string
+	Performer string
+	Genre     string
+	Date      string
+}
+
+// cuefields splits line of CUE sheet to fields,
+// quoted fields can contain spaces.
+func cuefields(line string) (fields []string) {
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return
+		}
+		if line[0] == '"' {
+			if i := strings.IndexByte(line[1:], '"'); i >= 0 {
+				fields = append(fields, line[1:i+1])
+				line = line[i+2:]
+			} else {
+				fields = append(fields, line[1:])
+				return
+			}
+		} else {
+			if i := strings.IndexAny(line, " \t"); i >= 0 {
+				fields = append(fields, line[:i])
+				line = line[i:]
+			} else {
+				fields = append(fields, line)
+				return
+			}
+		}
+	}
+}
+
+// CueTime parses CUE sheet time position in "mm:ss:ff" format,
+// where ff is CD frames number, 75 frames per second.
+func CueTime(s string) (pos time.Duration, err error) {
+	var a = strings.Split(s, ":")
+	if len(a) != 3 {
+		return 0, ErrCueIndex
+	}
+	var mm, ss, ff int
+	if mm, err = strconv.Atoi(a[0]); err != nil {
+		return 0, ErrCueIndex
+	}
+	if ss, err = strconv.Atoi(a[1]); err != nil || ss >= 60 {
+		return 0, ErrCueIndex
+	}
+	if ff, err = strconv.Atoi(a[2]); err != nil || ff >= CueFrames {
+		return 0, ErrCueIndex
+	}
+	pos = time.Duration(mm)*time.Minute + time.Duration(ss)*time.Second +
+		time.Duration(ff)*time.Second/CueFrames
+	return
+}
+
+// ReadCue reads CUE sheet content. Files are given relative to CUE sheet
+// destination. Content that is not valid UTF-8 is read as ISO 8859-1.
+func (cs *CueSheet) ReadCue(r io.Reader) (num int64, err error) {
+	var body []byte
+	if body, err = io.ReadAll(r); err != nil {
+		return
+	}
+	num = int64(len(body))
+	var text = strings.TrimPrefix(string(body), utf8bom)
+	if !utf8.ValidString(text) {
+		var runes = make([]rune, len(text))
+		for i := 0; i < len(text); i++ {
+			runes[i] = rune(text[i])
+		}
+		text = string(runes)
+	}
+
+	var pl = Playlist{Dest: cs.Dest}
+	var file string
+	var track *CueTrack
+	var scanner = bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		var fields = cuefields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "REM":
+			if len(fields) > 2 {
+				switch strings.ToUpper(fields[1]) {
+				case "GENRE":
+					cs.Genre = fields[2]
+				case "DATE":
+					cs.Date = fields[2]
+				}
+			}
+		case "FILE":
+			file = ToSlash(pl.AbsPath(fields[1]))
+		case "TRACK":
+			var n int
+			if n, err = strconv.Atoi(fields[1]); err != nil || n < 1 || n > 99 {
+				return num, ErrCueTrack
+			}
+			if file == "" {
+				return num, ErrCueFile
+			}
+			cs.Tracks = append(cs.Tracks, CueTrack{
+				Number:    n,
+				Performer: cs.Performer,
+				File:      file,
+			})
+			track = &cs.Tracks[len(cs.Tracks)-1]
+		case "TITLE":
+			if track != nil {
+				track.Title = fields[1]
+			} else {
+				cs.Title = fields[1]
+			}
+		case "PERFORMER":
+			if track != nil {
+				track.Performer = fields[1]
+			} else {
+				cs.Performer = fields[1]
+			}
+		case "INDEX":
+			if track != nil && len(fields) > 2 && fields[1] == "01" {
+				if track.Start, err = CueTime(fields[2]); err != nil {
+					return
+				}
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if len(cs.Tracks) == 0 {
+		return num, ErrCueNone
+	}
+
+	// each track lasts up to next track in the same file
+	for i := range cs.Tracks[:len(cs.Tracks)-1] {
+		if next := &cs.Tracks[i+1]; next.File == cs.Tracks[i].File {
+			cs.Tracks[i].End = next.Start
+		}
+	}
+	return
+}
+
+// Track returns track with given number.
+func (cs *CueSheet) Track(n int) (ct CueTrack, ok bool) {
+	for _, ct = range cs.Tracks {
+		if ct.Number == n {
+			return ct, true
+		}
+	}
+	return
+}
+
+// CueRead reads CUE sheet file with given system path.
+func CueRead(syspath string) (cs CueSheet, err error) {
+	var file fs.File
+	if file, err = JP.Open(syspath); err != nil {
+		return
+	}
+	defer file.Close()
+
+	cs.Dest = path.Dir(syspath)
+	_, err = cs.ReadCue(file)
+	return
+}
+
+// CueTrackPath returns virtual path of CUE sheet track.
+// It's placed inside CUE sheet file as in folder, and has
+// extension of audio file to be recognized as audio.
+func CueTrackPath(cuepath string, ct *CueTrack) string {
+	return JoinPath(cuepath, fmt.Sprintf("%02d%s", ct.Number, GetFileExt(ct.File)))
+}
+
+// CueTrackSplit returns CUE sheet path and track number for
+// given virtual track path. It does not check that CUE sheet exists.
+func CueTrackSplit(syspath string) (cuepath string, n int, ok bool) {
+	cuepath = path.Dir(syspath)
+	if !IsTypeCue(GetFileExt(cuepath)) {
+		return "", 0, false
+	}
+	var name = path.Base(syspath)
+	var err error
+	if n, err = strconv.Atoi(strings.TrimSuffix(name, path.Ext(name))); err != nil || n < 1 || n > 99 {
+		return "", 0, false
+	}
+	return cuepath, n, true
+}
+
+// CueTrackName returns displayed file name of CUE sheet track.
+func CueTrackName(ct *CueTrack) string {
+	var title = ct.Title
+	if title == "" {
+		title = fmt.Sprintf("Track %02d", ct.Number)
+	}
+	title = strings.NewReplacer("/", "-", "\\", "-").Replace(title)
+	return fmt.Sprintf("%02d. %s%s", ct.Number, title, GetFileExt(ct.File))
+}
+
+// The End.
@@ -0,0 +1,80 @@
+//go:build integration
+
+package hms
+
+import (
+	"os"
+	"testing"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+// Data source names of databases for integration tests. Tests
+// for database are skipped if its data source name is not set.
+// Given databases should be empty, all tables are dropped after test.
+var testdialects = []struct {
+	driver string
+	env    string
+}{
+	{"postgres", "HMS_TEST_PGSQL"},
+	{"mysql", "HMS_TEST_MYSQL"},
+}
+
+// testDialect opens database with data source name given at environment
+// variable, applies migrations, and drops created tables after test.
+func testDialect(t *testing.T, driver, env string, ms Migrations) *xorm.Engine {
+	t.Helper()
+	var dsn = os.Getenv(env)
+	if dsn == "" {
+		t.Skipf("%s is not set", env)
+	}
+	var engine, err = xorm.NewEngine(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetMapper(names.GonicMapper{})
+	var drop = func() {
+		var tables, _ = engine.DBMetas()
+		for _, table := range tables {
+			engine.DropTables(table.Name)
+		}
+	}
+	drop()
+	t.Cleanup(func() {
+		drop()
+		engine.Close()
+	})
+	if _, err = ms.Up(engine, 0); err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func TestDialectUserlog(t *testing.T) {
+	for _, d := range testdialects {
+		t.Run(d.driver, func(t *testing.T) {
+			var engine = testDialect(t, d.driver, d.env, UserlogMigrations)
+			var prev = XormUserlog
+			XormUserlog = engine
+			t.Cleanup(func() { XormUserlog = prev })
+			testUaidStore(t)
+		})
+	}
+}
+
+func TestDialectPathStore(t *testing.T) {
+	for _, d := range testdialects {
+		t.Run(d.driver, func(t *testing.T) {
+			var engine = testDialect(t, d.driver, d.env, StorageMigrations)
+			var prev, prevpc = XormStorage, PathCache
+			XormStorage, PathCache = engine, NewBimap[Puid_t, string]()
+			t.Cleanup(func() { XormStorage, PathCache = prev, prevpc })
+			var session = engine.NewSession()
+			defer session.Close()
+			testPathStore(t, session)
+		})
+	}
+}
+
+// The End.
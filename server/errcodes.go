@@ -309,6 +309,297 @@ const (
 	AEC_usrlst_asts
 	AEC_usrlst_fost
 	AEC_usrlst_post
+
+	// stat/topfiles
+
+	AEC_topfiles_nobind
+	AEC_topfiles_query
+
+	// stat/topdirs
+
+	AEC_topdirs_nobind
+	AEC_topdirs_query
+
+	// stat/shares
+
+	AEC_shares_nobind
+	AEC_shares_query
+
+	// stat/activity
+
+	AEC_activity_nobind
+	AEC_activity_unit
+	AEC_activity_query
+
+	// stat/topclients
+
+	AEC_topclients_nobind
+	AEC_topclients_query
+
+	// userlog/clean
+
+	AEC_ulclean_run
+	AEC_ulclean_fail
+
+	// userlog/export
+
+	AEC_ulexport_nobind
+	AEC_ulexport_badtbl
+	AEC_ulexport_badfmt
+	AEC_ulexport_query
+
+	// playlist/save
+
+	AEC_plsave_nobind
+	AEC_plsave_badacc
+	AEC_plsave_noacc
+	AEC_plsave_deny
+	AEC_plsave_badpath
+	AEC_plsave_hidden
+	AEC_plsave_access
+	AEC_plsave_stat
+	AEC_plsave_notdir
+	AEC_plsave_badname
+	AEC_plsave_badtrack
+	AEC_plsave_over
+	AEC_plsave_write
+	AEC_plsave_tracks
+
+	// playlist/edit
+
+	AEC_pledit_nobind
+	AEC_pledit_badacc
+	AEC_pledit_noacc
+	AEC_pledit_deny
+	AEC_pledit_badpath
+	AEC_pledit_hidden
+	AEC_pledit_access
+	AEC_pledit_read
+	AEC_pledit_remove
+	AEC_pledit_order
+	AEC_pledit_badtrack
+	AEC_pledit_write
+	AEC_pledit_tracks
+
+	// playlist/download
+
+	AEC_pldown_nobind
+	AEC_pldown_badacc
+	AEC_pldown_noacc
+	AEC_pldown_badpath
+	AEC_pldown_hidden
+	AEC_pldown_access
+	AEC_pldown_noshr
+	AEC_pldown_format
+	AEC_pldown_nocat
+	AEC_pldown_stat
+	AEC_pldown_read
+	AEC_pldown_list
+
+	// folder/cue
+
+	AEC_folder_cue
+	AEC_folder_cuetracks
+
+	// file/cue
+
+	AEC_media_cueread
+	AEC_media_cuetrack
+	AEC_media_cuehidden
+	AEC_media_cueaccess
+	AEC_media_cuegone
+	AEC_media_cueopen
+	AEC_media_cuecut
+
+	// folder/smart
+
+	AEC_folder_nosmart
+	AEC_folder_smart
+
+	// playlist/download smart
+
+	AEC_pldown_nosmart
+	AEC_pldown_smart
+
+	// smart/list
+
+	AEC_smartlist_badacc
+	AEC_smartlist_noacc
+	AEC_smartlist_deny
+
+	// smart/set
+
+	AEC_smartset_nobind
+	AEC_smartset_badacc
+	AEC_smartset_noacc
+	AEC_smartset_deny
+	AEC_smartset_rules
+	AEC_smartset_nosmart
+
+	// smart/del
+
+	AEC_smartdel_nobind
+	AEC_smartdel_badacc
+	AEC_smartdel_noacc
+	AEC_smartdel_deny
+
+	// folder/state
+
+	AEC_folder_favs
+	AEC_folder_recent
+
+	// state/get
+
+	AEC_stateget_nobind
+	AEC_stateget_badacc
+	AEC_stateget_noacc
+	AEC_stateget_deny
+	AEC_stateget_fail
+
+	// state/fav
+
+	AEC_statefav_nobind
+	AEC_statefav_badacc
+	AEC_statefav_noacc
+	AEC_statefav_deny
+	AEC_statefav_nopath
+	AEC_statefav_hidden
+	AEC_statefav_access
+	AEC_statefav_fail
+
+	// state/play
+
+	AEC_stateplay_nobind
+	AEC_stateplay_badacc
+	AEC_stateplay_noacc
+	AEC_stateplay_deny
+	AEC_stateplay_nopath
+	AEC_stateplay_hidden
+	AEC_stateplay_access
+	AEC_stateplay_fail
+
+	// state/forget
+
+	AEC_stateforget_nobind
+	AEC_stateforget_badacc
+	AEC_stateforget_noacc
+	AEC_stateforget_deny
+	AEC_stateforget_fail
+
+	// folder/tags
+
+	AEC_folder_notag
+	AEC_folder_tag
+	AEC_folder_tags
+
+	// tag/add
+
+	AEC_tagadd_nobind
+	AEC_tagadd_badacc
+	AEC_tagadd_noacc
+	AEC_tagadd_deny
+	AEC_tagadd_name
+	AEC_tagadd_fail
+
+	// tag/del
+
+	AEC_tagdel_nobind
+	AEC_tagdel_badacc
+	AEC_tagdel_noacc
+	AEC_tagdel_deny
+	AEC_tagdel_name
+	AEC_tagdel_fail
+
+	// tag/rate
+
+	AEC_tagrate_nobind
+	AEC_tagrate_badacc
+	AEC_tagrate_noacc
+	AEC_tagrate_deny
+	AEC_tagrate_range
+	AEC_tagrate_fail
+
+	// tag/get
+
+	AEC_tagget_nobind
+	AEC_tagget_badacc
+	AEC_tagget_noacc
+	AEC_tagget_fail
+
+	// tag/cloud
+
+	AEC_tagcloud_badacc
+	AEC_tagcloud_noacc
+	AEC_tagcloud_noshr
+	AEC_tagcloud_fail
+
+	// edit/tags
+
+	AEC_edttags_nobind
+	AEC_edttags_badacc
+	AEC_edttags_noacc
+	AEC_edttags_deny
+	AEC_edttags_badpath
+	AEC_edttags_hidden
+	AEC_edttags_access
+	AEC_edttags_format
+	AEC_edttags_write
+	AEC_edttags_extract
+
+	AEC_edttags_number
+
+	// edit/exif
+
+	AEC_edtexif_nobind
+	AEC_edtexif_badacc
+	AEC_edtexif_noacc
+	AEC_edtexif_deny
+	AEC_edtexif_badpath
+	AEC_edtexif_hidden
+	AEC_edtexif_access
+	AEC_edtexif_format
+	AEC_edtexif_write
+	AEC_edtexif_extract
+
+	// compact
+
+	AEC_compact_run
+	AEC_compact_thumb
+	AEC_compact_tiles
+
+	// tile
+
+	AEC_tile_nospec
+
+	// path store
+
+	AEC_drvadd_store
+	AEC_cldadd_store
+	AEC_plsave_store
+	AEC_pldown_store
+	AEC_smartlist_store
+	AEC_smartset_store
+	AEC_edtren_store
+
+	// playlist remote
+
+	AEC_plsave_remote
+	AEC_pledit_remote
+
+	// dup/list
+
+	AEC_duplist_nobind
+	AEC_duplist_badacc
+	AEC_duplist_noacc
+	AEC_duplist_deny
+	AEC_duplist_baddist
+	AEC_duplist_hashes
+	AEC_duplist_list
+
+	// metrics
+
+	AEC_metrics_off
+	AEC_metrics_token
 )
 
 // HTTP error messages
@@ -318,20 +609,30 @@ var (
 	ErrNotSys  = errors.New("root PUID does not refers to file system path")
 	ErrPathOut = errors.New("path cannot refers outside root PUID")
 
-	ErrArgNoHD   = errors.New("'hd' parameter not recognized")
-	ErrArgNoDim  = errors.New("bad tiles dimensions")
-	ErrArgZDim   = errors.New("dimensions can not be zero")
-	ErrNotDir    = errors.New("path is not directory")
-	ErrNoPath    = errors.New("path is not found")
-	ErrDeny      = errors.New("access denied for specified authorization")
-	ErrNotShared = errors.New("access to specified resource does not shared")
-	ErrHidden    = errors.New("access to specified file path is disabled")
-	ErrNoAccess  = errors.New("profile has no access to specified file path")
-	ErrNoCat     = errors.New("specified category does not found")
-	ErrNotPlay   = errors.New("file can not be read as playlist")
-	ErrFileOver  = errors.New("to many files with same names contains")
-	ErrShapeCirc = errors.New("circle must contains 1 coordinates point")
-	ErrShapePoly = errors.New("polygon must contains 3 coordinates points at least")
-	ErrShapeRect = errors.New("rectangle must contains 4 coordinates points")
-	ErrShapeBad  = errors.New("shape is not recognized")
+	ErrArgNoHD    = errors.New("'hd' parameter not recognized")
+	ErrArgNoDim   = errors.New("bad tiles dimensions")
+	ErrArgZDim    = errors.New("dimensions can not be zero")
+	ErrNoTileSpec = errors.New("tiles are not configured")
+	ErrNotDir     = errors.New("path is not directory")
+	ErrNoPath     = errors.New("path is not found")
+	ErrDeny       = errors.New("access denied for specified authorization")
+	ErrNotShared  = errors.New("access to specified resource does not shared")
+	ErrHidden     = errors.New("access to specified file path is disabled")
+	ErrNoAccess   = errors.New("profile has no access to specified file path")
+	ErrNoCat      = errors.New("specified category does not found")
+	ErrNotPlay    = errors.New("file can not be read as playlist")
+	ErrFileOver   = errors.New("to many files with same names contains")
+	ErrShapeCirc  = errors.New("circle must contains 1 coordinates point")
+	ErrShapePoly  = errors.New("polygon must contains 3 coordinates points at least")
+	ErrShapeRect  = errors.New("rectangle must contains 4 coordinates points")
+	ErrShapeBad   = errors.New("shape is not recognized")
+	ErrHashDist   = errors.New("hashes distance is out of range")
+	ErrBadUnit    = errors.New("time unit should be 'hour' or 'day'")
+	ErrPlName     = errors.New("playlist name should be file name with extension of known playlist format")
+	ErrPlTrack    = errors.New("playlist track should be a file")
+	ErrPlIndex    = errors.New("track index is out of range")
+	ErrPlOrder    = errors.New("tracks order should be permutation of tracks indexes")
+	ErrPlRemote   = errors.New("playlist can be written only at local file system")
+	ErrMetricsOff = errors.New("metrics are disabled by configuration")
+	ErrMetricsTok = errors.New("metrics token is absent or invalid")
 )
@@ -0,0 +1,32 @@
+package hms
+
+import (
+	"testing"
+)
+
+func TestErrCodes(t *testing.T) {
+	// codes of released builds are used by clients, they must not be changed
+	var tests = []struct {
+		name string
+		code int
+		want int
+	}{
+		{"AEC_null", AEC_null, 0},
+		{"AEC_gpsscan_noacc", AEC_gpsscan_noacc, 203},
+		{"AEC_usrlst_nobind", AEC_usrlst_nobind, 204},
+		{"AEC_usrlst_post", AEC_usrlst_post, 207},
+	}
+	for _, test := range tests {
+		if test.code != test.want {
+			t.Errorf("%s: expected code %d, got %d", test.name, test.want, test.code)
+		}
+	}
+	// new codes are appended after released ones
+	for _, code := range []int{AEC_topfiles_nobind, AEC_duplist_nobind, AEC_duplist_list} {
+		if code <= AEC_usrlst_post {
+			t.Errorf("code %d is placed among released codes", code)
+		}
+	}
+}
+
+// The End.
@@ -0,0 +1,287 @@
+package hms
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/schwarzlichtbezirk/hms/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Types of server events.
+const (
+	EvLog    = "log"    // new log entry
+	EvImgScn = "imgscn" // images processing queue statistics was changed
+	EvBgScan = "bgscan" // background scanning state was changed
+	EvOnline = "online" // client became online or offline
+	EvOpen   = "open"   // some file or folder was opened by client
+)
+
+const (
+	evbufsize = 256              // buffer size of subscriber channel
+	evwatch   = time.Second      // period of states watching
+	evping    = 15 * time.Second // period of keep-alive comments in stream
+)
+
+// Event is notification sent to subscribers.
+type Event struct {
+	Type string
+	Data any
+}
+
+// OnlineEvent is notification about client that became online or offline.
+type OnlineEvent struct {
+	CID    uint64 `json:"cid" yaml:"cid" xml:"cid,attr"`          // client ID
+	Online bool   `json:"online" yaml:"online" xml:"online,attr"` // client is online now
+	Count  int    `json:"count" yaml:"count" xml:"count"`         // number of clients online
+}
+
+// OpenEvent is notification about opened file or folder.
+type OpenEvent struct {
+	CID     uint64 `json:"cid" yaml:"cid" xml:"cid,attr"`        // client ID
+	AID     uint64 `json:"aid" yaml:"aid" xml:"aid,attr"`        // access profile ID
+	UID     uint64 `json:"uid" yaml:"uid" xml:"uid,attr"`        // user profile ID
+	Path    string `json:"path" yaml:"path" xml:"path"`          // system path
+	Latency int    `json:"latency" yaml:"latency" xml:"latency"` // event latency, in milliseconds, or -1 if it file
+	Time    Unix_t `json:"time" yaml:"time" xml:"time"`          // time of event rise
+}
+
+// EventHub delivers server events to subscribers.
+type EventHub struct {
+	mux    sync.Mutex
+	subs   map[chan Event]struct{}
+	num    atomic.Int32
+	closed bool
+}
+
+// Events is singleton hub of server events.
+var Events EventHub
+
+// Count returns number of subscribers.
+func (h *EventHub) Count() int {
+	return int(h.num.Load())
+}
+
+// Subscribe returns new channel that receives events.
+// Channel is closed when hub is closed.
+func (h *EventHub) Subscribe() chan Event {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	var ch = make(chan Event, evbufsize)
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	if h.subs == nil {
+		h.subs = map[chan Event]struct{}{}
+	}
+	h.subs[ch] = struct{}{}
+	h.num.Store(int32(len(h.subs)))
+	return ch
+}
+
+// Unsubscribe removes given channel from subscribers and closes it.
+func (h *EventHub) Unsubscribe(ch chan Event) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+		h.num.Store(int32(len(h.subs)))
+	}
+}
+
+// Publish sends event to all subscribers. Event is dropped
+// for subscriber which does not read its channel in time.
+func (h *EventHub) Publish(typ string, data any) {
+	if h.num.Load() == 0 {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	var ev = Event{Type: typ, Data: data}
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Close closes all subscribers channels, and rejects new subscribers.
+func (h *EventHub) Close() {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	for ch := range h.subs {
+		close(ch)
+	}
+	h.subs = nil
+	h.closed = true
+	h.num.Store(0)
+}
+
+// onlineset returns set of clients which are online now.
+func onlineset() map[uint64]struct{} {
+	uamux.Lock()
+	defer uamux.Unlock()
+
+	var now = time.Now()
+	var set = map[uint64]struct{}{}
+	for uaid, t := range UserOnline {
+		if now.Sub(t) < Cfg.OnlineTimeout {
+			set[UaMap[uaid]] = struct{}{}
+		}
+	}
+	return set
+}
+
+// Watch forwards log entries to subscribers, and periodically
+// checks images processing, background scanning and online clients
+// to notify subscribers about changes. Hub is closed on exit.
+func (h *EventHub) Watch(exitctx context.Context) {
+	Log.SetHook(func(li cfg.LogStore) {
+		h.Publish(EvLog, li)
+	})
+	defer Log.SetHook(nil)
+	defer h.Close()
+
+	var lastscan ScanStat
+	var lastbg BgScanStat
+	var lastonline map[uint64]struct{}
+	var ticker = time.NewTicker(evwatch)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-exitctx.Done():
+			return
+		}
+		if h.Count() == 0 {
+			lastonline = nil
+			continue
+		}
+
+		if st := ImgScanner.Stat(); st != lastscan {
+			lastscan = st
+			h.Publish(EvImgScn, st)
+		}
+		if st := BgScanState(); st != lastbg {
+			lastbg = st
+			h.Publish(EvBgScan, st)
+		}
+
+		var online = onlineset()
+		if lastonline != nil {
+			for cid := range online {
+				if _, ok := lastonline[cid]; !ok {
+					h.Publish(EvOnline, OnlineEvent{CID: cid, Online: true, Count: len(online)})
+				}
+			}
+			for cid := range lastonline {
+				if _, ok := online[cid]; !ok {
+					h.Publish(EvOnline, OnlineEvent{CID: cid, Online: false, Count: len(online)})
+				}
+			}
+		}
+		lastonline = online
+	}
+}
+
+// InsertOpen stores event of opened file or folder,
+// and notifies events subscribers about it.
+func InsertOpen(ost *OpenStore) {
+	if _, err := XormUserlog.InsertOne(ost); err != nil {
+		Log.Error(err)
+		return
+	}
+	if Events.Count() > 0 {
+		uamux.Lock()
+		var cid = UaMap[uint64(ost.UAID)]
+		uamux.Unlock()
+		Events.Publish(EvOpen, OpenEvent{
+			CID:     cid,
+			AID:     ost.AID,
+			UID:     ost.UID,
+			Path:    ost.Path,
+			Latency: ost.Latency,
+			Time:    UnixJS(ost.Time),
+		})
+	}
+}
+
+// APIHANDLER
+// SpiEvents streams server events by Server-Sent Events protocol.
+// Optional "types" query parameter is comma-separated list of
+// event types to receive, all events are sent by default.
+// Events of opened files and log entries are sent only to
+// authorized clients.
+func SpiEvents(c *gin.Context) {
+	var filter map[string]bool
+	if s := c.Query("types"); s != "" {
+		filter = map[string]bool{}
+		for _, typ := range strings.Split(s, ",") {
+			filter[strings.TrimSpace(typ)] = true
+		}
+	}
+	var isauth = GetUser(c) != nil
+	var pass = func(typ string) bool {
+		if !isauth && (typ == EvOpen || typ == EvLog) {
+			return false
+		}
+		return filter == nil || filter[typ]
+	}
+
+	var ch = Events.Subscribe()
+	defer Events.Unsubscribe(ch)
+
+	// stream is long-lived, so server write timeout should not break it
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Server", serverhdr)
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// send initial states
+	if pass(EvImgScn) {
+		c.SSEvent(EvImgScn, ImgScanner.Stat())
+	}
+	if pass(EvBgScan) {
+		c.SSEvent(EvBgScan, BgScanState())
+	}
+	if pass(EvOnline) {
+		c.SSEvent(EvOnline, OnlineEvent{Count: len(onlineset())})
+	}
+	c.Writer.Flush()
+
+	var ping = time.NewTicker(evping)
+	defer ping.Stop()
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return // server is shutting down
+			}
+			if pass(ev.Type) {
+				c.SSEvent(ev.Type, ev.Data)
+				c.Writer.Flush()
+			}
+		case <-ping.C:
+			c.Writer.WriteString(": ping\n\n")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// The End.
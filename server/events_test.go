@@ -0,0 +1,132 @@
+package hms
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEventHub(t *testing.T) {
+	var h EventHub
+	var ch1, ch2 = h.Subscribe(), h.Subscribe()
+	if h.Count() != 2 {
+		t.Fatalf("expected 2 subscribers, got %d", h.Count())
+	}
+
+	h.Publish(EvOpen, "a")
+	for i, ch := range []chan Event{ch1, ch2} {
+		if ev := <-ch; ev.Type != EvOpen || ev.Data != "a" {
+			t.Errorf("subscriber %d: unexpected event %v", i+1, ev)
+		}
+	}
+
+	// slow subscriber does not block publisher
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < evbufsize+10; i++ {
+			h.Publish(EvLog, i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publisher is blocked by subscriber")
+	}
+	if n := len(ch1); n != evbufsize {
+		t.Errorf("expected %d buffered events, got %d", evbufsize, n)
+	}
+
+	h.Unsubscribe(ch1)
+	h.Unsubscribe(ch1) // repeated call is safe
+	if h.Count() != 1 {
+		t.Fatalf("expected 1 subscriber, got %d", h.Count())
+	}
+	for range ch1 { // channel is closed after buffered events
+	}
+
+	h.Close()
+	if h.Count() != 0 {
+		t.Fatalf("expected no subscribers after close, got %d", h.Count())
+	}
+	for range ch2 {
+	}
+	if _, ok := <-h.Subscribe(); ok {
+		t.Fatal("subscriber channel is open after hub close")
+	}
+	h.Publish(EvLog, "after close") // should not panic
+}
+
+func TestSpiEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var r = gin.New()
+	r.GET("/api/stat/events", Auth(false), SpiEvents)
+	var srv = httptest.NewServer(r)
+	defer srv.Close()
+
+	testProfile(t, "watcher", "secret")
+	var tests = []struct {
+		name    string
+		query   string
+		auth    bool
+		publish []string // types of published events
+		want    []string // types of received events
+	}{
+		{"filter", "?types=open", true, []string{EvLog, EvOpen}, []string{EvOpen}},
+		{"filter list", "?types=log,%20open", true, []string{EvImgScn, EvLog, EvOpen}, []string{EvLog, EvOpen}},
+		{"all", "", true, []string{EvOpen}, []string{EvImgScn, EvBgScan, EvOnline, EvOpen}},
+		{"anonymous", "", false, []string{EvLog, EvOpen, EvImgScn}, []string{EvImgScn, EvBgScan, EvOnline, EvImgScn}},
+		{"anonymous filter", "?types=open,online,log", false, []string{EvOpen, EvLog, EvOnline}, []string{EvOnline, EvOnline}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var req, _ = http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/stat/events"+test.query, nil)
+			if test.auth {
+				req.Header.Set("Authorization", "Basic "+base64.RawURLEncoding.EncodeToString([]byte("watcher:secret")))
+			}
+			var resp, err = http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+				t.Fatalf("unexpected content type %q", ct)
+			}
+
+			// headers are sent after subscription
+			for _, typ := range test.publish {
+				Events.Publish(typ, map[string]string{"type": typ})
+			}
+
+			var sc = bufio.NewScanner(resp.Body)
+			var got []string
+			for len(got) < len(test.want) && sc.Scan() {
+				if typ, ok := strings.CutPrefix(sc.Text(), "event:"); ok {
+					got = append(got, typ)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Fatalf("expected events %v, got %v", test.want, got)
+			}
+		})
+	}
+	// subscribers are removed on disconnect
+	var deadline = time.Now().Add(5 * time.Second)
+	for Events.Count() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := Events.Count(); n != 0 {
+		t.Fatalf("expected no subscribers after disconnect, got %d", n)
+	}
+}
+
+// The End.
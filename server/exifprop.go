@@ -40,6 +40,8 @@ type ExifProp struct {
 	Longitude  float64 `xorm:"'longitude'" json:"longitude,omitempty" yaml:"longitude,omitempty" xml:"longitude,omitempty"`
 	Altitude   float32 `xorm:"'altitude'" json:"altitude,omitempty" yaml:"altitude,omitempty" xml:"altitude,omitempty"`
 	Satellites string  `xorm:"'satellites'" json:"satellites,omitempty" yaml:"satellites,omitempty" xml:"satellites,omitempty"`
+
+	SrcProp `xorm:"extends" json:"-" yaml:"-" xml:"-"`
 }
 
 // IsZero used to check whether an object is zero to determine whether
@@ -157,9 +159,9 @@ func (tp *ExifProp) Setup(x *exif.Exif) {
 }
 
 // ExifExtract trys to extract EXIF metadata from file.
-func ExifExtract(session *Session, file io.Reader, puid Puid_t) (tp ExifProp, err error) {
+func ExifExtract(session *Session, file io.ReadSeeker, puid Puid_t) (tp ExifProp, err error) {
 	var x *exif.Exif
-	if x, err = exif.Decode(file); err != nil {
+	if x, err = ExifDecode(file); err != nil {
 		return
 	}
 
@@ -168,6 +170,11 @@ func ExifExtract(session *Session, file io.Reader, puid Puid_t) (tp ExifProp, er
 		err = ErrEmptyExif
 		return
 	}
+	if f, ok := file.(fs.File); ok {
+		if fi, _ := f.Stat(); fi != nil {
+			tp.SrcProp.Setup(fi)
+		}
+	}
 	ExifStoreSet(session, puid, tp) // update database
 	return
 }
@@ -180,14 +187,14 @@ func ExtractThumbEXIF(syspath string) (md MediaData, err error) {
 		}
 	}()
 
-	var file fs.File
-	if file, err = JP.Open(syspath); err != nil {
+	var file RFile
+	if file, err = OpenFile(syspath); err != nil {
 		return
 	}
 	defer file.Close()
 
 	var x *exif.Exif
-	if x, err = exif.Decode(file); err != nil {
+	if x, err = ExifDecode(file); err != nil {
 		return
 	}
 
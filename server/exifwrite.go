@@ -0,0 +1,597 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+// EXIF writing errors.
+var (
+	ErrExifFmt   = errors.New("file format does not supported for EXIF writing")
+	ErrExifBad   = errors.New("EXIF data is malformed")
+	ErrExifBig   = errors.New("EXIF data does not fit into JPEG segment")
+	ErrJpegBad   = errors.New("JPEG file is malformed")
+	ErrExifOrint = errors.New("orientation should be in range 1-8")
+	ErrExifGps   = errors.New("latitude and longitude should be given both in valid range")
+)
+
+// TIFF tags used on EXIF writing.
+const (
+	tiffOrientation      = 0x0112
+	tiffExifIFD          = 0x8769
+	tiffGpsIFD           = 0x8825
+	tiffDateTimeOriginal = 0x9003
+	tiffGPSVersionID     = 0x0000
+	tiffGPSLatitudeRef   = 0x0001
+	tiffGPSLatitude      = 0x0002
+	tiffGPSLongitudeRef  = 0x0003
+	tiffGPSLongitude     = 0x0004
+	tiffGPSAltitudeRef   = 0x0005
+	tiffGPSAltitude      = 0x0006
+)
+
+// TIFF field types.
+const (
+	tiffByte     = 1
+	tiffAscii    = 2
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+const (
+	exifhdr     = "Exif\x00\x00"
+	jpegmaxseg  = 0xffff - 2 // maximum JPEG segment content size
+	exiftimefmt = "2006:01:02 15:04:05"
+)
+
+// ExifEdit is the set of EXIF properties to write into JPEG file.
+// Nil fields are left unchanged.
+type ExifEdit struct {
+	DateTime    *time.Time `json:"datetime,omitempty" yaml:"datetime,omitempty" xml:"datetime,omitempty"`          // original date/time of photo
+	Orientation *int       `json:"orientation,omitempty" yaml:"orientation,omitempty" xml:"orientation,omitempty"` // EXIF orientation, 1-8
+	Latitude    *float64   `json:"latitude,omitempty" yaml:"latitude,omitempty" xml:"latitude,omitempty"`
+	Longitude   *float64   `json:"longitude,omitempty" yaml:"longitude,omitempty" xml:"longitude,omitempty"`
+	Altitude    *float32   `json:"altitude,omitempty" yaml:"altitude,omitempty" xml:"altitude,omitempty"`
+	NoGPS       bool       `json:"nogps,omitempty" yaml:"nogps,omitempty" xml:"nogps,omitempty"` // remove GPS information
+}
+
+// Check validates given values.
+func (ee *ExifEdit) Check() error {
+	if ee.Orientation != nil && (*ee.Orientation < OrientNormal || *ee.Orientation > OrientAcw) {
+		return ErrExifOrint
+	}
+	if (ee.Latitude == nil) != (ee.Longitude == nil) {
+		return ErrExifGps
+	}
+	if ee.Latitude != nil && (math.Abs(*ee.Latitude) > 90 || math.Abs(*ee.Longitude) > 180) {
+		return ErrExifGps
+	}
+	return nil
+}
+
+// ExifWrite writes given EXIF properties into JPEG file at local file system.
+// Image data is not recompressed.
+func ExifWrite(syspath string, ee *ExifEdit) (err error) {
+	if !IsTypeJPEG(GetFileExt(syspath)) {
+		return ErrExifFmt
+	}
+	if err = ee.Check(); err != nil {
+		return
+	}
+	return FileRewrite(syspath, func(r io.ReadSeeker, w io.Writer) error {
+		return JpegWriteExif(r, w, ee)
+	})
+}
+
+// TIFF tag of pointer to interoperability IFD.
+const tiffInteropIFD = 0xa005
+
+// tiffsubs is the list of tags with pointers to nested IFDs.
+var tiffsubs = []uint16{tiffExifIFD, tiffGpsIFD, tiffInteropIFD}
+
+// tiffsize returns size of one value of TIFF field type,
+// or zero for unknown types.
+func tiffsize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
+
+// tiffEntry is IFD entry. Value contains data of new field, or it is nil
+// for field read from source, then Raw value/offset bytes are kept.
+type tiffEntry struct {
+	Tag   uint16
+	Type  uint16
+	Count uint32
+	Raw   [4]byte // value or offset to value
+	Value []byte  // data of new field, or nil
+}
+
+// tiffDir is IFD with its nested IFDs.
+type tiffDir struct {
+	off   uint32              // offset of source IFD, zero for new IFD
+	size  int                 // number of entries at source IFD
+	list  []tiffEntry         // entries of IFD
+	subs  map[uint16]*tiffDir // nested IFDs by pointer tags
+	next  *tiffDir            // next IFD in chain
+	dirty bool                // entries were changed
+}
+
+// tiffEditor reads all IFDs reachable from the header, and writes back
+// only changed IFDs. All source data is kept at its offsets, so offsets
+// inside maker notes and fields of unknown types remain valid. Changed
+// IFD is written at its place if it fits there, or appended to the end.
+// Data of replaced and removed fields is wiped, new data is written
+// at place of replaced data if it fits there, or appended to the end.
+type tiffEditor struct {
+	bo interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	}
+	src     []byte          // original TIFF data
+	data    []byte          // new TIFF data
+	visited map[uint32]bool // offsets of read IFDs to prevent loops
+}
+
+func (te *tiffEditor) readIFD(off uint32) (list []tiffEntry, next uint32, err error) {
+	if int64(off)+2 > int64(len(te.src)) {
+		return nil, 0, ErrExifBad
+	}
+	var n = int(te.bo.Uint16(te.src[off:]))
+	var pos = int(off) + 2
+	if pos+n*12+4 > len(te.src) {
+		return nil, 0, ErrExifBad
+	}
+	list = make([]tiffEntry, n)
+	for i := range list {
+		var b = te.src[pos+i*12:]
+		var e = &list[i]
+		e.Tag = te.bo.Uint16(b)
+		e.Type = te.bo.Uint16(b[2:])
+		e.Count = te.bo.Uint32(b[4:])
+		copy(e.Raw[:], b[8:12])
+		if voff, size := te.extern(*e); size > 0 && voff+size > int64(len(te.src)) {
+			return nil, 0, ErrExifBad
+		}
+	}
+	next = te.bo.Uint32(te.src[pos+n*12:])
+	return
+}
+
+// extern returns offset and size of source field data placed
+// outside of IFD entry, or zero size if there is no such data.
+func (te *tiffEditor) extern(e tiffEntry) (off, size int64) {
+	if e.Value != nil {
+		return
+	}
+	if size = int64(tiffsize(e.Type)) * int64(e.Count); size <= 4 {
+		return 0, 0
+	}
+	return int64(te.bo.Uint32(e.Raw[:])), size
+}
+
+// readDir reads IFD at given offset with all nested IFDs and chain.
+func (te *tiffEditor) readDir(off uint32) (dir *tiffDir, err error) {
+	if te.visited[off] {
+		return nil, ErrExifBad
+	}
+	te.visited[off] = true
+	dir = &tiffDir{off: off, subs: map[uint16]*tiffDir{}}
+	var next uint32
+	if dir.list, next, err = te.readIFD(off); err != nil {
+		return
+	}
+	dir.size = len(dir.list)
+	for _, tag := range tiffsubs {
+		if ptr, ok := te.pointer(dir.list, tag); ok {
+			if dir.subs[tag], err = te.readDir(ptr); err != nil {
+				return
+			}
+		}
+	}
+	if next != 0 {
+		if dir.next, err = te.readDir(next); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// pointer returns offset or length stored at LONG or SHORT entry with given tag.
+func (te *tiffEditor) pointer(list []tiffEntry, tag uint16) (uint32, bool) {
+	for _, e := range list {
+		if e.Tag == tag && e.Count == 1 {
+			switch e.Type {
+			case tiffLong:
+				return te.bo.Uint32(e.Raw[:]), true
+			case tiffShort:
+				return uint32(te.bo.Uint16(e.Raw[:])), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// entry makes new entry with given data.
+func (te *tiffEditor) entry(tag, typ uint16, count uint32, v []byte) (e tiffEntry) {
+	e = tiffEntry{Tag: tag, Type: typ, Count: count, Value: v}
+	if len(v) <= 4 {
+		copy(e.Raw[:], v)
+	}
+	return
+}
+
+// long makes entry with single LONG value.
+func (te *tiffEditor) long(tag uint16, v uint32) tiffEntry {
+	return te.entry(tag, tiffLong, 1, te.bo.AppendUint32(nil, v))
+}
+
+// align pads data to word boundary.
+func (te *tiffEditor) align() {
+	if len(te.data)%2 != 0 {
+		te.data = append(te.data, 0)
+	}
+}
+
+// wipe clears source data of given entry, and returns its offset
+// and size to be reused.
+func (te *tiffEditor) wipe(e tiffEntry) (off, size int64) {
+	if off, size = te.extern(e); size > 0 {
+		clear(te.data[off : off+size])
+	}
+	return
+}
+
+// set replaces or adds entry in IFD. Data of replaced
+// entry is wiped, and new data is placed there if it fits.
+func (te *tiffEditor) set(dir *tiffDir, e tiffEntry) {
+	dir.dirty = true
+	var i = slices.IndexFunc(dir.list, func(old tiffEntry) bool {
+		return old.Tag == e.Tag
+	})
+	if i < 0 {
+		dir.list = append(dir.list, e)
+		return
+	}
+	if off, size := te.wipe(dir.list[i]); len(e.Value) > 4 && int64(len(e.Value)) <= size {
+		copy(te.data[off:], e.Value)
+		te.bo.PutUint32(e.Raw[:], uint32(off))
+		e.Value = nil // data is placed
+	}
+	dir.list[i] = e
+}
+
+// del removes entry with given tag from IFD and wipes its data.
+func (te *tiffEditor) del(dir *tiffDir, tag uint16) {
+	dir.list = slices.DeleteFunc(dir.list, func(e tiffEntry) bool {
+		if e.Tag == tag {
+			te.wipe(e)
+			dir.dirty = true
+			return true
+		}
+		return false
+	})
+}
+
+// wipeDir clears source IFD with all its fields data and nested IFDs.
+func (te *tiffEditor) wipeDir(dir *tiffDir) {
+	for _, sub := range dir.subs {
+		te.wipeDir(sub)
+	}
+	for _, e := range dir.list {
+		te.wipe(e)
+	}
+	if dir.off != 0 {
+		clear(te.data[dir.off : int(dir.off)+2+dir.size*12+4])
+	}
+}
+
+// writeDir writes changed nested IFDs, chained IFDs, and then
+// the IFD itself if it was changed. It returns offset of the IFD.
+func (te *tiffEditor) writeDir(dir *tiffDir) uint32 {
+	for _, tag := range tiffsubs {
+		if sub, ok := dir.subs[tag]; ok {
+			var off = te.writeDir(sub)
+			if ptr, ok := te.pointer(dir.list, tag); !ok || ptr != off {
+				te.set(dir, te.long(tag, off))
+			}
+		}
+	}
+	var next uint32
+	if dir.next != nil {
+		if next = te.writeDir(dir.next); next != dir.next.off {
+			dir.dirty = true
+		}
+	}
+	if !dir.dirty && dir.off != 0 {
+		return dir.off
+	}
+	return te.writeIFD(dir, next)
+}
+
+// writeIFD writes IFD at its place if it fits there,
+// or to the end of data, and returns its offset.
+func (te *tiffEditor) writeIFD(dir *tiffDir, next uint32) uint32 {
+	slices.SortFunc(dir.list, func(a, b tiffEntry) int {
+		return int(a.Tag) - int(b.Tag)
+	})
+	// data of new fields is appended to the end
+	for i := range dir.list {
+		var e = &dir.list[i]
+		if len(e.Value) > 4 {
+			te.align()
+			te.bo.PutUint32(e.Raw[:], uint32(len(te.data)))
+			te.data = append(te.data, e.Value...)
+			e.Value = nil
+		}
+	}
+	var off = dir.off
+	if off != 0 {
+		clear(te.data[off : int(off)+2+dir.size*12+4])
+	}
+	if off == 0 || len(dir.list) > dir.size {
+		te.align()
+		off = uint32(len(te.data))
+		te.data = append(te.data, make([]byte, 2+len(dir.list)*12+4)...)
+	}
+	var b = te.data[off:]
+	te.bo.PutUint16(b, uint16(len(dir.list)))
+	for i, e := range dir.list {
+		var p = b[2+i*12:]
+		te.bo.PutUint16(p, e.Tag)
+		te.bo.PutUint16(p[2:], e.Type)
+		te.bo.PutUint32(p[4:], e.Count)
+		copy(p[8:12], e.Raw[:])
+	}
+	te.bo.PutUint32(b[2+len(dir.list)*12:], next)
+	return off
+}
+
+func (te *tiffEditor) short(tag uint16, v uint16) tiffEntry {
+	return te.entry(tag, tiffShort, 1, te.bo.AppendUint16(nil, v))
+}
+
+func (te *tiffEditor) ascii(tag uint16, s string) tiffEntry {
+	var v = append([]byte(s), 0)
+	return te.entry(tag, tiffAscii, uint32(len(v)), v)
+}
+
+func (te *tiffEditor) rationals(tag uint16, vals ...float64) tiffEntry {
+	var v []byte
+	for _, f := range vals {
+		const den = 10000
+		v = te.bo.AppendUint32(v, uint32(math.Round(f*den)))
+		v = te.bo.AppendUint32(v, den)
+	}
+	return te.entry(tag, tiffRational, uint32(len(vals)), v)
+}
+
+// degrees splits absolute value of coordinate to degrees, minutes and seconds.
+func degrees(f float64) (d, m, s float64) {
+	f = math.Abs(f)
+	d = math.Floor(f)
+	f = (f - d) * 60
+	m = math.Floor(f)
+	s = (f - m) * 60
+	return
+}
+
+// subdir returns nested IFD with given pointer tag, or creates new one.
+func subdir(dir *tiffDir, tag uint16) *tiffDir {
+	var sub, ok = dir.subs[tag]
+	if !ok {
+		sub = &tiffDir{subs: map[uint16]*tiffDir{}}
+		dir.subs[tag] = sub
+	}
+	return sub
+}
+
+// Apply writes edited properties into TIFF structure.
+func (te *tiffEditor) Apply(ee *ExifEdit) (err error) {
+	te.visited = map[uint32]bool{}
+	var ifd0 *tiffDir
+	if ifd0, err = te.readDir(te.bo.Uint32(te.src[4:])); err != nil {
+		return
+	}
+	te.data = bytes.Clone(te.src)
+
+	if ee.Orientation != nil {
+		te.set(ifd0, te.short(tiffOrientation, uint16(*ee.Orientation)))
+	}
+
+	if ee.DateTime != nil {
+		var exififd = subdir(ifd0, tiffExifIFD)
+		te.set(exififd, te.ascii(tiffDateTimeOriginal, ee.DateTime.Format(exiftimefmt)))
+	}
+
+	if ee.NoGPS {
+		if sub, ok := ifd0.subs[tiffGpsIFD]; ok {
+			te.wipeDir(sub)
+			delete(ifd0.subs, tiffGpsIFD)
+		}
+		te.del(ifd0, tiffGpsIFD)
+	}
+	if ee.Latitude != nil || ee.Altitude != nil {
+		var gpsifd = subdir(ifd0, tiffGpsIFD)
+		te.set(gpsifd, te.entry(tiffGPSVersionID, tiffByte, 4, []byte{2, 3, 0, 0}))
+		if ee.Latitude != nil {
+			var lat, lon = *ee.Latitude, *ee.Longitude
+			var latref, lonref = "N", "E"
+			if lat < 0 {
+				latref = "S"
+			}
+			if lon < 0 {
+				lonref = "W"
+			}
+			te.set(gpsifd, te.ascii(tiffGPSLatitudeRef, latref))
+			var d, m, s = degrees(lat)
+			te.set(gpsifd, te.rationals(tiffGPSLatitude, d, m, s))
+			te.set(gpsifd, te.ascii(tiffGPSLongitudeRef, lonref))
+			d, m, s = degrees(lon)
+			te.set(gpsifd, te.rationals(tiffGPSLongitude, d, m, s))
+		}
+		if ee.Altitude != nil {
+			var alt = float64(*ee.Altitude)
+			var altref byte
+			if alt < 0 {
+				altref = 1 // below sea level
+			}
+			te.set(gpsifd, te.entry(tiffGPSAltitudeRef, tiffByte, 1, []byte{altref}))
+			te.set(gpsifd, te.rationals(tiffGPSAltitude, math.Abs(alt)))
+		}
+	}
+
+	var off = te.writeDir(ifd0)
+	te.bo.PutUint32(te.data[4:], off)
+	return
+}
+
+// NewTiff creates empty TIFF structure with big-endian byte order.
+func NewTiff() []byte {
+	return []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0}
+}
+
+// TiffEdit returns new TIFF structure with applied EXIF properties.
+// Source data is kept at its offsets, only changed IFDs and new data are written.
+func TiffEdit(data []byte, ee *ExifEdit) (ret []byte, err error) {
+	if len(data) < 8 {
+		return nil, ErrExifBad
+	}
+	var te tiffEditor
+	switch string(data[:4]) {
+	case "II*\x00":
+		te.bo = binary.LittleEndian
+	case "MM\x00*":
+		te.bo = binary.BigEndian
+	default:
+		return nil, ErrExifBad
+	}
+	te.src = data
+	if err = te.Apply(ee); err != nil {
+		return
+	}
+	return te.data, nil
+}
+
+// JPEG markers.
+const (
+	jpegSOI  = 0xd8
+	jpegSOS  = 0xda
+	jpegEOI  = 0xd9
+	jpegAPP0 = 0xe0
+	jpegAPP1 = 0xe1
+)
+
+// JpegWriteExif copies JPEG file from reader to writer with
+// modified EXIF APP1 segment. Image data is copied as is.
+func JpegWriteExif(r io.ReadSeeker, w io.Writer, ee *ExifEdit) (err error) {
+	var soi [2]byte
+	if _, err = io.ReadFull(r, soi[:]); err != nil {
+		return
+	}
+	if soi[0] != 0xff || soi[1] != jpegSOI {
+		return ErrJpegBad
+	}
+
+	// read segments up to start of scan
+	type segment struct {
+		Marker byte
+		Data   []byte
+	}
+	var segs []segment
+	var sos []byte // SOS marker with its header
+	for sos == nil {
+		var hdr [4]byte
+		if _, err = io.ReadFull(r, hdr[:2]); err != nil {
+			return
+		}
+		for hdr[1] == 0xff { // fill bytes
+			if _, err = io.ReadFull(r, hdr[1:2]); err != nil {
+				return
+			}
+		}
+		if hdr[0] != 0xff || hdr[1] == jpegEOI {
+			return ErrJpegBad
+		}
+		if _, err = io.ReadFull(r, hdr[2:]); err != nil {
+			return
+		}
+		var size = int(binary.BigEndian.Uint16(hdr[2:]))
+		if size < 2 {
+			return ErrJpegBad
+		}
+		var data = make([]byte, size-2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return
+		}
+		if hdr[1] == jpegSOS {
+			sos = append(hdr[:], data...)
+		} else {
+			segs = append(segs, segment{hdr[1], data})
+		}
+	}
+
+	// find existing EXIF or make new one
+	var tiff []byte
+	var pos = 0
+	for i, seg := range segs {
+		if seg.Marker == jpegAPP0 {
+			pos = i + 1
+		}
+	}
+	for i, seg := range segs {
+		if seg.Marker == jpegAPP1 && bytes.HasPrefix(seg.Data, []byte(exifhdr)) {
+			tiff = seg.Data[len(exifhdr):]
+			segs = slices.Delete(segs, i, i+1)
+			pos = i
+			break
+		}
+	}
+	if tiff == nil {
+		tiff = NewTiff()
+	}
+	if tiff, err = TiffEdit(tiff, ee); err != nil {
+		return
+	}
+	var app1 = append([]byte(exifhdr), tiff...)
+	if len(app1) > jpegmaxseg {
+		return ErrExifBig
+	}
+	segs = slices.Insert(segs, pos, segment{jpegAPP1, app1})
+
+	// write file
+	if _, err = w.Write(soi[:]); err != nil {
+		return
+	}
+	for _, seg := range segs {
+		var hdr = []byte{0xff, seg.Marker, 0, 0}
+		binary.BigEndian.PutUint16(hdr[2:], uint16(len(seg.Data)+2))
+		if _, err = w.Write(hdr); err != nil {
+			return
+		}
+		if _, err = w.Write(seg.Data); err != nil {
+			return
+		}
+	}
+	if _, err = w.Write(sos); err != nil {
+		return
+	}
+	_, err = io.Copy(w, r)
+	return
+}
+
+// The End.
@@ -0,0 +1,315 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// testJpeg makes small JPEG image without EXIF.
+func testJpeg(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 16)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TIFF tags of pointers to thumbnail data in IFD1.
+const (
+	tiffThumbOffset = 0x0201
+	tiffThumbLength = 0x0202
+)
+
+// testTiffThumb makes little-endian TIFF with IFD0 that has Make field,
+// and IFD1 with thumbnail data.
+func testTiffThumb(thumb []byte) []byte {
+	var bo = binary.LittleEndian
+	var b = []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	// IFD0 at 8: 1 entry, next IFD at 26
+	b = bo.AppendUint16(b, 1)
+	b = bo.AppendUint16(b, 0x010f) // Make
+	b = bo.AppendUint16(b, tiffAscii)
+	b = bo.AppendUint32(b, 4)
+	b = append(b, 'A', 'B', 'C', 0)
+	b = bo.AppendUint32(b, 26)
+	// IFD1 at 26: 2 entries, thumbnail at 56
+	b = bo.AppendUint16(b, 2)
+	b = bo.AppendUint16(b, tiffThumbOffset)
+	b = bo.AppendUint16(b, tiffLong)
+	b = bo.AppendUint32(b, 1)
+	b = bo.AppendUint32(b, 56)
+	b = bo.AppendUint16(b, tiffThumbLength)
+	b = bo.AppendUint16(b, tiffLong)
+	b = bo.AppendUint32(b, 1)
+	b = bo.AppendUint32(b, uint32(len(thumb)))
+	b = bo.AppendUint32(b, 0)
+	return append(b, thumb...)
+}
+
+func TestExifEditCheck(t *testing.T) {
+	var o0, o9, o6 = 0, 9, 6
+	var lat, lon, big = 55.75, 37.61, 200.0
+	var tests = []struct {
+		name string
+		ee   ExifEdit
+		err  error
+	}{
+		{"empty", ExifEdit{}, nil},
+		{"orientation", ExifEdit{Orientation: &o6}, nil},
+		{"orientation low", ExifEdit{Orientation: &o0}, ErrExifOrint},
+		{"orientation high", ExifEdit{Orientation: &o9}, ErrExifOrint},
+		{"coordinates", ExifEdit{Latitude: &lat, Longitude: &lon}, nil},
+		{"latitude only", ExifEdit{Latitude: &lat}, ErrExifGps},
+		{"latitude range", ExifEdit{Latitude: &big, Longitude: &lon}, ErrExifGps},
+		{"longitude range", ExifEdit{Latitude: &lat, Longitude: &big}, ErrExifGps},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.ee.Check(); err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestJpegWriteExif(t *testing.T) {
+	var src = testJpeg(t)
+	var orient = 6
+	var lat, lon = -33.8568, 151.2153
+	var alt float32 = 58
+	var dt = time.Date(2020, 5, 17, 10, 20, 30, 0, time.UTC)
+	var ee = ExifEdit{
+		DateTime:    &dt,
+		Orientation: &orient,
+		Latitude:    &lat,
+		Longitude:   &lon,
+		Altitude:    &alt,
+	}
+
+	var size int
+	var data = src
+	for i := range 5 {
+		var buf bytes.Buffer
+		if err := JpegWriteExif(bytes.NewReader(data), &buf, &ee); err != nil {
+			t.Fatal(err)
+		}
+		data = buf.Bytes()
+		if i == 0 {
+			size = len(data)
+		} else if len(data) != size {
+			t.Fatalf("size changed on pass %d: %d -> %d", i+1, size, len(data))
+		}
+	}
+
+	var x, err = exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tag, _ = x.Get(exif.Orientation)
+	if v, _ := tag.Int(0); tag == nil || v != orient {
+		t.Errorf("orientation mismatch: %v", tag)
+	}
+	var tm time.Time
+	if tm, err = x.DateTime(); err != nil || !tm.Equal(time.Date(2020, 5, 17, 10, 20, 30, 0, time.Local)) {
+		t.Errorf("date/time mismatch: %v, %v", tm, err)
+	}
+	var xlat, xlon float64
+	if xlat, xlon, err = x.LatLong(); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(xlat-lat) > 1e-5 || math.Abs(xlon-lon) > 1e-5 {
+		t.Errorf("coordinates mismatch: %f, %f", xlat, xlon)
+	}
+
+	// remove GPS
+	var buf bytes.Buffer
+	if err = JpegWriteExif(bytes.NewReader(data), &buf, &ExifEdit{NoGPS: true}); err != nil {
+		t.Fatal(err)
+	}
+	// source data is kept at its place, but GPS data is wiped
+	var d, m, s = degrees(lat)
+	var latval = (&tiffEditor{bo: binary.BigEndian}).rationals(tiffGPSLatitude, d, m, s).Value
+	if !bytes.Contains(data, latval) {
+		t.Fatal("latitude is not found at source data")
+	}
+	if buf.Len() != len(data) || bytes.Contains(buf.Bytes(), latval) {
+		t.Errorf("removed GPS data is not wiped: %d -> %d", len(data), buf.Len())
+	}
+	if x, err = exif.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = x.LatLong(); err == nil {
+		t.Error("GPS is not removed")
+	}
+}
+
+func TestTiffEditKeepsData(t *testing.T) {
+	var thumb = []byte{0xff, 0xd8, 1, 2, 3, 4, 5, 0xff, 0xd9}
+	var orient = 3
+	var data = testTiffThumb(thumb)
+	for range 3 {
+		var err error
+		if data, err = TiffEdit(data, &ExifEdit{Orientation: &orient}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var x, err = exif.Decode(bytes.NewReader(append([]byte(exifhdr), data...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tag *tiff.Tag
+	if tag, err = x.Get(exif.Make); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := tag.StringVal(); s != "ABC" {
+		t.Errorf("make mismatch: %q", s)
+	}
+	var b []byte
+	if b, err = x.JpegThumbnail(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, thumb) {
+		t.Errorf("thumbnail mismatch: %v", b)
+	}
+}
+
+func TestTiffEditBad(t *testing.T) {
+	var loop = []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 0, 0, 0, 0, 8}
+	var tests = []struct {
+		name string
+		data []byte
+	}{
+		{"short", []byte{'M', 'M'}},
+		{"magic", []byte{'X', 'X', 0, 42, 0, 0, 0, 8}},
+		{"offset", []byte{'M', 'M', 0, 42, 0, 0, 1, 0}},
+		{"loop", loop},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := TiffEdit(test.data, &ExifEdit{}); err != ErrExifBad {
+				t.Fatalf("expected error %v, got %v", ErrExifBad, err)
+			}
+		})
+	}
+}
+
+// testTiffMaker makes little-endian TIFF with EXIF IFD that has
+// maker note with offset inside it, and field of unknown type.
+// It returns TIFF data and offsets of maker note and vendor data.
+func testTiffMaker() (b []byte, maker, vendor uint32) {
+	var bo = binary.LittleEndian
+	const exifoff, makeroff, vendoroff = 26, 56, 72
+	b = []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	// IFD0 at 8: 1 entry
+	b = bo.AppendUint16(b, 1)
+	b = bo.AppendUint16(b, tiffExifIFD)
+	b = bo.AppendUint16(b, tiffLong)
+	b = bo.AppendUint32(b, 1)
+	b = bo.AppendUint32(b, exifoff)
+	b = bo.AppendUint32(b, 0)
+	// EXIF IFD at 26: 2 entries
+	b = bo.AppendUint16(b, 2)
+	b = bo.AppendUint16(b, 0x927c) // MakerNote
+	b = bo.AppendUint16(b, 7)      // UNDEFINED
+	b = bo.AppendUint32(b, 16)
+	b = bo.AppendUint32(b, makeroff)
+	b = bo.AppendUint16(b, 0xc000) // private field
+	b = bo.AppendUint16(b, 99)     // unknown type
+	b = bo.AppendUint32(b, 1)
+	b = bo.AppendUint32(b, vendoroff)
+	b = bo.AppendUint32(b, 0)
+	// maker note at 56 with offset to vendor data
+	b = append(b, "Vendor\x00\x00"...)
+	b = bo.AppendUint32(b, vendoroff)
+	b = bo.AppendUint32(b, 8)
+	// vendor data at 72
+	b = append(b, "PRIVATE!"...)
+	return b, makeroff, vendoroff
+}
+
+func TestTiffEditMakerNote(t *testing.T) {
+	var orient = 8
+	var lat, lon = 55.75, 37.61
+	var dt = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var tests = []struct {
+		name string
+		ee   ExifEdit
+	}{
+		{"orientation", ExifEdit{Orientation: &orient}},
+		{"date/time", ExifEdit{DateTime: &dt}},
+		{"gps", ExifEdit{Latitude: &lat, Longitude: &lon}},
+		{"no gps", ExifEdit{NoGPS: true}},
+		{"all", ExifEdit{Orientation: &orient, DateTime: &dt, Latitude: &lat, Longitude: &lon}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var src, maker, vendor = testTiffMaker()
+			var data, err = TiffEdit(bytes.Clone(src), &test.ee)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// maker note and vendor data are kept at their offsets
+			if len(data) < len(src) {
+				t.Fatalf("data is truncated: %d -> %d", len(src), len(data))
+			}
+			if !bytes.Equal(data[maker:vendor+8], src[maker:vendor+8]) {
+				t.Errorf("maker note is changed: %q", data[maker:vendor+8])
+			}
+			var te = tiffEditor{bo: binary.LittleEndian, src: data, visited: map[uint32]bool{}}
+			var ifd0 *tiffDir
+			if ifd0, err = te.readDir(te.bo.Uint32(data[4:])); err != nil {
+				t.Fatal(err)
+			}
+			var exififd, ok = ifd0.subs[tiffExifIFD]
+			if !ok {
+				t.Fatal("EXIF IFD is lost")
+			}
+			for _, want := range []struct {
+				tag uint16
+				off uint32
+			}{
+				{0x927c, maker},
+				{0xc000, vendor},
+			} {
+				var i = slices.IndexFunc(exififd.list, func(e tiffEntry) bool { return e.Tag == want.tag })
+				if i < 0 {
+					t.Fatalf("field %04x is lost", want.tag)
+				}
+				if off := te.bo.Uint32(exififd.list[i].Raw[:]); off != want.off {
+					t.Errorf("field %04x: expected offset %d, got %d", want.tag, want.off, off)
+				}
+			}
+			// edited fields are present
+			if test.ee.Orientation != nil {
+				if v, ok := te.pointer(ifd0.list, tiffOrientation); !ok || v != uint32(orient) {
+					t.Errorf("orientation mismatch: %d", v)
+				}
+			}
+			if test.ee.DateTime != nil {
+				var i = slices.IndexFunc(exififd.list, func(e tiffEntry) bool { return e.Tag == tiffDateTimeOriginal })
+				if i < 0 {
+					t.Fatal("date/time is absent")
+				}
+				var off = te.bo.Uint32(exififd.list[i].Raw[:])
+				if s := string(data[off : off+19]); s != dt.Format(exiftimefmt) {
+					t.Errorf("date/time mismatch: %q", s)
+				}
+			}
+			if _, ok := ifd0.subs[tiffGpsIFD]; ok != (test.ee.Latitude != nil) {
+				t.Errorf("expected GPS IFD %v, got %v", test.ee.Latitude != nil, ok)
+			}
+		})
+	}
+}
+
+// The End.
@@ -5,6 +5,7 @@ import (
 	"image"
 	"io"
 	"io/fs"
+	"path"
 	"sync/atomic"
 	"time"
 
@@ -31,6 +32,8 @@ type ExtProp struct {
 	Height  int           `xorm:"height" json:"height,omitempty" yaml:"height,omitempty" xml:"height,omitempty"` // image height in pixels
 	PBLen   time.Duration `xorm:"pblen" json:"pblen,omitempty" yaml:"pblen,omitempty" xml:"pblen,omitempty"`     // playback length
 	BitRate int           `xorm:"bitrate" json:"bitrate,omitempty" yaml:"bitrate,omitempty" xml:"bitrate,omitempty"`
+
+	SrcProp `xorm:"extends" json:"-" yaml:"-" xml:"-"`
 }
 
 type ExtStat struct {
@@ -54,11 +57,16 @@ func TagsExtract(fpath string, session *Session, buf *StoreBuf, es *ExtStat, get
 
 	var puid, _ = PathStorePUID(session, fpath)
 	var ext = GetFileExt(fpath)
+	var sp SrcProp
+	if fi, _ := JP.Stat(fpath); fi != nil {
+		sp.Setup(fi)
+	}
 	if IsTypeEXIF(ext) {
 		var ek ExifKit
 		var imc image.Config
 		ek.Tags = TagDis
 		ek.ETmb = MimeDis
+		ek.ExtProp.SrcProp = sp
 		defer func() {
 			p, xp = ek, ek.ExtProp
 			buf.Push(session, ExtStore{
@@ -75,19 +83,35 @@ func TagsExtract(fpath string, session *Session, buf *StoreBuf, es *ExtStat, get
 		}
 		defer file.Close()
 
-		if imc, _, err = image.DecodeConfig(file); err != nil {
+		if imc, _, err = ImageDecodeConfig(file, ext); err != nil {
 			return
 		}
 		ek.Tags = TagImg // image config is exist
 		ek.Width, ek.Height = imc.Width, imc.Height
 		atomic.AddUint64(&es.ImgCount, 1)
 
+		// import XMP rating and keywords only at first extraction,
+		// to keep tags and rating that was changed by user later
+		if puid != 0 && !ExtStoreHas(session, puid) {
+			if _, err = file.Seek(0, io.SeekStart); err != nil {
+				return
+			}
+			if xmp, _ := XmpRead(file); !xmp.IsZero() {
+				if err := buf.Push(session, XmpStore{
+					Puid: puid,
+					Prop: xmp,
+				}); err != nil {
+					Log.Warnf("xmp: %s, error %v", path.Base(fpath), err)
+				}
+			}
+		}
+
 		if _, err = file.Seek(0, io.SeekStart); err != nil {
 			return
 		}
 		var x *exif.Exif
-		if x, err = exif.Decode(file); err != nil {
-			if errors.Is(err, io.EOF) {
+		if x, err = ExifDecode(file); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, ErrBmffNoExif) {
 				err = nil
 				return
 			}
@@ -100,6 +124,7 @@ func TagsExtract(fpath string, session *Session, buf *StoreBuf, es *ExtStat, get
 		ek.Tags = TagExif // EXIF is exist
 		atomic.AddUint64(&es.ExifCount, 1)
 
+		ek.ExifProp.SrcProp = sp
 		GpsCachePut(puid, ek.ExifProp)
 		buf.Push(session, ExifStore{
 			Puid: puid,
@@ -128,6 +153,7 @@ func TagsExtract(fpath string, session *Session, buf *StoreBuf, es *ExtStat, get
 		var imc image.Config
 		xp.Tags = TagDis
 		xp.ETmb = MimeDis
+		xp.SrcProp = sp
 		defer func() {
 			p = xp
 			buf.Push(session, ExtStore{
@@ -154,6 +180,7 @@ func TagsExtract(fpath string, session *Session, buf *StoreBuf, es *ExtStat, get
 		var ik Id3Kit
 		ik.Tags = TagDis
 		ik.ETmb = MimeDis
+		ik.ExtProp.SrcProp = sp
 		defer func() {
 			p, xp = ik, ik.ExtProp
 			buf.Push(session, ExtStore{
@@ -192,6 +219,7 @@ func TagsExtract(fpath string, session *Session, buf *StoreBuf, es *ExtStat, get
 		ik.Tags = TagID3 // ID3 is exist
 		atomic.AddUint64(&es.Id3Count, 1)
 
+		ik.Id3Prop.SrcProp = sp
 		buf.Push(session, Id3Store{
 			Puid: puid,
 			Prop: ik.Id3Prop,
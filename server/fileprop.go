@@ -36,6 +36,25 @@ func (fp *FileProp) Setup(fi fs.FileInfo) {
 	fp.Time = fi.ModTime()
 }
 
+// SrcProp is size and modify time of source file, that is kept
+// with cached records to check up that they are actual.
+type SrcProp struct {
+	SrcSize int64  `xorm:"'srcsize' default 0" json:"-" yaml:"-" xml:"-"`
+	SrcTime Unix_t `xorm:"'srctime' default 0" json:"-" yaml:"-" xml:"-"`
+}
+
+// Setup fills fields from fs.FileInfo structure.
+func (sp *SrcProp) Setup(fi fs.FileInfo) {
+	sp.SrcSize = fi.Size()
+	sp.SrcTime = UnixJS(fi.ModTime())
+}
+
+// IsOutdated returns true if record was made from another content
+// of source file, or if source file was deleted (fi is nil).
+func (sp SrcProp) IsOutdated(fi fs.FileInfo) bool {
+	return fi == nil || sp.SrcSize != fi.Size() || sp.SrcTime != UnixJS(fi.ModTime())
+}
+
 // PuidProp encapsulated path unique ID value for some properties kit.
 type PuidProp struct {
 	PUID   Puid_t `xorm:"'puid'" json:"puid" yaml:"puid" xml:"puid,attr"`
@@ -44,8 +63,9 @@ type PuidProp struct {
 	Static bool   `xorm:"'static'" json:"static" yaml:"static" xml:"static,attr"`
 }
 
-func (pp *PuidProp) Setup(session *Session, syspath string) {
-	pp.PUID = PathStoreCache(session, syspath)
+func (pp *PuidProp) Setup(session *Session, syspath string) (err error) {
+	pp.PUID, err = PathStoreCache(session, syspath)
+	return
 }
 
 // FileKit is common files properties kit.
@@ -116,4 +136,31 @@ type DirKit struct {
 	DirProp  `xorm:"extends" yaml:",inline"`
 }
 
+// TrackKit is placeholder for playlist track that can not be shown
+// as file: remote track given by URL, or absent local file.
+type TrackKit struct {
+	PuidProp `yaml:",inline"`
+	FileProp `yaml:",inline"`
+	Link     string `json:"link,omitempty" yaml:"link,omitempty" xml:"link,omitempty"`               // URL of remote track
+	Duration int64  `json:"duration,omitempty" yaml:"duration,omitempty" xml:"duration,omitempty"`   // track duration in milliseconds from playlist
+	Missing  bool   `json:"missing,omitempty" yaml:"missing,omitempty" xml:"missing,omitempty,attr"` // local file is absent
+}
+
+// CueProp is CUE sheet track properties chunk.
+type CueProp struct {
+	Track     int           `json:"track" yaml:"track" xml:"track,attr"`
+	Title     string        `json:"title,omitempty" yaml:"title,omitempty" xml:"title,omitempty"`
+	Performer string        `json:"performer,omitempty" yaml:"performer,omitempty" xml:"performer,omitempty"`
+	Start     time.Duration `json:"start" yaml:"start" xml:"start"`                              // track position in audio file
+	End       time.Duration `json:"end,omitempty" yaml:"end,omitempty" xml:"end,omitempty"`      // end position, or zero up to end of file
+	Cut       bool          `json:"cut,omitempty" yaml:"cut,omitempty" xml:"cut,omitempty,attr"` // track is served as cut fragment, otherwise whole audio file is served
+}
+
+// CueKit is CUE sheet track properties kit. Track is
+// represented as virtual file placed inside CUE sheet.
+type CueKit struct {
+	FileKit `yaml:",inline"`
+	CueProp `yaml:",inline"`
+}
+
 // The End.
@@ -81,6 +81,9 @@ var extgrp = map[string]FG_t{
 	".tif":  FGimage,
 	".tiff": FGimage,
 	".dng":  FGimage,
+	".cr2":  FGimage,
+	".nef":  FGimage,
+	".arw":  FGimage,
 	".jpg":  FGimage,
 	".jpe":  FGimage,
 	".jpeg": FGimage,
@@ -89,6 +92,8 @@ var extgrp = map[string]FG_t{
 	".png":  FGimage,
 	".webp": FGimage,
 	".avif": FGimage,
+	".heic": FGimage,
+	".heif": FGimage,
 	".psd":  FGimage,
 	".psb":  FGimage,
 	".jp2":  FGimage,
@@ -227,6 +232,8 @@ var extgrp = map[string]FG_t{
 	".wpl":  FGpacks,
 	".pls":  FGpacks,
 	".asx":  FGpacks,
+	".xspf": FGpacks,
+	".cue":  FGpacks,
 }
 
 // GetFileExt returns file extension converted to lowercase.
@@ -244,9 +251,10 @@ func IsTypeImage(ext string) bool {
 	switch ext {
 	case ".tga", ".bmp", ".dib", ".rle", ".dds",
 		".tif", ".tiff", ".dng", ".psd", ".psb",
+		".cr2", ".nef", ".arw",
 		".jpg", ".jpe", ".jpeg", ".jfif",
 		".jp2", ".jpg2", ".jpx", ".jpm", ".jxr",
-		".gif", ".png", ".webp", ".avif":
+		".gif", ".png", ".webp", ".avif", ".heic", ".heif":
 		return true
 	}
 	return false
@@ -266,7 +274,8 @@ func IsTypeNativeImg(ext string) bool {
 func IsTypeTileImg(ext string) bool {
 	switch ext {
 	case ".jpg", ".jpe", ".jpeg", ".jfif",
-		/*".avif",*/ ".webp", ".png", ".gif":
+		".avif", ".webp", ".png", ".gif", ".heic", ".heif",
+		".dng", ".cr2", ".nef", ".arw":
 		return true
 	}
 	return false
@@ -277,7 +286,29 @@ func IsTypeDecoded(ext string) bool {
 	switch ext {
 	case ".jpg", ".jpe", ".jpeg", ".jfif", ".webp", ".png", ".gif",
 		".tga", ".bmp", ".dib", ".rle", ".dds",
-		".tif", ".tiff", ".dng", ".psd", ".psb":
+		".tif", ".tiff", ".dng", ".psd", ".psb",
+		".cr2", ".nef", ".arw",
+		".avif", ".heic", ".heif":
+		return true
+	}
+	return false
+}
+
+// IsTypeHEIF checks that file extension belongs to images in HEIF container.
+// Decoder of such images applies orientation transformations by itself.
+func IsTypeHEIF(ext string) bool {
+	switch ext {
+	case ".heic", ".heif", ".avif":
+		return true
+	}
+	return false
+}
+
+// IsTypeRAW checks that file extension belongs to camera RAW files
+// in TIFF container with embedded JPEG previews.
+func IsTypeRAW(ext string) bool {
+	switch ext {
+	case ".dng", ".cr2", ".nef", ".arw":
 		return true
 	}
 	return false
@@ -314,9 +345,9 @@ func IsTypeMp3(ext string) bool {
 // IsTypeEXIF checks that file extension belongs to images with EXIF tags.
 func IsTypeEXIF(ext string) bool {
 	switch ext {
-	case ".tif", ".tiff", ".dng",
+	case ".tif", ".tiff", ".dng", ".cr2", ".nef", ".arw",
 		".jpg", ".jpe", ".jpeg", ".jfif",
-		".png", ".webp":
+		".png", ".webp", ".avif", ".heic", ".heif":
 		return true
 	}
 	return false
@@ -331,6 +362,15 @@ func IsTypePlaylist(ext string) bool {
 	return false
 }
 
+// IsTypeCue checks that file extension belongs CUE sheet file.
+func IsTypeCue(ext string) bool {
+	switch ext {
+	case ".cue":
+		return true
+	}
+	return false
+}
+
 // IsTypeISO checks that file extension is ISO-disk.
 func IsTypeISO(ext string) bool {
 	switch ext {
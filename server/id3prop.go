@@ -3,6 +3,7 @@ package hms
 import (
 	"errors"
 	"io"
+	"io/fs"
 	"time"
 
 	"github.com/dhowden/tag"
@@ -21,10 +22,12 @@ type Id3Prop struct {
 	TrackSum int    `xorm:"'tracksum'" json:"tracksum,omitempty" yaml:"tracksum,flow,omitempty" xml:"tracksum,omitempty,attr"`
 	DiscNum  int    `xorm:"'discnum'" json:"discnum,omitempty" yaml:"discnum,flow,omitempty" xml:"discnum,omitempty,attr"`
 	DiscSum  int    `xorm:"'discsum'" json:"discsum,omitempty" yaml:"discsum,flow,omitempty" xml:"discsum,omitempty,attr"`
-	Lyrics   string `json:"lyrics,omitempty" yaml:"lyrics,omitempty" xml:"lyrics,omitempty"`
-	Comment  string `json:"comment,omitempty" yaml:"comment,omitempty" xml:"comment,omitempty"`
+	Lyrics   string `xorm:"text" json:"lyrics,omitempty" yaml:"lyrics,omitempty" xml:"lyrics,omitempty"`
+	Comment  string `xorm:"text" json:"comment,omitempty" yaml:"comment,omitempty" xml:"comment,omitempty"`
 	ThumbLen int    `xorm:"'thumblen'" json:"thumblen,omitempty" yaml:"thumblen,omitempty" xml:"thumblen,omitempty"`
 	TmbMime  Mime_t `xorm:"'tmbmime'" json:"tmbmime,omitempty" yaml:"tmbmime,omitempty" xml:"tmbmime,omitempty"`
+
+	SrcProp `xorm:"extends" json:"-" yaml:"-" xml:"-"`
 }
 
 // IsZero used to check whether an object is zero to determine whether
@@ -71,6 +74,11 @@ func Id3Extract(session *Session, file io.ReadSeeker, puid Puid_t) (tp Id3Prop,
 		err = ErrEmptyID3
 		return
 	}
+	if f, ok := file.(fs.File); ok {
+		if fi, _ := f.Stat(); fi != nil {
+			tp.SrcProp.Setup(fi)
+		}
+	}
 	Id3StoreSet(session, puid, tp) // update database
 	return
 }
@@ -0,0 +1,112 @@
+package hms
+
+import (
+	"image"
+	"math/bits"
+
+	"github.com/disintegration/gift"
+)
+
+// HashProp is perceptual hash of image content.
+type HashProp struct {
+	DHash int64 `xorm:"'dhash' index" json:"dhash" yaml:"dhash" xml:"dhash"`
+
+	SrcProp `xorm:"extends" json:"-" yaml:"-" xml:"-"`
+}
+
+const (
+	HashDistDef = 4  // default Hamming distance for near-identical images
+	HashDistMax = 12 // maximum Hamming distance allowed to search duplicates
+)
+
+// DHash calculates 64-bit difference hash of image. Image is reduced
+// to 9x8 grayscale with given orientation, and each bit of hash is set
+// if pixel is brighter than its right neighbour.
+func DHash(src image.Image, orientation int) uint64 {
+	var wdh, hgt = 9, 8
+	switch orientation {
+	case OrientCwHorzReversed, OrientCw, OrientAcwHorzReversed, OrientAcw:
+		wdh, hgt = hgt, wdh
+	}
+	var fltlst = AddOrientFilter([]gift.Filter{
+		gift.Resize(wdh, hgt, gift.BoxResampling),
+		gift.Grayscale(),
+	}, orientation)
+	var filter = gift.New(fltlst...)
+	var dst = image.NewGray(filter.Bounds(src.Bounds()))
+	filter.Draw(dst, src)
+
+	var hash uint64
+	var b = dst.Bounds()
+	for y := b.Min.Y; y < b.Min.Y+8; y++ {
+		for x := b.Min.X; x < b.Min.X+8; x++ {
+			hash <<= 1
+			if dst.GrayAt(x, y).Y > dst.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HashDist returns Hamming distance between two hashes.
+func HashDist(h1, h2 uint64) int {
+	return bits.OnesCount64(h1 ^ h2)
+}
+
+// HashClusters groups images with hashes that differs at most in dist bits.
+// Hashes are split into dist+1 chunks, so by pigeonhole principle similar
+// hashes have at least one equal chunk, and only such pairs are compared.
+// Returns list of clusters with 2 or more PUIDs in each.
+func HashClusters(list []HashStore, dist int) (clusters [][]Puid_t) {
+	// disjoint set with path compression
+	var parent = make([]int, len(list))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	var chunks = dist + 1
+	for c := range chunks {
+		var lo, hi = 64 * c / chunks, 64 * (c + 1) / chunks
+		var mask = uint64(1)<<(hi-lo) - 1
+		var buckets = map[uint64][]int{}
+		for i, hs := range list {
+			var key = uint64(hs.Prop.DHash) >> lo & mask
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, idx := range buckets {
+			for j, i1 := range idx {
+				for _, i2 := range idx[j+1:] {
+					var r1, r2 = find(i1), find(i2)
+					if r1 == r2 {
+						continue
+					}
+					if HashDist(uint64(list[i1].Prop.DHash), uint64(list[i2].Prop.DHash)) <= dist {
+						parent[r2] = r1
+					}
+				}
+			}
+		}
+	}
+
+	var groups = map[int][]Puid_t{}
+	for i, hs := range list {
+		var r = find(i)
+		groups[r] = append(groups[r], hs.Puid)
+	}
+	for _, g := range groups {
+		if len(g) > 1 {
+			clusters = append(clusters, g)
+		}
+	}
+	return
+}
+
+// The End.
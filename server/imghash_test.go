@@ -0,0 +1,80 @@
+package hms
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestHashDist(t *testing.T) {
+	var tests = []struct {
+		h1, h2 uint64
+		dist   int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xff, 0x0f, 4},
+		{0, ^uint64(0), 64},
+		{0xaaaa, 0x5555, 16},
+	}
+	for _, test := range tests {
+		if d := HashDist(test.h1, test.h2); d != test.dist {
+			t.Errorf("distance %x, %x: expected %d, got %d", test.h1, test.h2, test.dist, d)
+		}
+	}
+}
+
+func TestHashClusters(t *testing.T) {
+	var hs = func(puid Puid_t, h uint64) HashStore {
+		return HashStore{Puid: puid, Prop: HashProp{DHash: int64(h)}}
+	}
+	var tests = []struct {
+		name string
+		list []HashStore
+		dist int
+		want [][]Puid_t
+	}{
+		{"empty", nil, 4, nil},
+		{"equal", []HashStore{hs(1, 0xdead), hs(2, 0xdead)}, 0, [][]Puid_t{{1, 2}}},
+		{"no pair", []HashStore{hs(1, 0), hs(2, 0xff)}, 4, nil},
+		{"near", []HashStore{hs(1, 0), hs(2, 0x0f), hs(3, 0xff00ff00ff)}, 4, [][]Puid_t{{1, 2}}},
+		{"chain", []HashStore{hs(1, 0), hs(2, 0x3), hs(3, 0xf)}, 2, [][]Puid_t{{1, 2, 3}}},
+		{"high bits", []HashStore{hs(1, 1<<63), hs(2, 1<<63|1), hs(3, 1)}, 1, [][]Puid_t{{1, 2, 3}}},
+		{"two groups", []HashStore{hs(1, 0), hs(2, ^uint64(0)), hs(3, 1), hs(4, ^uint64(1))}, 1, [][]Puid_t{{1, 3}, {2, 4}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got = HashClusters(test.list, test.dist)
+			for _, c := range got {
+				slices.Sort(c)
+			}
+			slices.SortFunc(got, func(a, b []Puid_t) int { return int(a[0]) - int(b[0]) })
+			if !slices.EqualFunc(got, test.want, slices.Equal) {
+				t.Fatalf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestDHash(t *testing.T) {
+	// horizontal gradient, brighter at left
+	var img = image.NewGray(image.Rect(0, 0, 90, 80))
+	for y := range 80 {
+		for x := range 90 {
+			img.SetGray(x, y, color.Gray{Y: uint8(255 - x*2)})
+		}
+	}
+	if h := DHash(img, OrientNormal); h != ^uint64(0) {
+		t.Errorf("expected all bits set, got %x", h)
+	}
+	if h := DHash(img, OrientHorzReversed); h != 0 {
+		t.Errorf("expected no bits set for mirrored image, got %x", h)
+	}
+	var flat = image.NewGray(image.Rect(0, 0, 50, 50))
+	if h := DHash(flat, OrientNormal); h != 0 {
+		t.Errorf("expected zero hash for flat image, got %x", h)
+	}
+}
+
+// The End.
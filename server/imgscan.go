@@ -53,7 +53,7 @@ func (puid ThumbPath) Cache() {
 	}
 
 	var tp, _ = tilecache.Peek(Puid_t(puid))
-	tp.SetTile(tm0, md.Mime)
+	tp.SetThumb(md.Mime)
 	tilecache.Poke(Puid_t(puid), tp)
 }
 
@@ -78,8 +78,7 @@ func (tile TilePath) Cache() {
 	}
 
 	var tp, _ = tilecache.Peek(tile.Puid)
-	var tm = TM_t(tile.Wdh / htcell)
-	tp.SetTile(tm, md.Mime)
+	tp.SetTile(tile.Wdh, tile.Hgt, md.Mime)
 	tilecache.Poke(tile.Puid, tp)
 }
 
@@ -96,160 +95,343 @@ func GetScanThreadsNum() int {
 	return thrnum
 }
 
+// Prio_t is priority of image processing job.
+type Prio_t int
+
+const (
+	PrioVisible Prio_t = iota // item is displayed on client screen now
+	PrioPage                  // item is at opened client page out of screen
+	PrioBack                  // item is scheduled by server itself
+	PrioNum                   // number of priorities
+)
+
+// scanjob is queued image processing job.
+type scanjob struct {
+	arg  Cacher
+	cid  uint64    // ID of client who has put the job
+	prio Prio_t    // job priority
+	refs int       // number of requests merged into this job
+	put  time.Time // time of first request
+	del  bool      // job was removed or moved, and should be skipped
+}
+
+// scanlane is round-robin queue of jobs with the same priority,
+// each client have its own FIFO queue in the lane.
+type scanlane struct {
+	order []uint64              // clients with pending jobs in round-robin order
+	jobs  map[uint64][]*scanjob // pending jobs of each client
+}
+
+// push puts job at the end of client's queue.
+func (l *scanlane) push(job *scanjob) {
+	if l.jobs == nil {
+		l.jobs = map[uint64][]*scanjob{}
+	}
+	if _, ok := l.jobs[job.cid]; !ok {
+		l.order = append(l.order, job.cid)
+	}
+	l.jobs[job.cid] = append(l.jobs[job.cid], job)
+}
+
+// pop takes first actual job of next client in round-robin order.
+func (l *scanlane) pop() *scanjob {
+	for len(l.order) > 0 {
+		var cid = l.order[0]
+		l.order = l.order[1:]
+		var jobs = l.jobs[cid]
+		for len(jobs) > 0 && jobs[0].del {
+			jobs = jobs[1:] // skip removed jobs
+		}
+		if len(jobs) == 0 {
+			delete(l.jobs, cid)
+			continue
+		}
+		var job = jobs[0]
+		if jobs = jobs[1:]; len(jobs) > 0 {
+			l.jobs[cid] = jobs
+			l.order = append(l.order, cid) // client goes to the end of order
+		} else {
+			delete(l.jobs, cid)
+		}
+		return job
+	}
+	return nil
+}
+
+// ScanStat is image processing queue statistics.
+type ScanStat struct {
+	Queued   [PrioNum]int `json:"queued" yaml:"queued" xml:"queued>prio"`  // number of pending jobs for each priority
+	Clients  int          `json:"clients" yaml:"clients" xml:"clients"`    // number of clients with pending jobs
+	Running  int          `json:"running" yaml:"running" xml:"running"`    // number of jobs in progress
+	Done     uint64       `json:"done" yaml:"done" xml:"done"`             // number of completed jobs
+	Merged   uint64       `json:"merged" yaml:"merged" xml:"merged"`       // number of requests merged with queued or running jobs
+	Canceled uint64       `json:"canceled" yaml:"canceled" xml:"canceled"` // number of jobs removed from queue before processing
+	WaitAvg  int64        `json:"waitavg" yaml:"waitavg" xml:"waitavg"`    // average time in milliseconds of waiting in queue
+	WaitMax  int64        `json:"waitmax" yaml:"waitmax" xml:"waitmax"`    // maximum time in milliseconds of waiting in queue
+	WaitLast int64        `json:"waitlast" yaml:"waitlast" xml:"waitlast"` // time in milliseconds of waiting in queue of last started job
+	WorkAvg  int64        `json:"workavg" yaml:"workavg" xml:"workavg"`    // average time in milliseconds of job processing
+	Oldest   int64        `json:"oldest" yaml:"oldest" xml:"oldest"`       // time in milliseconds of waiting of oldest pending job
+}
+
 // ImgScanner is singleton for thumbnails producing
 // with single queue to prevent overload.
 var ImgScanner scanner
 
 type scanner struct {
-	put    chan Cacher
-	del    chan Cacher
+	mux      sync.Mutex
+	lanes    [PrioNum]scanlane
+	pending  map[Cacher]*scanjob // queued jobs
+	inflight map[Cacher]*scanjob // jobs in progress
+	wake     chan struct{}       // signals to workers about new jobs
+
+	started  uint64        // number of started jobs
+	done     uint64        // number of completed jobs
+	merged   uint64        // number of merged requests
+	canceled uint64        // number of canceled jobs
+	waitsum  time.Duration // summary waiting time of started jobs
+	waitmax  time.Duration // maximum waiting time of started jobs
+	waitlast time.Duration // waiting time of last started job
+	worksum  time.Duration // summary processing time of completed jobs
+
 	cancel context.CancelFunc
 	fin    context.Context
 }
 
+// init makes internal data on first usage. Mutex should be locked.
+func (s *scanner) init() {
+	if s.pending == nil {
+		s.pending = map[Cacher]*scanjob{}
+		s.inflight = map[Cacher]*scanjob{}
+		s.wake = make(chan struct{}, 1)
+	}
+}
+
+// signal wakes up one of idle workers, if it's present.
+func (s *scanner) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Put adds job to queue with given priority for given client.
+// Identical job already present in queue is moved to higher
+// priority if it's needed, job in progress is not repeated.
+func (s *scanner) Put(arg Cacher, cid uint64, prio Prio_t) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.init()
+
+	if job, ok := s.inflight[arg]; ok {
+		job.refs++
+		s.merged++
+		return
+	}
+	if job, ok := s.pending[arg]; ok {
+		job.refs++
+		s.merged++
+		if prio < job.prio { // move job to lane with higher priority
+			job.del = true
+			var moved = *job
+			moved.cid, moved.prio, moved.del = cid, prio, false
+			s.pending[arg] = &moved
+			s.lanes[prio].push(&moved)
+		}
+		return
+	}
+	var job = &scanjob{
+		arg:  arg,
+		cid:  cid,
+		prio: prio,
+		refs: 1,
+		put:  time.Now(),
+	}
+	s.pending[arg] = job
+	s.lanes[prio].push(job)
+	s.signal()
+}
+
+// Remove cancels one request of job in queue. Job is removed
+// when there is no more requests for it.
+func (s *scanner) Remove(arg Cacher) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.init()
+
+	if job, ok := s.pending[arg]; ok {
+		if job.refs--; job.refs <= 0 {
+			job.del = true
+			delete(s.pending, arg)
+			s.canceled++
+		}
+	}
+}
+
+// pop takes job with highest priority from queue and marks it as running.
+func (s *scanner) pop() *scanjob {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.init()
+
+	for i := range s.lanes {
+		if job := s.lanes[i].pop(); job != nil {
+			delete(s.pending, job.arg)
+			s.inflight[job.arg] = job
+			var wait = time.Since(job.put)
+			s.started++
+			s.waitsum += wait
+			s.waitlast = wait
+			s.waitmax = max(s.waitmax, wait)
+			if len(s.pending) > 0 {
+				s.signal() // wake up next worker
+			}
+			return job
+		}
+	}
+	return nil
+}
+
+// complete removes finished job from running set. Returns true
+// if there is no more pending or running jobs.
+func (s *scanner) complete(job *scanjob, work time.Duration) (idle bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.inflight, job.arg)
+	s.done++
+	s.worksum += work
+	return len(s.pending) == 0 && len(s.inflight) == 0
+}
+
+// Stat returns snapshot of queue statistics.
+func (s *scanner) Stat() (st ScanStat) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var now = time.Now()
+	var clients = map[uint64]struct{}{}
+	for _, job := range s.pending {
+		st.Queued[job.prio]++
+		clients[job.cid] = struct{}{}
+		st.Oldest = max(st.Oldest, now.Sub(job.put).Milliseconds())
+	}
+	st.Clients = len(clients)
+	st.Running = len(s.inflight)
+	st.Done = s.done
+	st.Merged = s.merged
+	st.Canceled = s.canceled
+	if s.started > 0 {
+		st.WaitAvg = (s.waitsum / time.Duration(s.started)).Milliseconds()
+	}
+	st.WaitMax = s.waitmax.Milliseconds()
+	st.WaitLast = s.waitlast.Milliseconds()
+	if s.done > 0 {
+		st.WorkAvg = (s.worksum / time.Duration(s.done)).Milliseconds()
+	}
+	return
+}
+
 // Scan is goroutine for thumbnails scanning.
 func (s *scanner) Scan() {
-	s.put = make(chan Cacher)
-	s.del = make(chan Cacher)
+	s.mux.Lock()
+	s.init()
 	var ctx context.Context
 	ctx, s.cancel = context.WithCancel(context.Background())
 	var cancel context.CancelFunc
 	s.fin, cancel = context.WithCancel(context.Background())
-	defer func() {
-		s.fin, s.cancel = nil, nil
-		cancel()
-	}()
-
-	var thrnum = GetScanThreadsNum()
-	var busy = make([]bool, thrnum)
-	var free = make(chan int)
-	var args = make([]chan Cacher, thrnum)
-	for i := range args {
-		args[i] = make(chan Cacher)
-	}
+	s.mux.Unlock()
+	defer cancel()
 
-	var queue []Cacher
 	var issync uint32 // prevents a series of calls
+	var idlesync = func() {
+		if atomic.LoadUint32(&issync) == 0 {
+			atomic.StoreUint32(&issync, 1)
+			go func() {
+				defer atomic.StoreUint32(&issync, 0)
+				time.Sleep(500 * time.Millisecond)
+				// sync file tags tables of caches
+				if err := ThumbPkg.Sync(); err != nil {
+					Log.Error(err)
+				}
+				if err := TilesPkg.Sync(); err != nil {
+					Log.Error(err)
+				}
+				Log.Info("caches synced")
+			}()
+		}
+	}
 
+	var thrnum = GetScanThreadsNum()
 	var wg sync.WaitGroup
 	wg.Add(thrnum)
-	for i := 0; i < thrnum; i++ {
-		var i = i // localize
+	for range thrnum {
 		go func() {
 			defer wg.Done()
 			for {
+				if job := s.pop(); job != nil {
+					var t0 = time.Now()
+					job.arg.Cache()
+					if s.complete(job, time.Since(t0)) {
+						idlesync()
+					}
+					continue
+				}
 				select {
-				case arg := <-args[i]:
-					arg.Cache()
-					free <- i
+				case <-s.wake:
 				case <-ctx.Done():
 					return
 				}
 			}
 		}()
 	}
-
-	func() {
-		for {
-		selector:
-			select {
-			case arg := <-s.put:
-				var found = false
-				for i, b := range busy {
-					if !b {
-						busy[i] = true
-						args[i] <- arg
-						found = true
-						break
-					}
-				}
-				if !found {
-					queue = append(queue, arg)
-				}
-			case arg := <-s.del:
-				for i, val := range queue {
-					if arg == val {
-						queue = append(queue[:i], queue[i+1:]...)
-						break
-					}
-				}
-			case i := <-free:
-				if len(queue) > 0 {
-					var arg = queue[0]
-					queue = queue[1:]
-					busy[i] = true
-					args[i] <- arg
-				} else {
-					busy[i] = false
-					for _, b := range busy {
-						if b {
-							break selector
-						}
-					}
-					if atomic.LoadUint32(&issync) == 0 {
-						atomic.StoreUint32(&issync, 1)
-						go func() {
-							defer atomic.StoreUint32(&issync, 0)
-							time.Sleep(500 * time.Millisecond)
-							// sync file tags tables of caches
-							if err := ThumbPkg.Sync(); err != nil {
-								Log.Error(err)
-							}
-							if err := TilesPkg.Sync(); err != nil {
-								Log.Error(err)
-							}
-							Log.Info("caches synced")
-						}()
-					}
-				}
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-
 	wg.Wait()
 }
 
 // Stop makes the break to scanning process and returns context
 // that indicates graceful scanning end.
 func (s *scanner) Stop() (ctx context.Context) {
-	ctx = s.fin
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	if s.cancel != nil {
 		s.cancel()
 	}
+	if ctx = s.fin; ctx == nil { // scanning was not started
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+	}
 	return
 }
 
 // AddTags adds system path to queue to extract embedded thumbnail and tags.
-func (s *scanner) AddTags(puid Puid_t) {
-	s.put <- EmbedPath(puid)
+func (s *scanner) AddTags(puid Puid_t, cid uint64, prio Prio_t) {
+	s.Put(EmbedPath(puid), cid, prio)
 }
 
 // RemoveTags removes system path for embedded thumbnail from queue.
 func (s *scanner) RemoveTags(puid Puid_t) {
-	s.del <- EmbedPath(puid)
+	s.Remove(EmbedPath(puid))
 }
 
-// AddTile adds system path to queue to render thumbnail from image
-// source (on tm == tm0), or to render tile with given tile multiplier
-// (on any other tm case).
-func (s *scanner) AddTile(puid Puid_t, tm TM_t) {
-	if tm == tm0 {
-		s.put <- ThumbPath(puid)
-	} else {
-		s.put <- TilePath{puid, int(tm * htcell), int(tm * vtcell)}
-	}
+// AddThumb adds system path to queue to render thumbnail from image source.
+func (s *scanner) AddThumb(puid Puid_t, cid uint64, prio Prio_t) {
+	s.Put(ThumbPath(puid), cid, prio)
 }
 
-// RemoveTile removes system path for thumbnail render (on tm == tm0),
-// or for tile render from queue (on any other tm case).
-func (s *scanner) RemoveTile(puid Puid_t, tm TM_t) {
-	if tm == tm0 {
-		s.del <- ThumbPath(puid)
-	} else {
-		s.del <- TilePath{puid, int(tm * htcell), int(tm * vtcell)}
-	}
+// RemoveThumb removes system path for thumbnail render from queue.
+func (s *scanner) RemoveThumb(puid Puid_t) {
+	s.Remove(ThumbPath(puid))
+}
+
+// AddTile adds system path to queue to render tile with given dimensions.
+func (s *scanner) AddTile(puid Puid_t, wdh, hgt int, cid uint64, prio Prio_t) {
+	s.Put(TilePath{puid, wdh, hgt}, cid, prio)
+}
+
+// RemoveTile removes system path for tile render from queue.
+func (s *scanner) RemoveTile(puid Puid_t, wdh, hgt int) {
+	s.Remove(TilePath{puid, wdh, hgt})
 }
 
 // The End.
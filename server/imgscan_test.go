@@ -0,0 +1,148 @@
+package hms
+
+import (
+	"testing"
+)
+
+// testJob is Cacher implementation that does nothing.
+type testJob int
+
+func (testJob) Cache() {}
+
+func TestScanlane(t *testing.T) {
+	var l scanlane
+	var removed = &scanjob{arg: testJob(3), cid: 1, del: true}
+	for _, job := range []*scanjob{
+		{arg: testJob(1), cid: 1},
+		{arg: testJob(2), cid: 1},
+		removed,
+		{arg: testJob(4), cid: 1},
+		{arg: testJob(5), cid: 2},
+		{arg: testJob(6), cid: 3},
+		{arg: testJob(7), cid: 3},
+	} {
+		l.push(job)
+	}
+	// one job from each client in turn, removed job is skipped
+	var want = []testJob{1, 5, 6, 2, 7, 4}
+	for i, w := range want {
+		var job = l.pop()
+		if job == nil {
+			t.Fatalf("step %d: lane is empty", i)
+		}
+		if job.arg != w {
+			t.Errorf("step %d: expected job %d, got %v", i, w, job.arg)
+		}
+	}
+	if job := l.pop(); job != nil {
+		t.Fatalf("expected empty lane, got job %v", job.arg)
+	}
+	if len(l.jobs) != 0 || len(l.order) != 0 {
+		t.Fatalf("lane is not cleared: %d clients, %d in order", len(l.jobs), len(l.order))
+	}
+}
+
+func TestScannerPrio(t *testing.T) {
+	type put struct {
+		arg  testJob
+		cid  uint64
+		prio Prio_t
+	}
+	var tests = []struct {
+		name string
+		puts []put
+		del  []testJob
+		want []testJob
+	}{
+		{
+			name: "priority order",
+			puts: []put{{1, 1, PrioBack}, {2, 1, PrioPage}, {3, 1, PrioVisible}},
+			want: []testJob{3, 2, 1},
+		},
+		{
+			name: "round-robin within priority",
+			puts: []put{{1, 1, PrioPage}, {2, 1, PrioPage}, {3, 2, PrioPage}},
+			want: []testJob{1, 3, 2},
+		},
+		{
+			name: "raised priority",
+			puts: []put{{1, 1, PrioBack}, {2, 1, PrioBack}, {2, 2, PrioVisible}},
+			want: []testJob{2, 1},
+		},
+		{
+			name: "lower priority is merged",
+			puts: []put{{1, 1, PrioPage}, {2, 1, PrioPage}, {1, 2, PrioBack}},
+			want: []testJob{1, 2},
+		},
+		{
+			name: "removed",
+			puts: []put{{1, 1, PrioPage}, {2, 1, PrioPage}},
+			del:  []testJob{1},
+			want: []testJob{2},
+		},
+		{
+			name: "removed only last request",
+			puts: []put{{1, 1, PrioPage}, {1, 2, PrioPage}, {2, 1, PrioPage}},
+			del:  []testJob{1},
+			want: []testJob{1, 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var s scanner
+			for _, p := range test.puts {
+				s.Put(p.arg, p.cid, p.prio)
+			}
+			for _, arg := range test.del {
+				s.Remove(arg)
+			}
+			var got []testJob
+			for job := s.pop(); job != nil; job = s.pop() {
+				got = append(got, job.arg.(testJob))
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("expected jobs %v, got %v", test.want, got)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("expected jobs %v, got %v", test.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestScannerStat(t *testing.T) {
+	var s scanner
+	s.Put(testJob(1), 1, PrioVisible)
+	s.Put(testJob(2), 2, PrioBack)
+	s.Put(testJob(3), 2, PrioBack)
+	s.Put(testJob(3), 1, PrioBack) // merged
+	s.Put(testJob(4), 1, PrioPage)
+	s.Remove(testJob(4)) // canceled
+
+	var st = s.Stat()
+	if st.Queued != [PrioNum]int{1, 0, 2} || st.Clients != 2 {
+		t.Fatalf("unexpected queue state: %v, %d clients", st.Queued, st.Clients)
+	}
+	if st.Merged != 1 || st.Canceled != 1 {
+		t.Fatalf("expected 1 merged and 1 canceled, got %d and %d", st.Merged, st.Canceled)
+	}
+
+	var job = s.pop()
+	s.Put(testJob(1), 2, PrioVisible) // merged with job in progress
+	if st = s.Stat(); st.Running != 1 || st.Merged != 2 || st.Queued != [PrioNum]int{0, 0, 2} {
+		t.Fatalf("unexpected state of running job: %+v", st)
+	}
+	if s.complete(job, 0) {
+		t.Fatal("scanner is idle while jobs are pending")
+	}
+	for job = s.pop(); job != nil; job = s.pop() {
+		s.complete(job, 0)
+	}
+	if st = s.Stat(); st.Done != 3 || st.Running != 0 || st.Clients != 0 {
+		t.Fatalf("unexpected final state: %+v", st)
+	}
+}
+
+// The End.
@@ -107,6 +107,7 @@ func PrfReadYaml(fname string) (err error) {
 		return
 	}
 	for _, prf := range list {
+		prf.UpgradeSmart()
 		Profiles.Set(prf.ID, prf)
 	}
 	return
@@ -118,16 +119,13 @@ func PrfUpdate() {
 		SqlSession(func(session *Session) (res any, err error) {
 			Profiles.Range(func(id uint64, prf *Profile) bool {
 				Log.Infof("loaded profile id%d, login='%s'", prf.ID, prf.Login)
-				// cache local and remote roots
-				for _, dp := range prf.Local {
-					PathStoreCache(session, dp.Path)
-				}
-				for _, dp := range prf.Remote {
-					PathStoreCache(session, dp.Path)
-				}
-				// cache shares
-				for _, dp := range prf.Shares {
-					PathStoreCache(session, dp.Path)
+				// cache local and remote roots, and shares
+				for _, list := range [][]DiskPath{prf.Local, prf.Remote, prf.Shares} {
+					for _, dp := range list {
+						if _, err := PathStoreCache(session, dp.Path); err != nil {
+							Log.Warnf("id%d: can not cache path %s: %s", prf.ID, dp.Path, err.Error())
+						}
+					}
 				}
 
 				// build shares tables
@@ -0,0 +1,355 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ISO base media file format errors.
+var (
+	ErrBmffBad    = errors.New("ISO base media file structure is malformed")
+	ErrBmffNoMeta = errors.New("'meta' box is not found")
+	ErrBmffNoExif = errors.New("EXIF item is not found in HEIF container")
+	ErrBmffBrand  = errors.New("HEIF container has no brand of supported codec")
+)
+
+const (
+	bmffmetamax = 16 * 1024 * 1024 // maximum size of 'meta' box to read
+	bmffftypmax = 4096             // maximum size of 'ftyp' box to read
+)
+
+// HeicBrands is the list of HEIF brands of images coded by HEVC.
+var HeicBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis"}
+
+// IsBmff checks up that given file header is the header of
+// ISO base media file, such as HEIF, AVIF, MP4.
+func IsBmff(hdr []byte) bool {
+	return len(hdr) >= 12 && string(hdr[4:8]) == "ftyp"
+}
+
+// bmffBox returns content and type of box at beginning of given data,
+// and the rest of data after the box.
+func bmffBox(b []byte) (typ string, content, rest []byte, err error) {
+	if len(b) < 8 {
+		err = ErrBmffBad
+		return
+	}
+	var size = uint64(binary.BigEndian.Uint32(b))
+	typ = string(b[4:8])
+	var hdr uint64 = 8
+	switch size {
+	case 0: // box extends to end of data
+		size = uint64(len(b))
+	case 1:
+		if len(b) < 16 {
+			err = ErrBmffBad
+			return
+		}
+		size, hdr = binary.BigEndian.Uint64(b[8:]), 16
+	}
+	if size < hdr || size > uint64(len(b)) {
+		err = ErrBmffBad
+		return
+	}
+	return typ, b[hdr:size], b[size:], nil
+}
+
+// bmffUint reads big-endian unsigned integer with given size in bytes.
+func bmffUint(b []byte, size int) (v uint64, rest []byte, err error) {
+	if len(b) < size {
+		return 0, nil, ErrBmffBad
+	}
+	for i := range size {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, b[size:], nil
+}
+
+// bmffReadMeta finds top-level 'meta' box in the file and returns its content.
+func bmffReadMeta(r io.ReadSeeker) (meta []byte, err error) {
+	var pos int64
+	for {
+		if _, err = r.Seek(pos, io.SeekStart); err != nil {
+			return
+		}
+		var hdr [16]byte
+		if _, err = io.ReadFull(r, hdr[:8]); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = ErrBmffNoMeta
+			}
+			return
+		}
+		var size = int64(binary.BigEndian.Uint32(hdr[:]))
+		var hdrlen int64 = 8
+		if size == 1 {
+			if _, err = io.ReadFull(r, hdr[8:]); err != nil {
+				return
+			}
+			size, hdrlen = int64(binary.BigEndian.Uint64(hdr[8:])), 16
+		}
+		if string(hdr[4:8]) == "meta" {
+			if size == 0 || size-hdrlen > bmffmetamax {
+				return nil, ErrBmffBad
+			}
+			meta = make([]byte, size-hdrlen)
+			_, err = io.ReadFull(r, meta)
+			return
+		}
+		if size < hdrlen {
+			return nil, ErrBmffNoMeta // box up to end of file, or broken
+		}
+		pos += size
+	}
+}
+
+// bmffExifItem returns identifier of 'Exif' item from 'iinf' box content.
+func bmffExifItem(iinf []byte) (id uint32, ok bool, err error) {
+	if len(iinf) < 4 {
+		return 0, false, ErrBmffBad
+	}
+	var ver = iinf[0]
+	var b = iinf[4:]
+	var cntsize = 2
+	if ver > 0 {
+		cntsize = 4
+	}
+	if _, b, err = bmffUint(b, cntsize); err != nil {
+		return
+	}
+	for len(b) > 0 {
+		var typ string
+		var infe []byte
+		if typ, infe, b, err = bmffBox(b); err != nil {
+			return
+		}
+		if typ != "infe" || len(infe) < 4 || infe[0] < 2 {
+			continue
+		}
+		var idsize = 2
+		if infe[0] >= 3 {
+			idsize = 4
+		}
+		var v uint64
+		var p = infe[4:]
+		if v, p, err = bmffUint(p, idsize); err != nil {
+			return
+		}
+		if len(p) < 6 {
+			return 0, false, ErrBmffBad
+		}
+		if string(p[2:6]) == "Exif" { // skip item_protection_index
+			return uint32(v), true, nil
+		}
+	}
+	return
+}
+
+// bmffExtent is location of item data chunk in the file.
+type bmffExtent struct {
+	Offset uint64
+	Length uint64
+}
+
+// bmffItemLoc returns extents of item with given identifier from 'iloc' box content.
+func bmffItemLoc(iloc []byte, itemid uint32) (ext []bmffExtent, err error) {
+	if len(iloc) < 6 {
+		return nil, ErrBmffBad
+	}
+	var ver = iloc[0]
+	var offsize = int(iloc[4] >> 4)
+	var lensize = int(iloc[4] & 0x0f)
+	var basesize = int(iloc[5] >> 4)
+	var idxsize int
+	if ver == 1 || ver == 2 {
+		idxsize = int(iloc[5] & 0x0f)
+	}
+	var b = iloc[6:]
+	var idsize = 2
+	if ver == 2 {
+		idsize = 4
+	}
+	var count, v uint64
+	if count, b, err = bmffUint(b, idsize); err != nil {
+		return
+	}
+	for range count {
+		var id, method, base, extcount uint64
+		if id, b, err = bmffUint(b, idsize); err != nil {
+			return
+		}
+		if ver == 1 || ver == 2 {
+			if method, b, err = bmffUint(b, 2); err != nil {
+				return
+			}
+			method &= 0x0f
+		}
+		if _, b, err = bmffUint(b, 2); err != nil { // data_reference_index
+			return
+		}
+		if base, b, err = bmffUint(b, basesize); err != nil {
+			return
+		}
+		if extcount, b, err = bmffUint(b, 2); err != nil {
+			return
+		}
+		var list = make([]bmffExtent, 0, extcount)
+		for range extcount {
+			var e bmffExtent
+			if _, b, err = bmffUint(b, idxsize); err != nil {
+				return
+			}
+			if v, b, err = bmffUint(b, offsize); err != nil {
+				return
+			}
+			e.Offset = base + v
+			if e.Length, b, err = bmffUint(b, lensize); err != nil {
+				return
+			}
+			list = append(list, e)
+		}
+		if uint32(id) == itemid {
+			if method != 0 {
+				return nil, ErrBmffNoExif // data is not at file offsets
+			}
+			return list, nil
+		}
+	}
+	return nil, ErrBmffNoExif
+}
+
+// HeifExifData returns TIFF structure with EXIF data from HEIF or AVIF file.
+func HeifExifData(r io.ReadSeeker) (tiff []byte, err error) {
+	var meta []byte
+	if meta, err = bmffReadMeta(r); err != nil {
+		return
+	}
+	if len(meta) < 4 {
+		return nil, ErrBmffBad
+	}
+
+	var iinf, iloc []byte
+	var b = meta[4:] // skip version and flags
+	for len(b) > 0 {
+		var typ string
+		var content []byte
+		if typ, content, b, err = bmffBox(b); err != nil {
+			return
+		}
+		switch typ {
+		case "iinf":
+			iinf = content
+		case "iloc":
+			iloc = content
+		}
+	}
+	if iinf == nil || iloc == nil {
+		return nil, ErrBmffNoExif
+	}
+
+	var id uint32
+	var ok bool
+	if id, ok, err = bmffExifItem(iinf); err != nil {
+		return
+	}
+	if !ok {
+		return nil, ErrBmffNoExif
+	}
+	var extents []bmffExtent
+	if extents, err = bmffItemLoc(iloc, id); err != nil {
+		return
+	}
+
+	var data []byte
+	for _, e := range extents {
+		if e.Length > bmffmetamax || uint64(len(data))+e.Length > bmffmetamax {
+			return nil, ErrBmffBad
+		}
+		if _, err = r.Seek(int64(e.Offset), io.SeekStart); err != nil {
+			return
+		}
+		var chunk = make([]byte, e.Length)
+		if _, err = io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		data = append(data, chunk...)
+	}
+
+	// data starts with offset to TIFF header
+	var off uint64
+	if off, data, err = bmffUint(data, 4); err != nil {
+		return
+	}
+	if off > uint64(len(data)) {
+		return nil, ErrBmffBad
+	}
+	return data[off:], nil
+}
+
+// ExifDecode decodes EXIF metadata from JPEG, TIFF, or
+// from ISO base media file such as HEIF or AVIF.
+func ExifDecode(r io.ReadSeeker) (x *exif.Exif, err error) {
+	var hdr [12]byte
+	var n int
+	if n, err = io.ReadFull(r, hdr[:]); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return
+	}
+	if IsBmff(hdr[:n]) {
+		var tiff []byte
+		if tiff, err = HeifExifData(r); err != nil {
+			return
+		}
+		return exif.Decode(bytes.NewReader(tiff))
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	return exif.Decode(r)
+}
+
+// bmffCodec returns image format, "avif" or "heic", by major brand
+// and compatible brands list of given 'ftyp' box content. It returns
+// empty string if there is no brand of known codec.
+func bmffCodec(ftyp []byte) string {
+	if len(ftyp) < 8 {
+		return ""
+	}
+	var brands = []string{string(ftyp[:4])}
+	for b := ftyp[8:]; len(b) >= 4; b = b[4:] {
+		brands = append(brands, string(b[:4]))
+	}
+	for _, brand := range brands {
+		if brand == "avif" || brand == "avis" {
+			return "avif"
+		}
+		if slices.Contains(HeicBrands, brand) {
+			return "heic"
+		}
+	}
+	return ""
+}
+
+// bmffReadFtyp reads 'ftyp' box at beginning of given stream. It returns
+// box content and reader of whole stream from the beginning.
+func bmffReadFtyp(r io.Reader) (ftyp []byte, rr io.Reader, err error) {
+	var hdr [8]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	var size = binary.BigEndian.Uint32(hdr[:])
+	if string(hdr[4:8]) != "ftyp" || size < 16 || size > bmffftypmax {
+		return nil, nil, ErrBmffBad
+	}
+	var b = make([]byte, size)
+	copy(b, hdr[:])
+	if _, err = io.ReadFull(r, b[8:]); err != nil {
+		return
+	}
+	return b[8:], io.MultiReader(bytes.NewReader(b), r), nil
+}
+
+// The End.
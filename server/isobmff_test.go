@@ -0,0 +1,224 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// box makes ISO base media box with given type and content.
+func box(typ string, content ...[]byte) []byte {
+	var c = bytes.Join(content, nil)
+	var b = binary.BigEndian.AppendUint32(nil, uint32(8+len(c)))
+	return append(append(b, typ...), c...)
+}
+
+// testHeif makes HEIF file with EXIF item that contains given TIFF data.
+// If ver1 is true, 'iloc' box of version 1 is used.
+func testHeif(tiff []byte, ver1 bool) []byte {
+	var be = binary.BigEndian
+	var ftyp = box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	// item with ID 1 is the image, item with ID 2 is EXIF
+	var infe = func(id uint16, typ string) []byte {
+		var c = []byte{2, 0, 0, 0}
+		c = be.AppendUint16(c, id)
+		c = be.AppendUint16(c, 0) // item_protection_index
+		c = append(c, typ...)
+		return box("infe", c, []byte{0})
+	}
+	var iinf = box("iinf", []byte{0, 0, 0, 0, 0, 2}, infe(1, "hvc1"), infe(2, "Exif"))
+
+	var data = append(be.AppendUint32(nil, 6), "Exif\x00\x00"...)
+	data = append(data, tiff...)
+
+	var iloc = func(off uint32) []byte {
+		var c []byte
+		if ver1 {
+			c = []byte{1, 0, 0, 0, 0x44, 0x00}
+		} else {
+			c = []byte{0, 0, 0, 0, 0x44, 0x00}
+		}
+		c = be.AppendUint16(c, 2) // item_count
+		for id, ext := range [][2]uint32{{1, 0}, {2, off}} {
+			c = be.AppendUint16(c, uint16(id+1))
+			if ver1 {
+				c = be.AppendUint16(c, 0) // construction_method
+			}
+			c = be.AppendUint16(c, 0) // data_reference_index
+			c = be.AppendUint16(c, 1) // extent_count
+			c = be.AppendUint32(c, ext[1])
+			if ext[1] == 0 {
+				c = be.AppendUint32(c, 0)
+			} else {
+				c = be.AppendUint32(c, uint32(len(data)))
+			}
+		}
+		return box("iloc", c)
+	}
+	var meta = box("meta", []byte{0, 0, 0, 0}, iinf, iloc(0))
+	var off = uint32(len(ftyp) + len(meta) + 8)
+	meta = box("meta", []byte{0, 0, 0, 0}, iinf, iloc(off))
+	return bytes.Join([][]byte{ftyp, meta, box("mdat", data)}, nil)
+}
+
+func TestBmffBox(t *testing.T) {
+	var large = append(binary.BigEndian.AppendUint32(nil, 1), "free"...)
+	large = binary.BigEndian.AppendUint64(large, 18)
+	large = append(large, 'a', 'b')
+	var tests = []struct {
+		name    string
+		data    []byte
+		typ     string
+		content string
+		rest    int
+		err     error
+	}{
+		{"plain", append(box("ftyp", []byte("avif")), 1, 2), "ftyp", "avif", 2, nil},
+		{"to end", append([]byte{0, 0, 0, 0}, "mdat1234"...), "mdat", "1234", 0, nil},
+		{"large size", large, "free", "ab", 0, nil},
+		{"short", []byte{0, 0, 0, 8}, "", "", 0, ErrBmffBad},
+		{"size under header", []byte{0, 0, 0, 4, 'f', 'r', 'e', 'e'}, "", "", 0, ErrBmffBad},
+		{"size over data", []byte{0, 0, 0, 9, 'f', 'r', 'e', 'e'}, "", "", 0, ErrBmffBad},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var typ, content, rest, err = bmffBox(test.data)
+			if err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if typ != test.typ || string(content) != test.content || len(rest) != test.rest {
+				t.Fatalf("got %q, %q, %d bytes rest", typ, content, len(rest))
+			}
+		})
+	}
+}
+
+func TestIsBmff(t *testing.T) {
+	var tests = []struct {
+		hdr  []byte
+		want bool
+	}{
+		{box("ftyp", []byte("heic")), true},
+		{[]byte("\x00\x00\x00\x18ftyp"), false},
+		{[]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01"), false},
+	}
+	for i, test := range tests {
+		if got := IsBmff(test.hdr); got != test.want {
+			t.Errorf("test #%d: expected %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+func TestBmffCodec(t *testing.T) {
+	var tests = []struct {
+		name string
+		ftyp string
+		want string
+	}{
+		{"heic major", "heic\x00\x00\x00\x00mif1heic", "heic"},
+		{"avif major", "avif\x00\x00\x00\x00mif1miaf", "avif"},
+		{"heic compatible", "mif1\x00\x00\x00\x00mif1heic", "heic"},
+		{"hevc sequence", "msf1\x00\x00\x00\x00msf1hevc", "heic"},
+		{"avif compatible", "mif1\x00\x00\x00\x00mif1miafavif", "avif"},
+		{"avis compatible", "msf1\x00\x00\x00\x00msf1avis", "avif"},
+		{"no codec", "mif1\x00\x00\x00\x00mif1miaf", ""},
+		{"short", "mif1", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := bmffCodec([]byte(test.ftyp)); got != test.want {
+				t.Fatalf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestBmffReadFtyp(t *testing.T) {
+	var ftyp = box("ftyp", []byte("mif1\x00\x00\x00\x00mif1avif"))
+	var tests = []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"valid", append(ftyp, box("meta")...), nil},
+		{"not ftyp", box("meta", []byte("mif1\x00\x00\x00\x00")), ErrBmffBad},
+		{"too short", box("ftyp", []byte("mif1")), ErrBmffBad},
+		{"truncated", ftyp[:len(ftyp)-2], io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var content, r, err = bmffReadFtyp(bytes.NewReader(test.data))
+			if err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(content, ftyp[8:]) {
+				t.Errorf("got content %q", content)
+			}
+			// reader must give whole stream from the beginning
+			if b, _ := io.ReadAll(r); !bytes.Equal(b, test.data) {
+				t.Errorf("stream is not restored, got %d bytes", len(b))
+			}
+		})
+	}
+}
+
+func TestHeifDecodeBrand(t *testing.T) {
+	// generic brand without codec brands must not be given to any decoder
+	var data = box("ftyp", []byte("mif1\x00\x00\x00\x00mif1miaf"))
+	var _, format, err = image.DecodeConfig(bytes.NewReader(data))
+	if format != "heif" || err != ErrBmffBrand {
+		t.Fatalf("expected heif format with error %v, got %q, %v", ErrBmffBrand, format, err)
+	}
+}
+
+func TestHeifExifData(t *testing.T) {
+	var orient = 8
+	var tiff, err = TiffEdit(NewTiff(), &ExifEdit{Orientation: &orient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ver1 := range []bool{false, true} {
+		var file = testHeif(tiff, ver1)
+		var x *exif.Exif
+		if x, err = ExifDecode(bytes.NewReader(file)); err != nil {
+			t.Fatalf("iloc version 1 is %v: %v", ver1, err)
+		}
+		var tag, _ = x.Get(exif.Orientation)
+		if v, _ := tag.Int(0); tag == nil || v != orient {
+			t.Errorf("iloc version 1 is %v: orientation mismatch: %v", ver1, tag)
+		}
+	}
+}
+
+func TestHeifExifDataBad(t *testing.T) {
+	var ftyp = box("ftyp", []byte("heic"))
+	var tests = []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"no meta", bytes.Join([][]byte{ftyp, box("mdat", []byte{1, 2, 3})}, nil), ErrBmffNoMeta},
+		{"empty meta", bytes.Join([][]byte{ftyp, box("meta", []byte{0, 0, 0, 0})}, nil), ErrBmffNoExif},
+		{"broken meta", bytes.Join([][]byte{ftyp, box("meta", []byte{0, 0, 0, 0, 0, 0, 0, 99})}, nil), ErrBmffBad},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := HeifExifData(bytes.NewReader(test.data)); err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+// The End.
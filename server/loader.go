@@ -173,9 +173,9 @@ func ApiWrap(c *gin.Context) {
 		UaMap[uanew] = cid
 		go func() {
 			if _, err := XormUserlog.InsertOne(&AgentStore{
-				UAID: uanew,
+				UAID: int64(uanew),
 				CID:  cid,
-				Addr: addr,
+				Addr: AnonAddr(addr),
 				UA:   ua,
 				Lang: c.Request.Header.Get("Accept-Language"),
 			}); err != nil {
@@ -183,7 +183,11 @@ func ApiWrap(c *gin.Context) {
 			}
 		}()
 	}
-	UserOnline[uanew] = time.Now()
+	var now = time.Now()
+	UserOnline[uanew] = now
+	if !IsStatPoll(c.FullPath()) {
+		lastactive = now
+	}
 	uamux.Unlock()
 
 	// call the next handler
@@ -6,17 +6,20 @@ import (
 	"fmt"
 	"image"
 	_ "image/gif"
-	_ "image/jpeg"
+	"image/jpeg"
 	_ "image/png"
 	"io"
 	"io/fs"
 	"time"
 
 	"github.com/disintegration/gift"
+	"github.com/gen2brain/avif" // register AVIF
+	"github.com/gen2brain/heic"
 
 	"github.com/chai2010/webp"    // register WebP
 	_ "github.com/jsummers/gobmp" // register BMP format
 	_ "github.com/oov/psd"        // register PSD format
+	cfg "github.com/schwarzlichtbezirk/hms/config"
 	"github.com/schwarzlichtbezirk/tga"
 	_ "github.com/spate/glimage/dds" // register DDS format
 	_ "golang.org/x/image/tiff"      // register TIFF format
@@ -25,9 +28,50 @@ import (
 // Register TGA after all others to put format to the end of list,
 // because decoder does not have magic prefix.
 func init() {
+	// HEVC brands in addition to "heic" registered by decoder package.
+	for _, brand := range HeicBrands[1:] {
+		image.RegisterFormat("heic", "????ftyp"+brand, heic.Decode, heic.DecodeConfig)
+	}
+	// Generic HEIF brands are used both by HEIC and AVIF images,
+	// so codec is detected by compatible brands.
+	for _, brand := range []string{"mif1", "msf1"} {
+		image.RegisterFormat("heif", "????ftyp"+brand, HeifDecode, HeifDecodeConfig)
+	}
 	tga.RegisterFormat()
 }
 
+// HeifDecode decodes image in HEIF container with generic major brand
+// by codec detected from compatible brands.
+func HeifDecode(r io.Reader) (img image.Image, err error) {
+	var ftyp []byte
+	if ftyp, r, err = bmffReadFtyp(r); err != nil {
+		return
+	}
+	switch bmffCodec(ftyp) {
+	case "avif":
+		return avif.Decode(r)
+	case "heic":
+		return heic.Decode(r)
+	}
+	return nil, ErrBmffBrand
+}
+
+// HeifDecodeConfig returns configuration of image in HEIF container
+// with generic major brand by codec detected from compatible brands.
+func HeifDecodeConfig(r io.Reader) (conf image.Config, err error) {
+	var ftyp []byte
+	if ftyp, r, err = bmffReadFtyp(r); err != nil {
+		return
+	}
+	switch bmffCodec(ftyp) {
+	case "avif":
+		return avif.DecodeConfig(r)
+	case "heic":
+		return heic.DecodeConfig(r)
+	}
+	return conf, ErrBmffBrand
+}
+
 type Mime_t int16
 
 const (
@@ -39,6 +83,7 @@ const (
 	MimePng  // image/png
 	MimeJpeg // image/jpeg
 	MimeWebp // image/webp
+	MimeAvif // image/avif
 )
 
 var MimeStr = map[Mime_t]string{
@@ -48,6 +93,7 @@ var MimeStr = map[Mime_t]string{
 	MimePng:  "image/png",
 	MimeJpeg: "image/jpeg",
 	MimeWebp: "image/webp",
+	MimeAvif: "image/avif",
 }
 
 var MimeVal = map[string]Mime_t{
@@ -57,6 +103,7 @@ var MimeVal = map[string]Mime_t{
 	"image/jpg":  MimeJpeg,
 	"image/jpeg": MimeJpeg,
 	"image/webp": MimeWebp,
+	"image/avif": MimeAvif,
 }
 
 var MimeExt = map[string]Mime_t{
@@ -65,6 +112,7 @@ var MimeExt = map[string]Mime_t{
 	"jpg":  MimeJpeg,
 	"jpeg": MimeJpeg,
 	"webp": MimeWebp,
+	"avif": MimeAvif,
 }
 
 func GetMimeVal(mime, ext string) Mime_t {
@@ -82,9 +130,10 @@ func GetMimeVal(mime, ext string) Mime_t {
 
 // MediaData is thumbnails cache element.
 type MediaData struct {
-	Data []byte
-	Mime Mime_t
-	Time time.Time
+	Data    []byte
+	Mime    Mime_t
+	Time    time.Time
+	SrcSize int64 // size of source file, if it known
 }
 
 func (md MediaData) Size() int64 {
@@ -143,10 +192,12 @@ var (
 	ErrNotImg   = errors.New("file is not image")
 	ErrTooBig   = errors.New("file is too big")
 	ErrImgNil   = errors.New("can not allocate image")
+	ErrTileFmt  = errors.New("tile format is not supported")
 )
 
-// ExtractThmub extract thumbnail from embedded file tags.
-func ExtractThmub(syspath string) (md MediaData, err error) {
+// ExtractThumb extract thumbnail from embedded file tags,
+// or from embedded preview of RAW file.
+func ExtractThumb(syspath string) (md MediaData, err error) {
 	var puid, _ = PathCache.GetRev(syspath)
 	var ok bool
 	if md, ok = etmbcache.Peek(puid); ok {
@@ -156,6 +207,10 @@ func ExtractThmub(syspath string) (md MediaData, err error) {
 	var ext = GetFileExt(syspath)
 	if IsTypeID3(ext) {
 		md, err = Id3ExtractThumb(syspath)
+	} else if IsTypeRAW(ext) {
+		if md, err = ExtractThumbRAW(syspath); errors.Is(err, ErrNoThumb) {
+			md, err = ExtractThumbEXIF(syspath)
+		}
 	} else if IsTypeEXIF(ext) {
 		md, err = ExtractThumbEXIF(syspath)
 	} else {
@@ -200,14 +255,6 @@ func DrawThumb(src image.Image, wdh, hgt int, orientation int) (data []byte, err
 // CacheThumb tries to extract existing thumbnail from cache, otherwise
 // makes new one and put it to cache.
 func CacheThumb(session *Session, syspath string) (md MediaData, err error) {
-	// try to extract thumbnail from package
-	if md, err = ThumbPkg.GetData(syspath); err != nil {
-		return // failure
-	}
-	if md.Data != nil {
-		return // extracted
-	}
-
 	var fi fs.FileInfo
 	if fi, err = JP.Stat(syspath); err != nil {
 		return
@@ -216,6 +263,23 @@ func CacheThumb(session *Session, syspath string) (md MediaData, err error) {
 		err = ErrNotFile // file is directory
 		return
 	}
+	var puid Puid_t
+	if puid, err = PathStoreCache(session, syspath); err != nil {
+		return
+	}
+
+	// drop all cached data if file was modified
+	if ThumbPkg.IsOutdated(syspath, fi) {
+		CacheStale(puid, syspath, fi)
+	}
+
+	// try to extract thumbnail from package
+	if md, err = ThumbPkg.GetData(syspath); err != nil {
+		return // failure
+	}
+	if md.Data != nil {
+		return // extracted
+	}
 
 	var ext = GetFileExt(syspath)
 	if IsTypeID3(ext) {
@@ -241,6 +305,7 @@ func CacheThumb(session *Session, syspath string) (md MediaData, err error) {
 			}
 			md.Mime = MimeWebp
 			md.Time = mdtag.Time
+			md.SrcSize = fi.Size()
 			// push thumbnail to package
 			err = ThumbPkg.PutFile(syspath, md)
 			return
@@ -263,7 +328,7 @@ func CacheThumb(session *Session, syspath string) (md MediaData, err error) {
 	defer file.Close()
 
 	var imc image.Config
-	if imc, _, err = image.DecodeConfig(file); err != nil {
+	if imc, _, err = ImageDecodeConfig(file, ext); err != nil {
 		return // can not recognize format or decode config
 	}
 	if float32(imc.Width*imc.Height+5e5)/1e6 > Cfg.ImageMaxMpx {
@@ -275,20 +340,22 @@ func CacheThumb(session *Session, syspath string) (md MediaData, err error) {
 	}
 
 	// try to extract orientation from EXIF
-	var puid = PathStoreCache(session, syspath)
 	var orientation = OrientNormal
-	if tp, ok := ExifStoreGet(session, puid); ok && tp.Orientation > 0 {
+	if tp, ok := ExifStoreGet(session, puid, fi); ok && tp.Orientation > 0 {
 		orientation = tp.Orientation
 	} else if tp, err = ExifExtract(session, file, puid); err == nil && tp.Orientation > 0 {
 		orientation = tp.Orientation
 	}
+	if IsTypeHEIF(ext) {
+		orientation = OrientNormal // image is already transformed by decoder
+	}
 	if _, err = file.Seek(0, io.SeekStart); err != nil {
 		return
 	}
 
 	// create sized image for thumbnail
 	var src image.Image
-	if src, _, err = image.Decode(file); err != nil {
+	if src, _, err = ImageDecode(file, ext); err != nil {
 		if src == nil { // skip "short Huffman data" or others errors with partial results
 			return // can not decode file by any codec
 		}
@@ -296,18 +363,73 @@ func CacheThumb(session *Session, syspath string) (md MediaData, err error) {
 	if md.Data, err = DrawThumb(src, imc.Width, imc.Height, orientation); err != nil {
 		return
 	}
-	md.Mime = MimeWebp
-	if fi, _ := file.Stat(); fi != nil {
-		md.Time = fi.ModTime()
+	// store perceptual hash to find duplicates
+	var hp = HashProp{
+		DHash: int64(DHash(src, orientation)),
 	}
+	hp.SrcProp.Setup(fi)
+	if err := HashStoreSet(session, puid, hp); err != nil {
+		Log.Errorf("can not store perceptual hash of %s, error %v", syspath, err)
+	}
+	md.Mime = MimeWebp
+	md.Time = fi.ModTime()
+	md.SrcSize = fi.Size()
 
 	// push thumbnail to package
 	err = ThumbPkg.PutFile(syspath, md)
 	return
 }
 
-// DrawTile produces new tile object.
-func DrawTile(src image.Image, wdh, hgt int, orientation int) (data []byte, err error) {
+// TileMimeOf returns MIME type of tiles with given format.
+func TileMimeOf(format string) (mime Mime_t, ok bool) {
+	switch ToLower(format) {
+	case "webp":
+		return MimeWebp, true
+	case "avif":
+		return MimeAvif, true
+	case "jpeg", "jpg":
+		return MimeJpeg, true
+	}
+	return MimeDis, false
+}
+
+// EncodeTile writes tile image in format given by tile specification.
+func EncodeTile(img *image.RGBA, spec cfg.CfgTileSpec) (data []byte, mime Mime_t, err error) {
+	var ok bool
+	if mime, ok = TileMimeOf(spec.Format); !ok {
+		err = fmt.Errorf("%w: %s", ErrTileFmt, spec.Format)
+		return
+	}
+	switch mime {
+	case MimeWebp:
+		if data, err = webp.EncodeRGBA(img, spec.Quality); err != nil {
+			return // can not write webp
+		}
+	case MimeAvif:
+		var buf bytes.Buffer
+		if err = avif.Encode(&buf, img, avif.Options{
+			Quality:      int(spec.Quality),
+			QualityAlpha: int(spec.Quality),
+			Speed:        avif.DefaultSpeed,
+		}); err != nil {
+			return // can not write avif
+		}
+		data = buf.Bytes()
+	case MimeJpeg:
+		var buf bytes.Buffer
+		if err = jpeg.Encode(&buf, img, &jpeg.Options{
+			Quality: int(spec.Quality),
+		}); err != nil {
+			return // can not write jpeg
+		}
+		data = buf.Bytes()
+	}
+	return
+}
+
+// DrawTile produces new tile object with given specification.
+func DrawTile(src image.Image, spec cfg.CfgTileSpec, orientation int) (data []byte, mime Mime_t, err error) {
+	var wdh, hgt = spec.Width, spec.Height
 	switch orientation {
 	case OrientCwHorzReversed, OrientCw, OrientAcwHorzReversed, OrientAcw:
 		wdh, hgt = hgt, wdh
@@ -323,24 +445,19 @@ func DrawTile(src image.Image, wdh, hgt int, orientation int) (data []byte, err
 	}
 	filter.Draw(dst, src)
 
-	if data, err = webp.EncodeRGBA(dst, Cfg.TileWebpQuality); err != nil {
-		return // can not write webp
-	}
-	return
+	return EncodeTile(dst, spec)
 }
 
 // CacheTile tries to extract existing tile from cache, otherwise
-// makes new one and put it to cache.
+// makes new one by configured specification and put it to cache.
 func CacheTile(session *Session, syspath string, wdh, hgt int) (md MediaData, err error) {
-	var tilepath = fmt.Sprintf("%s?%dx%d", syspath, wdh, hgt)
-
-	// try to extract tile from package
-	if md, err = TilesPkg.GetData(tilepath); err != nil {
-		return // failure
-	}
-	if md.Data != nil {
-		return // extracted
+	var spec, ok = NearestTileSpec(wdh, hgt)
+	if !ok {
+		err = ErrNoTileSpec
+		return
 	}
+	wdh, hgt = spec.Width, spec.Height
+	var tilepath = TileKey(syspath, wdh, hgt)
 
 	var fi fs.FileInfo
 	if fi, err = JP.Stat(syspath); err != nil {
@@ -350,6 +467,30 @@ func CacheTile(session *Session, syspath string, wdh, hgt int) (md MediaData, er
 		err = ErrNotFile // file is directory
 		return
 	}
+	var puid Puid_t
+	if puid, err = PathStoreCache(session, syspath); err != nil {
+		return
+	}
+
+	// drop all cached data if file was modified
+	if TilesPkg.IsOutdated(tilepath, fi) {
+		CacheStale(puid, syspath, fi)
+	}
+
+	// drop tile if it was made in another format
+	if mime, ok := TileMimeOf(spec.Format); ok {
+		if tm := CachedTileMime(syspath, wdh, hgt); tm != MimeNil && tm != mime {
+			TilesPkg.DelTagset(tilepath)
+		}
+	}
+
+	// try to extract tile from package
+	if md, err = TilesPkg.GetData(tilepath); err != nil {
+		return // failure
+	}
+	if md.Data != nil {
+		return // extracted
+	}
 
 	var ext = GetFileExt(syspath)
 
@@ -366,7 +507,7 @@ func CacheTile(session *Session, syspath string, wdh, hgt int) (md MediaData, er
 	defer file.Close()
 
 	var imc image.Config
-	if imc, _, err = image.DecodeConfig(file); err != nil {
+	if imc, _, err = ImageDecodeConfig(file, ext); err != nil {
 		return // can not recognize format or decode config
 	}
 	if float32(imc.Width*imc.Height+5e5)/1e6 > Cfg.ImageMaxMpx {
@@ -378,30 +519,30 @@ func CacheTile(session *Session, syspath string, wdh, hgt int) (md MediaData, er
 	}
 
 	// try to extract orientation from EXIF
-	var puid = PathStoreCache(session, syspath)
 	var orientation = OrientNormal
-	if tp, ok := ExifStoreGet(session, puid); ok && tp.Orientation > 0 {
+	if tp, ok := ExifStoreGet(session, puid, fi); ok && tp.Orientation > 0 {
 		orientation = tp.Orientation
 	} else if tp, err = ExifExtract(session, file, puid); err == nil && tp.Orientation > 0 {
 		orientation = tp.Orientation
 	}
+	if IsTypeHEIF(ext) {
+		orientation = OrientNormal // image is already transformed by decoder
+	}
 	if _, err = file.Seek(0, io.SeekStart); err != nil {
 		return
 	}
 
 	var src image.Image
-	if src, _, err = image.Decode(file); err != nil {
+	if src, _, err = ImageDecode(file, ext); err != nil {
 		if src == nil { // skip "short Huffman data" or others errors with partial results
 			return // can not decode file by any codec
 		}
 	}
-	if md.Data, err = DrawTile(src, wdh, hgt, orientation); err != nil {
+	if md.Data, md.Mime, err = DrawTile(src, spec, orientation); err != nil {
 		return
 	}
-	md.Mime = MimeWebp
-	if fi, _ := file.Stat(); fi != nil {
-		md.Time = fi.ModTime()
-	}
+	md.Time = fi.ModTime()
+	md.SrcSize = fi.Size()
 
 	// push tile to package
 	err = TilesPkg.PutFile(tilepath, md)
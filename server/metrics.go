@@ -0,0 +1,237 @@
+package hms
+
+import (
+	"crypto/subtle"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/schwarzlichtbezirk/wpk"
+	"xorm.io/xorm"
+)
+
+// Metrics is registry with server metrics exposed in Prometheus format.
+var Metrics = prometheus.NewRegistry()
+
+// Duration of requests processing by routes.
+var reqduration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "hms",
+	Subsystem: "http",
+	Name:      "request_duration_seconds",
+	Help:      "Duration of HTTP requests processing by routes.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route", "code"})
+
+// Descriptions of server state metrics.
+var (
+	cachehitsdesc = prometheus.NewDesc("hms_cache_hits_total",
+		"Number of lookups to memory cache with found value.", []string{"cache"}, nil)
+	cachemissdesc = prometheus.NewDesc("hms_cache_misses_total",
+		"Number of lookups to memory cache without found value.", []string{"cache"}, nil)
+	cacheitemsdesc = prometheus.NewDesc("hms_cache_items",
+		"Number of items in memory cache.", []string{"cache"}, nil)
+	cachebytesdesc = prometheus.NewDesc("hms_cache_bytes",
+		"Size of media data in memory cache.", []string{"cache"}, nil)
+	scanqueueddesc = prometheus.NewDesc("hms_imgscan_queued",
+		"Number of pending images processing jobs.", []string{"prio"}, nil)
+	scanrunningdesc = prometheus.NewDesc("hms_imgscan_running",
+		"Number of images processing jobs in progress.", nil, nil)
+	scandonedesc = prometheus.NewDesc("hms_imgscan_done_total",
+		"Number of completed images processing jobs.", nil, nil)
+	pkgfilesdesc = prometheus.NewDesc("hms_package_files",
+		"Number of files in cache package.", []string{"package"}, nil)
+	pkgbytesdesc = prometheus.NewDesc("hms_package_bytes",
+		"Size of data part of cache package.", []string{"package"}, nil)
+	dbrowsdesc = prometheus.NewDesc("hms_db_rows",
+		"Number of rows in database table.", []string{"table"}, nil)
+	onlinedesc = prometheus.NewDesc("hms_users_online",
+		"Number of clients online.", nil, nil)
+)
+
+// tablerows is number of rows in database table.
+type tablerows struct {
+	name  string
+	count int64
+}
+
+// Counts of database tables rows. Counting can be slow on big tables,
+// so counts are refreshed not often than once per configured period,
+// and concurrent scrapes wait for one count.
+var (
+	dbrowsmux  sync.Mutex
+	dbrowstime time.Time
+	dbrows     []tablerows
+)
+
+// dbrowscount returns counts of database tables rows.
+func dbrowscount() []tablerows {
+	dbrowsmux.Lock()
+	defer dbrowsmux.Unlock()
+
+	if dbrows != nil && time.Since(dbrowstime) < Cfg.MetricsRowsPeriod {
+		return dbrows
+	}
+	var list []tablerows
+	var count = func(engine *xorm.Engine, name string, bean any) {
+		if n, err := engine.Count(bean); err == nil {
+			list = append(list, tablerows{name, n})
+		}
+	}
+	if XormStorage != nil {
+		count(XormStorage, "path_store", &PathStore{})
+		count(XormStorage, "dir_store", &DirStore{})
+		count(XormStorage, "ext_store", &ExtStore{})
+		count(XormStorage, "exif_store", &ExifStore{})
+		count(XormStorage, "id3_store", &Id3Store{})
+		count(XormStorage, "hash_store", &HashStore{})
+		count(XormStorage, "fav_store", &FavStore{})
+		count(XormStorage, "play_store", &PlayStore{})
+		count(XormStorage, "tag_store", &TagStore{})
+		count(XormStorage, "tag_link", &TagLink{})
+		count(XormStorage, "rate_store", &RateStore{})
+	}
+	if XormUserlog != nil {
+		count(XormUserlog, "agent_store", &AgentStore{})
+		count(XormUserlog, "open_store", &OpenStore{})
+	}
+	dbrows, dbrowstime = list, time.Now()
+	return dbrows
+}
+
+// Names of images processing jobs priorities.
+var prioname = [PrioNum]string{
+	PrioVisible: "visible",
+	PrioPage:    "page",
+	PrioBack:    "back",
+}
+
+// statcollector gathers server state metrics at scrape time.
+type statcollector struct{}
+
+// Describe is prometheus.Collector implementation.
+func (statcollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cachehitsdesc
+	ch <- cachemissdesc
+	ch <- cacheitemsdesc
+	ch <- cachebytesdesc
+	ch <- scanqueueddesc
+	ch <- scanrunningdesc
+	ch <- scandonedesc
+	ch <- pkgfilesdesc
+	ch <- pkgbytesdesc
+	ch <- dbrowsdesc
+	ch <- onlinedesc
+}
+
+// Collect is prometheus.Collector implementation.
+func (statcollector) Collect(ch chan<- prometheus.Metric) {
+	// memory caches
+	var lookups = func(name string, hits, misses uint64, items int) {
+		ch <- prometheus.MustNewConstMetric(cachehitsdesc, prometheus.CounterValue, float64(hits), name)
+		ch <- prometheus.MustNewConstMetric(cachemissdesc, prometheus.CounterValue, float64(misses), name)
+		ch <- prometheus.MustNewConstMetric(cacheitemsdesc, prometheus.GaugeValue, float64(items), name)
+	}
+	var hits, misses = etmbcache.Lookups()
+	lookups("etmb", hits, misses, etmbcache.Len())
+	ch <- prometheus.MustNewConstMetric(cachebytesdesc, prometheus.GaugeValue, float64(CacheSize(etmbcache)), "etmb")
+	hits, misses = imgcache.Lookups()
+	lookups("img", hits, misses, imgcache.Len())
+	ch <- prometheus.MustNewConstMetric(cachebytesdesc, prometheus.GaugeValue, float64(CacheSize(imgcache)), "img")
+	hits, misses = extcache.Lookups()
+	lookups("ext", hits, misses, extcache.Len())
+
+	// images processing queue
+	var st = ImgScanner.Stat()
+	for prio, n := range st.Queued {
+		ch <- prometheus.MustNewConstMetric(scanqueueddesc, prometheus.GaugeValue, float64(n), prioname[prio])
+	}
+	ch <- prometheus.MustNewConstMetric(scanrunningdesc, prometheus.GaugeValue, float64(st.Running))
+	ch <- prometheus.MustNewConstMetric(scandonedesc, prometheus.CounterValue, float64(st.Done))
+
+	// cache packages
+	for _, pkg := range []struct {
+		name string
+		fc   *FileCache
+	}{
+		{"thumb", ThumbPkg},
+		{"tiles", TilesPkg},
+	} {
+		if pkg.fc == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(pkgfilesdesc, prometheus.GaugeValue, float64(pkg.fc.TagsetNum()), pkg.name)
+		if fi, err := os.Stat(wpk.MakeDataPath(pkg.fc.fpath)); err == nil {
+			ch <- prometheus.MustNewConstMetric(pkgbytesdesc, prometheus.GaugeValue, float64(fi.Size()), pkg.name)
+		}
+	}
+
+	// database tables
+	for _, tr := range dbrowscount() {
+		ch <- prometheus.MustNewConstMetric(dbrowsdesc, prometheus.GaugeValue, float64(tr.count), tr.name)
+	}
+
+	// clients
+	var online int
+	var now = time.Now()
+	uamux.Lock()
+	for _, t := range UserOnline {
+		if now.Sub(t) < Cfg.OnlineTimeout {
+			online++
+		}
+	}
+	uamux.Unlock()
+	ch <- prometheus.MustNewConstMetric(onlinedesc, prometheus.GaugeValue, float64(online))
+}
+
+func init() {
+	Metrics.MustRegister(
+		reqduration,
+		statcollector{},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// MetricsWrap is middleware that measures requests processing duration.
+// Requests without matched route are gathered under one label to keep
+// number of series bounded.
+func MetricsWrap(c *gin.Context) {
+	var t0 = time.Now()
+	c.Next()
+	var route = c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	reqduration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+		Observe(time.Since(t0).Seconds())
+}
+
+// MetricsAuth is middleware that allows to scrape metrics if they are
+// enabled by configuration. Scraper should provide configured bearer
+// token, or authorization of any profile if token is not configured.
+func MetricsAuth(c *gin.Context) {
+	if !Cfg.MetricsEnable {
+		Ret404(c, AEC_metrics_off, ErrMetricsOff)
+		return
+	}
+	if Cfg.MetricsToken == "" {
+		Auth(true)(c)
+		return
+	}
+	var hdr = c.Request.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(hdr), []byte("Bearer "+Cfg.MetricsToken)) != 1 {
+		Ret401(c, AEC_metrics_token, ErrMetricsTok)
+		return
+	}
+	c.Next()
+}
+
+// SpiMetrics returns server metrics in Prometheus exposition format.
+var SpiMetrics = gin.WrapH(promhttp.HandlerFor(Metrics, promhttp.HandlerOpts{}))
+
+// The End.
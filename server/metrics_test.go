@@ -0,0 +1,185 @@
+package hms
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testScrape returns metrics in Prometheus exposition format
+// as it served by the router.
+func testScrape(t *testing.T) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	var r = gin.New()
+	r.GET("/metrics", SpiMetrics)
+	var w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("metrics are not served, status %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestMetricsWrap(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var r = gin.New()
+	r.Use(MetricsWrap)
+	r.GET("/test/metrics/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/test/metrics/fail", func(c *gin.Context) { c.Status(http.StatusBadRequest) })
+	for _, req := range []struct{ method, url string }{
+		{"GET", "/test/metrics/1"},
+		{"GET", "/test/metrics/2"},
+		{"POST", "/test/metrics/fail"},
+		{"GET", "/test/metrics-absent"},
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.url, nil))
+	}
+
+	var body = testScrape(t)
+	var tests = []string{
+		// requests are gathered by route pattern, not by path
+		`hms_http_request_duration_seconds_count{code="200",method="GET",route="/test/metrics/:id"} 2`,
+		`hms_http_request_duration_seconds_count{code="400",method="POST",route="/test/metrics/fail"} 1`,
+		`hms_http_request_duration_seconds_count{code="404",method="GET",route="unmatched"}`,
+	}
+	for _, line := range tests {
+		if !strings.Contains(body, line) {
+			t.Errorf("metric is not found: %s", line)
+		}
+	}
+	if strings.Contains(body, `route="/test/metrics/1"`) {
+		t.Error("request path is used as label")
+	}
+}
+
+// testRowsReset drops counts of database tables rows
+// to be counted again at next scrape.
+func testRowsReset(t *testing.T) {
+	t.Helper()
+	dbrowsmux.Lock()
+	defer dbrowsmux.Unlock()
+	dbrows, dbrowstime = nil, time.Time{}
+}
+
+func TestMetricsCollect(t *testing.T) {
+	testStorage(t)
+	testPackages(t)
+	testRowsReset(t)
+
+	var body = testScrape(t)
+	var tests = []string{
+		`hms_cache_hits_total{cache="etmb"}`,
+		`hms_cache_misses_total{cache="img"}`,
+		`hms_cache_items{cache="ext"}`,
+		`hms_cache_bytes{cache="img"}`,
+		`hms_imgscan_queued{prio="visible"}`,
+		`hms_imgscan_queued{prio="page"}`,
+		`hms_imgscan_queued{prio="back"}`,
+		`hms_imgscan_running`,
+		`hms_imgscan_done_total`,
+		`hms_package_files{package="thumb"} 0`,
+		`hms_package_files{package="tiles"} 0`,
+		`hms_db_rows{table="path_store"}`,
+		`hms_db_rows{table="tag_link"} 0`,
+		`hms_users_online`,
+		`go_goroutines`,
+	}
+	for _, line := range tests {
+		if !strings.Contains(body, line) {
+			t.Errorf("metric is not found: %s", line)
+		}
+	}
+}
+
+func TestMetricsRows(t *testing.T) {
+	var engine = testStorage(t)
+	testRowsReset(t)
+	var prev = Cfg.MetricsRowsPeriod
+	Cfg.MetricsRowsPeriod = time.Hour
+	t.Cleanup(func() {
+		Cfg.MetricsRowsPeriod = prev
+	})
+
+	var tests = []struct {
+		name  string
+		links int  // number of inserted links before scrape
+		reset bool // period is expired
+		want  int  // number of links at metrics
+	}{
+		{"first count", 2, false, 2},
+		{"cached count", 3, false, 2},
+		{"expired count", 1, true, 6},
+	}
+	var tid uint64
+	for _, test := range tests {
+		for range test.links {
+			tid++
+			if _, err := engine.InsertOne(&TagLink{TID: tid, Puid: PUIDcache}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.reset {
+			dbrowsmux.Lock()
+			dbrowstime = time.Now().Add(-2 * time.Hour)
+			dbrowsmux.Unlock()
+		}
+		var line = fmt.Sprintf(`hms_db_rows{table="tag_link"} %d`, test.want)
+		if body := testScrape(t); !strings.Contains(body, line) {
+			t.Errorf("%s: metric is not found: %s", test.name, line)
+		}
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var r = gin.New()
+	r.GET("/metrics", MetricsAuth, SpiMetrics)
+	testProfile(t, "scraper", "secret")
+	var prevon, prevtok = Cfg.MetricsEnable, Cfg.MetricsToken
+	t.Cleanup(func() {
+		Cfg.MetricsEnable, Cfg.MetricsToken = prevon, prevtok
+	})
+	var basic = "Basic " + base64.RawURLEncoding.EncodeToString([]byte("scraper:secret"))
+
+	var tests = []struct {
+		name   string
+		enable bool
+		token  string
+		auth   string // authorization header
+		code   int
+	}{
+		{"disabled", false, "", basic, http.StatusNotFound},
+		{"anonymous", true, "", "", http.StatusUnauthorized},
+		{"profile", true, "", basic, http.StatusOK},
+		{"token", true, "t0ken", "Bearer t0ken", http.StatusOK},
+		{"wrong token", true, "t0ken", "Bearer token", http.StatusUnauthorized},
+		{"no token", true, "t0ken", "", http.StatusUnauthorized},
+		{"profile instead of token", true, "t0ken", basic, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Cfg.MetricsEnable, Cfg.MetricsToken = test.enable, test.token
+			var req = httptest.NewRequest("GET", "/metrics", nil)
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+			var w = httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != test.code {
+				t.Fatalf("expected status %d, got %d", test.code, w.Code)
+			}
+			if w.Code == http.StatusOK && !strings.Contains(w.Body.String(), "go_goroutines") {
+				t.Error("metrics are not served")
+			}
+		})
+	}
+}
+
+// The End.
@@ -0,0 +1,412 @@
+package hms
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+// Migrations errors.
+var (
+	ErrMigrateOrder = errors.New("migration steps should have unique versions in increasing order")
+	ErrMigrateNewer = errors.New("database schema has version that is unknown for this build")
+	ErrMigrateDown  = errors.New("migration step can not be reverted")
+	ErrMigrateInit  = errors.New("cannot revert initial schema")
+)
+
+// Migration is one step of database schema upgrade. Steps are applied
+// in order of versions, each step is performed in own transaction.
+type Migration struct {
+	Version int                  // schema version after the step is applied
+	Name    string               // short description of the step
+	Up      func(*Session) error // upgrades schema from previous version
+	Down    func(*Session) error // reverts the step, nil if step can not be reverted
+}
+
+// VersionStore is database record with applied migration step.
+type VersionStore struct {
+	Version int       `xorm:"pk"`
+	Name    string    `xorm:"notnull"`
+	Time    time.Time `xorm:"created"`
+}
+
+// MigrateStat is state of migration step at database.
+type MigrateStat struct {
+	Version int       `json:"version" yaml:"version" xml:"version,attr"`
+	Name    string    `json:"name" yaml:"name" xml:"name"`
+	Applied bool      `json:"applied" yaml:"applied" xml:"applied,attr"`
+	Known   bool      `json:"known" yaml:"known" xml:"known,attr"` // step is present at this build
+	Time    time.Time `json:"time,omitempty" yaml:"time,omitempty" xml:"time,omitempty"`
+}
+
+// VersionTable is default name of table with applied migration steps.
+const VersionTable = "version_store"
+
+// Migrations is ordered list of schema upgrade steps of some database.
+// Each list keeps applied steps at own table, so different lists
+// can be applied to the same database.
+type Migrations struct {
+	Table string      // name of table with applied steps, VersionTable if empty
+	Steps []Migration // steps in order of versions
+}
+
+// table returns name of table with applied steps.
+func (ms Migrations) table() string {
+	if ms.Table == "" {
+		return VersionTable
+	}
+	return ms.Table
+}
+
+// Check verifies that steps versions are unique and increasing.
+func (ms Migrations) Check() error {
+	for i, m := range ms.Steps {
+		if m.Version <= 0 || (i > 0 && m.Version <= ms.Steps[i-1].Version) {
+			return fmt.Errorf("%w, version %d", ErrMigrateOrder, m.Version)
+		}
+	}
+	return nil
+}
+
+// Latest returns version of last step.
+func (ms Migrations) Latest() int {
+	if len(ms.Steps) == 0 {
+		return 0
+	}
+	return ms.Steps[len(ms.Steps)-1].Version
+}
+
+// applied returns records of applied steps sorted by versions.
+func (ms Migrations) applied(engine *xorm.Engine) (vss []VersionStore, err error) {
+	var session = engine.NewSession()
+	defer session.Close()
+
+	if err = session.Table(ms.table()).Sync(&VersionStore{}); err != nil {
+		return
+	}
+	err = session.Table(ms.table()).Asc("version").Find(&vss)
+	return
+}
+
+// Version returns current schema version of database,
+// or zero if no one step was applied.
+func (ms Migrations) Version(engine *xorm.Engine) (ver int, err error) {
+	var vss []VersionStore
+	if vss, err = ms.applied(engine); err != nil {
+		return
+	}
+	if len(vss) > 0 {
+		ver = vss[len(vss)-1].Version
+	}
+	return
+}
+
+// Status returns states of all known steps, and of applied
+// steps that are unknown for this build, in order of versions.
+func (ms Migrations) Status(engine *xorm.Engine) (list []MigrateStat, err error) {
+	var vss []VersionStore
+	if vss, err = ms.applied(engine); err != nil {
+		return
+	}
+	var stmap = map[int]MigrateStat{}
+	for _, m := range ms.Steps {
+		stmap[m.Version] = MigrateStat{
+			Version: m.Version,
+			Name:    m.Name,
+			Known:   true,
+		}
+	}
+	for _, vs := range vss {
+		var st, ok = stmap[vs.Version]
+		if !ok {
+			st.Version, st.Name = vs.Version, vs.Name
+		}
+		st.Applied, st.Time = true, vs.Time
+		stmap[vs.Version] = st
+	}
+	list = make([]MigrateStat, 0, len(stmap))
+	for _, st := range stmap {
+		list = append(list, st)
+	}
+	slices.SortFunc(list, func(a, b MigrateStat) int {
+		return a.Version - b.Version
+	})
+	return
+}
+
+// Up applies not applied steps with versions up to target version,
+// or all steps if target is zero. It returns list of applied steps.
+func (ms Migrations) Up(engine *xorm.Engine, target int) (done []Migration, err error) {
+	if err = ms.Check(); err != nil {
+		return
+	}
+	var vss []VersionStore
+	if vss, err = ms.applied(engine); err != nil {
+		return
+	}
+	var has = map[int]bool{}
+	for _, vs := range vss {
+		has[vs.Version] = true
+		if vs.Version > ms.Latest() {
+			err = fmt.Errorf("%w, version %d", ErrMigrateNewer, vs.Version)
+			return
+		}
+	}
+	if target <= 0 {
+		target = ms.Latest()
+	}
+	for _, m := range ms.Steps {
+		if m.Version > target {
+			break
+		}
+		if has[m.Version] {
+			continue
+		}
+		if err = ms.step(engine, func(session *Session) (err error) {
+			if err = m.Up(session); err != nil {
+				return
+			}
+			_, err = session.Table(ms.table()).InsertOne(&VersionStore{Version: m.Version, Name: m.Name})
+			return
+		}); err != nil {
+			err = fmt.Errorf("migration to version %d failed: %w", m.Version, err)
+			return
+		}
+		done = append(done, m)
+	}
+	return
+}
+
+// Down reverts applied steps with versions greater than target version,
+// in reverse order. It returns list of reverted steps.
+func (ms Migrations) Down(engine *xorm.Engine, target int) (done []Migration, err error) {
+	if err = ms.Check(); err != nil {
+		return
+	}
+	var vss []VersionStore
+	if vss, err = ms.applied(engine); err != nil {
+		return
+	}
+	var has = map[int]bool{}
+	for _, vs := range vss {
+		has[vs.Version] = true
+		if vs.Version > ms.Latest() {
+			err = fmt.Errorf("%w, version %d", ErrMigrateNewer, vs.Version)
+			return
+		}
+	}
+	// check up all steps before reverting any of them
+	for i := len(ms.Steps) - 1; i >= 0 && ms.Steps[i].Version > target; i-- {
+		if !has[ms.Steps[i].Version] || ms.Steps[i].Down != nil {
+			continue
+		}
+		if i == 0 {
+			err = ErrMigrateInit
+		} else {
+			err = fmt.Errorf("%w, version %d", ErrMigrateDown, ms.Steps[i].Version)
+		}
+		return
+	}
+	for i := len(ms.Steps) - 1; i >= 0; i-- {
+		var m = ms.Steps[i]
+		if m.Version <= target {
+			break
+		}
+		if !has[m.Version] {
+			continue
+		}
+		if err = ms.step(engine, func(session *Session) (err error) {
+			if err = m.Down(session); err != nil {
+				return
+			}
+			_, err = session.Table(ms.table()).Delete(&VersionStore{Version: m.Version})
+			return
+		}); err != nil {
+			err = fmt.Errorf("revert of version %d failed: %w", m.Version, err)
+			return
+		}
+		done = append(done, m)
+	}
+	return
+}
+
+// step performs given function in transaction.
+func (ms Migrations) step(engine *xorm.Engine, f func(*Session) error) (err error) {
+	var session = engine.NewSession()
+	defer session.Close()
+
+	if err = session.Begin(); err != nil {
+		return
+	}
+	if err = f(session); err != nil {
+		session.Rollback()
+		return
+	}
+	return session.Commit()
+}
+
+// synctables returns migration function that creates tables
+// for given beans, or adds missing columns and indexes to them.
+func synctables(beans ...any) func(*Session) error {
+	return func(session *Session) (err error) {
+		return session.Sync(beans...)
+	}
+}
+
+// droptables returns migration function that drops tables for given beans.
+func droptables(beans ...any) func(*Session) error {
+	return func(session *Session) (err error) {
+		for _, bean := range beans {
+			if err = session.DropTable(bean); err != nil {
+				return
+			}
+		}
+		return
+	}
+}
+
+// fillpathstore puts predefined items into empty path_store table.
+func fillpathstore(session *Session) (err error) {
+	var ok bool
+	if ok, err = session.IsTableEmpty(&PathStore{}); err != nil || !ok {
+		return
+	}
+	var ctgrpath = make([]PathStore, PUIDcache-1)
+	for puid, path := range CatKeyPath {
+		ctgrpath[puid-1].Puid = puid
+		ctgrpath[puid-1].Path = path
+	}
+	for puid := Puid_t(len(CatKeyPath) + 1); puid < PUIDcache; puid++ {
+		ctgrpath[puid-1].Puid = puid
+		ctgrpath[puid-1].Path = fmt.Sprintf("<reserved%d>", puid)
+	}
+	if _, err = session.Insert(&ctgrpath); err != nil {
+		return
+	}
+	// PostgreSQL sequence is not moved by inserts with explicit values
+	if session.Engine().Dialect().URI().DBType == schemas.POSTGRES {
+		if _, err = session.Exec("SELECT setval(pg_get_serial_sequence('path_store', 'puid'), (SELECT MAX(puid) FROM path_store))"); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// setpathstore replaces path of given PUID at path_store table.
+func setpathstore(session *Session, puid Puid_t, fpath string) (err error) {
+	if _, err = session.ID(puid).Cols("path").Update(&PathStore{Path: fpath}); err != nil {
+		return
+	}
+	PathCache.DeleteDir(puid)
+	return
+}
+
+// StorageMigrations is list of schema upgrade steps of files properties storage.
+var StorageMigrations = Migrations{Table: VersionTable, Steps: []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: func(session *Session) (err error) {
+			if err = synctables(&v1PathStore{}, &v1DirStore{}, &v1ExtStore{}, &v1ExifStore{}, &v1Id3Store{}, &v1HashStore{}, &v1WalkStore{}, &v1TaskStore{})(session); err != nil {
+				return
+			}
+			return fillpathstore(session)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "favorites and playback state",
+		Up: func(session *Session) (err error) {
+			if err = synctables(&FavStore{}, &PlayStore{})(session); err != nil {
+				return
+			}
+			for _, puid := range []Puid_t{PUIDfavs, PUIDrecent} {
+				if err = setpathstore(session, puid, CatKeyPath[puid]); err != nil {
+					return
+				}
+			}
+			return
+		},
+		Down: func(session *Session) (err error) {
+			if err = droptables(&FavStore{}, &PlayStore{})(session); err != nil {
+				return
+			}
+			for _, puid := range []Puid_t{PUIDfavs, PUIDrecent} {
+				if err = setpathstore(session, puid, fmt.Sprintf("<reserved%d>", puid)); err != nil {
+					return
+				}
+			}
+			return
+		},
+	},
+	{
+		Version: 3,
+		Name:    "tags and ratings",
+		Up: func(session *Session) (err error) {
+			if err = synctables(&TagStore{}, &TagLink{}, &RateStore{})(session); err != nil {
+				return
+			}
+			return setpathstore(session, PUIDtags, CPtags)
+		},
+		Down: func(session *Session) (err error) {
+			if err = droptables(&TagStore{}, &TagLink{}, &RateStore{})(session); err != nil {
+				return
+			}
+			return setpathstore(session, PUIDtags, fmt.Sprintf("<reserved%d>", PUIDtags))
+		},
+	},
+	{
+		Version: 4,
+		Name:    "marks of complete scanning",
+		Up:      synctables(&WalkStore{}),
+		Down: func(session *Session) (err error) {
+			if _, err = session.Where("done=?", true).Delete(&WalkStore{}); err != nil {
+				return
+			}
+			_, err = session.Exec("ALTER TABLE walk_store DROP COLUMN done")
+			return
+		},
+	},
+}}
+
+// UserlogMigrations is list of schema upgrade steps of user log.
+// Its steps are kept apart from storage steps, so both can be applied
+// to the same database. User log databases of previous builds have
+// steps at VersionTable, they are applied again, and this is harmless
+// because all of them can be repeated.
+var UserlogMigrations = Migrations{Table: "userlog_version", Steps: []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up:      synctables(&v1AgentStore{}, &v1OpenStore{}),
+	},
+	{
+		Version: 2,
+		Name:    "signed user agent IDs",
+		Up:      uaidcolumns("BIGINT"),
+		Down:    uaidcolumns("BIGINT UNSIGNED"),
+	},
+}}
+
+// uaidcolumns returns migration function that changes type of user agent ID
+// columns at MySQL. Other databases have no unsigned integer types, so
+// columns are already signed there.
+func uaidcolumns(sqltype string) func(*Session) error {
+	return func(session *Session) (err error) {
+		if session.Engine().Dialect().URI().DBType != schemas.MYSQL {
+			return
+		}
+		for _, table := range []string{"agent_store", "open_store"} {
+			if _, err = session.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY uaid %s", table, sqltype)); err != nil {
+				return
+			}
+		}
+		return
+	}
+}
+
+// The End.
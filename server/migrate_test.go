@@ -0,0 +1,233 @@
+package hms
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+// testEngine opens new empty SQLite database at temporary directory.
+func testEngine(t *testing.T) *xorm.Engine {
+	t.Helper()
+	var engine, err = xorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "migrate.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetMapper(names.GonicMapper{})
+	t.Cleanup(func() {
+		engine.Close()
+	})
+	return engine
+}
+
+// hascolumn returns true if table at database has column with given name.
+func hascolumn(t *testing.T, engine *xorm.Engine, table, column string) bool {
+	t.Helper()
+	var tables, err = engine.DBMetas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tbl := range tables {
+		if tbl.Name == table {
+			return tbl.GetColumn(column) != nil
+		}
+	}
+	return false
+}
+
+func TestMigrationsCheck(t *testing.T) {
+	var step = func(ver int) Migration {
+		return Migration{Version: ver}
+	}
+	var tests = []struct {
+		name string
+		ms   Migrations
+		err  error
+	}{
+		{"empty", Migrations{}, nil},
+		{"ordered", Migrations{Steps: []Migration{step(1), step(2), step(5)}}, nil},
+		{"zero version", Migrations{Steps: []Migration{step(0), step(1)}}, ErrMigrateOrder},
+		{"duplicate", Migrations{Steps: []Migration{step(1), step(2), step(2)}}, ErrMigrateOrder},
+		{"decreasing", Migrations{Steps: []Migration{step(2), step(1)}}, ErrMigrateOrder},
+		{"storage", StorageMigrations, nil},
+		{"user log", UserlogMigrations, nil},
+	}
+	for _, test := range tests {
+		if err := test.ms.Check(); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestMigrationsOrder(t *testing.T) {
+	var engine = testEngine(t)
+	var calls []string
+	var rec = func(s string) func(*Session) error {
+		return func(*Session) error {
+			calls = append(calls, s)
+			return nil
+		}
+	}
+	var ms = Migrations{Steps: []Migration{
+		{Version: 1, Name: "first", Up: rec("up1")},
+		{Version: 2, Name: "second", Up: rec("up2"), Down: rec("down2")},
+		{Version: 3, Name: "third", Up: rec("up3"), Down: rec("down3")},
+	}}
+
+	var tests = []struct {
+		name   string
+		down   bool
+		target int
+		calls  []string // called steps in order
+		ver    int      // version after action
+		err    error
+	}{
+		{"up to 2", false, 2, []string{"up1", "up2"}, 2, nil},
+		{"up to applied", false, 1, nil, 2, nil},
+		{"up to latest", false, 0, []string{"up3"}, 3, nil},
+		{"down to 1", true, 1, []string{"down3", "down2"}, 1, nil},
+		{"down initial", true, 0, nil, 1, ErrMigrateInit},
+		{"up again", false, 0, []string{"up2", "up3"}, 3, nil},
+		{"down all", true, 0, nil, 3, ErrMigrateInit},
+	}
+	for _, test := range tests {
+		calls = nil
+		var err error
+		if test.down {
+			_, err = ms.Down(engine, test.target)
+		} else {
+			_, err = ms.Up(engine, test.target)
+		}
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: expected error %v, got %v", test.name, test.err, err)
+		}
+		if strings.Join(calls, ",") != strings.Join(test.calls, ",") {
+			t.Errorf("%s: expected calls %v, got %v", test.name, test.calls, calls)
+		}
+		if ver, _ := ms.Version(engine); ver != test.ver {
+			t.Errorf("%s: expected version %d, got %d", test.name, test.ver, ver)
+		}
+	}
+
+	// failed step is not recorded as applied
+	var failed = Migrations{Steps: append(ms.Steps, Migration{Version: 4, Name: "fail", Up: func(*Session) error {
+		return ErrMigrateDown
+	}})}
+	if _, err := failed.Up(engine, 0); !errors.Is(err, ErrMigrateDown) {
+		t.Fatalf("expected error of failed step, got %v", err)
+	}
+	if ver, _ := failed.Version(engine); ver != 3 {
+		t.Errorf("expected version 3 after failed step, got %d", ver)
+	}
+	// build does not know applied step
+	if _, err := (Migrations{Steps: ms.Steps[:1]}).Up(engine, 0); !errors.Is(err, ErrMigrateNewer) {
+		t.Errorf("expected error %v, got %v", ErrMigrateNewer, err)
+	}
+}
+
+func TestStorageBaseline(t *testing.T) {
+	var engine = testEngine(t)
+	var tests = []struct {
+		name string
+		down bool
+		ver  int
+		done bool // walk_store has "done" column
+		err  error
+	}{
+		{"initial", false, 1, false, nil},
+		{"latest", false, 0, true, nil},
+		{"revert marks", true, 3, false, nil},
+		{"revert to initial", true, 1, false, nil},
+		{"revert initial", true, 0, false, ErrMigrateInit},
+	}
+	for _, test := range tests {
+		var err error
+		if test.down {
+			_, err = StorageMigrations.Down(engine, test.ver)
+		} else {
+			_, err = StorageMigrations.Up(engine, test.ver)
+		}
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: expected error %v, got %v", test.name, test.err, err)
+		}
+		if done := hascolumn(t, engine, "walk_store", "done"); done != test.done {
+			t.Errorf("%s: expected done column %v, got %v", test.name, test.done, done)
+		}
+		if !hascolumn(t, engine, "path_store", "path") {
+			t.Errorf("%s: path store is absent", test.name)
+		}
+	}
+}
+
+func TestUserlogBaseline(t *testing.T) {
+	var engine = testEngine(t)
+	if _, err := UserlogMigrations.Up(engine, 1); err != nil {
+		t.Fatal(err)
+	}
+	// latest records can be written to initial schema
+	var ast = AgentStore{UAID: 1, CID: 1, Addr: "192.0.2.1"}
+	if _, err := engine.InsertOne(&ast); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UserlogMigrations.Up(engine, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UserlogMigrations.Down(engine, 0); !errors.Is(err, ErrMigrateInit) {
+		t.Fatalf("expected error %v, got %v", ErrMigrateInit, err)
+	}
+	if n, _ := engine.Count(&AgentStore{}); n != 1 {
+		t.Errorf("expected 1 agent after migrations, got %d", n)
+	}
+}
+
+func TestMigrationsShared(t *testing.T) {
+	var engine = testEngine(t)
+	// storage and user log at the same database, in any order
+	var tests = []struct {
+		name   string
+		ms     Migrations
+		tables []string // tables and columns created by migrations
+	}{
+		{"storage", StorageMigrations, []string{"path_store.path", "walk_store.done", "tag_store.name"}},
+		{"user log", UserlogMigrations, []string{"agent_store.uaid", "open_store.uaid"}},
+		{"storage again", StorageMigrations, nil},
+		{"user log again", UserlogMigrations, nil},
+	}
+	for _, test := range tests {
+		var done, err = test.ms.Up(engine, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if test.tables == nil && len(done) > 0 {
+			t.Errorf("%s: expected nothing to do, got %d steps", test.name, len(done))
+		}
+		if test.tables != nil && len(done) != len(test.ms.Steps) {
+			t.Errorf("%s: expected %d steps, got %d", test.name, len(test.ms.Steps), len(done))
+		}
+		for _, tc := range test.tables {
+			var table, column, _ = strings.Cut(tc, ".")
+			if !hascolumn(t, engine, table, column) {
+				t.Errorf("%s: column %s is absent", test.name, tc)
+			}
+		}
+		if ver, _ := test.ms.Version(engine); ver != test.ms.Latest() {
+			t.Errorf("%s: expected version %d, got %d", test.name, test.ms.Latest(), ver)
+		}
+	}
+	// revert of one list does not touch another
+	if _, err := StorageMigrations.Down(engine, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ver, _ := UserlogMigrations.Version(engine); ver != UserlogMigrations.Latest() {
+		t.Errorf("expected user log version %d, got %d", UserlogMigrations.Latest(), ver)
+	}
+	if ver, _ := StorageMigrations.Version(engine); ver != 1 {
+		t.Errorf("expected storage version 1, got %d", ver)
+	}
+}
+
+// The End.
@@ -0,0 +1,156 @@
+package hms
+
+import (
+	"time"
+)
+
+// Baseline copies of tables at initial schema. Initial migration step
+// creates tables by these definitions, so changes of actual records
+// structures does not affect it, and should be made by further steps.
+
+type v1PathStore struct {
+	Puid uint64 `xorm:"pk autoincr"`
+	Path string `xorm:"varchar(768) notnull unique index"`
+}
+
+func (v1PathStore) TableName() string { return "path_store" }
+
+type v1SrcProp struct {
+	SrcSize int64  `xorm:"'srcsize' default 0"`
+	SrcTime Unix_t `xorm:"'srctime' default 0"`
+}
+
+type v1FileGroup struct {
+	FGother uint `xorm:"'other' default 0"`
+	FGvideo uint `xorm:"'video' default 0"`
+	FGaudio uint `xorm:"'audio' default 0"`
+	FGimage uint `xorm:"'image' default 0"`
+	FGbooks uint `xorm:"'books' default 0"`
+	FGtexts uint `xorm:"'texts' default 0"`
+	FGpacks uint `xorm:"'packs' default 0"`
+	FGgroup uint `xorm:"'group' default 0"`
+}
+
+type v1DirStore struct {
+	Puid    uint64 `xorm:"pk"`
+	Scan    time.Time
+	FGrp    v1FileGroup `xorm:"extends"`
+	Latency int         `xorm:"default 0"`
+}
+
+func (v1DirStore) TableName() string { return "dir_store" }
+
+type v1ExtStore struct {
+	Puid    uint64        `xorm:"pk"`
+	Tags    int           `xorm:"tags"`
+	ETmb    int16         `xorm:"etmb"`
+	Width   int           `xorm:"width"`
+	Height  int           `xorm:"height"`
+	PBLen   time.Duration `xorm:"pblen"`
+	BitRate int           `xorm:"bitrate"`
+	SrcProp v1SrcProp     `xorm:"extends"`
+}
+
+func (v1ExtStore) TableName() string { return "ext_store" }
+
+type v1ExifStore struct {
+	Puid         uint64 `xorm:"pk"`
+	ImgWdh       int
+	ImgHgt       int
+	Model        string    `xorm:"'model'"`
+	Make         string    `xorm:"'make'"`
+	Software     string    `xorm:"'software'"`
+	DateTime     time.Time `xorm:"'datetime'"`
+	Orientation  int       `xorm:"'orientation'"`
+	ExposureTime string    `xorm:"'exposure_time'"`
+	ExposureProg int       `xorm:"'exposure_prog'"`
+	FNumber      float32   `xorm:"'fnumber'"`
+	ISOSpeed     int       `xorm:"'iso_speed'"`
+	ShutterSpeed float32   `xorm:"'shutter_speed'"`
+	Aperture     float32   `xorm:"'aperture'"`
+	ExposureBias float32   `xorm:"'exposure_bias'"`
+	LightSource  int       `xorm:"'light_source'"`
+	Focal        float32   `xorm:"'focal'"`
+	Focal35mm    int       `xorm:"'focal35mm'"`
+	DigitalZoom  float32   `xorm:"'digital_zoom'"`
+	Flash        int       `xorm:"'flash'"`
+	UniqueID     string    `xorm:"'unique_id'"`
+	ThumbJpegLen int       `xorm:"'thumb_jpeg_len'"`
+	Latitude     float64   `xorm:"'latitude'"`
+	Longitude    float64   `xorm:"'longitude'"`
+	Altitude     float32   `xorm:"'altitude'"`
+	Satellites   string    `xorm:"'satellites'"`
+	SrcProp      v1SrcProp `xorm:"extends"`
+}
+
+func (v1ExifStore) TableName() string { return "exif_store" }
+
+type v1Id3Store struct {
+	Puid     uint64 `xorm:"pk"`
+	Title    string
+	Album    string
+	Artist   string
+	Composer string
+	Genre    string
+	Year     int
+	TrackNum int       `xorm:"'tracknum'"`
+	TrackSum int       `xorm:"'tracksum'"`
+	DiscNum  int       `xorm:"'discnum'"`
+	DiscSum  int       `xorm:"'discsum'"`
+	Lyrics   string    `xorm:"text"`
+	Comment  string    `xorm:"text"`
+	ThumbLen int       `xorm:"'thumblen'"`
+	TmbMime  int16     `xorm:"'tmbmime'"`
+	SrcProp  v1SrcProp `xorm:"extends"`
+}
+
+func (v1Id3Store) TableName() string { return "id3_store" }
+
+type v1HashStore struct {
+	Puid    uint64    `xorm:"pk"`
+	DHash   int64     `xorm:"'dhash' index"`
+	SrcProp v1SrcProp `xorm:"extends"`
+}
+
+func (v1HashStore) TableName() string { return "hash_store" }
+
+type v1WalkStore struct {
+	Path string      `xorm:"varchar(768) pk"`
+	Time time.Time   `xorm:"notnull"`
+	FGrp v1FileGroup `xorm:"extends"`
+}
+
+func (v1WalkStore) TableName() string { return "walk_store" }
+
+type v1TaskStore struct {
+	ID    uint64 `xorm:"pk autoincr"`
+	Stage int    `xorm:"notnull index"`
+	Path  string `xorm:"text notnull"`
+	Size  int64  `xorm:"notnull default 0"`
+}
+
+func (v1TaskStore) TableName() string { return "task_store" }
+
+type v1AgentStore struct {
+	UAID uint64 `xorm:"unique"`
+	CID  uint64
+	Addr string
+	UA   string `xorm:"text"`
+	Lang string
+	Time time.Time `xorm:"created"`
+}
+
+func (v1AgentStore) TableName() string { return "agent_store" }
+
+type v1OpenStore struct {
+	UAID    uint64
+	AID     uint64 `xorm:"default 0"`
+	UID     uint64 `xorm:"default 0"`
+	Path    string `xorm:"text"`
+	Latency int
+	Time    time.Time `xorm:"created"`
+}
+
+func (v1OpenStore) TableName() string { return "open_store" }
+
+// The End.
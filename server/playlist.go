@@ -189,6 +189,52 @@ func (pl *Playlist) WriteTo(w io.Writer) (num int64, err error) {
 	return pl.WriteM3U(w)
 }
 
+// ReadFormat reads playlist in format given by file extension.
+func (pl *Playlist) ReadFormat(r io.Reader, ext string) (num int64, err error) {
+	switch ext {
+	case ".m3u", ".m3u8":
+		return pl.ReadM3U(r)
+	case ".wpl":
+		return pl.ReadWPL(r)
+	case ".pls":
+		return pl.ReadPLS(r)
+	case ".asx":
+		return pl.ReadASX(r)
+	case ".xspf":
+		return pl.ReadXSPF(r)
+	}
+	return 0, ErrNotPlay
+}
+
+// WriteFormat writes playlist in format given by file extension.
+func (pl *Playlist) WriteFormat(w io.Writer, ext string) (num int64, err error) {
+	switch ext {
+	case ".m3u":
+		return pl.WriteM3U(w)
+	case ".m3u8":
+		return pl.WriteM3U8(w)
+	case ".wpl":
+		return pl.WriteWPL(w)
+	case ".pls":
+		return pl.WritePLS(w)
+	case ".asx":
+		return pl.WriteASX(w)
+	case ".xspf":
+		return pl.WriteXSPF(w)
+	}
+	return 0, ErrNotPlay
+}
+
+// PlaylistMime is MIME types of playlists formats.
+var PlaylistMime = map[string]string{
+	".m3u":  "audio/x-mpegurl",
+	".m3u8": "application/vnd.apple.mpegurl",
+	".wpl":  "application/vnd.ms-wpl",
+	".pls":  "audio/x-scpls",
+	".asx":  "video/x-ms-asf",
+	".xspf": "application/xspf+xml",
+}
+
 var extinfre = regexp.MustCompile(`^#EXTINF:\s*(\d+),\s*(.*)$`)
 var plistre = regexp.MustCompile(`^#PLAYLIST:\s*(.*)$`)
 var grpre = regexp.MustCompile(`^#EXTGRP:\s*(.*)$`)
@@ -533,30 +579,26 @@ func (pl *Playlist) WritePLS(w io.Writer) (num int64, err error) {
 				return
 			}
 		}
-		n, err = fmt.Fprintf(w, "File%d=%s\n", i, fpath)
+		// entries are numbered from 1, and each entry
+		// has title and length to be read back by ReadPLS
+		n, err = fmt.Fprintf(w, "File%d=%s\n", i+1, fpath)
 		num += int64(n)
 		if err != nil {
 			return
 		}
-		if len(track.Title) > 0 {
-			n, err = fmt.Fprintf(w, "Title%d=%s\n", i, track.Title)
-			num += int64(n)
-			if err != nil {
-				return
-			}
+		n, err = fmt.Fprintf(w, "Title%d=%s\n", i+1, track.Title)
+		num += int64(n)
+		if err != nil {
+			return
 		}
-		if track.Duration != 0 {
-			var sec int64
-			if track.Duration > 0 {
-				sec = track.Duration / 1000
-			} else {
-				sec = -1
-			}
-			n, err = fmt.Fprintf(w, "Length%d=%d\n", i, sec)
-			num += int64(n)
-			if err != nil {
-				return
-			}
+		var sec int64 = -1
+		if track.Duration > 0 {
+			sec = track.Duration / 1000
+		}
+		n, err = fmt.Fprintf(w, "Length%d=%d\n", i+1, sec)
+		num += int64(n)
+		if err != nil {
+			return
 		}
 	}
 
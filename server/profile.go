@@ -126,7 +126,7 @@ func UnfoldPath(session *Session, shrpath string) (syspath string, puid Puid_t,
 	}
 	syspath = JoinPath(syspath, suff)
 	// get PUID if it not have
-	puid = PathStoreCache(session, syspath)
+	puid, err = PathStoreCache(session, syspath)
 	return // composite path
 }
 
@@ -161,6 +161,9 @@ type Profile struct {
 	Remote []DiskPath `json:"remote" yaml:"remote" xml:"remote>item"`
 	Shares []DiskPath `json:"shares" yaml:"shares" xml:"shares>item"`
 
+	Smart   []SmartList `json:"smart,omitempty" yaml:"smart,omitempty" xml:"smart>list,omitempty"`  // smart playlists
+	SmartID uint64      `json:"smartid,omitempty" yaml:"smartid,omitempty" xml:"smartid,omitempty"` // last given ID of smart playlist
+
 	// private shares data
 	ctgrshare CatGrp
 	mux       sync.RWMutex
@@ -321,13 +324,13 @@ func (prf *Profile) FindLocal() {
 }
 
 // ScanLocal scans paths from local roots list.
-func (prf *Profile) ScanLocal(session *Session, scanembed bool) (ret []any, err error) {
+func (prf *Profile) ScanLocal(session *Session, cid uint64, scanembed bool) (ret []any, err error) {
 	prf.mux.RLock()
 	var vfiles = append([]DiskPath{}, prf.Local...) // make non-nil copy
 	prf.mux.RUnlock()
 
 	var dp DirProp
-	if ret, dp, err = ScanFileNameList(prf, session, vfiles, scanembed); err != nil {
+	if ret, dp, err = ScanFileNameList(prf, session, vfiles, cid, scanembed); err != nil {
 		return
 	}
 
@@ -340,13 +343,13 @@ func (prf *Profile) ScanLocal(session *Session, scanembed bool) (ret []any, err
 }
 
 // ScanRemote scans paths at network destination.
-func (prf *Profile) ScanRemote(session *Session, scanembed bool) (ret []any, err error) {
+func (prf *Profile) ScanRemote(session *Session, cid uint64, scanembed bool) (ret []any, err error) {
 	prf.mux.RLock()
 	var vfiles = append([]DiskPath{}, prf.Remote...) // make non-nil copy
 	prf.mux.RUnlock()
 
 	var dp DirProp
-	if ret, dp, err = ScanFileNameList(prf, session, vfiles, scanembed); err != nil {
+	if ret, dp, err = ScanFileNameList(prf, session, vfiles, cid, scanembed); err != nil {
 		return
 	}
 
@@ -359,13 +362,13 @@ func (prf *Profile) ScanRemote(session *Session, scanembed bool) (ret []any, err
 }
 
 // ScanShares scans actual shares from shares list.
-func (prf *Profile) ScanShares(session *Session, scanembed bool) (ret []any, err error) {
+func (prf *Profile) ScanShares(session *Session, cid uint64, scanembed bool) (ret []any, err error) {
 	prf.mux.RLock()
 	var vfiles = append([]DiskPath{}, prf.Shares...) // make non-nil copy
 	prf.mux.RUnlock()
 
 	var dp DirProp
-	if ret, dp, err = ScanFileNameList(prf, session, vfiles, scanembed); err != nil {
+	if ret, dp, err = ScanFileNameList(prf, session, vfiles, cid, scanembed); err != nil {
 		return
 	}
 
@@ -402,6 +405,20 @@ func (prf *Profile) updateGrp() {
 	}
 }
 
+// GetLocal returns copy of local roots list.
+func (prf *Profile) GetLocal() []DiskPath {
+	prf.mux.RLock()
+	defer prf.mux.RUnlock()
+	return append([]DiskPath{}, prf.Local...)
+}
+
+// GetShares returns copy of shares list.
+func (prf *Profile) GetShares() []DiskPath {
+	prf.mux.RLock()
+	defer prf.mux.RUnlock()
+	return append([]DiskPath{}, prf.Shares...)
+}
+
 // AddLocal adds system path to local roots list.
 func (prf *Profile) AddLocal(syspath, name string) bool {
 	prf.mux.Lock()
@@ -504,8 +521,9 @@ func (prf *Profile) GetSharePath(session *Session, syspath string) (shrpath, shr
 		}
 	}
 	if len(base) > 0 {
-		var puid = PathStoreCache(session, base)
-		shrpath = JoinPath(puid.String(), syspath[len(base):])
+		if puid, err := PathStoreCache(session, base); err == nil { // skip errors
+			shrpath = JoinPath(puid.String(), syspath[len(base):])
+		}
 		return
 	}
 	return
@@ -527,8 +545,9 @@ func (prf *Profile) GetRootPath(session *Session, syspath string) (rootpath, roo
 		}
 	}
 	if len(base) > 0 {
-		var puid = PathStoreCache(session, base)
-		rootpath = JoinPath(puid.String(), syspath[len(base):])
+		if puid, err := PathStoreCache(session, base); err == nil { // skip errors
+			rootpath = JoinPath(puid.String(), syspath[len(base):])
+		}
 		return
 	}
 	for _, dp := range prf.Remote {
@@ -540,8 +559,9 @@ func (prf *Profile) GetRootPath(session *Session, syspath string) (rootpath, roo
 		}
 	}
 	if len(base) > 0 {
-		var puid = PathStoreCache(session, base)
-		rootpath = JoinPath(puid.String(), syspath[len(base):])
+		if puid, err := PathStoreCache(session, base); err == nil { // skip errors
+			rootpath = JoinPath(puid.String(), syspath[len(base):])
+		}
 		return
 	}
 	return
@@ -580,6 +600,20 @@ func (prf *Profile) PathAccess(syspath string, isadmin bool) bool {
 	if _, ok := CatPathKey[syspath]; ok {
 		return isadmin
 	}
+	if _, ok := SmartPathID(syspath); ok {
+		return isadmin
+	}
+	if _, ok := TagPathID(syspath); ok {
+		if isadmin {
+			return true
+		}
+		for _, dp := range prf.Shares {
+			if dp.Path == CPtags {
+				return true
+			}
+		}
+		return false
+	}
 	return false
 }
 
@@ -32,6 +32,9 @@ const (
 	PUIDbooks  Puid_t = 9
 	PUIDtexts  Puid_t = 10
 	PUIDmap    Puid_t = 11
+	PUIDfavs   Puid_t = 12
+	PUIDrecent Puid_t = 13
+	PUIDtags   Puid_t = 14
 
 	PUIDcache = 32 // first PUID of file system paths
 )
@@ -49,6 +52,9 @@ const (
 	CPbooks  = "<books>"
 	CPtexts  = "<texts>"
 	CPmap    = "<map>"
+	CPfavs   = "<favorites>"
+	CPrecent = "<recent>"
+	CPtags   = "<tags>"
 )
 
 var CatNames = map[string]string{
@@ -63,6 +69,9 @@ var CatNames = map[string]string{
 	CPbooks:  "Books",
 	CPtexts:  "Text files",
 	CPmap:    "Map",
+	CPfavs:   "Favorites",
+	CPrecent: "Recently played",
+	CPtags:   "Tags",
 }
 
 // CatKeyPath is predefined read-only maps with PUIDs keys and categories values.
@@ -78,6 +87,9 @@ var CatKeyPath = map[Puid_t]string{
 	PUIDbooks:  CPbooks,
 	PUIDtexts:  CPtexts,
 	PUIDmap:    CPmap,
+	PUIDfavs:   CPfavs,
+	PUIDrecent: CPrecent,
+	PUIDtags:   CPtags,
 }
 
 // CatPathKey is predefined read-only map with categories keys and PUIDs values.
@@ -93,6 +105,9 @@ var CatPathKey = map[string]Puid_t{
 	CPbooks:  PUIDbooks,
 	CPtexts:  PUIDtexts,
 	CPmap:    PUIDmap,
+	CPfavs:   PUIDfavs,
+	CPrecent: PUIDrecent,
+	CPtags:   PUIDtags,
 }
 
 // Produce base32 string representation of given random bytes slice.
@@ -0,0 +1,278 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+)
+
+// RAW files errors.
+var (
+	ErrRawBad     = errors.New("RAW file is not in TIFF container")
+	ErrRawNoPrev  = errors.New("embedded JPEG preview is not found in RAW file")
+	ErrRawBigPrev = errors.New("embedded JPEG preview is too big")
+)
+
+// TIFF tags used to find embedded previews.
+const (
+	tiffCompression     = 0x0103
+	tiffStripOffsets    = 0x0111
+	tiffStripByteCounts = 0x0117
+	tiffSubIFDs         = 0x014a
+	tiffJpegOffset      = 0x0201
+	tiffJpegLength      = 0x0202
+)
+
+const (
+	rawmaxifd   = 64               // maximum number of IFDs to look through
+	rawmaxprev  = 64 * 1024 * 1024 // maximum size of embedded preview
+	rawcfgchunk = 64 * 1024        // size of preview header to decode config
+)
+
+// rawPreview is location of embedded JPEG in RAW file.
+type rawPreview struct {
+	Offset int64
+	Length int64
+}
+
+// rawScanner looks through IFDs of TIFF container
+// to find embedded JPEG previews.
+type rawScanner struct {
+	r     io.ReadSeeker
+	bo    binary.ByteOrder
+	seen  map[int64]struct{}
+	found []rawPreview
+}
+
+// scan reads IFD at given offset, all its sub-IFDs and next IFDs chain.
+func (rs *rawScanner) scan(off int64) (err error) {
+	for off != 0 {
+		if _, ok := rs.seen[off]; ok || len(rs.seen) >= rawmaxifd {
+			return
+		}
+		rs.seen[off] = struct{}{}
+
+		if _, err = rs.r.Seek(off, io.SeekStart); err != nil {
+			return
+		}
+		var cnt [2]byte
+		if _, err = io.ReadFull(rs.r, cnt[:]); err != nil {
+			return
+		}
+		var n = int(rs.bo.Uint16(cnt[:]))
+		var buf = make([]byte, n*12+4)
+		if _, err = io.ReadFull(rs.r, buf); err != nil {
+			return
+		}
+
+		var compression uint32
+		var jpgoff, jpglen, stripoff, striplen int64
+		var subs []int64
+		for i := range n {
+			var e = buf[i*12 : i*12+12]
+			var tag, typ, count = rs.bo.Uint16(e), rs.bo.Uint16(e[2:]), rs.bo.Uint32(e[4:])
+			var val uint32
+			if typ == tiffShort {
+				val = uint32(rs.bo.Uint16(e[8:]))
+			} else {
+				val = rs.bo.Uint32(e[8:])
+			}
+			switch tag {
+			case tiffCompression:
+				compression = val
+			case tiffJpegOffset:
+				jpgoff = int64(val)
+			case tiffJpegLength:
+				jpglen = int64(val)
+			case tiffStripOffsets:
+				if count == 1 {
+					stripoff = int64(val)
+				}
+			case tiffStripByteCounts:
+				if count == 1 {
+					striplen = int64(val)
+				}
+			case tiffSubIFDs:
+				if count == 1 {
+					subs = append(subs, int64(val))
+				} else if count > 1 && count <= rawmaxifd {
+					var arr = make([]byte, count*4)
+					if _, err = rs.r.Seek(int64(val), io.SeekStart); err != nil {
+						return
+					}
+					if _, err = io.ReadFull(rs.r, arr); err != nil {
+						return
+					}
+					for j := range int(count) {
+						subs = append(subs, int64(rs.bo.Uint32(arr[j*4:])))
+					}
+				}
+			}
+		}
+		if jpgoff > 0 && jpglen > 0 {
+			rs.found = append(rs.found, rawPreview{jpgoff, jpglen})
+		}
+		if (compression == 6 || compression == 7) && stripoff > 0 && striplen > 0 {
+			rs.found = append(rs.found, rawPreview{stripoff, striplen})
+		}
+		for _, sub := range subs {
+			if err = rs.scan(sub); err != nil {
+				return
+			}
+		}
+		off = int64(rs.bo.Uint32(buf[n*12:]))
+	}
+	return
+}
+
+// rawPreviewLoc finds the biggest embedded JPEG preview in RAW file.
+func rawPreviewLoc(r io.ReadSeeker) (best rawPreview, err error) {
+	var hdr [8]byte
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	var rs = rawScanner{
+		r:    r,
+		seen: map[int64]struct{}{},
+	}
+	switch string(hdr[:4]) {
+	case "II*\x00":
+		rs.bo = binary.LittleEndian
+	case "MM\x00*":
+		rs.bo = binary.BigEndian
+	default:
+		err = ErrRawBad
+		return
+	}
+	if err = rs.scan(int64(rs.bo.Uint32(hdr[4:]))); err != nil && len(rs.found) == 0 {
+		return
+	}
+	err = nil
+
+	// choose the biggest preview that can be decoded
+	var area int
+	for _, p := range rs.found {
+		if _, err = r.Seek(p.Offset, io.SeekStart); err != nil {
+			return
+		}
+		var imc image.Config
+		var format string
+		if imc, format, err = image.DecodeConfig(io.LimitReader(r, min(p.Length, rawcfgchunk))); err != nil || format != "jpeg" {
+			continue // lossless JPEG or broken data
+		}
+		if imc.Width*imc.Height > area {
+			best, area = p, imc.Width*imc.Height
+		}
+	}
+	err = nil
+	if area == 0 {
+		err = ErrRawNoPrev
+	}
+	return
+}
+
+// RawPreview returns the biggest embedded JPEG preview from RAW file
+// in TIFF container, such as CR2, NEF, ARW, DNG.
+func RawPreview(r io.ReadSeeker) (data []byte, err error) {
+	var best rawPreview
+	if best, err = rawPreviewLoc(r); err != nil {
+		return
+	}
+	if best.Length > rawmaxprev {
+		return nil, ErrRawBigPrev
+	}
+
+	data = make([]byte, best.Length)
+	if _, err = r.Seek(best.Offset, io.SeekStart); err != nil {
+		return
+	}
+	_, err = io.ReadFull(r, data)
+	return
+}
+
+// ExtractThumbRAW makes thumbnail from the biggest embedded
+// JPEG preview of RAW file. Preview is scaled down to thumbnail size.
+func ExtractThumbRAW(syspath string) (md MediaData, err error) {
+	// disable thumbnail if it not found
+	defer func() {
+		if md.Mime == MimeNil {
+			md.Mime = MimeDis
+		}
+	}()
+
+	var file RFile
+	if file, err = OpenFile(syspath); err != nil {
+		return
+	}
+	defer file.Close()
+
+	var data []byte
+	if data, err = RawPreview(file); err != nil {
+		if errors.Is(err, ErrRawNoPrev) || errors.Is(err, ErrRawBad) {
+			err = ErrNoThumb // set err to 'no thumbnail'
+		}
+		return
+	}
+
+	var src image.Image
+	if src, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+		if src == nil { // skip "short Huffman data" or others errors with partial results
+			return
+		}
+	}
+	var bounds = src.Bounds()
+	if md.Data, err = DrawThumb(src, bounds.Dx(), bounds.Dy(), OrientNormal); err != nil {
+		return
+	}
+	md.Mime = MimeWebp
+	if fi, _ := file.Stat(); fi != nil {
+		md.Time = fi.ModTime()
+	}
+	return
+}
+
+// ImageDecodeConfig decodes the color model and dimensions of image file,
+// for RAW files it returns properties of embedded preview if it present.
+func ImageDecodeConfig(r io.ReadSeeker, ext string) (imc image.Config, format string, err error) {
+	if IsTypeRAW(ext) {
+		var best rawPreview
+		if best, err = rawPreviewLoc(r); err == nil {
+			if _, err = r.Seek(best.Offset, io.SeekStart); err != nil {
+				return
+			}
+			return image.DecodeConfig(io.LimitReader(r, best.Length))
+		}
+		if !errors.Is(err, ErrRawNoPrev) {
+			return
+		}
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+	}
+	return image.DecodeConfig(r)
+}
+
+// ImageDecode decodes image file, for RAW files it decodes embedded preview
+// if it present.
+func ImageDecode(r io.ReadSeeker, ext string) (img image.Image, format string, err error) {
+	if IsTypeRAW(ext) {
+		var data []byte
+		if data, err = RawPreview(r); err == nil {
+			return image.Decode(bytes.NewReader(data))
+		}
+		if !errors.Is(err, ErrRawNoPrev) {
+			return
+		}
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+	}
+	return image.Decode(r)
+}
+
+// The End.
@@ -0,0 +1,106 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testJpegSize makes JPEG image with given dimensions.
+func testJpegSize(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testRaw makes little-endian TIFF container such as RAW file has,
+// with small JPEG at IFD0 and big JPEG at sub-IFD strip.
+func testRaw(small, big []byte) []byte {
+	var bo = binary.LittleEndian
+	var entry = func(b []byte, tag, typ uint16, val uint32) []byte {
+		b = bo.AppendUint16(b, tag)
+		b = bo.AppendUint16(b, typ)
+		b = bo.AppendUint32(b, 1)
+		return bo.AppendUint32(b, val)
+	}
+	const ifd0, subifd = 8, 8 + 2 + 3*12 + 4
+	const data = subifd + 2 + 3*12 + 4
+	var b = []byte{'I', 'I', 42, 0, ifd0, 0, 0, 0}
+	b = bo.AppendUint16(b, 3)
+	b = entry(b, tiffSubIFDs, tiffLong, subifd)
+	b = entry(b, tiffJpegOffset, tiffLong, data)
+	b = entry(b, tiffJpegLength, tiffLong, uint32(len(small)))
+	b = bo.AppendUint32(b, 0)
+	b = bo.AppendUint16(b, 3)
+	b = entry(b, tiffCompression, tiffShort, 6)
+	b = entry(b, tiffStripOffsets, tiffLong, uint32(data+len(small)))
+	b = entry(b, tiffStripByteCounts, tiffLong, uint32(len(big)))
+	b = bo.AppendUint32(b, 0)
+	b = append(b, small...)
+	return append(b, big...)
+}
+
+func TestRawPreview(t *testing.T) {
+	var small, big = testJpegSize(t, 32, 24), testJpegSize(t, 640, 480)
+	var tests = []struct {
+		name string
+		data []byte
+		want []byte
+		err  error
+	}{
+		{"biggest", testRaw(small, big), big, nil},
+		{"broken big", testRaw(small, []byte("not a jpeg")), small, nil},
+		{"no preview", testRaw([]byte("xxxx"), []byte("yyyy")), nil, ErrRawNoPrev},
+		{"not tiff", big, nil, ErrRawBad},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data, err = RawPreview(bytes.NewReader(test.data))
+			if err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if !bytes.Equal(data, test.want) {
+				t.Fatalf("preview mismatch: got %d bytes, expected %d", len(data), len(test.want))
+			}
+		})
+	}
+}
+
+func TestExtractThumbRAW(t *testing.T) {
+	var dir = t.TempDir()
+	var fpath = filepath.Join(dir, "photo.nef")
+	if err := os.WriteFile(fpath, testRaw(testJpegSize(t, 32, 24), testJpegSize(t, 640, 480)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var md, err = ExtractThumbRAW(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Mime != MimeWebp {
+		t.Fatalf("expected webp thumbnail, got mime %d", md.Mime)
+	}
+	var imc image.Config
+	if imc, _, err = image.DecodeConfig(bytes.NewReader(md.Data)); err != nil {
+		t.Fatal(err)
+	}
+	if imc.Width > Cfg.TmbResolution[0] || imc.Height > Cfg.TmbResolution[1] || imc.Width < imc.Height {
+		t.Fatalf("thumbnail has wrong size %dx%d", imc.Width, imc.Height)
+	}
+
+	var nopath = filepath.Join(dir, "empty.nef")
+	if err = os.WriteFile(nopath, testRaw([]byte("xxxx"), []byte("yyyy")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if md, err = ExtractThumbRAW(nopath); err != ErrNoThumb || md.Mime != MimeDis {
+		t.Fatalf("expected error %v with disabled mime, got %v, %d", ErrNoThumb, err, md.Mime)
+	}
+}
+
+// The End.
@@ -3,10 +3,12 @@ package hms
 import (
 	"encoding/xml"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	cfg "github.com/schwarzlichtbezirk/hms/config"
 
@@ -140,10 +142,52 @@ func Ret404(c *gin.Context, code int, err error) {
 }
 
 func Ret500(c *gin.Context, code int, err error) {
-	Log.Error("response error: %s", err.Error())
+	Slog.Error("response error", append(ReqAttrs(c), "code", code, "error", err)...)
 	RetErr(c, http.StatusInternalServerError, code, err)
 }
 
+// ReqAttrs returns structured log attributes of request
+// with route, profile ID, user ID and PUID if they are present.
+func ReqAttrs(c *gin.Context) []any {
+	var attrs = make([]any, 0, 8)
+	var route = c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	attrs = append(attrs, "route", route)
+	if s := c.Param("aid"); s != "" {
+		attrs = append(attrs, "aid", s)
+	}
+	if uv, ok := c.Get(userKey); ok {
+		attrs = append(attrs, "uid", uv.(*Profile).ID)
+	}
+	if s := c.Param("puid"); s != "" {
+		attrs = append(attrs, "puid", s)
+	}
+	return attrs
+}
+
+// LogWrap is middleware that writes log entry for each served request
+// with its route, method, status, latency and client identification.
+func LogWrap(c *gin.Context) {
+	var t0 = time.Now()
+	c.Next()
+	var status = c.Writer.Status()
+	var lev = slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		lev = slog.LevelError
+	} else if status >= http.StatusBadRequest {
+		lev = slog.LevelWarn
+	}
+	Slog.Log(c.Request.Context(), lev, "request", append(ReqAttrs(c),
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"status", status,
+		"latency", time.Since(t0),
+		"ip", AnonAddr(c.ClientIP()),
+	)...)
+}
+
 // HdrRange describes one range chunk of the file to download.
 type HdrRange struct {
 	Start int64
@@ -190,6 +234,10 @@ func HasRangeBegin(r *http.Request) bool {
 }
 
 func Router(r *gin.Engine) {
+	r.Use(MetricsWrap)
+	if Cfg.LogRequests {
+		r.Use(LogWrap)
+	}
 	r.NoRoute(Handle404)
 	r.NoMethod(Handle405)
 
@@ -232,23 +280,38 @@ func Router(r *gin.Engine) {
 	// cached tiles
 	gacc.GET("/tile/:puid/:dim", Auth(false), SpiTile)
 
-	////////////////
-	// API routes //
-	////////////////
+	// metrics in Prometheus format
+	r.GET("/metrics", MetricsAuth, SpiMetrics)
+
+	ApiRouter(r)
+}
 
+// ApiRouter registers API routes.
+func ApiRouter(r *gin.Engine) {
 	var api = r.Group("/api", ApiWrap)
 	api.GET("/ping", SpiPing)
 	api.POST("/reload", Auth(true), SpiReload)
+	api.POST("/compact", Auth(true), SpiCompact)
 	api.GET("/stat/srvinf", SpiServInfo)
 	api.GET("/stat/memusg", SpiMemUsage)
 	api.GET("/stat/cchinf", SpiCachesInfo)
+	api.GET("/stat/imgscn", SpiScanQueue)
+	api.GET("/stat/bgscan", SpiBgScan)
 	api.POST("/stat/getlog", SpiGetLog)
 	api.POST("/stat/usrlst", SpiUserList)
+	api.GET("/stat/events", Auth(false), SpiEvents)
+	api.POST("/stat/topfiles", Auth(true), SpiTopFiles)
+	api.POST("/stat/topdirs", Auth(true), SpiTopDirs)
+	api.POST("/stat/shares", Auth(true), SpiSharesTraffic)
+	api.POST("/stat/activity", Auth(true), SpiActivity)
+	api.POST("/stat/topclients", Auth(true), SpiTopClients)
+	api.POST("/userlog/clean", Auth(true), SpiUserlogClean)
+	api.GET("/userlog/export", Auth(true), SpiUserlogExport)
 
 	api.POST("/auth/signin", SpiSignin)
 	api.GET("/auth/refresh", Auth(true), SpiRefresh)
 
-	var usr = gacc.Group("/api")
+	var usr = r.Group("/id:aid/api")
 
 	usr.POST("/res/folder", Auth(false), SpiFolder)
 	usr.POST("/res/tags", Auth(false), SpiTags)
@@ -256,6 +319,7 @@ func Router(r *gin.Engine) {
 
 	usr.POST("/gps/range", Auth(true), SpiGpsRange)
 	usr.POST("/gps/scan", Auth(false), SpiGpsScan)
+	usr.POST("/dup/list", Auth(true), SpiDupList)
 
 	usr.POST("/tags/check", Auth(false), SpiTagsCheck)
 	usr.POST("/tags/start", Auth(false), SpiTagsStart)
@@ -276,4 +340,25 @@ func Router(r *gin.Engine) {
 	usr.POST("/edit/copy", Auth(true), SpiEditCopy)
 	usr.POST("/edit/rename", Auth(true), SpiEditRename)
 	usr.POST("/edit/delete", Auth(true), SpiEditDelete)
+	usr.POST("/edit/tags", Auth(true), SpiEditTags)
+	usr.POST("/edit/exif", Auth(true), SpiEditExif)
+
+	usr.POST("/playlist/save", Auth(true), SpiPlaylistSave)
+	usr.POST("/playlist/edit", Auth(true), SpiPlaylistEdit)
+	usr.GET("/playlist/download", Auth(false), SpiPlaylistDownload)
+
+	usr.POST("/smart/list", Auth(true), SpiSmartList)
+	usr.POST("/smart/set", Auth(true), SpiSmartSet)
+	usr.POST("/smart/del", Auth(true), SpiSmartDel)
+
+	usr.POST("/state/get", Auth(true), SpiStateGet)
+	usr.POST("/state/fav", Auth(true), SpiStateFav)
+	usr.POST("/state/play", Auth(true), SpiStatePlay)
+	usr.POST("/state/forget", Auth(true), SpiStateForget)
+
+	usr.POST("/tag/add", Auth(true), SpiTagAdd)
+	usr.POST("/tag/del", Auth(true), SpiTagDel)
+	usr.POST("/tag/rate", Auth(true), SpiTagRate)
+	usr.POST("/tag/get", Auth(false), SpiTagGet)
+	usr.POST("/tag/cloud", Auth(false), SpiTagCloud)
 }
@@ -2,6 +2,7 @@ package hms
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 type RWList[T comparable] struct {
@@ -157,6 +158,8 @@ type Cache[K comparable, T any] struct {
 	idx map[K]int      // map with pairs positions pointed by keys
 	efn func(K, T)     // exit function, called on pair remove
 	mux sync.Mutex
+
+	hits, misses atomic.Uint64 // lookups statistics
 }
 
 // NewCache returns pointer to new Cache object.
@@ -196,9 +199,25 @@ func (c *Cache[K, T]) Peek(key K) (ret T, ok bool) {
 	if n, ok = c.idx[key]; ok {
 		ret = c.seq[n].val
 	}
+	c.count(ok)
 	return
 }
 
+// count updates lookups statistics.
+func (c *Cache[K, T]) count(ok bool) {
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// Lookups returns number of found and not found values
+// by Peek and Get calls.
+func (c *Cache[K, T]) Lookups() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
 // Get returns value pointed by given key, and brings the pair to top of cache.
 func (c *Cache[K, T]) Get(key K) (ret T, ok bool) {
 	var n int
@@ -216,6 +235,7 @@ func (c *Cache[K, T]) Get(key K) (ret T, ok bool) {
 			c.idx[c.seq[i].key] = i
 		}
 	}
+	c.count(ok)
 	return
 }
 
@@ -3,6 +3,7 @@ package hms
 import (
 	"fmt"
 	"io/fs"
+	"path"
 	"time"
 
 	jnt "github.com/schwarzlichtbezirk/joint"
@@ -46,21 +47,23 @@ func IsStatic(fi fs.FileInfo) (static bool) {
 
 // ScanFileNameList returns file properties list for given list of
 // full file system paths. File paths can be in different folders.
-func ScanFileNameList(prf *Profile, session *Session, vpaths []DiskPath, scanembed bool) (ret []any, lstp DirProp, err error) {
+func ScanFileNameList(prf *Profile, session *Session, vpaths []DiskPath, cid uint64, scanembed bool) (ret []any, lstp DirProp, err error) {
 	var files = make([]fs.FileInfo, len(vpaths))
 	for i, dp := range vpaths {
 		fi, _ := JP.Stat(dp.Path)
 		files[i] = fi
 	}
 
-	return ScanFileInfoList(prf, session, files, vpaths, scanembed)
+	return ScanFileInfoList(prf, session, files, vpaths, cid, scanembed)
 }
 
 // ScanFileInfoList returns file properties list for given list of
 // []fs.FileInfo and associated list of full file system paths.
 // Elements of []fs.FileInfo list can be nil in case if file is
-// unavailable, or if it categoty item.
-func ScanFileInfoList(prf *Profile, session *Session, vfiles []fs.FileInfo, vpaths []DiskPath, scanembed bool) (ret []any, lstp DirProp, err error) {
+// unavailable, or if it categoty item. If scanembed is set, files
+// without cached tags are queued to extraction on behalf of client
+// with given user agent ID.
+func ScanFileInfoList(prf *Profile, session *Session, vfiles []fs.FileInfo, vpaths []DiskPath, cid uint64, scanembed bool) (ret []any, lstp DirProp, err error) {
 	var tscan = time.Now()
 
 	var vpuids = make([]Puid_t, len(vpaths)) // verified PUIDs
@@ -117,18 +120,20 @@ func ScanFileInfoList(prf *Profile, session *Session, vfiles []fs.FileInfo, vpat
 	var extmap = map[Puid_t]ExtProp{}
 	var ess []ExtStore
 	var epuids = make([]Puid_t, 0, len(vpuids)) // ext
+	var eidx = map[Puid_t]int{}                 // indexes of ext
 	for i, puid := range vpuids {
-		if xp, ok := extcache.Peek(puid); ok {
-			extmap[puid] = xp
-		} else {
-			var ext = GetFileExt(vpaths[i].Path)
-			if IsTypeEXIF(ext) || IsTypeDecoded(ext) || IsTypeID3(ext) {
-				epuids = append(epuids, puid)
+		var ext = GetFileExt(vpaths[i].Path)
+		if IsTypeEXIF(ext) || IsTypeDecoded(ext) || IsTypeID3(ext) {
+			if xp, ok := extcache.Peek(puid); ok && (vfiles[i] == nil || !xp.IsOutdated(vfiles[i])) {
+				extmap[puid] = xp
 			} else {
-				extmap[puid] = ExtProp{
-					Tags: TagDis,
-					ETmb: MimeDis,
-				}
+				epuids = append(epuids, puid)
+				eidx[puid] = i
+			}
+		} else {
+			extmap[puid] = ExtProp{
+				Tags: TagDis,
+				ETmb: MimeDis,
 			}
 		}
 	}
@@ -137,6 +142,12 @@ func ScanFileInfoList(prf *Profile, session *Session, vfiles []fs.FileInfo, vpat
 			return
 		}
 		for _, es := range ess {
+			var i = eidx[es.Puid]
+			if vfiles[i] != nil && es.Prop.IsOutdated(vfiles[i]) {
+				// file was modified, drop all cached data
+				CacheStale(es.Puid, vpaths[i].Path, vfiles[i])
+				continue
+			}
 			extcache.Poke(es.Puid, es.Prop)
 			extmap[es.Puid] = es.Prop
 		}
@@ -145,7 +156,7 @@ func ScanFileInfoList(prf *Profile, session *Session, vfiles []fs.FileInfo, vpat
 	if scanembed {
 		for _, puid := range epuids {
 			if _, ok := extmap[puid]; !ok {
-				ImgScanner.AddTags(puid)
+				ImgScanner.AddTags(puid, cid, PrioBack)
 			}
 		}
 	}
@@ -205,7 +216,7 @@ func ScanFileInfoList(prf *Profile, session *Session, vfiles []fs.FileInfo, vpat
 
 // ScanDir returns file properties list for given file system directory,
 // or directory in iso-disk.
-func ScanDir(prf *Profile, session *Session, dir string, isadmin bool, scanembed bool) (ret []any, skipped int, err error) {
+func ScanDir(prf *Profile, session *Session, dir string, isadmin bool, cid uint64, scanembed bool) (ret []any, skipped int, err error) {
 	var files []fs.DirEntry
 	if files, err = JP.ReadDir(dir); err != nil && len(files) == 0 {
 		return
@@ -236,13 +247,183 @@ func ScanDir(prf *Profile, session *Session, dir string, isadmin bool, scanembed
 	skipped = len(files) - len(vfiles)
 
 	var dp DirProp
-	if ret, dp, err = ScanFileInfoList(prf, session, vfiles, vpaths, scanembed); err != nil {
+	if ret, dp, err = ScanFileInfoList(prf, session, vfiles, vpaths, cid, scanembed); err != nil {
 		return
 	}
 
 	go SqlSession(func(session *Session) (res any, err error) {
-		var puid = PathStoreCache(session, dir)
-		DirStoreSet(session, puid, dp)
+		var puid Puid_t
+		if puid, err = PathStoreCache(session, dir); err != nil {
+			return
+		}
+		err = DirStoreSet(session, puid, dp)
+		return
+	})
+
+	return
+}
+
+// ScanPlaylist returns properties list for tracks of given playlist
+// in order of tracks. Remote tracks and absent local files are
+// represented by placeholders. Playlist folder properties are cached
+// for playlist file with given system path.
+func ScanPlaylist(prf *Profile, session *Session, plpath string, pl *Playlist, isadmin bool, cid uint64, scanembed bool) (ret []any, skipped int, err error) {
+	var vfiles = make([]fs.FileInfo, 0, len(pl.Tracks)) // verified file infos
+	var vpaths = make([]DiskPath, 0, len(pl.Tracks))    // verified paths
+	var vidx = make([]int, 0, len(pl.Tracks))           // indexes of verified files at list
+	ret = make([]any, 0, len(pl.Tracks))
+	var holders FileGroup
+	for _, track := range pl.Tracks {
+		var name = track.Title
+		if name == "" {
+			name = path.Base(track.Location)
+		}
+		if isURL(track.Location) {
+			ret = append(ret, &TrackKit{
+				PuidProp: PuidProp{Static: true},
+				FileProp: FileProp{Name: name, Type: FTfile},
+				Link:     track.Location,
+				Duration: track.Duration,
+			})
+			*holders.Field(GetFileGroup(track.Location))++
+			continue
+		}
+		var fpath = ToSlash(track.Location)
+		if Hidden.Fits(fpath) || !prf.PathAccess(fpath, isadmin) {
+			skipped++
+			continue
+		}
+		if fi, _ := JP.Stat(fpath); fi != nil {
+			vidx = append(vidx, len(ret))
+			ret = append(ret, nil)
+			vfiles = append(vfiles, fi)
+			vpaths = append(vpaths, MakeFilePath(fpath))
+		} else {
+			ret = append(ret, &TrackKit{
+				PuidProp: PuidProp{Static: true},
+				FileProp: FileProp{Name: name, Type: FTfile},
+				Duration: track.Duration,
+				Missing:  true,
+			})
+			*holders.Field(GetFileGroup(fpath))++
+		}
+	}
+
+	var list []any
+	var dp DirProp
+	if list, dp, err = ScanFileInfoList(prf, session, vfiles, vpaths, cid, scanembed); err != nil {
+		ret = nil
+		return
+	}
+	for i, prop := range list {
+		ret[vidx[i]] = prop
+	}
+	for id := FG_t(0); id < FGnum; id++ {
+		*dp.FGrp.Field(id) += *holders.Field(id)
+	}
+
+	go SqlSession(func(session *Session) (res any, err error) {
+		var puid Puid_t
+		if puid, err = PathStoreCache(session, plpath); err != nil {
+			return
+		}
+		err = DirStoreSet(session, puid, dp)
+		return
+	})
+
+	return
+}
+
+// ScanCue returns properties list for tracks of given CUE sheet.
+// Each track is represented by virtual file placed inside CUE sheet,
+// tracks of absent audio files are represented by placeholders.
+// CUE sheet folder properties are cached for CUE sheet file.
+func ScanCue(prf *Profile, session *Session, cuepath string, cs *CueSheet, isadmin bool) (ret []any, skipped int, err error) {
+	var tscan = time.Now()
+	var dp DirProp
+	var fimap = map[string]fs.FileInfo{}  // audio files infos
+	var flen = map[string]time.Duration{} // audio files playback length
+	ret = make([]any, 0, len(cs.Tracks))
+	for _, ct := range cs.Tracks {
+		if Hidden.Fits(ct.File) || !prf.PathAccess(ct.File, isadmin) {
+			skipped++
+			continue
+		}
+		var fi, ok = fimap[ct.File]
+		if !ok {
+			fi, _ = JP.Stat(ct.File)
+			fimap[ct.File] = fi
+			// playback length of whole audio file, if it's known
+			if puid, ok := PathStorePUID(session, ct.File); ok {
+				if xp, ok := ExtStoreGet(session, puid); ok {
+					flen[ct.File] = xp.PBLen
+				}
+			}
+		}
+		*dp.FGrp.Field(GetFileGroup(ct.File))++
+		if fi == nil {
+			ret = append(ret, &TrackKit{
+				PuidProp: PuidProp{Static: true},
+				FileProp: FileProp{Name: CueTrackName(&ct), Type: FTfile},
+				Duration: int64(ct.Duration() / time.Millisecond),
+				Missing:  true,
+			})
+			continue
+		}
+
+		var vpath = CueTrackPath(cuepath, &ct)
+		var vpuid Puid_t
+		if vpuid, err = PathStoreCache(session, vpath); err != nil {
+			return
+		}
+		var ck = CueKit{
+			FileKit: FileKit{
+				PuidProp: PuidProp{
+					PUID:   vpuid,
+					Free:   prf.PathAccess(vpath, false),
+					Shared: prf.IsShared(vpath),
+					Static: true,
+				},
+				FileProp: FileProp{
+					Name: CueTrackName(&ct),
+					Type: FTfile,
+					Time: fi.ModTime(),
+				},
+				ExtProp: ExtProp{
+					Tags:  TagDis,
+					ETmb:  MimeDis,
+					PBLen: ct.Duration(),
+				},
+			},
+			CueProp: CueProp{
+				Track:     ct.Number,
+				Title:     ct.Title,
+				Performer: ct.Performer,
+				Start:     ct.Start,
+				End:       ct.End,
+				Cut:       IsTypeCut(GetFileExt(ct.File)),
+			},
+		}
+		// last track lasts up to end of file
+		if ck.PBLen == 0 && flen[ct.File] > ct.Start {
+			ck.PBLen = flen[ct.File] - ct.Start
+		}
+		// estimate size by duration
+		if ck.PBLen > 0 && flen[ct.File] > 0 {
+			ck.Size = int64(float64(fi.Size()) * float64(ck.PBLen) / float64(flen[ct.File]))
+		}
+		ret = append(ret, &ck)
+	}
+
+	dp.Scan = tscan
+	dp.Latency = int(time.Since(tscan) / time.Millisecond)
+
+	go SqlSession(func(session *Session) (res any, err error) {
+		var puid Puid_t
+		if puid, err = PathStoreCache(session, cuepath); err != nil {
+			return
+		}
+		err = DirStoreSet(session, puid, dp)
 		return
 	})
 
@@ -251,10 +432,11 @@ func ScanDir(prf *Profile, session *Session, dir string, isadmin bool, scanembed
 
 // ScanCat returns file properties list where number of files
 // of given category is more then given percent.
-func ScanCat(prf *Profile, session *Session, puid Puid_t, cat string, percent float64, scanembed bool) (ret []any, err error) {
-	const categoryCond = "(%s)/(other+video+audio+image+books+texts+packs) > %f"
+func ScanCat(prf *Profile, session *Session, puid Puid_t, cat string, percent float64, cid uint64, scanembed bool) (ret []any, err error) {
+	// condition without division to avoid integer arithmetic and division by zero
+	const categoryCond = "(%s) > ? * (other+video+audio+image+books+texts+packs)"
 	var dss []DirStore
-	if err = session.Where(fmt.Sprintf(categoryCond, cat, percent)).Find(&dss); err != nil {
+	if err = session.Where(fmt.Sprintf(categoryCond, cat), percent).Find(&dss); err != nil {
 		return
 	}
 	var newpuids []uint64
@@ -279,7 +461,7 @@ func ScanCat(prf *Profile, session *Session, puid Puid_t, cat string, percent fl
 	}
 
 	var dp DirProp
-	if ret, dp, err = ScanFileNameList(prf, session, vpaths, scanembed); err != nil {
+	if ret, dp, err = ScanFileNameList(prf, session, vpaths, cid, scanembed); err != nil {
 		return
 	}
 
@@ -0,0 +1,165 @@
+package hms
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanPlaylist(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+	var prf = testProfile(t, "admin", "secret")
+	var dir = ToSlash(t.TempDir())
+	prf.Local = []DiskPath{{Path: dir, Name: "music"}}
+	if err := os.WriteFile(JoinPath(dir, "a.mp3"), []byte("ID3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type kind int
+	const (
+		file kind = iota
+		link
+		missing
+	)
+	var tests = []struct {
+		name  string
+		track Track
+		kind  kind
+	}{
+		{"local file", Track{Title: "a", Location: JoinPath(dir, "a.mp3")}, file},
+		{"remote track", Track{Title: "radio", Location: "http://example.com/radio.mp3", Duration: 1000}, link},
+		{"absent file", Track{Title: "b", Location: JoinPath(dir, "b.mp3"), Duration: 2000}, missing},
+		{"hidden file", Track{Title: "c", Location: JoinPath(dir, ".c.mp3")}, -1},
+		{"no access", Track{Title: "d", Location: "/nowhere/d.mp3"}, -1},
+	}
+	var pl Playlist
+	var want []kind
+	for _, test := range tests {
+		pl.Tracks = append(pl.Tracks, test.track)
+		if test.kind >= 0 {
+			want = append(want, test.kind)
+		}
+	}
+	var plpath = JoinPath(dir, "list.m3u8")
+	var puid, err = PathStoreCache(session, plpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ret []any
+	var skipped int
+	if ret, skipped, err = ScanPlaylist(prf, session, plpath, &pl, true, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	// wait until playlist folder properties are stored in background
+	var dp DirProp
+	for i := 0; i < 100; i++ {
+		var ok bool
+		if dp, ok = DirStoreGet(session, puid); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if skipped != len(tests)-len(want) {
+		t.Errorf("expected %d skipped tracks, got %d", len(tests)-len(want), skipped)
+	}
+	if len(ret) != len(want) {
+		t.Fatalf("expected %d tracks, got %d", len(want), len(ret))
+	}
+	for i, prop := range ret {
+		var test = tests[i]
+		switch p := prop.(type) {
+		case *FileKit:
+			if test.kind != file || p.PUID == 0 {
+				t.Errorf("%s: unexpected file %v", test.name, p)
+			}
+		case *TrackKit:
+			if p.PUID != 0 || p.Name != test.track.Title || p.Duration != test.track.Duration {
+				t.Errorf("%s: unexpected placeholder %v", test.name, p)
+			}
+			if (p.Link != "") != (test.kind == link) || p.Missing != (test.kind == missing) {
+				t.Errorf("%s: unexpected placeholder kind %v", test.name, p)
+			}
+		default:
+			t.Errorf("%s: unexpected property type %T", test.name, prop)
+		}
+	}
+	if dp.FGrp.FGaudio != uint(len(want)) {
+		t.Errorf("expected %d audio files at folder properties, got %d", len(want), dp.FGrp.FGaudio)
+	}
+}
+
+func TestScanCue(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+	var prf = testProfile(t, "admin", "secret")
+	var dir = ToSlash(t.TempDir())
+	prf.Local = []DiskPath{{Path: dir, Name: "music"}}
+	for _, name := range []string{"sample.flac", "sample.mp3"} {
+		var b, err = os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(JoinPath(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		name  string
+		track CueTrack
+		cut   bool // track is cut from audio file
+		found bool // audio file is present
+	}{
+		{"flac", CueTrack{Number: 1, File: JoinPath(dir, "sample.flac"), End: time.Second}, true, true},
+		{"flac tail", CueTrack{Number: 2, File: JoinPath(dir, "sample.flac"), Start: time.Second}, true, true},
+		{"mp3", CueTrack{Number: 3, File: JoinPath(dir, "sample.mp3"), Start: time.Second}, false, true},
+		{"absent", CueTrack{Number: 4, File: JoinPath(dir, "absent.wav")}, false, false},
+	}
+	var cs CueSheet
+	for _, test := range tests {
+		cs.Tracks = append(cs.Tracks, test.track)
+	}
+	var cuepath = JoinPath(dir, "album.cue")
+	var puid, err = PathStoreCache(session, cuepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret []any
+	if ret, _, err = ScanCue(prf, session, cuepath, &cs, true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, ok := DirStoreGet(session, puid); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(ret) != len(tests) {
+		t.Fatalf("expected %d tracks, got %d", len(tests), len(ret))
+	}
+	for i, test := range tests {
+		var ck, ok = ret[i].(*CueKit)
+		if ok != test.found {
+			t.Errorf("%s: unexpected track properties %T", test.name, ret[i])
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if ck.Cut != test.cut {
+			t.Errorf("%s: expected cut %v, got %v", test.name, test.cut, ck.Cut)
+		}
+		if ck.Start != test.track.Start || ck.End != test.track.End {
+			t.Errorf("%s: expected range %v-%v, got %v-%v", test.name, test.track.Start, test.track.End, ck.Start, ck.End)
+		}
+	}
+}
+
+// The End.
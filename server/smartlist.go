@@ -0,0 +1,389 @@
+package hms
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Smart playlists errors.
+var (
+	ErrSmartNone  = errors.New("smart playlist with given ID is not found")
+	ErrSmartName  = errors.New("smart playlist should have a name")
+	ErrSmartRules = errors.New("smart playlist should have at least one rule")
+	ErrSmartField = errors.New("smart playlist rule has unknown field")
+	ErrSmartOp    = errors.New("smart playlist rule has operator that can not be applied to field")
+	ErrSmartValue = errors.New("smart playlist rule has bad value for field")
+)
+
+// SmartRule is condition of smart playlist on file tag.
+type SmartRule struct {
+	Field string `json:"field" yaml:"field" xml:"field,attr"`
+	Op    string `json:"op" yaml:"op" xml:"op,attr"`
+	Value string `json:"value" yaml:"value" xml:",chardata"`
+}
+
+// SmartList is smart playlist, that is set of rules on files
+// tags evaluated on files properties storage.
+type SmartList struct {
+	ID    uint64      `json:"id" yaml:"id" xml:"id,attr"`
+	Name  string      `json:"name" yaml:"name" xml:"name"`
+	Any   bool        `json:"any,omitempty" yaml:"any,omitempty" xml:"any,omitempty,attr"` // match any rule instead of all rules
+	Rules []SmartRule `json:"rules" yaml:"rules" xml:"rules>rule"`
+	Order string      `json:"order,omitempty" yaml:"order,omitempty" xml:"order,omitempty"` // field to sort by, with "-" prefix for descending order
+	Limit int         `json:"limit,omitempty" yaml:"limit,omitempty" xml:"limit,omitempty"` // maximum number of files, no limit if zero
+}
+
+// Kinds of smart playlist fields values.
+const (
+	sfString = iota
+	sfInt
+	sfFloat
+	sfDuration // value in seconds, column in nanoseconds
+	sfTime     // value is date, column is date/time
+	sfUnix     // value is date, column is Unix_t time
+)
+
+type smartfield struct {
+	table  string
+	column string
+	kind   int
+}
+
+// SmartFields is fields that can be used at smart playlists rules.
+var SmartFields = map[string]smartfield{
+	// music tags
+	"title":    {"id3_store", "title", sfString},
+	"album":    {"id3_store", "album", sfString},
+	"artist":   {"id3_store", "artist", sfString},
+	"composer": {"id3_store", "composer", sfString},
+	"genre":    {"id3_store", "genre", sfString},
+	"year":     {"id3_store", "year", sfInt},
+	"tracknum": {"id3_store", "tracknum", sfInt},
+	"discnum":  {"id3_store", "discnum", sfInt},
+	"comment":  {"id3_store", "comment", sfString},
+	// photo tags
+	"make":      {"exif_store", "make", sfString},
+	"model":     {"exif_store", "model", sfString},
+	"software":  {"exif_store", "software", sfString},
+	"taken":     {"exif_store", "datetime", sfTime},
+	"isospeed":  {"exif_store", "iso_speed", sfInt},
+	"fnumber":   {"exif_store", "fnumber", sfFloat},
+	"focal":     {"exif_store", "focal", sfFloat},
+	"focal35mm": {"exif_store", "focal35mm", sfInt},
+	"flash":     {"exif_store", "flash", sfInt},
+	// common properties
+	"width":    {"ext_store", "width", sfInt},
+	"height":   {"ext_store", "height", sfInt},
+	"length":   {"ext_store", "pblen", sfDuration},
+	"bitrate":  {"ext_store", "bitrate", sfInt},
+	"size":     {"ext_store", "srcsize", sfInt},
+	"modified": {"ext_store", "srctime", sfUnix}, // file modification time
+	// user properties
+	"rating": {"rate_store", "rating", sfInt},
+}
+
+// smartrenamed is previous names of smart playlist fields.
+var smartrenamed = map[string]string{
+	"time": "modified",
+}
+
+// smartjoin is aliases of joined tables.
+var smartjoin = map[string]string{
+	"id3_store":  "sid3",
+	"exif_store": "sexif",
+	"ext_store":  "sext",
+	"rate_store": "srate",
+}
+
+// smartdate parses date in "2006-01-02" or RFC3339 format.
+func smartdate(s string) (t time.Time, err error) {
+	if t, err = time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// smartlike escapes wildcards of LIKE pattern with '!' character.
+var smartlike = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// Cond returns SQL condition for the rule and its arguments.
+// Strings are compared case-insensitive. Operator "within"
+// selects dates within given number of days before now.
+func (r *SmartRule) Cond(quote func(string) string) (cond string, args []any, err error) {
+	var sf, ok = SmartFields[r.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrSmartField, r.Field)
+	}
+	var col = smartjoin[sf.table] + "." + quote(sf.column)
+	var badval = func() error {
+		return fmt.Errorf("%w %s: %s", ErrSmartValue, r.Field, r.Value)
+	}
+
+	var cmp string
+	switch r.Op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		cmp = r.Op
+		if cmp == "!=" {
+			cmp = "<>"
+		}
+	case "contains", "starts":
+		if sf.kind != sfString {
+			return "", nil, fmt.Errorf("%w %s: %s", ErrSmartOp, r.Field, r.Op)
+		}
+		var pattern = ToLower(smartlike.Replace(r.Value)) + "%"
+		if r.Op == "contains" {
+			pattern = "%" + pattern
+		}
+		return fmt.Sprintf("LOWER(%s) LIKE ? ESCAPE '!'", col), []any{pattern}, nil
+	case "within":
+		var days float64
+		if days, err = strconv.ParseFloat(r.Value, 64); err != nil || days < 0 {
+			return "", nil, badval()
+		}
+		var since = time.Now().Add(-time.Duration(days * float64(24*time.Hour)))
+		switch sf.kind {
+		case sfTime:
+			return col + " >= ?", []any{since}, nil
+		case sfUnix:
+			return col + " >= ?", []any{UnixJS(since).String()}, nil
+		}
+		return "", nil, fmt.Errorf("%w %s: %s", ErrSmartOp, r.Field, r.Op)
+	default:
+		return "", nil, fmt.Errorf("%w %s: %s", ErrSmartOp, r.Field, r.Op)
+	}
+
+	var arg any
+	switch sf.kind {
+	case sfString:
+		return fmt.Sprintf("LOWER(%s) %s ?", col, cmp), []any{ToLower(r.Value)}, nil
+	case sfInt:
+		var v int64
+		if v, err = strconv.ParseInt(r.Value, 10, 64); err != nil {
+			return "", nil, badval()
+		}
+		arg = v
+	case sfFloat:
+		var v float64
+		if v, err = strconv.ParseFloat(r.Value, 64); err != nil {
+			return "", nil, badval()
+		}
+		arg = v
+	case sfDuration:
+		var v float64
+		if v, err = strconv.ParseFloat(r.Value, 64); err != nil {
+			return "", nil, badval()
+		}
+		arg = int64(v * float64(time.Second))
+	case sfTime:
+		var t time.Time
+		if t, err = smartdate(r.Value); err != nil {
+			return "", nil, badval()
+		}
+		arg = t
+	case sfUnix:
+		var t time.Time
+		if t, err = smartdate(r.Value); err != nil {
+			return "", nil, badval()
+		}
+		arg = UnixJS(t).String()
+	}
+	return fmt.Sprintf("%s %s ?", col, cmp), []any{arg}, nil
+}
+
+// Query returns SQL query that selects PUIDs and paths
+// of files matching to smart playlist rules, and its arguments.
+func (sl *SmartList) Query(quote func(string) string) (query string, args []any, err error) {
+	if len(sl.Rules) == 0 {
+		return "", nil, ErrSmartRules
+	}
+	var conds = make([]string, len(sl.Rules))
+	var tables = map[string]bool{}
+	for i, r := range sl.Rules {
+		var cond string
+		var cargs []any
+		if cond, cargs, err = r.Cond(quote); err != nil {
+			return
+		}
+		conds[i] = "(" + cond + ")"
+		args = append(args, cargs...)
+		tables[SmartFields[r.Field].table] = true
+	}
+
+	var order string
+	if sl.Order != "" {
+		var field, desc = strings.CutPrefix(sl.Order, "-")
+		var sf, ok = SmartFields[field]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s", ErrSmartField, field)
+		}
+		tables[sf.table] = true
+		order = " ORDER BY " + smartjoin[sf.table] + "." + quote(sf.column)
+		if desc {
+			order += " DESC"
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT p.puid, p.path FROM path_store p")
+	for _, table := range []string{"id3_store", "exif_store", "ext_store", "rate_store"} {
+		if !tables[table] {
+			continue
+		}
+		var join = " INNER JOIN "
+		if sl.Any {
+			join = " LEFT JOIN "
+		}
+		fmt.Fprintf(&sb, "%s%s %s ON %s.puid = p.puid", join, table, smartjoin[table], smartjoin[table])
+	}
+	sb.WriteString(" WHERE ")
+	if sl.Any {
+		sb.WriteString(strings.Join(conds, " OR "))
+	} else {
+		sb.WriteString(strings.Join(conds, " AND "))
+	}
+	sb.WriteString(order)
+	if sl.Limit > 0 {
+		fmt.Fprintf(&sb, " LIMIT %d", sl.Limit)
+	}
+	query = sb.String()
+	return
+}
+
+// Check verifies smart playlist name and rules.
+func (sl *SmartList) Check() (err error) {
+	if strings.TrimSpace(sl.Name) == "" {
+		return ErrSmartName
+	}
+	_, _, err = sl.Query(func(s string) string { return s })
+	return
+}
+
+// Find returns system paths of files matching to smart playlist rules.
+func (sl *SmartList) Find(session *Session) (list []string, err error) {
+	var query string
+	var args []any
+	if query, args, err = sl.Query(session.Engine().Quote); err != nil {
+		return
+	}
+	var nps []PathStore
+	if err = session.SQL(query, args...).Find(&nps); err != nil {
+		return
+	}
+	list = make([]string, len(nps))
+	for i, ps := range nps {
+		PathCache.Set(ps.Puid, ps.Path)
+		list[i] = ps.Path
+	}
+	return
+}
+
+// SmartPath returns virtual path of smart playlist with given ID.
+func SmartPath(id uint64) string {
+	return fmt.Sprintf("<smart%d>", id)
+}
+
+// SmartPathID returns ID of smart playlist for given virtual path.
+func SmartPathID(syspath string) (id uint64, ok bool) {
+	var s string
+	if s, ok = strings.CutPrefix(syspath, "<smart"); !ok {
+		return
+	}
+	if s, ok = strings.CutSuffix(s, ">"); !ok {
+		return
+	}
+	var err error
+	if id, err = strconv.ParseUint(s, 10, 64); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// UpgradeSmart renames fields at rules and order of smart playlists
+// saved with previous names of fields. It's called on profile loading.
+func (prf *Profile) UpgradeSmart() {
+	prf.mux.Lock()
+	defer prf.mux.Unlock()
+
+	for i := range prf.Smart {
+		var sl = &prf.Smart[i]
+		for j := range sl.Rules {
+			if name, ok := smartrenamed[sl.Rules[j].Field]; ok {
+				sl.Rules[j].Field = name
+			}
+		}
+		var field, desc = strings.CutPrefix(sl.Order, "-")
+		if name, ok := smartrenamed[field]; ok {
+			sl.Order = name
+			if desc {
+				sl.Order = "-" + name
+			}
+		}
+	}
+}
+
+// GetSmart returns smart playlist with given ID.
+func (prf *Profile) GetSmart(id uint64) (sl SmartList, ok bool) {
+	prf.mux.RLock()
+	defer prf.mux.RUnlock()
+
+	for _, sl = range prf.Smart {
+		if sl.ID == id {
+			return sl, true
+		}
+	}
+	return SmartList{}, false
+}
+
+// GetSmartList returns copy of smart playlists list.
+func (prf *Profile) GetSmartList() []SmartList {
+	prf.mux.RLock()
+	defer prf.mux.RUnlock()
+	return append([]SmartList{}, prf.Smart...)
+}
+
+// SetSmart replaces smart playlist with the same ID, or adds new
+// smart playlist if ID is zero. New smart playlist gets next value
+// of profile counter, so IDs of deleted playlists are never reused.
+// It returns ID of smart playlist.
+func (prf *Profile) SetSmart(sl SmartList) (id uint64, ok bool) {
+	prf.mux.Lock()
+	defer prf.mux.Unlock()
+
+	if sl.ID == 0 {
+		// counter can be behind of IDs for profiles
+		// made before it was introduced
+		for _, s := range prf.Smart {
+			prf.SmartID = max(prf.SmartID, s.ID)
+		}
+		prf.SmartID++
+		sl.ID = prf.SmartID
+		prf.Smart = append(prf.Smart, sl)
+		return sl.ID, true
+	}
+	for i, s := range prf.Smart {
+		if s.ID == sl.ID {
+			prf.Smart[i] = sl
+			return sl.ID, true
+		}
+	}
+	return 0, false
+}
+
+// DelSmart deletes smart playlist with given ID.
+func (prf *Profile) DelSmart(id uint64) bool {
+	prf.mux.Lock()
+	defer prf.mux.Unlock()
+
+	for i, sl := range prf.Smart {
+		if sl.ID == id {
+			prf.Smart = append(prf.Smart[:i], prf.Smart[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// The End.
@@ -0,0 +1,223 @@
+package hms
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smartquote is identity quote function for SQL identifiers.
+func smartquote(s string) string {
+	return s
+}
+
+func TestSmartRuleCond(t *testing.T) {
+	var date = time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+	var tests = []struct {
+		name string
+		rule SmartRule
+		cond string
+		args []any // nil if arguments should not be checked
+		err  error
+	}{
+		{"string equal", SmartRule{"artist", "=", "Queen"}, "LOWER(sid3.artist) = ?", []any{"queen"}, nil},
+		{"string not equal", SmartRule{"genre", "!=", "Rock"}, "LOWER(sid3.genre) <> ?", []any{"rock"}, nil},
+		{"contains", SmartRule{"title", "contains", "50% Off_"}, "LOWER(sid3.title) LIKE ? ESCAPE '!'", []any{"%50!% off!_%"}, nil},
+		{"starts", SmartRule{"album", "starts", "Best!"}, "LOWER(sid3.album) LIKE ? ESCAPE '!'", []any{"best!!%"}, nil},
+		{"int", SmartRule{"year", ">=", "1990"}, "sid3.year >= ?", []any{int64(1990)}, nil},
+		{"float", SmartRule{"fnumber", "<", "2.8"}, "sexif.fnumber < ?", []any{2.8}, nil},
+		{"duration", SmartRule{"length", ">", "1.5"}, "sext.pblen > ?", []any{int64(1500 * time.Millisecond)}, nil},
+		{"date", SmartRule{"taken", "<", "2026-10-01"}, "sexif.datetime < ?", []any{date}, nil},
+		{"modified", SmartRule{"modified", ">", "2026-10-01"}, "sext.srctime > ?", []any{UnixJS(date).String()}, nil},
+		{"modified within", SmartRule{"modified", "within", "7"}, "sext.srctime >= ?", nil, nil},
+		{"taken within", SmartRule{"taken", "within", "0.5"}, "sexif.datetime >= ?", nil, nil},
+		{"rating", SmartRule{"rating", "=", "5"}, "srate.rating = ?", []any{int64(5)}, nil},
+		{"unknown field", SmartRule{"time", "=", "1"}, "", nil, ErrSmartField},
+		{"unknown operator", SmartRule{"year", "~", "1"}, "", nil, ErrSmartOp},
+		{"contains on int", SmartRule{"year", "contains", "19"}, "", nil, ErrSmartOp},
+		{"within on int", SmartRule{"year", "within", "7"}, "", nil, ErrSmartOp},
+		{"bad int", SmartRule{"year", "=", "last"}, "", nil, ErrSmartValue},
+		{"bad float", SmartRule{"focal", "=", "wide"}, "", nil, ErrSmartValue},
+		{"bad date", SmartRule{"taken", "<", "yesterday"}, "", nil, ErrSmartValue},
+		{"negative days", SmartRule{"modified", "within", "-1"}, "", nil, ErrSmartValue},
+	}
+	for _, test := range tests {
+		var cond, args, err = test.rule.Cond(smartquote)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if cond != test.cond {
+			t.Errorf("%s: expected condition %q, got %q", test.name, test.cond, cond)
+		}
+		if test.args == nil {
+			if test.err == nil && len(args) != 1 {
+				t.Errorf("%s: expected 1 argument, got %v", test.name, args)
+			}
+			continue
+		}
+		if len(args) != len(test.args) {
+			t.Errorf("%s: expected arguments %v, got %v", test.name, test.args, args)
+			continue
+		}
+		for i := range args {
+			if tm, ok := args[i].(time.Time); ok {
+				if !tm.Equal(test.args[i].(time.Time)) {
+					t.Errorf("%s: expected arguments %v, got %v", test.name, test.args, args)
+				}
+			} else if args[i] != test.args[i] {
+				t.Errorf("%s: expected arguments %v, got %v", test.name, test.args, args)
+			}
+		}
+	}
+}
+
+func TestSmartListQuery(t *testing.T) {
+	var tests = []struct {
+		name  string
+		sl    SmartList
+		query string
+		nargs int
+		err   error
+	}{
+		{"one rule", SmartList{Rules: []SmartRule{{"year", "=", "1990"}}},
+			"SELECT p.puid, p.path FROM path_store p INNER JOIN id3_store sid3 ON sid3.puid = p.puid WHERE (sid3.year = ?)", 1, nil},
+		{"all rules", SmartList{Rules: []SmartRule{{"artist", "=", "a"}, {"length", ">", "60"}}},
+			"SELECT p.puid, p.path FROM path_store p INNER JOIN id3_store sid3 ON sid3.puid = p.puid INNER JOIN ext_store sext ON sext.puid = p.puid WHERE (LOWER(sid3.artist) = ?) AND (sext.pblen > ?)", 2, nil},
+		{"any rule", SmartList{Any: true, Rules: []SmartRule{{"artist", "=", "a"}, {"model", "=", "b"}}},
+			"SELECT p.puid, p.path FROM path_store p LEFT JOIN id3_store sid3 ON sid3.puid = p.puid LEFT JOIN exif_store sexif ON sexif.puid = p.puid WHERE (LOWER(sid3.artist) = ?) OR (LOWER(sexif.model) = ?)", 2, nil},
+		{"order and limit", SmartList{Rules: []SmartRule{{"rating", ">=", "4"}}, Order: "-modified", Limit: 25},
+			"SELECT p.puid, p.path FROM path_store p INNER JOIN ext_store sext ON sext.puid = p.puid INNER JOIN rate_store srate ON srate.puid = p.puid WHERE (srate.rating >= ?) ORDER BY sext.srctime DESC LIMIT 25", 1, nil},
+		{"no rules", SmartList{}, "", 0, ErrSmartRules},
+		{"bad rule", SmartList{Rules: []SmartRule{{"year", "=", "x"}}}, "", 0, ErrSmartValue},
+		{"bad order", SmartList{Rules: []SmartRule{{"year", "=", "1"}}, Order: "time"}, "", 0, ErrSmartField},
+	}
+	for _, test := range tests {
+		var query, args, err = test.sl.Query(smartquote)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if query != test.query {
+			t.Errorf("%s: expected query\n%s\ngot\n%s", test.name, test.query, query)
+		}
+		if len(args) != test.nargs {
+			t.Errorf("%s: expected %d arguments, got %d", test.name, test.nargs, len(args))
+		}
+	}
+}
+
+func TestSmartListFind(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+
+	var now = time.Now()
+	for _, f := range []struct {
+		path   string
+		artist string
+		mtime  time.Time
+	}{
+		{"/music/a.mp3", "Queen", now.Add(-48 * time.Hour)},
+		{"/music/b.mp3", "queen", now.Add(-240 * time.Hour)},
+		{"/music/c.mp3", "Abba", now.Add(-24 * time.Hour)},
+	} {
+		var puid, err = PathStoreCache(session, f.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := engine.InsertOne(&Id3Store{Puid: puid, Prop: Id3Prop{Artist: f.artist}}); err != nil {
+			t.Fatal(err)
+		}
+		var xp ExtProp
+		xp.SrcTime = UnixJS(f.mtime)
+		if _, err := engine.InsertOne(&ExtStore{Puid: puid, Prop: xp}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		name string
+		sl   SmartList
+		list string
+	}{
+		{"artist", SmartList{Rules: []SmartRule{{"artist", "=", "QUEEN"}}, Order: "modified"}, "/music/b.mp3,/music/a.mp3"},
+		{"modified within", SmartList{Rules: []SmartRule{{"modified", "within", "3"}}, Order: "-modified"}, "/music/c.mp3,/music/a.mp3"},
+		{"any", SmartList{Any: true, Rules: []SmartRule{{"artist", "=", "abba"}, {"modified", "within", "5"}}, Order: "modified", Limit: 1}, "/music/a.mp3"},
+	}
+	for _, test := range tests {
+		var list, err = test.sl.Find(session)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if strings.Join(list, ",") != test.list {
+			t.Errorf("%s: expected %s, got %v", test.name, test.list, list)
+		}
+	}
+}
+
+func TestSetSmart(t *testing.T) {
+	var prf Profile
+	var sl = func(id uint64, name string) SmartList {
+		return SmartList{ID: id, Name: name}
+	}
+	var tests = []struct {
+		name string
+		do   func() (uint64, bool)
+		id   uint64
+		ok   bool
+	}{
+		{"add first", func() (uint64, bool) { return prf.SetSmart(sl(0, "a")) }, 1, true},
+		{"add second", func() (uint64, bool) { return prf.SetSmart(sl(0, "b")) }, 2, true},
+		{"replace", func() (uint64, bool) { return prf.SetSmart(sl(1, "a2")) }, 1, true},
+		{"replace absent", func() (uint64, bool) { return prf.SetSmart(sl(7, "x")) }, 0, false},
+		{"add after delete", func() (uint64, bool) {
+			prf.DelSmart(2)
+			return prf.SetSmart(sl(0, "c"))
+		}, 3, true},
+		{"add after delete all", func() (uint64, bool) {
+			prf.DelSmart(1)
+			prf.DelSmart(3)
+			return prf.SetSmart(sl(0, "d"))
+		}, 4, true},
+		{"add to loaded without counter", func() (uint64, bool) {
+			prf.Smart, prf.SmartID = []SmartList{sl(5, "e"), sl(9, "f")}, 0
+			return prf.SetSmart(sl(0, "g"))
+		}, 10, true},
+	}
+	for _, test := range tests {
+		if id, ok := test.do(); id != test.id || ok != test.ok {
+			t.Errorf("%s: expected %d, %v, got %d, %v", test.name, test.id, test.ok, id, ok)
+		}
+	}
+	if got, _ := prf.GetSmart(10); got.Name != "g" {
+		t.Errorf("expected smart playlist 'g', got %v", got)
+	}
+}
+
+func TestUpgradeSmart(t *testing.T) {
+	var tests = []struct {
+		name  string
+		sl    SmartList
+		field string
+		order string
+	}{
+		{"renamed field", SmartList{Rules: []SmartRule{{"time", "within", "7"}}, Order: "time"}, "modified", "modified"},
+		{"descending order", SmartList{Rules: []SmartRule{{"year", "=", "1"}}, Order: "-time"}, "year", "-modified"},
+		{"actual names", SmartList{Rules: []SmartRule{{"modified", ">", "2026-01-01"}}, Order: "-size"}, "modified", "-size"},
+	}
+	for _, test := range tests {
+		var prf = Profile{Smart: []SmartList{test.sl}}
+		prf.UpgradeSmart()
+		var sl = prf.Smart[0]
+		if sl.Rules[0].Field != test.field || sl.Order != test.order {
+			t.Errorf("%s: expected field %s order %s, got %s %s", test.name, test.field, test.order, sl.Rules[0].Field, sl.Order)
+		}
+		if err := sl.Check(); err != nil && !errors.Is(err, ErrSmartName) {
+			t.Errorf("%s: upgraded smart playlist is invalid: %v", test.name, err)
+		}
+	}
+}
+
+// The End.
@@ -11,12 +11,30 @@ var (
 func UpsertBuffer[T any](session *Session, table any, buf *[]Store[T]) (err error) {
 	if session != nil {
 		if _, err = session.Table(table).Insert(buf); err != nil {
+			// some records are present, so insert or update them one by one
 			for _, val := range *buf {
-				if _, err = session.Table(table).ID(val.Puid).Update(&val); err != nil {
+				if affected, _ := session.Table(table).InsertOne(&val); affected > 0 {
+					continue
+				}
+				if _, err = session.Table(table).ID(val.Puid).AllCols().Omit("puid").Update(&val); err != nil {
 					return
 				}
 			}
+			err = nil
+		}
+	}
+	*buf = (*buf)[:0]
+	return
+}
+
+// ImportBuffer links buffered XMP keywords and ratings to files.
+func ImportBuffer(session *Session, buf *[]Store[XmpProp]) (err error) {
+	if session != nil {
+		var errs = make([]error, 0, len(*buf))
+		for _, val := range *buf {
+			errs = append(errs, XmpImport(session, val.Puid, &val.Prop))
 		}
+		err = errors.Join(errs...)
 	}
 	*buf = (*buf)[:0]
 	return
@@ -26,12 +44,16 @@ type StoreBuf struct {
 	extbuf  []Store[ExtProp]
 	exifbuf []Store[ExifProp]
 	id3buf  []Store[Id3Prop]
+	hashbuf []Store[HashProp]
+	xmpbuf  []Store[XmpProp]
 }
 
 func (sb *StoreBuf) Init(limit int) {
 	sb.extbuf = make([]Store[ExtProp], 0, limit)
 	sb.exifbuf = make([]Store[ExifProp], 0, limit)
 	sb.id3buf = make([]Store[Id3Prop], 0, limit)
+	sb.hashbuf = make([]Store[HashProp], 0, limit)
+	sb.xmpbuf = make([]Store[XmpProp], 0, limit)
 }
 
 func (sb *StoreBuf) Push(session *Session, val any) (err error) {
@@ -54,6 +76,16 @@ func (sb *StoreBuf) Push(session *Session, val any) (err error) {
 		if len(sb.id3buf) == cap(sb.id3buf) {
 			err = UpsertBuffer(session, Id3Store{}, &sb.id3buf)
 		}
+	case HashStore:
+		sb.hashbuf = append(sb.hashbuf, Store[HashProp](st))
+		if len(sb.hashbuf) == cap(sb.hashbuf) {
+			err = UpsertBuffer(session, HashStore{}, &sb.hashbuf)
+		}
+	case XmpStore:
+		sb.xmpbuf = append(sb.xmpbuf, Store[XmpProp](st))
+		if len(sb.xmpbuf) == cap(sb.xmpbuf) {
+			err = ImportBuffer(session, &sb.xmpbuf)
+		}
 	default:
 		return ErrBadType
 	}
@@ -64,7 +96,7 @@ func (sb *StoreBuf) Flush(session *Session) (err error) {
 	if sb == nil {
 		return
 	}
-	var errs [3]error
+	var errs [5]error
 	if len(sb.extbuf) > 0 {
 		errs[0] = UpsertBuffer(session, ExtStore{}, &sb.extbuf)
 	}
@@ -74,6 +106,12 @@ func (sb *StoreBuf) Flush(session *Session) (err error) {
 	if len(sb.id3buf) > 0 {
 		errs[2] = UpsertBuffer(session, Id3Store{}, &sb.id3buf)
 	}
+	if len(sb.hashbuf) > 0 {
+		errs[3] = UpsertBuffer(session, HashStore{}, &sb.hashbuf)
+	}
+	if len(sb.xmpbuf) > 0 {
+		errs[4] = ImportBuffer(session, &sb.xmpbuf)
+	}
 	return errors.Join(errs[:]...)
 }
 
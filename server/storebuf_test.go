@@ -0,0 +1,72 @@
+package hms
+
+import (
+	"path/filepath"
+	"testing"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+// testStorage opens new SQLite storage at temporary directory with
+// latest schema, and sets it as XormStorage while test is running.
+func testStorage(t *testing.T) *xorm.Engine {
+	t.Helper()
+	var engine, err = xorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "storage.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetMapper(names.GonicMapper{})
+	if _, err = StorageMigrations.Up(engine, 0); err != nil {
+		engine.Close()
+		t.Fatal(err)
+	}
+	var prev, prevpc = XormStorage, PathCache
+	XormStorage, PathCache = engine, NewBimap[Puid_t, string]()
+	t.Cleanup(func() {
+		XormStorage, PathCache = prev, prevpc
+		engine.Close()
+	})
+	return engine
+}
+
+func TestStoreBufHash(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+
+	var buf StoreBuf
+	buf.Init(3)
+	var tests = []struct {
+		puid  Puid_t
+		dhash int64
+	}{
+		{PUIDcache + 1, 0x0f0f},
+		{PUIDcache + 2, -1},
+		{PUIDcache + 3, 1 << 40},
+		{PUIDcache + 1, 0x7777}, // update of already stored
+		{PUIDcache + 4, 5},      // new one at the same portion
+	}
+	for _, test := range tests {
+		if err := buf.Push(session, HashStore{Puid: test.puid, Prop: HashProp{DHash: test.dhash}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, _ := session.Count(&HashStore{}); n != 3 {
+		t.Fatalf("expected 3 records before flush, got %d", n)
+	}
+	if err := buf.Flush(session); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests[1:] {
+		var hp, ok = HashStoreGet(session, test.puid)
+		if !ok || hp.DHash != test.dhash {
+			t.Errorf("puid %d: expected hash %x, got %x", test.puid, test.dhash, hp.DHash)
+		}
+	}
+	if err := buf.Push(session, PathStore{}); err != ErrBadType {
+		t.Errorf("expected error %v, got %v", ErrBadType, err)
+	}
+}
+
+// The End.
@@ -0,0 +1,1056 @@
+package hms
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Music tags writing errors.
+var (
+	ErrTagsFmt  = errors.New("file format does not supported for tags writing")
+	ErrTagsBig  = errors.New("tags content is too big for file format")
+	ErrID3Bad   = errors.New("ID3v2 tag is malformed")
+	ErrFlacBad  = errors.New("file is not FLAC stream")
+	ErrOggBad   = errors.New("OGG stream is malformed")
+	ErrOggCodec = errors.New("OGG stream codec does not supported")
+	ErrOggMux   = errors.New("multiplexed OGG streams does not supported")
+	ErrCoverFmt = errors.New("cover art should be JPEG or PNG image")
+	ErrTagsNum  = errors.New("year, track and disc numbers should be positive")
+	ErrTagsSum  = errors.New("track or disc number should not exceed the total")
+)
+
+const (
+	tagsvendor = "hms"      // vendor string for new Vorbis comments
+	tagspad    = 1024       // padding size after written tags
+	piccover   = 3          // picture type "Cover (front)" for ID3 APIC and FLAC PICTURE
+	flacmaxblk = 1<<24 - 1  // maximum size of FLAC metadata block
+	id3maxsize = 1<<28 - 1  // maximum size of ID3v2 tag
+	oggnogran  = ^uint64(0) // granule position for pages without finished packets
+	id3v1size  = 128        // size of ID3v1 tag at the end of file
+	id3v2hdr   = 10         // size of ID3v2 header and frame header
+	utf8enc    = 3          // ID3v2.4 text encoding for UTF-8
+	tagsmaxnum = 9999       // maximum value of year, track and disc numbers
+)
+
+// TagsEdit is the set of music tags to write into file.
+// Nil fields are left unchanged, empty values removes the tag.
+// Zero numbers are empty values, other numbers should be positive.
+type TagsEdit struct {
+	Title    *string `json:"title,omitempty" yaml:"title,omitempty" xml:"title,omitempty"`
+	Artist   *string `json:"artist,omitempty" yaml:"artist,omitempty" xml:"artist,omitempty"`
+	Album    *string `json:"album,omitempty" yaml:"album,omitempty" xml:"album,omitempty"`
+	Genre    *string `json:"genre,omitempty" yaml:"genre,omitempty" xml:"genre,omitempty"`
+	Year     *int    `json:"year,omitempty" yaml:"year,omitempty" xml:"year,omitempty"`
+	TrackNum *int    `json:"tracknum,omitempty" yaml:"tracknum,omitempty" xml:"tracknum,omitempty"`
+	TrackSum *int    `json:"tracksum,omitempty" yaml:"tracksum,omitempty" xml:"tracksum,omitempty"`
+	DiscNum  *int    `json:"discnum,omitempty" yaml:"discnum,omitempty" xml:"discnum,omitempty"`
+	DiscSum  *int    `json:"discsum,omitempty" yaml:"discsum,omitempty" xml:"discsum,omitempty"`
+	Cover    []byte  `json:"cover,omitempty" yaml:"cover,omitempty" xml:"cover,omitempty"`       // new front cover, JPEG or PNG content
+	NoCover  bool    `json:"nocover,omitempty" yaml:"nocover,omitempty" xml:"nocover,omitempty"` // remove existing front cover
+}
+
+// IsCover returns true if front cover should be replaced or removed.
+func (te *TagsEdit) IsCover() bool {
+	return te.Cover != nil || te.NoCover
+}
+
+// CoverInfo returns MIME type and dimensions of new cover art.
+func (te *TagsEdit) CoverInfo() (mime string, imc image.Config, err error) {
+	if imc, mime, err = image.DecodeConfig(bytes.NewReader(te.Cover)); err != nil {
+		return
+	}
+	switch mime {
+	case "jpeg", "png":
+		mime = "image/" + mime
+	default:
+		err = ErrCoverFmt
+	}
+	return
+}
+
+// Check verifies that year, track and disc numbers are zero to remove
+// the tag, or are in range from 1 to 9999, and that track and disc numbers
+// do not exceed the totals if both are given.
+func (te *TagsEdit) Check() error {
+	for _, p := range []*int{te.Year, te.TrackNum, te.TrackSum, te.DiscNum, te.DiscSum} {
+		if p != nil && (*p < 0 || *p > tagsmaxnum) {
+			return fmt.Errorf("%w: %d", ErrTagsNum, *p)
+		}
+	}
+	for _, pair := range [][2]*int{{te.TrackNum, te.TrackSum}, {te.DiscNum, te.DiscSum}} {
+		if pair[0] != nil && pair[1] != nil && *pair[1] > 0 && *pair[0] > *pair[1] {
+			return fmt.Errorf("%w: %d/%d", ErrTagsSum, *pair[0], *pair[1])
+		}
+	}
+	return nil
+}
+
+// itoa converts number to string, zero values gives empty string.
+func itoa(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// numpair makes "n/m" string for ID3 track and disc numbers.
+func numpair(n, m int) string {
+	if n == 0 {
+		return ""
+	}
+	if m == 0 {
+		return strconv.Itoa(n)
+	}
+	return strconv.Itoa(n) + "/" + strconv.Itoa(m)
+}
+
+// TagsWrite writes given tags into music file at local file system.
+// File content is written to temporary file at the same directory,
+// that replaces original file on success.
+func TagsWrite(syspath string, te *TagsEdit) (err error) {
+	var ext = GetFileExt(syspath)
+	var fn func(io.ReadSeeker, io.Writer, *TagsEdit) error
+	switch ext {
+	case ".mp3":
+		fn = Id3WriteTags
+	case ".flac":
+		fn = FlacWriteTags
+	case ".ogg", ".opus":
+		fn = OggWriteTags
+	default:
+		return ErrTagsFmt
+	}
+	if err = te.Check(); err != nil {
+		return
+	}
+	if te.Cover != nil {
+		if _, _, err = te.CoverInfo(); err != nil {
+			return
+		}
+	}
+	return FileRewrite(syspath, func(r io.ReadSeeker, w io.Writer) error {
+		return fn(r, w, te)
+	})
+}
+
+// FileRewrite calls given function to write new content of file
+// with given system path to temporary file, and then replaces
+// the original file with it.
+func FileRewrite(syspath string, f func(io.ReadSeeker, io.Writer) error) (err error) {
+	var src, dst *os.File
+	if src, err = os.Open(syspath); err != nil {
+		return
+	}
+	defer src.Close()
+
+	var fi os.FileInfo
+	if fi, err = src.Stat(); err != nil {
+		return
+	}
+
+	if dst, err = os.CreateTemp(path.Dir(syspath), "~hms-*"+path.Ext(syspath)); err != nil {
+		return
+	}
+	var tmppath = dst.Name()
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(tmppath)
+		}
+	}()
+
+	var w = bufio.NewWriter(dst)
+	if err = f(src, w); err != nil {
+		return
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	if err = dst.Close(); err != nil {
+		return
+	}
+	src.Close()
+	os.Chmod(tmppath, fi.Mode())
+	err = os.Rename(tmppath, syspath)
+	return
+}
+
+////////////////////
+// Vorbis comment //
+////////////////////
+
+// VorbisComment is Vorbis comment header content,
+// used by FLAC and OGG containers.
+type VorbisComment struct {
+	Vendor string
+	Fields []string // each field is "NAME=value" string
+}
+
+// Decode reads Vorbis comment from given data,
+// and returns number of read bytes.
+func (vc *VorbisComment) Decode(b []byte) (n int, err error) {
+	var str = func() (s string, ok bool) {
+		if len(b)-n < 4 {
+			return
+		}
+		var l = int(binary.LittleEndian.Uint32(b[n:]))
+		n += 4
+		if l < 0 || len(b)-n < l {
+			return
+		}
+		s = string(b[n : n+l])
+		n += l
+		return s, true
+	}
+	var ok bool
+	if vc.Vendor, ok = str(); !ok {
+		return n, io.ErrUnexpectedEOF
+	}
+	if len(b)-n < 4 {
+		return n, io.ErrUnexpectedEOF
+	}
+	var num = int(binary.LittleEndian.Uint32(b[n:]))
+	n += 4
+	vc.Fields = make([]string, 0, min(num, 256))
+	for range num {
+		var s string
+		if s, ok = str(); !ok {
+			return n, io.ErrUnexpectedEOF
+		}
+		vc.Fields = append(vc.Fields, s)
+	}
+	return
+}
+
+// Encode returns Vorbis comment binary representation.
+func (vc *VorbisComment) Encode() []byte {
+	var size = 8 + len(vc.Vendor)
+	for _, s := range vc.Fields {
+		size += 4 + len(s)
+	}
+	var b = make([]byte, 0, size)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(vc.Vendor)))
+	b = append(b, vc.Vendor...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(vc.Fields)))
+	for _, s := range vc.Fields {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+		b = append(b, s...)
+	}
+	return b
+}
+
+// Filter removes all fields for which given function returns false.
+func (vc *VorbisComment) Filter(f func(name, val string) bool) {
+	var fields = vc.Fields[:0]
+	for _, s := range vc.Fields {
+		var name, val, _ = strings.Cut(s, "=")
+		if f(strings.ToUpper(name), val) {
+			fields = append(fields, s)
+		}
+	}
+	vc.Fields = fields
+}
+
+// Set replaces all fields with given name by given value.
+// Empty value removes the field.
+func (vc *VorbisComment) Set(name, val string) {
+	vc.Filter(func(n, _ string) bool {
+		return n != name
+	})
+	if val != "" {
+		vc.Fields = append(vc.Fields, name+"="+val)
+	}
+}
+
+// Apply writes edited tags into Vorbis comment. Cover art is written
+// as METADATA_BLOCK_PICTURE field if picture is given.
+func (vc *VorbisComment) Apply(te *TagsEdit, pic []byte) {
+	var setstr = func(name string, p *string) {
+		if p != nil {
+			vc.Set(name, *p)
+		}
+	}
+	var setint = func(name string, p *int) {
+		if p != nil {
+			vc.Set(name, itoa(*p))
+		}
+	}
+	setstr("TITLE", te.Title)
+	setstr("ARTIST", te.Artist)
+	setstr("ALBUM", te.Album)
+	setstr("GENRE", te.Genre)
+	if te.Year != nil {
+		vc.Set("YEAR", "")
+	}
+	setint("DATE", te.Year)
+	setint("TRACKNUMBER", te.TrackNum)
+	setint("TRACKTOTAL", te.TrackSum)
+	setint("DISCNUMBER", te.DiscNum)
+	setint("DISCTOTAL", te.DiscSum)
+	if te.IsCover() {
+		vc.Filter(func(name, val string) bool {
+			if name == "COVERART" || name == "COVERARTMIME" {
+				return false
+			}
+			if name != "METADATA_BLOCK_PICTURE" {
+				return true
+			}
+			var b, err = base64.StdEncoding.DecodeString(val)
+			return err == nil && len(b) >= 4 && binary.BigEndian.Uint32(b) != piccover
+		})
+		if pic != nil {
+			vc.Fields = append(vc.Fields, "METADATA_BLOCK_PICTURE="+base64.StdEncoding.EncodeToString(pic))
+		}
+	}
+}
+
+// FlacPicture returns FLAC PICTURE metadata block content
+// with front cover from edited tags.
+func FlacPicture(te *TagsEdit) (b []byte, err error) {
+	var mime string
+	var imc image.Config
+	if mime, imc, err = te.CoverInfo(); err != nil {
+		return
+	}
+	b = make([]byte, 0, 32+len(mime)+len(te.Cover))
+	b = binary.BigEndian.AppendUint32(b, piccover)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(mime)))
+	b = append(b, mime...)
+	b = binary.BigEndian.AppendUint32(b, 0) // no description
+	b = binary.BigEndian.AppendUint32(b, uint32(imc.Width))
+	b = binary.BigEndian.AppendUint32(b, uint32(imc.Height))
+	b = binary.BigEndian.AppendUint32(b, 24) // color depth
+	b = binary.BigEndian.AppendUint32(b, 0)  // not indexed colors
+	b = binary.BigEndian.AppendUint32(b, uint32(len(te.Cover)))
+	b = append(b, te.Cover...)
+	return
+}
+
+//////////
+// FLAC //
+//////////
+
+// FLAC metadata block types.
+const (
+	flacStreamInfo    = 0
+	flacPadding       = 1
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+type flacBlock struct {
+	Type byte
+	Data []byte
+}
+
+// FlacWriteTags copies FLAC stream from reader to writer with
+// replaced VORBIS_COMMENT and front cover PICTURE metadata blocks.
+func FlacWriteTags(r io.ReadSeeker, w io.Writer, te *TagsEdit) (err error) {
+	var sig [4]byte
+	if _, err = io.ReadFull(r, sig[:]); err != nil {
+		return
+	}
+	if string(sig[:]) != "fLaC" {
+		return ErrFlacBad
+	}
+
+	// read all metadata blocks
+	var blocks []flacBlock
+	for {
+		var hdr [4]byte
+		if _, err = io.ReadFull(r, hdr[:]); err != nil {
+			return
+		}
+		var size = int(hdr[1])<<16 | int(hdr[2])<<8 | int(hdr[3])
+		var blk = flacBlock{
+			Type: hdr[0] & 0x7f,
+			Data: make([]byte, size),
+		}
+		if _, err = io.ReadFull(r, blk.Data); err != nil {
+			return
+		}
+		blocks = append(blocks, blk)
+		if hdr[0]&0x80 != 0 {
+			break
+		}
+	}
+	if len(blocks) == 0 || blocks[0].Type != flacStreamInfo {
+		return ErrFlacBad
+	}
+
+	var pic []byte
+	if te.Cover != nil {
+		if pic, err = FlacPicture(te); err != nil {
+			return
+		}
+	}
+
+	// modify blocks
+	var vc = VorbisComment{Vendor: tagsvendor}
+	var list = blocks[:0]
+	for _, blk := range blocks {
+		switch blk.Type {
+		case flacPadding:
+			continue
+		case flacVorbisComment:
+			if _, err = vc.Decode(blk.Data); err != nil {
+				return
+			}
+			continue
+		case flacPicture:
+			if te.IsCover() && len(blk.Data) >= 4 && binary.BigEndian.Uint32(blk.Data) == piccover {
+				continue
+			}
+		}
+		list = append(list, blk)
+	}
+	vc.Apply(te, nil)
+	list = append(list, flacBlock{Type: flacVorbisComment, Data: vc.Encode()})
+	if pic != nil {
+		list = append(list, flacBlock{Type: flacPicture, Data: pic})
+	}
+	list = append(list, flacBlock{Type: flacPadding, Data: make([]byte, tagspad)})
+
+	// write metadata
+	if _, err = w.Write(sig[:]); err != nil {
+		return
+	}
+	for i, blk := range list {
+		if len(blk.Data) > flacmaxblk {
+			return ErrTagsBig
+		}
+		var hdr = [4]byte{blk.Type, byte(len(blk.Data) >> 16), byte(len(blk.Data) >> 8), byte(len(blk.Data))}
+		if i == len(list)-1 {
+			hdr[0] |= 0x80
+		}
+		if _, err = w.Write(hdr[:]); err != nil {
+			return
+		}
+		if _, err = w.Write(blk.Data); err != nil {
+			return
+		}
+	}
+
+	// copy audio frames
+	_, err = io.Copy(w, r)
+	return
+}
+
+/////////
+// OGG //
+/////////
+
+var oggcrc = func() (t [256]uint32) {
+	for i := range t {
+		var r = uint32(i) << 24
+		for range 8 {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return
+}()
+
+// OGG page header flags.
+const (
+	oggCont = 0x01 // continued packet
+	oggBOS  = 0x02 // beginning of stream
+	oggEOS  = 0x04 // end of stream
+)
+
+type oggPage struct {
+	Flags   byte
+	Granule uint64
+	Serial  uint32
+	SeqNo   uint32
+	Segs    []byte // lacing values
+	Data    []byte
+}
+
+// Read reads OGG page from given reader.
+func (pg *oggPage) Read(r io.Reader) (err error) {
+	var hdr [27]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	if string(hdr[:4]) != "OggS" || hdr[4] != 0 {
+		return ErrOggBad
+	}
+	pg.Flags = hdr[5]
+	pg.Granule = binary.LittleEndian.Uint64(hdr[6:])
+	pg.Serial = binary.LittleEndian.Uint32(hdr[14:])
+	pg.SeqNo = binary.LittleEndian.Uint32(hdr[18:])
+	pg.Segs = make([]byte, hdr[26])
+	if _, err = io.ReadFull(r, pg.Segs); err != nil {
+		return
+	}
+	var size int
+	for _, l := range pg.Segs {
+		size += int(l)
+	}
+	pg.Data = make([]byte, size)
+	_, err = io.ReadFull(r, pg.Data)
+	return
+}
+
+// Encode returns page binary representation with calculated checksum.
+func (pg *oggPage) Encode() []byte {
+	var b = make([]byte, 27, 27+len(pg.Segs)+len(pg.Data))
+	copy(b, "OggS")
+	b[5] = pg.Flags
+	binary.LittleEndian.PutUint64(b[6:], pg.Granule)
+	binary.LittleEndian.PutUint32(b[14:], pg.Serial)
+	binary.LittleEndian.PutUint32(b[18:], pg.SeqNo)
+	b[26] = byte(len(pg.Segs))
+	b = append(b, pg.Segs...)
+	b = append(b, pg.Data...)
+	var crc uint32
+	for _, c := range b {
+		crc = crc<<8 ^ oggcrc[byte(crc>>24)^c]
+	}
+	binary.LittleEndian.PutUint32(b[22:], crc)
+	return b
+}
+
+// oggPaginate splits packets to pages. Each packet starts new page
+// in the way as header packets are placed.
+func oggPaginate(serial, seqno uint32, packets [][]byte) (pages []oggPage) {
+	var pg oggPage
+	var done bool
+	var flush = func(cont bool) {
+		pg.Serial, pg.SeqNo = serial, seqno
+		if done {
+			pg.Granule = 0
+		} else {
+			pg.Granule = oggnogran
+		}
+		pages = append(pages, pg)
+		seqno++
+		pg, done = oggPage{}, false
+		if cont {
+			pg.Flags = oggCont
+		}
+	}
+	for _, p := range packets {
+		var n = len(p)/255 + 1
+		for i := range n {
+			if len(pg.Segs) == 255 {
+				flush(i > 0)
+			}
+			var l = min(len(p)-i*255, 255)
+			pg.Segs = append(pg.Segs, byte(l))
+			pg.Data = append(pg.Data, p[i*255:i*255+l]...)
+		}
+		done = true
+	}
+	if len(pg.Segs) > 0 {
+		flush(false)
+	}
+	return
+}
+
+// OggWriteTags copies OGG Vorbis or Opus stream from reader to writer
+// with replaced comment header packet. Pages of stream are renumbered
+// if header pages number was changed.
+func OggWriteTags(r io.ReadSeeker, w io.Writer, te *TagsEdit) (err error) {
+	var br = bufio.NewReader(r)
+
+	// read identification header
+	var first oggPage
+	if err = first.Read(br); err != nil {
+		return
+	}
+	if first.Flags&oggBOS == 0 || len(first.Segs) == 0 || first.Segs[len(first.Segs)-1] == 255 {
+		return ErrOggBad
+	}
+	var prefix []byte
+	var npack int // number of header packets after identification header
+	switch {
+	case bytes.HasPrefix(first.Data, []byte("\x01vorbis")):
+		prefix, npack = []byte("\x03vorbis"), 2
+	case bytes.HasPrefix(first.Data, []byte("OpusHead")):
+		prefix, npack = []byte("OpusTags"), 1
+	default:
+		return ErrOggCodec
+	}
+
+	// read header packets
+	var packets [][]byte
+	var cur []byte
+	var oldnum uint32 = 1 // number of header pages
+	for len(packets) < npack {
+		var pg oggPage
+		if err = pg.Read(br); err != nil {
+			return
+		}
+		if pg.Serial != first.Serial {
+			return ErrOggMux
+		}
+		oldnum++
+		var off int
+		for _, l := range pg.Segs {
+			if len(packets) == npack {
+				return ErrOggBad // audio data at header page
+			}
+			cur = append(cur, pg.Data[off:off+int(l)]...)
+			off += int(l)
+			if l < 255 {
+				packets = append(packets, cur)
+				cur = nil
+			}
+		}
+	}
+	if !bytes.HasPrefix(packets[0], prefix) {
+		return ErrOggBad
+	}
+
+	// modify comment header
+	var pic []byte
+	if te.Cover != nil {
+		if pic, err = FlacPicture(te); err != nil {
+			return
+		}
+	}
+	var vc VorbisComment
+	var n int
+	if n, err = vc.Decode(packets[0][len(prefix):]); err != nil {
+		return
+	}
+	var tail = packets[0][len(prefix)+n:] // framing bit for Vorbis, or extra data for Opus
+	if npack == 2 {
+		tail = []byte{1}
+	}
+	vc.Apply(te, pic)
+	var comment = append(append(bytes.Clone(prefix), vc.Encode()...), tail...)
+	packets[0] = comment
+
+	// write header pages
+	if _, err = w.Write(first.Encode()); err != nil {
+		return
+	}
+	var pages = oggPaginate(first.Serial, 1, packets)
+	for _, pg := range pages {
+		if _, err = w.Write(pg.Encode()); err != nil {
+			return
+		}
+	}
+
+	// copy audio pages with renumbering
+	var delta = uint32(len(pages)+1) - oldnum
+	for {
+		var pg oggPage
+		if err = pg.Read(br); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return
+		}
+		if pg.Serial == first.Serial {
+			pg.SeqNo += delta
+		}
+		if _, err = w.Write(pg.Encode()); err != nil {
+			return
+		}
+	}
+}
+
+///////////
+// ID3v2 //
+///////////
+
+type id3Frame struct {
+	ID    string
+	Flags [2]byte
+	Data  []byte
+}
+
+// syncsafe decodes 28-bit integer from 4 bytes with 7 significant bits in each.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// appendSyncsafe appends 28-bit integer in syncsafe format.
+func appendSyncsafe(b []byte, n int) []byte {
+	return append(b, byte(n>>21)&0x7f, byte(n>>14)&0x7f, byte(n>>7)&0x7f, byte(n)&0x7f)
+}
+
+// id3Resync removes unsynchronisation scheme bytes.
+func id3Resync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xff, 0x00}, []byte{0xff})
+}
+
+// ID3v2.2 frames identifiers conversion to ID3v2.4.
+var id3v22map = map[string]string{
+	"TT1": "TIT1", "TT2": "TIT2", "TT3": "TIT3",
+	"TP1": "TPE1", "TP2": "TPE2", "TP3": "TPE3", "TP4": "TPE4",
+	"TAL": "TALB", "TRK": "TRCK", "TPA": "TPOS", "TYE": "TDRC",
+	"TCO": "TCON", "TCM": "TCOM", "TXT": "TEXT", "TLA": "TLAN",
+	"TBP": "TBPM", "TCR": "TCOP", "TEN": "TENC", "TPB": "TPUB",
+	"TOA": "TOPE", "TOT": "TOAL", "TOL": "TOLY", "TOR": "TDOR",
+	"TSS": "TSSE", "TRC": "TSRC", "TXX": "TXXX", "WXX": "WXXX",
+	"COM": "COMM", "ULT": "USLT", "PIC": "APIC", "UFI": "UFID",
+	"CNT": "PCNT", "POP": "POPM",
+}
+
+// ID3v2.3 frames identifiers conversion to ID3v2.4.
+// Frames with empty identifier are dropped.
+var id3v23map = map[string]string{
+	"TYER": "TDRC", "TORY": "TDOR",
+	"TDAT": "", "TIME": "", "TRDA": "", "TSIZ": "",
+	"IPLS": "", "RVAD": "", "EQUA": "",
+}
+
+// id3ReadFrames parses frames of ID3v2 tag body
+// and converts them to ID3v2.4 frames.
+func id3ReadFrames(ver, flags byte, body []byte) (frames []id3Frame, err error) {
+	if ver < 4 && flags&0x80 != 0 { // whole tag unsynchronisation
+		body = id3Resync(body)
+	}
+	if ver >= 3 && flags&0x40 != 0 { // skip extended header
+		if len(body) < 4 {
+			return nil, ErrID3Bad
+		}
+		var size int
+		if ver == 3 {
+			size = int(binary.BigEndian.Uint32(body)) + 4
+		} else {
+			size = syncsafe(body)
+		}
+		if size > len(body) {
+			return nil, ErrID3Bad
+		}
+		body = body[size:]
+	}
+
+	var hdrlen = id3v2hdr
+	if ver == 2 {
+		hdrlen = 6
+	}
+	for len(body) >= hdrlen && body[0] != 0 {
+		var fr id3Frame
+		var size int
+		switch ver {
+		case 2:
+			fr.ID = string(body[:3])
+			size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			fr.ID = string(body[:4])
+			size = int(binary.BigEndian.Uint32(body[4:]))
+		default:
+			fr.ID = string(body[:4])
+			size = syncsafe(body[4:])
+			fr.Flags = [2]byte{body[8], body[9]}
+		}
+		if size > len(body)-hdrlen {
+			return nil, ErrID3Bad
+		}
+		fr.Data = body[hdrlen : hdrlen+size]
+		switch ver {
+		case 2:
+			var id, ok = id3v22map[fr.ID]
+			if !ok {
+				body = body[hdrlen+size:]
+				continue
+			}
+			if fr.ID == "PIC" && len(fr.Data) >= 4 { // image format to MIME type
+				var mime = "image/" + strings.ToLower(string(fr.Data[1:4]))
+				if mime == "image/jpg" {
+					mime = "image/jpeg"
+				}
+				var data = append([]byte{fr.Data[0]}, mime...)
+				data = append(data, 0)
+				fr.Data = append(data, fr.Data[4:]...)
+			}
+			fr.ID = id
+		case 3:
+			var fl0, fl1 = body[8], body[9]
+			if fl1&0xc0 != 0 { // compressed or encrypted
+				body = body[hdrlen+size:]
+				continue
+			}
+			if id, ok := id3v23map[fr.ID]; ok {
+				if id == "" {
+					body = body[hdrlen+size:]
+					continue
+				}
+				fr.ID = id
+			}
+			fr.Flags = [2]byte{fl0 >> 1 & 0x70, fl1 >> 1 & 0x10 << 2}
+		}
+		frames = append(frames, fr)
+		body = body[hdrlen+size:]
+	}
+	return
+}
+
+// id3Text decodes content of ID3v2 text frame.
+func id3Text(data []byte) string {
+	if len(data) < 1 {
+		return ""
+	}
+	var enc, b = data[0], data[1:]
+	switch enc {
+	case 1, 2: // UTF-16 with BOM, UTF-16BE
+		var be = enc == 2
+		if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+			be, b = true, b[2:]
+		} else if len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe {
+			be, b = false, b[2:]
+		}
+		var u = make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			var c uint16
+			if be {
+				c = binary.BigEndian.Uint16(b[i:])
+			} else {
+				c = binary.LittleEndian.Uint16(b[i:])
+			}
+			if c == 0 {
+				break
+			}
+			u = append(u, c)
+		}
+		return string(utf16.Decode(u))
+	case 3: // UTF-8
+		var s, _, _ = bytes.Cut(b, []byte{0})
+		return string(s)
+	default: // ISO-8859-1
+		var s, _, _ = bytes.Cut(b, []byte{0})
+		var r = make([]rune, len(s))
+		for i, c := range s {
+			r[i] = rune(c)
+		}
+		return string(r)
+	}
+}
+
+// id3PicType returns picture type of APIC frame.
+func id3PicType(data []byte) int {
+	if len(data) < 2 {
+		return -1
+	}
+	var i = bytes.IndexByte(data[1:], 0)
+	if i < 0 || i+2 >= len(data) {
+		return -1
+	}
+	return int(data[i+2])
+}
+
+// id3Pair parses "n/m" string of ID3 track and disc numbers.
+func id3Pair(s string) (n, m int) {
+	var ns, ms, _ = strings.Cut(s, "/")
+	n, _ = strconv.Atoi(strings.TrimSpace(ns))
+	m, _ = strconv.Atoi(strings.TrimSpace(ms))
+	return
+}
+
+// Id3WriteTags copies MP3 file from reader to writer with new ID3v2.4 tag.
+// Frames of existing ID3v2 tag which are not edited are preserved.
+// ID3v1 tag at the end of file is updated if it present.
+func Id3WriteTags(r io.ReadSeeker, w io.Writer, te *TagsEdit) (err error) {
+	var frames []id3Frame
+	var start int64 // audio data start
+
+	var hdr [id3v2hdr]byte
+	var n int
+	if n, err = io.ReadFull(r, hdr[:]); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return
+	}
+	err = nil
+	if n == id3v2hdr && string(hdr[:3]) == "ID3" {
+		var ver, flags = hdr[3], hdr[5]
+		if ver < 2 || ver > 4 {
+			return ErrID3Bad
+		}
+		var body = make([]byte, syncsafe(hdr[6:]))
+		if _, err = io.ReadFull(r, body); err != nil {
+			return
+		}
+		start = id3v2hdr + int64(len(body))
+		if ver == 4 && flags&0x10 != 0 { // footer present
+			start += id3v2hdr
+		}
+		if frames, err = id3ReadFrames(ver, flags, body); err != nil {
+			return
+		}
+	}
+
+	// get existing numbers pairs
+	var trck, tpos [2]int
+	for _, fr := range frames {
+		switch fr.ID {
+		case "TRCK":
+			trck[0], trck[1] = id3Pair(id3Text(fr.Data))
+		case "TPOS":
+			tpos[0], tpos[1] = id3Pair(id3Text(fr.Data))
+		}
+	}
+
+	var edit = map[string]*string{}
+	var setstr = func(id string, p *string) {
+		if p != nil {
+			edit[id] = p
+		}
+	}
+	var setpair = func(id string, pair [2]int, n, m *int) {
+		if n != nil || m != nil {
+			if n != nil {
+				pair[0] = *n
+			}
+			if m != nil {
+				pair[1] = *m
+			}
+			var s = numpair(pair[0], pair[1])
+			edit[id] = &s
+		}
+	}
+	setstr("TIT2", te.Title)
+	setstr("TPE1", te.Artist)
+	setstr("TALB", te.Album)
+	setstr("TCON", te.Genre)
+	if te.Year != nil {
+		var s = itoa(*te.Year)
+		edit["TDRC"] = &s
+	}
+	setpair("TRCK", trck, te.TrackNum, te.TrackSum)
+	setpair("TPOS", tpos, te.DiscNum, te.DiscSum)
+
+	// remove edited frames
+	var list = frames[:0]
+	for _, fr := range frames {
+		if _, ok := edit[fr.ID]; ok {
+			continue
+		}
+		if fr.ID == "APIC" && te.IsCover() && id3PicType(fr.Data) == piccover {
+			continue
+		}
+		list = append(list, fr)
+	}
+	// add new frames
+	for _, id := range []string{"TIT2", "TPE1", "TALB", "TCON", "TDRC", "TRCK", "TPOS"} {
+		if p, ok := edit[id]; ok && *p != "" {
+			list = append(list, id3Frame{
+				ID:   id,
+				Data: append([]byte{utf8enc}, *p...),
+			})
+		}
+	}
+	if te.Cover != nil {
+		var mime string
+		if mime, _, err = te.CoverInfo(); err != nil {
+			return
+		}
+		var data = make([]byte, 0, len(mime)+4+len(te.Cover))
+		data = append(data, utf8enc)
+		data = append(data, mime...)
+		data = append(data, 0, piccover, 0) // no description
+		data = append(data, te.Cover...)
+		list = append(list, id3Frame{
+			ID:   "APIC",
+			Data: data,
+		})
+	}
+
+	// write ID3v2.4 tag
+	var size = tagspad
+	for _, fr := range list {
+		size += id3v2hdr + len(fr.Data)
+	}
+	if size > id3maxsize {
+		return ErrTagsBig
+	}
+	var tag = make([]byte, 0, id3v2hdr+size)
+	tag = append(tag, "ID3\x04\x00\x00"...)
+	tag = appendSyncsafe(tag, size)
+	for _, fr := range list {
+		tag = append(tag, fr.ID...)
+		tag = appendSyncsafe(tag, len(fr.Data))
+		tag = append(tag, fr.Flags[:]...)
+		tag = append(tag, fr.Data...)
+	}
+	tag = append(tag, make([]byte, tagspad)...)
+	if _, err = w.Write(tag); err != nil {
+		return
+	}
+
+	// check up ID3v1 tag
+	var end int64
+	if end, err = r.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+	var v1 []byte
+	if end-start >= id3v1size {
+		v1 = make([]byte, id3v1size)
+		if _, err = r.Seek(end-id3v1size, io.SeekStart); err != nil {
+			return
+		}
+		if _, err = io.ReadFull(r, v1); err != nil {
+			return
+		}
+		if string(v1[:3]) == "TAG" {
+			end -= id3v1size
+		} else {
+			v1 = nil
+		}
+	}
+
+	// copy audio frames
+	if _, err = r.Seek(start, io.SeekStart); err != nil {
+		return
+	}
+	if _, err = io.CopyN(w, r, end-start); err != nil {
+		return
+	}
+
+	// write updated ID3v1 tag
+	if v1 != nil {
+		var put = func(b []byte, p *string) {
+			if p == nil {
+				return
+			}
+			clear(b)
+			var i int
+			for _, c := range *p {
+				if i == len(b) {
+					break
+				}
+				if c > 0xff {
+					c = '?'
+				}
+				b[i] = byte(c)
+				i++
+			}
+		}
+		put(v1[3:33], te.Title)
+		put(v1[33:63], te.Artist)
+		put(v1[63:93], te.Album)
+		if te.Year != nil {
+			var s = itoa(*te.Year)
+			put(v1[93:97], &s)
+		}
+		if te.TrackNum != nil && v1[125] == 0 && *te.TrackNum < 256 {
+			v1[126] = byte(*te.TrackNum)
+		}
+		if _, err = w.Write(v1); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// The End.
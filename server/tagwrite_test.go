@@ -0,0 +1,146 @@
+package hms
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+func intp(n int) *int {
+	return &n
+}
+
+func strp(s string) *string {
+	return &s
+}
+
+func TestTagsEditCheck(t *testing.T) {
+	var tests = []struct {
+		name string
+		te   TagsEdit
+		err  error
+	}{
+		{"empty", TagsEdit{}, nil},
+		{"valid", TagsEdit{Year: intp(1999), TrackNum: intp(3), TrackSum: intp(12), DiscNum: intp(1), DiscSum: intp(2)}, nil},
+		{"remove", TagsEdit{Year: intp(0), TrackNum: intp(0), TrackSum: intp(0)}, nil},
+		{"no total", TagsEdit{TrackNum: intp(7)}, nil},
+		{"zero total", TagsEdit{TrackNum: intp(7), TrackSum: intp(0)}, nil},
+		{"track equal total", TagsEdit{TrackNum: intp(12), TrackSum: intp(12)}, nil},
+		{"negative year", TagsEdit{Year: intp(-1)}, ErrTagsNum},
+		{"big year", TagsEdit{Year: intp(10000)}, ErrTagsNum},
+		{"negative track", TagsEdit{TrackNum: intp(-3)}, ErrTagsNum},
+		{"negative total", TagsEdit{TrackSum: intp(-3)}, ErrTagsNum},
+		{"negative disc", TagsEdit{DiscNum: intp(-1)}, ErrTagsNum},
+		{"track over total", TagsEdit{TrackNum: intp(13), TrackSum: intp(12)}, ErrTagsSum},
+		{"disc over total", TagsEdit{DiscNum: intp(3), DiscSum: intp(2)}, ErrTagsSum},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var err = test.te.Check()
+			if test.err == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestTagsWriteRoundTrip(t *testing.T) {
+	var te = TagsEdit{
+		Title:    strp("Title ☼"),
+		Artist:   strp("Artist"),
+		Album:    strp("Album"),
+		Genre:    strp("Ambient"),
+		Year:     intp(2001),
+		TrackNum: intp(4),
+		TrackSum: intp(9),
+		DiscNum:  intp(1),
+		DiscSum:  intp(2),
+	}
+	var tests = []struct {
+		name string
+		fn   func(io.ReadSeeker, io.Writer, *TagsEdit) error
+	}{
+		{"sample.mp3", Id3WriteTags},
+		{"sample.flac", FlacWriteTags},
+		{"sample.ogg", OggWriteTags},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var src, err = os.ReadFile(filepath.Join("testdata", test.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err = test.fn(bytes.NewReader(src), &buf, &te); err != nil {
+				t.Fatal(err)
+			}
+			var m tag.Metadata
+			if m, err = tag.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			if m.Title() != *te.Title || m.Artist() != *te.Artist ||
+				m.Album() != *te.Album || m.Genre() != *te.Genre {
+				t.Errorf("text tags mismatch: %q, %q, %q, %q", m.Title(), m.Artist(), m.Album(), m.Genre())
+			}
+			if m.Year() != *te.Year {
+				t.Errorf("year mismatch: %d", m.Year())
+			}
+			if n, sum := m.Track(); n != *te.TrackNum || sum != *te.TrackSum {
+				t.Errorf("track mismatch: %d/%d", n, sum)
+			}
+			if n, sum := m.Disc(); n != *te.DiscNum || sum != *te.DiscSum {
+				t.Errorf("disc mismatch: %d/%d", n, sum)
+			}
+
+			// second pass removes the tags
+			var te2 = TagsEdit{Title: strp(""), TrackNum: intp(0)}
+			var buf2 bytes.Buffer
+			if err = test.fn(bytes.NewReader(buf.Bytes()), &buf2, &te2); err != nil {
+				t.Fatal(err)
+			}
+			if m, err = tag.ReadFrom(bytes.NewReader(buf2.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			if m.Title() != "" {
+				t.Errorf("title is not removed: %q", m.Title())
+			}
+			if n, _ := m.Track(); n != 0 {
+				t.Errorf("track is not removed: %d", n)
+			}
+			if m.Artist() != *te.Artist {
+				t.Errorf("artist is not kept: %q", m.Artist())
+			}
+		})
+	}
+}
+
+func TestTagsWriteReject(t *testing.T) {
+	var fpath = filepath.Join(t.TempDir(), "sample.mp3")
+	var src, err = os.ReadFile(filepath.Join("testdata", "sample.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(fpath, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = TagsWrite(fpath, &TagsEdit{TrackNum: intp(-1)}); !errors.Is(err, ErrTagsNum) {
+		t.Fatalf("expected error %v, got %v", ErrTagsNum, err)
+	}
+	var dst []byte
+	if dst, err = os.ReadFile(fpath); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, dst) {
+		t.Fatal("file is modified on rejected tags")
+	}
+}
+
+// The End.
@@ -2,70 +2,116 @@ package hms
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 
+	cfg "github.com/schwarzlichtbezirk/hms/config"
 	"github.com/schwarzlichtbezirk/wpk"
 )
 
-// Tiles multipliers:
+// Tiles specifications are given by configuration at
+// "images-prop.tile-specs" list. Frontend layouts use tiles
+// of 24x18 cell with multipliers:
 //  576px: 2,  4,  6,  8, 10, 12
 //  768px: 3,  6,  9, 12, 15, 18
 // 1280px: 4,  8, 12, 16, 20, 24
 // 1920px: 6, 12, 18, 24, 30, 36
 
-// Tiles horizontal resolutions (tm x 24):
-//  576px:  48,  96, 144, 192, 240, 288
-//  768px:  72, 144, 216, 288, 360, 432
-// 1280px:  96, 192, 288, 384, 480, 576
-// 1920px: 144, 288, 432, 576, 720, 864
-
 // https://go.dev/play/p/U5i5M-TfIkM
 
+// TileMime is image MIME type of tile with given dimensions.
+type TileMime struct {
+	Dim  string `json:"dim" yaml:"dim" xml:"dim,attr"`
+	Mime Mime_t `json:"mime" yaml:"mime" xml:"mime,attr"`
+}
+
 // TileProp is thumbnails properties.
 type TileProp struct {
-	MTmbVal Mime_t `json:"mtmb" yaml:"mtmb" xml:"mtmb"`
-	MT02Val Mime_t `json:"mt02,omitempty" yaml:"mt02,omitempty" xml:"mt02,omitempty"`
-	MT03Val Mime_t `json:"mt03,omitempty" yaml:"mt03,omitempty" xml:"mt03,omitempty"`
-	MT04Val Mime_t `json:"mt04,omitempty" yaml:"mt04,omitempty" xml:"mt04,omitempty"`
-	MT06Val Mime_t `json:"mt06,omitempty" yaml:"mt06,omitempty" xml:"mt06,omitempty"`
-	MT08Val Mime_t `json:"mt08,omitempty" yaml:"mt08,omitempty" xml:"mt08,omitempty"`
-	MT09Val Mime_t `json:"mt09,omitempty" yaml:"mt09,omitempty" xml:"mt09,omitempty"`
-	MT10Val Mime_t `json:"mt10,omitempty" yaml:"mt10,omitempty" xml:"mt10,omitempty"`
-	MT12Val Mime_t `json:"mt12,omitempty" yaml:"mt12,omitempty" xml:"mt12,omitempty"`
-	MT15Val Mime_t `json:"mt15,omitempty" yaml:"mt15,omitempty" xml:"mt15,omitempty"`
-	MT16Val Mime_t `json:"mt16,omitempty" yaml:"mt16,omitempty" xml:"mt16,omitempty"`
-	MT18Val Mime_t `json:"mt18,omitempty" yaml:"mt18,omitempty" xml:"mt18,omitempty"`
-	MT20Val Mime_t `json:"mt20,omitempty" yaml:"mt20,omitempty" xml:"mt20,omitempty"`
-	MT24Val Mime_t `json:"mt24,omitempty" yaml:"mt24,omitempty" xml:"mt24,omitempty"`
-	MT30Val Mime_t `json:"mt30,omitempty" yaml:"mt30,omitempty" xml:"mt30,omitempty"`
-	MT36Val Mime_t `json:"mt36,omitempty" yaml:"mt36,omitempty" xml:"mt36,omitempty"`
-}
-
-const (
-	htcell = 24 // horizontal tile cell length
-	vtcell = 18 // vertical tile cell length
-)
+	MTmbVal Mime_t     `json:"mtmb" yaml:"mtmb" xml:"mtmb"`
+	Tiles   []TileMime `xorm:"'tiles' json" json:"tiles,omitempty" yaml:"tiles,omitempty" xml:"tiles>tile,omitempty"`
+}
 
-type TM_t int
-
-const (
-	tm0  TM_t = 0
-	tm2  TM_t = 2
-	tm3  TM_t = 3
-	tm4  TM_t = 4
-	tm6  TM_t = 6
-	tm8  TM_t = 8
-	tm9  TM_t = 9
-	tm10 TM_t = 10
-	tm12 TM_t = 12
-	tm15 TM_t = 15
-	tm16 TM_t = 16
-	tm18 TM_t = 18
-	tm20 TM_t = 20
-	tm24 TM_t = 24
-	tm30 TM_t = 30
-	tm36 TM_t = 36
-)
+// TileDim returns tile dimensions string in format "WxH".
+func TileDim(wdh, hgt int) string {
+	return fmt.Sprintf("%dx%d", wdh, hgt)
+}
+
+// ParseTileDim returns width and height from dimensions string in format "WxH".
+func ParseTileDim(dim string) (wdh, hgt int, err error) {
+	var sw, sh, ok = strings.Cut(dim, "x")
+	if !ok {
+		err = ErrArgNoDim
+		return
+	}
+	if wdh, err = strconv.Atoi(sw); err != nil {
+		err = ErrArgNoDim
+		return
+	}
+	if hgt, err = strconv.Atoi(sh); err != nil {
+		err = ErrArgNoDim
+		return
+	}
+	if wdh <= 0 || hgt <= 0 {
+		err = ErrArgZDim
+		return
+	}
+	return
+}
+
+// TileKey returns key of tile with given dimensions in tiles package.
+func TileKey(syspath string, wdh, hgt int) string {
+	return fmt.Sprintf("%s?%dx%d", syspath, wdh, hgt)
+}
+
+// GetTileSpec returns configured specification of tile
+// with given dimensions.
+func GetTileSpec(wdh, hgt int) (spec cfg.CfgTileSpec, ok bool) {
+	for _, spec = range Cfg.TileSpecs {
+		if spec.Width == wdh && spec.Height == hgt {
+			ok = true
+			return
+		}
+	}
+	return
+}
+
+// NearestTileSpec returns configured specification of tile with given
+// dimensions, or with nearest dimensions if such tiles are not configured.
+// Larger tile is preferred from two equally near. Returns false if there
+// are no configured tiles.
+func NearestTileSpec(wdh, hgt int) (spec cfg.CfgTileSpec, ok bool) {
+	var best = -1
+	for _, s := range Cfg.TileSpecs {
+		var d = abs(s.Width-wdh) + abs(s.Height-hgt)
+		if best < 0 || d < best || (d == best && s.Width*s.Height > spec.Width*spec.Height) {
+			spec, best, ok = s, d, true
+		}
+	}
+	return
+}
+
+// abs returns absolute value of integer.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// CheckTileSpecs checks up that all configured tiles specifications
+// have valid dimensions and supported format.
+func CheckTileSpecs() error {
+	for _, spec := range Cfg.TileSpecs {
+		if spec.Width <= 0 || spec.Height <= 0 {
+			return fmt.Errorf("%w: %dx%d", ErrArgZDim, spec.Width, spec.Height)
+		}
+		if _, ok := TileMimeOf(spec.Format); !ok {
+			return fmt.Errorf("%w: %s for %dx%d", ErrTileFmt, spec.Format, spec.Width, spec.Height)
+		}
+	}
+	return nil
+}
 
 // CachedThumbMime returns MIME type of rendered thumbnail in package,
 // or MimeNil if it not present.
@@ -86,10 +132,9 @@ func CachedThumbMime(syspath string) Mime_t {
 }
 
 // CachedTileMime returns MIME type of rendered tile in package with
-// given tile multiplier, or MimeNil if it not present.
-func CachedTileMime(syspath string, tm TM_t) Mime_t {
-	var tilepath = fmt.Sprintf("%s?%dx%d", syspath, tm*htcell, tm*vtcell)
-	if ts, ok := TilesPkg.GetTagset(tilepath); ok {
+// given dimensions, or MimeNil if it not present.
+func CachedTileMime(syspath string, wdh, hgt int) Mime_t {
+	if ts, ok := TilesPkg.GetTagset(TileKey(syspath, wdh, hgt)); ok {
 		if str, ok := ts.TagStr(wpk.TIDmime); ok {
 			if strings.HasPrefix(str, "image/") {
 				return MimeVal[str]
@@ -104,89 +149,59 @@ func CachedTileMime(syspath string, tm TM_t) Mime_t {
 	}
 }
 
-// Tile returns image MIME type with given tile multiplier.
-func (tp *TileProp) Tile(tm TM_t) (mime Mime_t, ok bool) {
-	ok = true
-	switch tm {
-	case tm0:
-		mime = tp.MTmbVal
-	case tm2:
-		mime = tp.MT02Val
-	case tm3:
-		mime = tp.MT03Val
-	case tm4:
-		mime = tp.MT04Val
-	case tm6:
-		mime = tp.MT06Val
-	case tm8:
-		mime = tp.MT08Val
-	case tm9:
-		mime = tp.MT09Val
-	case tm10:
-		mime = tp.MT10Val
-	case tm12:
-		mime = tp.MT12Val
-	case tm15:
-		mime = tp.MT15Val
-	case tm16:
-		mime = tp.MT16Val
-	case tm18:
-		mime = tp.MT18Val
-	case tm20:
-		mime = tp.MT20Val
-	case tm24:
-		mime = tp.MT24Val
-	case tm30:
-		mime = tp.MT30Val
-	case tm36:
-		mime = tp.MT36Val
-	default:
+// IsTileCached returns true if tile with given specification
+// is present in package and has format of this specification.
+func IsTileCached(syspath string, spec cfg.CfgTileSpec) bool {
+	var mime, ok = TileMimeOf(spec.Format)
+	return ok && CachedTileMime(syspath, spec.Width, spec.Height) == mime
+}
+
+// Thumb returns image MIME type of thumbnail.
+func (tp *TileProp) Thumb() Mime_t {
+	return tp.MTmbVal
+}
+
+// SetThumb updates image state of thumbnail to given value.
+func (tp *TileProp) SetThumb(mime Mime_t) {
+	tp.MTmbVal = mime
+}
+
+// Tile returns image MIME type of tile with given dimensions.
+// Returns MimeDis if tiles with such dimensions are not configured,
+// or MimeNil if tile is not rendered yet.
+func (tp *TileProp) Tile(wdh, hgt int) (mime Mime_t, ok bool) {
+	if _, ok = GetTileSpec(wdh, hgt); !ok {
 		mime = MimeDis
-		ok = false
+		return
+	}
+	var dim = TileDim(wdh, hgt)
+	for _, tm := range tp.Tiles {
+		if tm.Dim == dim {
+			mime = tm.Mime
+			return
+		}
 	}
+	mime = MimeNil
 	return
 }
 
 // SetTile updates image state to given value for tile with
-// given tile multiplier.
-func (tp *TileProp) SetTile(tm TM_t, mime Mime_t) (ok bool) {
-	ok = true
-	switch tm {
-	case tm0:
-		tp.MTmbVal = mime
-	case tm2:
-		tp.MT02Val = mime
-	case tm3:
-		tp.MT03Val = mime
-	case tm4:
-		tp.MT04Val = mime
-	case tm6:
-		tp.MT06Val = mime
-	case tm8:
-		tp.MT08Val = mime
-	case tm9:
-		tp.MT09Val = mime
-	case tm10:
-		tp.MT10Val = mime
-	case tm12:
-		tp.MT12Val = mime
-	case tm15:
-		tp.MT15Val = mime
-	case tm16:
-		tp.MT16Val = mime
-	case tm18:
-		tp.MT18Val = mime
-	case tm20:
-		tp.MT20Val = mime
-	case tm24:
-		tp.MT24Val = mime
-	case tm30:
-		tp.MT30Val = mime
-	case tm36:
-		tp.MT36Val = mime
-	default:
-		ok = false
+// given dimensions. Tiles list is copied on write, so it can be
+// shared between copies of TileProp in cache.
+func (tp *TileProp) SetTile(wdh, hgt int, mime Mime_t) (ok bool) {
+	if _, ok = GetTileSpec(wdh, hgt); !ok {
+		return
+	}
+	var dim = TileDim(wdh, hgt)
+	var tiles = slices.Clone(tp.Tiles)
+	if i := slices.IndexFunc(tiles, func(tm TileMime) bool {
+		return tm.Dim == dim
+	}); i >= 0 {
+		tiles[i].Mime = mime
+	} else {
+		tiles = append(tiles, TileMime{dim, mime})
 	}
+	tp.Tiles = tiles
 	return
 }
 
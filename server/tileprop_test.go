@@ -0,0 +1,111 @@
+package hms
+
+import (
+	"errors"
+	"testing"
+
+	cfg "github.com/schwarzlichtbezirk/hms/config"
+)
+
+// testTileSpecs sets given tiles specifications while test is running.
+func testTileSpecs(t *testing.T, specs []cfg.CfgTileSpec) {
+	t.Helper()
+	var prev = Cfg.TileSpecs
+	Cfg.TileSpecs = specs
+	t.Cleanup(func() {
+		Cfg.TileSpecs = prev
+	})
+}
+
+func TestParseTileDim(t *testing.T) {
+	var tests = []struct {
+		dim      string
+		wdh, hgt int
+		err      error
+	}{
+		{"144x108", 144, 108, nil},
+		{"144", 0, 0, ErrArgNoDim},
+		{"ax108", 0, 0, ErrArgNoDim},
+		{"144xb", 0, 0, ErrArgNoDim},
+		{"0x108", 0, 0, ErrArgZDim},
+		{"144x-1", 0, 0, ErrArgZDim},
+	}
+	for _, test := range tests {
+		var wdh, hgt, err = ParseTileDim(test.dim)
+		if err != test.err {
+			t.Errorf("dim %q: expected error %v, got %v", test.dim, test.err, err)
+			continue
+		}
+		if err == nil && (wdh != test.wdh || hgt != test.hgt) {
+			t.Errorf("dim %q: expected %dx%d, got %dx%d", test.dim, test.wdh, test.hgt, wdh, hgt)
+		}
+	}
+}
+
+func TestTileKey(t *testing.T) {
+	if key := TileKey("/photo/img.jpg", 144, 108); key != "/photo/img.jpg?144x108" {
+		t.Fatalf("unexpected tile key %q", key)
+	}
+	if src := CacheSrcPath(TileKey("/photo/img.jpg", 144, 108)); src != "/photo/img.jpg" {
+		t.Fatalf("source path is not restored from tile key, got %q", src)
+	}
+}
+
+func TestNearestTileSpec(t *testing.T) {
+	testTileSpecs(t, []cfg.CfgTileSpec{
+		{Width: 48, Height: 36, Format: "webp"},
+		{Width: 96, Height: 72, Format: "webp"},
+		{Width: 144, Height: 108, Format: "webp"},
+	})
+	var tests = []struct {
+		wdh, hgt int
+		want     int // expected width
+	}{
+		{96, 72, 96},   // exact match
+		{100, 70, 96},  // nearest
+		{120, 90, 144}, // equally near, larger is preferred
+		{1000, 1000, 144},
+		{1, 1, 48},
+	}
+	for _, test := range tests {
+		var spec, ok = NearestTileSpec(test.wdh, test.hgt)
+		if !ok || spec.Width != test.want {
+			t.Errorf("%dx%d: expected width %d, got %d (%v)", test.wdh, test.hgt, test.want, spec.Width, ok)
+		}
+	}
+
+	if _, ok := GetTileSpec(100, 70); ok {
+		t.Error("not configured tile is found")
+	}
+	if spec, ok := GetTileSpec(144, 108); !ok || spec.Height != 108 {
+		t.Error("configured tile is not found")
+	}
+
+	testTileSpecs(t, nil)
+	if _, ok := NearestTileSpec(96, 72); ok {
+		t.Error("tile is found at empty configuration")
+	}
+}
+
+func TestCheckTileSpecs(t *testing.T) {
+	var tests = []struct {
+		name  string
+		specs []cfg.CfgTileSpec
+		err   error
+	}{
+		{"default", cfg.DefTileSpecs(), nil},
+		{"empty", nil, nil},
+		{"zero dim", []cfg.CfgTileSpec{{Width: 0, Height: 18, Format: "webp"}}, ErrArgZDim},
+		{"bad format", []cfg.CfgTileSpec{{Width: 24, Height: 18, Format: "bmp"}}, ErrTileFmt},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testTileSpecs(t, test.specs)
+			if err := CheckTileSpecs(); !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+// The End.
@@ -0,0 +1,331 @@
+package hms
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+// User log errors.
+var (
+	ErrUlCleanRun = errors.New("cleanup of user log is already in progress")
+	ErrUlTable    = errors.New("table should be 'open' or 'agent'")
+	ErrUlFormat   = errors.New("format should be 'csv' or 'json'")
+)
+
+// UserlogStat is the result of user log cleanup.
+type UserlogStat struct {
+	Opens   int64 `json:"opens" yaml:"opens" xml:"opens"`       // number of removed records of opened files and folders
+	Agents  int64 `json:"agents" yaml:"agents" xml:"agents"`    // number of removed records of user agents
+	OldSize int64 `json:"oldsize" yaml:"oldsize" xml:"oldsize"` // size of database file before cleanup
+	NewSize int64 `json:"newsize" yaml:"newsize" xml:"newsize"` // size of database file after cleanup
+}
+
+// prevents simultaneous cleanups
+var ulclean atomic.Bool
+
+// AnonAddr returns client address in representation
+// to store in user log, as it set by configuration.
+func AnonAddr(addr string) string {
+	switch Cfg.UlAddrMode {
+	case "truncate":
+		if ip := net.ParseIP(addr); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				return ip4.Mask(net.CIDRMask(24, 32)).String()
+			}
+			return ip.Mask(net.CIDRMask(48, 128)).String()
+		}
+	case "hash":
+		var h = xxhash.New()
+		h.Write(S2B(Cfg.UaidHmacKey))
+		h.Write(S2B(addr))
+		return fmt.Sprintf("%016x", h.Sum64())
+	}
+	return addr
+}
+
+// userlogfile returns path to user log database file,
+// or empty string if database is not SQLite.
+func userlogfile() string {
+	if XormUserlog.Dialect().URI().DBType != schemas.SQLITE {
+		return ""
+	}
+	var fpath = XormUserlog.DataSourceName()
+	if i := strings.IndexByte(fpath, '?'); i >= 0 {
+		fpath = fpath[:i]
+	}
+	return fpath
+}
+
+// ultime formats time in the same way as xorm writes it to user log,
+// so comparison with stored values does not depend on driver.
+func ultime(t time.Time) string {
+	return t.In(XormUserlog.DatabaseTZ).Format("2006-01-02 15:04:05")
+}
+
+// CleanUserlog removes user log records that are out of retention
+// policy, and rebuilds database file if vacuum is true.
+func CleanUserlog(vacuum bool) (st UserlogStat, err error) {
+	if !ulclean.CompareAndSwap(false, true) {
+		err = ErrUlCleanRun
+		return
+	}
+	defer ulclean.Store(false)
+
+	var fpath = userlogfile()
+	if fpath != "" {
+		if fi, err := os.Stat(fpath); err == nil {
+			st.OldSize = fi.Size()
+		}
+	}
+
+	var session = XormUserlog.NewSession()
+	defer session.Close()
+
+	var n int64
+	var cutoff time.Time // agents created before are removed if they are not referenced
+	if Cfg.UlKeepAge > 0 {
+		cutoff = time.Now().Add(-Cfg.UlKeepAge)
+		if n, err = session.Where("time<?", ultime(cutoff)).Delete(&OpenStore{}); err != nil {
+			return
+		}
+		st.Opens += n
+	}
+	if Cfg.UlKeepNum > 0 {
+		var last OpenStore
+		var ok bool
+		if ok, err = session.Desc("time").Limit(1, Cfg.UlKeepNum-1).Get(&last); err != nil {
+			return
+		}
+		if ok {
+			// records with the same time as last kept record are kept too
+			if n, err = session.Where("time<?", ultime(last.Time)).Delete(&OpenStore{}); err != nil {
+				return
+			}
+			st.Opens += n
+			if last.Time.After(cutoff) {
+				cutoff = last.Time
+			}
+		}
+	}
+
+	if !cutoff.IsZero() {
+		// remove agents that are not referenced by remained records
+		var uaids []int64
+		if err = session.Table(&AgentStore{}).Cols("uaid").
+			Where("time<?", ultime(cutoff)).
+			And("uaid NOT IN (SELECT uaid FROM open_store)").
+			Find(&uaids); err != nil {
+			return
+		}
+		const limit = 256
+		for i := 0; i < len(uaids); i += limit {
+			var chunk = uaids[i:min(i+limit, len(uaids))]
+			if n, err = session.In("uaid", chunk).Delete(&AgentStore{}); err != nil {
+				return
+			}
+			st.Agents += n
+		}
+		// agents should be inserted again on next visit
+		uamux.Lock()
+		for _, uaid := range uaids {
+			delete(UaMap, uint64(uaid))
+		}
+		uamux.Unlock()
+	}
+
+	if vacuum && fpath != "" {
+		if _, err = session.Exec("VACUUM"); err != nil {
+			return
+		}
+	}
+	if fpath != "" {
+		if fi, err := os.Stat(fpath); err == nil {
+			st.NewSize = fi.Size()
+		}
+	}
+	return
+}
+
+// APIHANDLER
+func SpiUserlogClean(c *gin.Context) {
+	var err error
+	var ret struct {
+		XMLName xml.Name `json:"-" yaml:"-" xml:"ret"`
+
+		UserlogStat `yaml:",inline"`
+	}
+
+	if ret.UserlogStat, err = CleanUserlog(Cfg.UlVacuum); err != nil {
+		if errors.Is(err, ErrUlCleanRun) {
+			RetErr(c, http.StatusConflict, AEC_ulclean_run, err)
+			return
+		}
+		Ret500(c, AEC_ulclean_fail, err)
+		return
+	}
+	Log.Infof("user log cleaned: %d opens and %d agents removed, size %d -> %d bytes",
+		ret.Opens, ret.Agents, ret.OldSize, ret.NewSize)
+
+	RetOk(c, ret)
+}
+
+// APIHANDLER
+// SpiUserlogExport streams user log table in CSV or JSON format.
+func SpiUserlogExport(c *gin.Context) {
+	type openrec struct {
+		UAID    uint64    `json:"uaid"`
+		AID     uint64    `json:"aid"`
+		UID     uint64    `json:"uid"`
+		Path    string    `json:"path"`
+		Latency int       `json:"latency"`
+		Time    time.Time `json:"time"`
+	}
+	type agentrec struct {
+		UAID uint64    `json:"uaid"`
+		CID  uint64    `json:"cid"`
+		Addr string    `json:"addr"`
+		UA   string    `json:"ua"`
+		Lang string    `json:"lang"`
+		Time time.Time `json:"time"`
+	}
+
+	var err error
+	var arg struct {
+		AnRange
+
+		Table  string `json:"table" yaml:"table" xml:"table" form:"table"`     // "open" or "agent"
+		Format string `json:"format" yaml:"format" xml:"format" form:"format"` // "csv" or "json"
+	}
+
+	// get arguments
+	if err = c.ShouldBind(&arg); err != nil {
+		Ret400(c, AEC_ulexport_nobind, err)
+		return
+	}
+	if arg.Table == "" {
+		arg.Table = "open"
+	}
+	if arg.Format == "" {
+		arg.Format = "csv"
+	}
+	var bean any
+	var header []string
+	switch arg.Table {
+	case "open":
+		bean = &OpenStore{}
+		header = []string{"uaid", "aid", "uid", "path", "latency", "time"}
+	case "agent":
+		bean = &AgentStore{}
+		header = []string{"uaid", "cid", "addr", "ua", "lang", "time"}
+	default:
+		Ret400(c, AEC_ulexport_badtbl, ErrUlTable)
+		return
+	}
+	var ctype string
+	switch arg.Format {
+	case "csv":
+		ctype = "text/csv; charset=utf-8"
+	case "json":
+		ctype = "application/json; charset=utf-8"
+	default:
+		Ret400(c, AEC_ulexport_badfmt, ErrUlFormat)
+		return
+	}
+
+	var session = XormUserlog.NewSession()
+	defer session.Close()
+
+	arg.Where(session, "time")
+	var rows *xorm.Rows
+	if rows, err = session.Asc("time").Rows(bean); err != nil {
+		Ret500(c, AEC_ulexport_query, err)
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Server", serverhdr)
+	c.Header("Content-Type", ctype)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="hms-userlog-%s.%s"`, arg.Table, arg.Format))
+	c.Status(http.StatusOK)
+
+	// get next record in exported representation
+	var next = func() (rec any, fields []string, err error) {
+		switch arg.Table {
+		case "open":
+			var ost OpenStore
+			if err = rows.Scan(&ost); err != nil {
+				return
+			}
+			rec = openrec{uint64(ost.UAID), ost.AID, ost.UID, ost.Path, ost.Latency, ost.Time}
+			fields = []string{
+				strconv.FormatUint(uint64(ost.UAID), 10),
+				strconv.FormatUint(ost.AID, 10),
+				strconv.FormatUint(ost.UID, 10),
+				ost.Path,
+				strconv.Itoa(ost.Latency),
+				ost.Time.Format(time.RFC3339),
+			}
+		case "agent":
+			var ast AgentStore
+			if err = rows.Scan(&ast); err != nil {
+				return
+			}
+			rec = agentrec{uint64(ast.UAID), ast.CID, ast.Addr, ast.UA, ast.Lang, ast.Time}
+			fields = []string{
+				strconv.FormatUint(uint64(ast.UAID), 10),
+				strconv.FormatUint(ast.CID, 10),
+				ast.Addr,
+				ast.UA,
+				ast.Lang,
+				ast.Time.Format(time.RFC3339),
+			}
+		}
+		return
+	}
+
+	switch arg.Format {
+	case "csv":
+		var w = csv.NewWriter(c.Writer)
+		w.Write(header)
+		for rows.Next() {
+			var _, fields, err = next()
+			if err != nil {
+				Log.Errorf("user log export failed: %s", err.Error())
+				break
+			}
+			w.Write(fields)
+		}
+		w.Flush()
+	case "json":
+		var enc = json.NewEncoder(c.Writer)
+		c.Writer.WriteString("[\n")
+		for i := 0; rows.Next(); i++ {
+			var rec, _, err = next()
+			if err != nil {
+				Log.Errorf("user log export failed: %s", err.Error())
+				break
+			}
+			if i > 0 {
+				c.Writer.WriteString(",")
+			}
+			enc.Encode(rec)
+		}
+		c.Writer.WriteString("]\n")
+	}
+}
+
+// The End.
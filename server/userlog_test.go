@@ -0,0 +1,162 @@
+package hms
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	cfg "github.com/schwarzlichtbezirk/hms/config"
+)
+
+func TestAnonAddr(t *testing.T) {
+	var prev = Cfg.UlAddrMode
+	t.Cleanup(func() { Cfg.UlAddrMode = prev })
+
+	var tests = []struct {
+		mode, addr, want string
+	}{
+		{"raw", "192.0.2.77", "192.0.2.77"},
+		{"truncate", "192.0.2.77", "192.0.2.0"},
+		{"truncate", "2001:db8:1:2:3:4:5:6", "2001:db8:1::"},
+		{"truncate", "not an ip", "not an ip"},
+	}
+	for _, test := range tests {
+		Cfg.UlAddrMode = test.mode
+		if got := AnonAddr(test.addr); got != test.want {
+			t.Errorf("mode %q, addr %q: expected %q, got %q", test.mode, test.addr, test.want, got)
+		}
+	}
+
+	Cfg.UlAddrMode = "hash"
+	var h1, h2 = AnonAddr("192.0.2.77"), AnonAddr("192.0.2.78")
+	if len(h1) != 16 || strings.Contains(h1, "192.0.2") {
+		t.Errorf("address is not hashed: %q", h1)
+	}
+	if h1 == h2 || h1 != AnonAddr("192.0.2.77") {
+		t.Errorf("hashes are not stable or not distinct: %q, %q", h1, h2)
+	}
+}
+
+func TestCleanUserlog(t *testing.T) {
+	var prevage, prevnum = Cfg.UlKeepAge, Cfg.UlKeepNum
+	t.Cleanup(func() { Cfg.UlKeepAge, Cfg.UlKeepNum = prevage, prevnum })
+
+	var now = time.Now().Truncate(time.Second)
+	var ago = func(d time.Duration) time.Time { return now.Add(-d) }
+	var agents = []AgentStore{
+		{UAID: 1, Time: ago(72 * time.Hour)}, // has only old records
+		{UAID: 2, Time: ago(72 * time.Hour)}, // has recent records
+		{UAID: 3, Time: ago(time.Minute)},    // new client without records
+	}
+	var opens = []OpenStore{
+		{UAID: 1, Path: "/a", Time: ago(48 * time.Hour)},
+		{UAID: 1, Path: "/b", Time: ago(36 * time.Hour)},
+		{UAID: 2, Path: "/c", Time: ago(2 * time.Hour)},
+		{UAID: 2, Path: "/d", Time: ago(2 * time.Hour)}, // tie with previous
+		{UAID: 2, Path: "/e", Time: ago(time.Hour)},
+	}
+
+	var tests = []struct {
+		name   string
+		age    time.Duration
+		num    int
+		opens  []string // remained paths
+		agents []uint64 // remained agents
+	}{
+		{"no policy", 0, 0, []string{"/a", "/b", "/c", "/d", "/e"}, []uint64{1, 2, 3}},
+		{"keep age", 24 * time.Hour, 0, []string{"/c", "/d", "/e"}, []uint64{2, 3}},
+		{"keep num", 0, 3, []string{"/c", "/d", "/e"}, []uint64{2, 3}},
+		{"keep num with tie", 0, 2, []string{"/c", "/d", "/e"}, []uint64{2, 3}},
+		{"keep num over all", 0, 10, []string{"/a", "/b", "/c", "/d", "/e"}, []uint64{1, 2, 3}},
+		{"keep num and age", 40 * time.Hour, 1, []string{"/e"}, []uint64{2, 3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var engine = testUserlog(t)
+			for _, ast := range agents {
+				if _, err := engine.NoAutoTime().InsertOne(&ast); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, ost := range opens {
+				if _, err := engine.NoAutoTime().InsertOne(&ost); err != nil {
+					t.Fatal(err)
+				}
+			}
+			Cfg.UlKeepAge, Cfg.UlKeepNum = test.age, test.num
+
+			var st, err = CleanUserlog(false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Opens != int64(len(opens)-len(test.opens)) {
+				t.Errorf("expected %d removed records, got %d", len(opens)-len(test.opens), st.Opens)
+			}
+			if st.Agents != int64(len(agents)-len(test.agents)) {
+				t.Errorf("expected %d removed agents, got %d", len(agents)-len(test.agents), st.Agents)
+			}
+
+			var paths []string
+			if err = engine.Table(&OpenStore{}).Cols("path").Asc("path").Find(&paths); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(paths, ",") != strings.Join(test.opens, ",") {
+				t.Errorf("expected records %v, got %v", test.opens, paths)
+			}
+			var uaids []uint64
+			if err = engine.Table(&AgentStore{}).Cols("uaid").Asc("uaid").Find(&uaids); err != nil {
+				t.Fatal(err)
+			}
+			if len(uaids) != len(test.agents) {
+				t.Fatalf("expected agents %v, got %v", test.agents, uaids)
+			}
+			for i := range uaids {
+				if uaids[i] != test.agents[i] {
+					t.Fatalf("expected agents %v, got %v", test.agents, uaids)
+				}
+			}
+		})
+	}
+}
+
+func TestLogWrapAddr(t *testing.T) {
+	var buf bytes.Buffer
+	var prevlog, prevmode = Slog, Cfg.UlAddrMode
+	Slog = slog.New(cfg.NewSlogHandler(cfg.NewLogger(&buf, 0, 10)))
+	t.Cleanup(func() { Slog, Cfg.UlAddrMode = prevlog, prevmode })
+
+	gin.SetMode(gin.TestMode)
+	var r = gin.New()
+	r.Use(LogWrap)
+	r.GET("/api/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	var tests = []struct {
+		mode string
+		want string
+	}{
+		{"raw", "ip=192.0.2.77"},
+		{"truncate", "ip=192.0.2.0"},
+		{"hash", "ip=" + func() string { Cfg.UlAddrMode = "hash"; return AnonAddr("192.0.2.77") }()},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		Cfg.UlAddrMode = test.mode
+		var req = httptest.NewRequest("GET", "/api/ping", nil)
+		req.RemoteAddr = "192.0.2.77:1234"
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		var out = buf.String()
+		if !strings.Contains(out, test.want) {
+			t.Errorf("mode %q: expected %q at log entry, got %q", test.mode, test.want, out)
+		}
+		if test.mode != "raw" && strings.Contains(out, "192.0.2.77") {
+			t.Errorf("mode %q: raw address at log entry %q", test.mode, out)
+		}
+	}
+}
+
+// The End.
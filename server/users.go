@@ -2,6 +2,7 @@ package hms
 
 import (
 	"encoding/xml"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,21 +15,23 @@ import (
 var XormUserlog *xorm.Engine
 
 // AgentStore is storage record with user agent string and user host address.
+// User agent IDs are stored with bits of uint64 hash as is, so they fit
+// to signed BIGINT columns of any database.
 type AgentStore struct {
-	UAID uint64    `xorm:"unique"` // user agent ID
+	UAID int64     `xorm:"unique"` // user agent ID
 	CID  uint64    // client ID
 	Addr string    // remote address
-	UA   string    // user agent
+	UA   string    `xorm:"text"` // user agent
 	Lang string    // accept language
 	Time time.Time `xorm:"created"`
 }
 
 // OpenStore is storage record with some opened file or opened folder.
 type OpenStore struct {
-	UAID    uint64    // client ID
+	UAID    int64     // user agent ID
 	AID     uint64    `xorm:"default 0"` // access profile ID
 	UID     uint64    `xorm:"default 0"` // user profile ID
-	Path    string    // system path
+	Path    string    `xorm:"text"`      // system path
 	Latency int       // event latency, in milliseconds, or -1 if it file
 	Time    time.Time `xorm:"created"` // time of event rise
 }
@@ -36,6 +39,8 @@ type OpenStore struct {
 var (
 	// UserOnline is map of last AJAX query time for each user.
 	UserOnline = map[uint64]time.Time{}
+	// time of last AJAX query of any user, except statistics polling.
+	lastactive time.Time
 	// UaMap is the map of user agent hashes and associated client IDs.
 	UaMap = map[uint64]uint64{}
 	// current maximum client ID
@@ -44,6 +49,21 @@ var (
 	uamux sync.Mutex
 )
 
+// LastOnline returns time of last AJAX query of any user. Queries
+// of server statistics are not counted, so opened statistics page
+// does not holds background jobs paused.
+func LastOnline() time.Time {
+	uamux.Lock()
+	defer uamux.Unlock()
+	return lastactive
+}
+
+// IsStatPoll returns "true" if given API route is polled by
+// statistics page.
+func IsStatPoll(route string) bool {
+	return strings.HasPrefix(route, "/api/stat/")
+}
+
 // CalcUAID calculate user agent ID by xxhash from given strings.
 func CalcUAID(addr, ua string) uint64 {
 	var h = xxhash.New()
@@ -63,7 +83,7 @@ func LoadUaMap() (err error) {
 	var session = XormUserlog.NewSession()
 	defer session.Close()
 
-	if _, err = session.Table(&AgentStore{}).Select("MAX(cid)").Get(&maxcid); err != nil {
+	if _, err = session.Table(&AgentStore{}).Select("COALESCE(MAX(cid), 0)").Get(&maxcid); err != nil {
 		return
 	}
 
@@ -71,12 +91,12 @@ func LoadUaMap() (err error) {
 	var offset int
 	for {
 		var chunk []AgentStore
-		if err = session.Limit(limit, offset).Find(&chunk); err != nil {
+		if err = session.Asc("uaid").Limit(limit, offset).Find(&chunk); err != nil {
 			return
 		}
 		offset += limit
 		for _, ast := range chunk {
-			UaMap[ast.UAID] = ast.CID
+			UaMap[uint64(ast.UAID)] = ast.CID
 		}
 		if limit > len(chunk) {
 			break
@@ -125,7 +145,7 @@ func SpiUserList(c *gin.Context) {
 	defer session.Close()
 
 	var asts []AgentStore
-	if err = XormUserlog.Limit(arg.Num, arg.Pos).Find(&asts); err != nil {
+	if err = XormUserlog.Asc("time").Limit(arg.Num, arg.Pos).Find(&asts); err != nil {
 		Ret500(c, AEC_usrlst_asts, err)
 		return
 	}
@@ -134,7 +154,7 @@ func SpiUserList(c *gin.Context) {
 	var now = time.Now()
 	for i, ast := range asts {
 		uamux.Lock()
-		var online = now.Sub(UserOnline[ast.UAID]) < Cfg.OnlineTimeout
+		var online = now.Sub(UserOnline[uint64(ast.UAID)]) < Cfg.OnlineTimeout
 		uamux.Unlock()
 		var ui = item{
 			Addr:   ast.Addr,
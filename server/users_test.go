@@ -0,0 +1,166 @@
+package hms
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+// testUserlog opens new SQLite user log at temporary directory with
+// latest schema, and sets it as XormUserlog while test is running.
+func testUserlog(t *testing.T) *xorm.Engine {
+	t.Helper()
+	var engine, err = xorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "userlog.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetMapper(names.GonicMapper{})
+	if _, err = UserlogMigrations.Up(engine, 0); err != nil {
+		engine.Close()
+		t.Fatal(err)
+	}
+	var prev = XormUserlog
+	XormUserlog = engine
+	t.Cleanup(func() {
+		XormUserlog = prev
+		engine.Close()
+	})
+	return engine
+}
+
+// testUaidStore checks that user agent IDs with any bits are stored
+// at user log and loaded back without changes.
+func testUaidStore(t *testing.T) {
+	t.Helper()
+	uamux.Lock()
+	var prevmap, prevmax = UaMap, maxcid
+	UaMap, maxcid = map[uint64]uint64{}, 0
+	uamux.Unlock()
+	t.Cleanup(func() {
+		uamux.Lock()
+		UaMap, maxcid = prevmap, prevmax
+		uamux.Unlock()
+	})
+
+	var tests = []struct {
+		uaid uint64
+		cid  uint64
+	}{
+		{1, 1},
+		{0x7fff_ffff_ffff_ffff, 2},
+		{0x8000_0000_0000_0000, 3},
+		{0xfedc_ba98_7654_3210, 4},
+		{0xffff_ffff_ffff_ffff, 5},
+	}
+	for _, test := range tests {
+		if _, err := XormUserlog.InsertOne(&AgentStore{UAID: int64(test.uaid), CID: test.cid}); err != nil {
+			t.Fatalf("uaid %x: %v", test.uaid, err)
+		}
+		if _, err := XormUserlog.InsertOne(&OpenStore{UAID: int64(test.uaid), Path: "/music/", Latency: -1}); err != nil {
+			t.Fatalf("uaid %x: %v", test.uaid, err)
+		}
+	}
+	if err := LoadUaMap(); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		if cid, ok := UaMap[test.uaid]; !ok || cid != test.cid {
+			t.Errorf("uaid %x: expected client %d, got %d, %v", test.uaid, test.cid, cid, ok)
+		}
+		var ost OpenStore
+		if ok, err := XormUserlog.Where("uaid=?", int64(test.uaid)).Get(&ost); err != nil || !ok {
+			t.Errorf("uaid %x: record is not found, %v", test.uaid, err)
+		} else if uint64(ost.UAID) != test.uaid {
+			t.Errorf("uaid %x: got %x", test.uaid, uint64(ost.UAID))
+		}
+	}
+	if maxcid != uint64(len(tests)) {
+		t.Errorf("expected maximum client ID %d, got %d", len(tests), maxcid)
+	}
+}
+
+func TestUaidStore(t *testing.T) {
+	testUserlog(t)
+	testUaidStore(t)
+}
+
+func TestIsStatPoll(t *testing.T) {
+	var tests = []struct {
+		route string
+		want  bool
+	}{
+		{"/api/stat/srvinf", true},
+		{"/api/stat/events", true},
+		{"/api/stat/topfiles", true},
+		{"/id:aid/api/res/folder", false},
+		{"/api/auth/pubkey", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := IsStatPoll(test.route); got != test.want {
+			t.Errorf("route %q: expected %v, got %v", test.route, test.want, got)
+		}
+	}
+}
+
+func TestLastOnline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var r = gin.New()
+	var ok = func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/api/stat/srvinf", ApiWrap, ok)
+	r.GET("/api/stat/memusg", ApiWrap, ok)
+	r.POST("/id/:aid/api/res/folder", ApiWrap, ok)
+
+	const addr, ua = "192.0.2.1", "test agent"
+	var uaid = CalcUAID(addr, ua)
+	uamux.Lock()
+	var prev = lastactive
+	UaMap[uaid] = 1 // client is known, so it is not written to user log
+	lastactive = time.Time{}
+	uamux.Unlock()
+	t.Cleanup(func() {
+		uamux.Lock()
+		delete(UaMap, uaid)
+		delete(UserOnline, uaid)
+		lastactive = prev
+		uamux.Unlock()
+	})
+
+	var tests = []struct {
+		method, url string
+		active      bool // query is counted as user activity
+	}{
+		{"GET", "/api/stat/srvinf", false},
+		{"GET", "/api/stat/memusg", false},
+		{"POST", "/id/1/api/res/folder", true},
+		{"GET", "/api/stat/srvinf", false},
+	}
+	for _, test := range tests {
+		var before = LastOnline()
+		var req = httptest.NewRequest(test.method, test.url, nil)
+		req.RemoteAddr = addr + ":1234"
+		req.Header.Set("User-Agent", ua)
+		var w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", test.url, w.Code)
+		}
+		uamux.Lock()
+		var _, online = UserOnline[uaid]
+		uamux.Unlock()
+		if !online {
+			t.Errorf("%s: client is not online", test.url)
+		}
+		if active := LastOnline().After(before); active != test.active {
+			t.Errorf("%s: expected activity %v, got %v", test.url, test.active, active)
+		}
+	}
+}
+
+// The End.
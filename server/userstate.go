@@ -0,0 +1,171 @@
+package hms
+
+import (
+	"time"
+)
+
+// FavStore is storage record with file or folder starred by profile.
+type FavStore struct {
+	AID  uint64    `xorm:"pk"` // profile ID
+	Puid Puid_t    `xorm:"pk"`
+	Time time.Time `xorm:"notnull"` // time when item was starred
+}
+
+// PlayStore is storage record with last playback position
+// of media file by profile.
+type PlayStore struct {
+	AID  uint64    `xorm:"pk"` // profile ID
+	Puid Puid_t    `xorm:"pk"`
+	Pos  int64     `xorm:"notnull default 0"` // playback position, in milliseconds
+	Time time.Time `xorm:"notnull index"`     // time of last playback
+}
+
+// FileState is state of file at profile.
+type FileState struct {
+	PUID Puid_t    `json:"puid" yaml:"puid" xml:"puid,attr"`
+	Fav  bool      `json:"fav,omitempty" yaml:"fav,omitempty" xml:"fav,omitempty,attr"` // file is starred
+	Pos  int64     `json:"pos,omitempty" yaml:"pos,omitempty" xml:"pos,omitempty,attr"` // last playback position, in milliseconds
+	Time time.Time `json:"time,omitempty" yaml:"time,omitempty" xml:"time,omitempty"`   // time of last playback
+}
+
+// FavSet stars file with given PUID for profile, or removes the star.
+func FavSet(session *Session, aid uint64, puid Puid_t, fav bool) (err error) {
+	if !fav {
+		_, err = session.Delete(&FavStore{AID: aid, Puid: puid})
+		return
+	}
+	var ok bool
+	if ok, err = session.Exist(&FavStore{AID: aid, Puid: puid}); err != nil || ok {
+		return
+	}
+	_, err = session.InsertOne(&FavStore{
+		AID:  aid,
+		Puid: puid,
+		Time: time.Now(),
+	})
+	return
+}
+
+// FavList returns PUIDs of files starred by profile, recent first.
+func FavList(session *Session, aid uint64) (list []Puid_t, err error) {
+	err = session.Table(&FavStore{}).Cols("puid").
+		Where("aid=?", aid).Desc("time").
+		Find(&list)
+	return
+}
+
+// PlaySet puts playback position of file with given PUID for profile,
+// and marks file as recently played. Only given number of last played
+// files is kept for profile, the number is not limited if it's zero.
+func PlaySet(session *Session, aid uint64, puid Puid_t, pos int64, limit int) (err error) {
+	var pst = &PlayStore{
+		AID:  aid,
+		Puid: puid,
+		Pos:  pos,
+		Time: time.Now(),
+	}
+	var affected int64
+	if affected, err = session.Where("aid=? AND puid=?", aid, puid).
+		Cols("pos", "time").Update(pst); err != nil {
+		return
+	}
+	if affected == 0 {
+		if _, err = session.InsertOne(pst); err != nil {
+			return
+		}
+	}
+	if limit <= 0 {
+		return
+	}
+
+	// remove files played before last ones, given file is
+	// excluded from the search because time can be the same
+	// with other files at storage resolution
+	var n int64
+	if n, err = session.Where("aid=?", aid).Count(&PlayStore{}); err != nil || n <= int64(limit) {
+		return
+	}
+	var list []Puid_t
+	if err = session.Table(&PlayStore{}).Cols("puid").
+		Where("aid=? AND puid<>?", aid, puid).Desc("time").
+		Limit(int(n)-limit, limit-1).
+		Find(&list); err != nil {
+		return
+	}
+	_, err = session.Where("aid=?", aid).In("puid", list).Delete(&PlayStore{})
+	return
+}
+
+// PlayDel removes playback position and recent state of files for profile.
+// All records of profile are removed if list is empty.
+func PlayDel(session *Session, aid uint64, list []Puid_t) (n int64, err error) {
+	var s = session.Where("aid=?", aid)
+	if len(list) > 0 {
+		s = s.In("puid", list)
+	}
+	return s.Delete(&PlayStore{})
+}
+
+// RecentList returns PUIDs of files recently played by profile,
+// last played first. Number of files is not limited if limit is zero.
+func RecentList(session *Session, aid uint64, limit int) (list []Puid_t, err error) {
+	var s = session.Table(&PlayStore{}).Cols("puid").
+		Where("aid=?", aid).Desc("time")
+	if limit > 0 {
+		s = s.Limit(limit)
+	}
+	err = s.Find(&list)
+	return
+}
+
+// StateGet returns states of files with given PUIDs for profile.
+func StateGet(session *Session, aid uint64, list []Puid_t) (ret []FileState, err error) {
+	var fsts []FavStore
+	if err = session.Where("aid=?", aid).In("puid", list).Find(&fsts); err != nil {
+		return
+	}
+	var psts []PlayStore
+	if err = session.Where("aid=?", aid).In("puid", list).Find(&psts); err != nil {
+		return
+	}
+	var fm = map[Puid_t]bool{}
+	for _, fst := range fsts {
+		fm[fst.Puid] = true
+	}
+	var pm = map[Puid_t]PlayStore{}
+	for _, pst := range psts {
+		pm[pst.Puid] = pst
+	}
+	ret = make([]FileState, len(list))
+	for i, puid := range list {
+		var pst = pm[puid]
+		ret[i] = FileState{
+			PUID: puid,
+			Fav:  fm[puid],
+			Pos:  pst.Pos,
+			Time: pst.Time,
+		}
+	}
+	return
+}
+
+// StatePaths returns paths of files with given PUIDs that are present
+// at storage and accessible by profile, and number of skipped files.
+func StatePaths(session *Session, prf *Profile, list []Puid_t, isadmin bool) (vpaths []DiskPath, skipped int) {
+	vpaths = make([]DiskPath, 0, len(list))
+	for _, puid := range list {
+		var fpath, ok = PathStorePath(session, puid)
+		if !ok || Hidden.Fits(fpath) || !prf.PathAccess(fpath, isadmin) {
+			skipped++
+			continue
+		}
+		if name, ok := CatNames[fpath]; ok {
+			vpaths = append(vpaths, DiskPath{fpath, name})
+		} else {
+			vpaths = append(vpaths, MakeFilePath(fpath))
+		}
+	}
+	return
+}
+
+// The End.
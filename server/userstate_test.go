@@ -0,0 +1,172 @@
+package hms
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPlaySet(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+
+	// files played before, older first
+	var past = time.Now().Add(-time.Hour)
+	for i, puid := range []Puid_t{101, 102, 103, 104} {
+		if _, err := engine.InsertOne(&PlayStore{AID: 1, Puid: puid, Pos: 1000, Time: past.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := engine.InsertOne(&PlayStore{AID: 2, Puid: 101, Time: past}); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name   string
+		aid    uint64
+		puid   Puid_t
+		pos    int64
+		limit  int
+		recent []Puid_t // files kept for profile, in any order
+	}{
+		{"new file", 1, 105, 500, 3, []Puid_t{103, 104, 105}},
+		{"played again", 1, 103, 700, 3, []Puid_t{103, 104, 105}},
+		{"new file again", 1, 106, 0, 3, []Puid_t{103, 105, 106}},
+		{"no limit", 1, 107, 0, 0, []Puid_t{103, 105, 106, 107}},
+		{"limit one", 1, 105, 900, 1, []Puid_t{105}},
+		{"other profile", 2, 102, 0, 1, []Puid_t{102}},
+	}
+	for _, test := range tests {
+		if err := PlaySet(session, test.aid, test.puid, test.pos, test.limit); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var list, err = RecentList(session, test.aid, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(list)
+		if !slices.Equal(list, test.recent) {
+			t.Errorf("%s: expected recent files %v, got %v", test.name, test.recent, list)
+		}
+		var st []FileState
+		if st, err = StateGet(session, test.aid, []Puid_t{test.puid}); err != nil {
+			t.Fatal(err)
+		}
+		if st[0].Pos != test.pos {
+			t.Errorf("%s: expected position %d, got %d", test.name, test.pos, st[0].Pos)
+		}
+	}
+	if n, _ := engine.Where("aid=?", 1).Count(&PlayStore{}); n != 1 {
+		t.Errorf("expected 1 record for profile, got %d", n)
+	}
+}
+
+func TestFavSet(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+
+	var tests = []struct {
+		name string
+		puid Puid_t
+		fav  bool
+		list []Puid_t // starred files, in any order
+	}{
+		{"star", 101, true, []Puid_t{101}},
+		{"star again", 101, true, []Puid_t{101}},
+		{"star other", 102, true, []Puid_t{101, 102}},
+		{"unstar", 101, false, []Puid_t{102}},
+		{"unstar absent", 103, false, []Puid_t{102}},
+	}
+	for _, test := range tests {
+		if err := FavSet(session, 1, test.puid, test.fav); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var list, err = FavList(session, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(list)
+		if !slices.Equal(list, test.list) {
+			t.Errorf("%s: expected favorites %v, got %v", test.name, test.list, list)
+		}
+		var st []FileState
+		if st, err = StateGet(session, 1, []Puid_t{test.puid}); err != nil {
+			t.Fatal(err)
+		}
+		if st[0].Fav != test.fav {
+			t.Errorf("%s: expected state %v, got %v", test.name, test.fav, st[0].Fav)
+		}
+	}
+}
+
+func TestSpiStatePlay(t *testing.T) {
+	var engine = testStorage(t)
+	var prf = testProfile(t, "admin", "secret")
+	var dir = ToSlash(t.TempDir())
+	prf.Local = []DiskPath{{Path: dir, Name: "music"}}
+	var prev = Cfg.RecentNum
+	Cfg.RecentNum = 2
+	t.Cleanup(func() { Cfg.RecentNum = prev })
+
+	var session = engine.NewSession()
+	defer session.Close()
+	var puids []Puid_t
+	for _, name := range []string{"a.mp3", "b.mp3", "c.mp3"} {
+		var fpath = JoinPath(dir, name)
+		if err := os.WriteFile(fpath, []byte("ID3"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var puid, err = PathStoreCache(session, fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		puids = append(puids, puid)
+	}
+	var outside, err = PathStoreCache(session, "/nowhere/d.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	var r = gin.New()
+	ApiRouter(r)
+
+	var url = fmt.Sprintf("/id%d/api/state/play", prf.ID)
+	var tests = []struct {
+		name   string
+		puid   Puid_t
+		pos    int64
+		code   int
+		recent int // number of recent files after request
+	}{
+		{"first", puids[0], 1500, http.StatusOK, 1},
+		{"second", puids[1], 0, http.StatusOK, 2},
+		{"third", puids[2], 3000, http.StatusOK, 2},
+		{"negative position", puids[2], -5, http.StatusOK, 2},
+		{"no access", outside, 0, http.StatusForbidden, 2},
+		{"absent", Puid_t(1 << 40), 0, http.StatusNotFound, 2},
+	}
+	for _, test := range tests {
+		var ret FileState
+		var arg = fmt.Sprintf(`{"puid":"%s","pos":%d}`, test.puid, test.pos)
+		if code := testPost(t, r, url, "admin", "secret", arg, &ret); code != test.code {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.code, code)
+			continue
+		}
+		if test.code == http.StatusOK && (ret.PUID != test.puid || ret.Pos != max(test.pos, 0)) {
+			t.Errorf("%s: unexpected state %v", test.name, ret)
+		}
+		if list, _ := RecentList(session, prf.ID, 0); len(list) != test.recent {
+			t.Errorf("%s: expected %d recent files, got %v", test.name, test.recent, list)
+		}
+	}
+}
+
+// The End.
@@ -0,0 +1,330 @@
+package hms
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tags errors.
+var (
+	ErrTagNone   = errors.New("tag with given ID is not found")
+	ErrTagName   = errors.New("tag name should be non-empty and not longer than 255 characters")
+	ErrTagRating = errors.New("rating should be in range from 0 to 5")
+)
+
+// TagStore is storage record with tag name. Tags, links and ratings
+// are global for all profiles, and each profile sees only those
+// of them that are linked with files accessible by this profile.
+type TagStore struct {
+	TID  uint64 `xorm:"pk autoincr"`
+	Name string `xorm:"varchar(255) notnull unique"`
+}
+
+// TagLink is storage record that links tag with file.
+type TagLink struct {
+	TID  uint64 `xorm:"pk"`
+	Puid Puid_t `xorm:"pk index"`
+}
+
+// RateStore is storage record with file rating.
+type RateStore struct {
+	Puid   Puid_t `xorm:"pk"`
+	Rating int    `xorm:"notnull"` // rating from 1 to 5
+}
+
+// TagCount is tag with number of linked files.
+type TagCount struct {
+	TID   uint64 `json:"tid" yaml:"tid" xml:"tid,attr"`
+	PUID  Puid_t `json:"puid" yaml:"puid" xml:"puid,attr"` // PUID of tag virtual folder
+	Name  string `json:"name" yaml:"name" xml:",chardata"`
+	Count int    `json:"count" yaml:"count" xml:"count,attr"`
+}
+
+// FileTags is tags and rating of file.
+type FileTags struct {
+	PUID   Puid_t   `json:"puid" yaml:"puid" xml:"puid,attr"`
+	Rating int      `json:"rating,omitempty" yaml:"rating,omitempty" xml:"rating,omitempty,attr"`
+	Tags   []string `json:"tags,omitempty" yaml:"tags,omitempty" xml:"tag,omitempty"`
+}
+
+// TagNames returns trimmed unique tag names, or error if some name is bad.
+func TagNames(names []string) (ret []string, err error) {
+	ret = make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || utf8.RuneCountInString(name) > 255 {
+			return nil, fmt.Errorf("%w: '%s'", ErrTagName, name)
+		}
+		if !slices.Contains(ret, name) {
+			ret = append(ret, name)
+		}
+	}
+	return
+}
+
+// TagIDs returns IDs of tags with given names. Absent tags
+// are created if create is true, or skipped otherwise.
+func TagIDs(session *Session, names []string, create bool) (tids []uint64, err error) {
+	if len(names) == 0 {
+		return
+	}
+	var tsts []TagStore
+	if err = session.In("name", names).Find(&tsts); err != nil {
+		return
+	}
+	for _, name := range names {
+		var i = slices.IndexFunc(tsts, func(tst TagStore) bool {
+			return tst.Name == name
+		})
+		if i >= 0 {
+			tids = append(tids, tsts[i].TID)
+			continue
+		}
+		if !create {
+			continue
+		}
+		var tst = TagStore{Name: name}
+		if _, err = session.InsertOne(&tst); err != nil {
+			return
+		}
+		// virtual folder of tag is expected by tags cloud
+		if _, err = PathStoreCache(session, TagPath(tst.TID)); err != nil {
+			return
+		}
+		tids = append(tids, tst.TID)
+	}
+	return
+}
+
+// TagsAdd links tags with given names to files with given PUIDs.
+// It returns number of new links.
+func TagsAdd(session *Session, list []Puid_t, names []string) (n int64, err error) {
+	var tids []uint64
+	if tids, err = TagIDs(session, names, true); err != nil {
+		return
+	}
+	for _, tid := range tids {
+		var tls []TagLink
+		if err = session.Where("tid=?", tid).In("puid", list).Find(&tls); err != nil {
+			return
+		}
+		var nls []TagLink
+		for _, puid := range list {
+			if !slices.ContainsFunc(tls, func(tl TagLink) bool { return tl.Puid == puid }) &&
+				!slices.ContainsFunc(nls, func(tl TagLink) bool { return tl.Puid == puid }) {
+				nls = append(nls, TagLink{TID: tid, Puid: puid})
+			}
+		}
+		if len(nls) > 0 {
+			var affected int64
+			if affected, err = session.Insert(&nls); err != nil {
+				return
+			}
+			n += affected
+		}
+	}
+	return
+}
+
+// TagsDel unlinks tags with given names from files with given PUIDs,
+// and deletes tags that are not linked with any file.
+// It returns number of removed links.
+func TagsDel(session *Session, list []Puid_t, names []string) (n int64, err error) {
+	var tids []uint64
+	if tids, err = TagIDs(session, names, false); err != nil || len(tids) == 0 {
+		return
+	}
+	if n, err = session.In("tid", tids).In("puid", list).Delete(&TagLink{}); err != nil {
+		return
+	}
+	_, err = session.In("tid", tids).
+		And("tid NOT IN (SELECT tid FROM tag_link)").
+		Delete(&TagStore{})
+	return
+}
+
+// RateSet puts rating to files with given PUIDs, zero rating removes it.
+func RateSet(session *Session, list []Puid_t, rating int) (err error) {
+	if rating < 0 || rating > 5 {
+		return ErrTagRating
+	}
+	if _, err = session.In("puid", list).Delete(&RateStore{}); err != nil || rating == 0 {
+		return
+	}
+	var rsts = make([]RateStore, 0, len(list))
+	for _, puid := range list {
+		if !slices.ContainsFunc(rsts, func(rst RateStore) bool { return rst.Puid == puid }) {
+			rsts = append(rsts, RateStore{Puid: puid, Rating: rating})
+		}
+	}
+	_, err = session.Insert(&rsts)
+	return
+}
+
+// TagsGet returns tags and ratings of files with given PUIDs.
+func TagsGet(session *Session, list []Puid_t) (ret []FileTags, err error) {
+	var tls []TagLink
+	if err = session.In("puid", list).Find(&tls); err != nil {
+		return
+	}
+	var tids = make([]uint64, 0, len(tls))
+	for _, tl := range tls {
+		if !slices.Contains(tids, tl.TID) {
+			tids = append(tids, tl.TID)
+		}
+	}
+	var tsts []TagStore
+	if len(tids) > 0 {
+		if err = session.In("tid", tids).Asc("name").Find(&tsts); err != nil {
+			return
+		}
+	}
+	var rsts []RateStore
+	if err = session.In("puid", list).Find(&rsts); err != nil {
+		return
+	}
+
+	ret = make([]FileTags, len(list))
+	for i, puid := range list {
+		ret[i].PUID = puid
+		for _, rst := range rsts {
+			if rst.Puid == puid {
+				ret[i].Rating = rst.Rating
+			}
+		}
+		for _, tst := range tsts {
+			if slices.Contains(tls, TagLink{TID: tst.TID, Puid: puid}) {
+				ret[i].Tags = append(ret[i].Tags, tst.Name)
+			}
+		}
+	}
+	return
+}
+
+// TagFiles returns PUIDs of files linked with tag with given ID.
+func TagFiles(session *Session, tid uint64) (list []Puid_t, err error) {
+	err = session.Table(&TagLink{}).Cols("puid").
+		Where("tid=?", tid).Asc("puid").
+		Find(&list)
+	return
+}
+
+// TagCloud returns tags with numbers of linked files that are accessible
+// by profile. Tags without accessible files are skipped. Tags are global,
+// so the same tag can have different numbers of files for different profiles.
+func TagCloud(session *Session, prf *Profile, isadmin bool) (ret []TagCount, err error) {
+	type row struct {
+		TID  uint64 `xorm:"tid"`
+		Path string `xorm:"path"`
+	}
+	var rows []row
+	if err = session.Table(&TagLink{}).Alias("l").
+		Join("INNER", []string{"path_store", "p"}, "p.puid=l.puid").
+		Select("l.tid AS tid, p.path AS path").
+		Find(&rows); err != nil {
+		return
+	}
+	var access = map[string]bool{}
+	var counts = map[uint64]int{}
+	for _, r := range rows {
+		var ok, has = access[r.Path]
+		if !has {
+			ok = !Hidden.Fits(r.Path) && prf.PathAccess(r.Path, isadmin)
+			access[r.Path] = ok
+		}
+		if ok {
+			counts[r.TID]++
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+
+	var tids = make([]uint64, 0, len(counts))
+	var paths = make([]string, 0, len(counts))
+	for tid := range counts {
+		tids = append(tids, tid)
+		paths = append(paths, TagPath(tid))
+	}
+	var tsts []TagStore
+	if err = session.In("tid", tids).Asc("name").Find(&tsts); err != nil {
+		return
+	}
+	var psts []PathStore
+	if err = session.In("path", paths).Find(&psts); err != nil {
+		return
+	}
+	for _, tst := range tsts {
+		var puid Puid_t
+		if i := slices.IndexFunc(psts, func(pst PathStore) bool {
+			return pst.Path == TagPath(tst.TID)
+		}); i >= 0 {
+			puid = psts[i].Puid
+		} else if puid, err = PathStoreCache(session, TagPath(tst.TID)); err != nil { // tag created before virtual folders
+			return
+		}
+		ret = append(ret, TagCount{
+			TID:   tst.TID,
+			PUID:  puid,
+			Name:  tst.Name,
+			Count: counts[tst.TID],
+		})
+	}
+	return
+}
+
+// TagName returns name of tag with given ID.
+func TagName(session *Session, tid uint64) (name string, ok bool) {
+	var tst TagStore
+	if ok, _ = session.ID(tid).Get(&tst); ok {
+		name = tst.Name
+	}
+	return
+}
+
+// XmpImport links keywords of XMP metadata to file as tags,
+// and puts XMP rating if file has no rating yet.
+func XmpImport(session *Session, puid Puid_t, xp *XmpProp) (err error) {
+	var names []string
+	if names, err = TagNames(xp.Subject); err == nil && len(names) > 0 {
+		if _, err = TagsAdd(session, []Puid_t{puid}, names); err != nil {
+			return
+		}
+	}
+	err = nil // skip bad keywords
+	if xp.Rating > 0 {
+		var ok bool
+		if ok, err = session.Exist(&RateStore{Puid: puid}); err != nil || ok {
+			return
+		}
+		_, err = session.InsertOne(&RateStore{Puid: puid, Rating: xp.Rating})
+	}
+	return
+}
+
+// TagPath returns virtual path of tag with given ID.
+func TagPath(tid uint64) string {
+	return fmt.Sprintf("<tag%d>", tid)
+}
+
+// TagPathID returns ID of tag for given virtual path.
+func TagPathID(syspath string) (tid uint64, ok bool) {
+	var s string
+	if s, ok = strings.CutPrefix(syspath, "<tag"); !ok {
+		return
+	}
+	if s, ok = strings.CutSuffix(s, ">"); !ok {
+		return
+	}
+	var err error
+	if tid, err = strconv.ParseUint(s, 10, 64); err != nil {
+		return 0, false
+	}
+	return tid, true
+}
+
+// The End.
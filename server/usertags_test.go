@@ -0,0 +1,201 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTagNames(t *testing.T) {
+	var tests = []struct {
+		name  string
+		names []string
+		ret   []string
+		err   error
+	}{
+		{"empty list", nil, []string{}, nil},
+		{"trimmed", []string{" sea ", "summer\t"}, []string{"sea", "summer"}, nil},
+		{"unique", []string{"sea", " sea", "summer", "sea"}, []string{"sea", "summer"}, nil},
+		{"case sensitive", []string{"Sea", "sea"}, []string{"Sea", "sea"}, nil},
+		{"empty name", []string{"sea", "  "}, nil, ErrTagName},
+		{"long name", []string{strings.Repeat("ы", 256)}, nil, ErrTagName},
+		{"longest name", []string{strings.Repeat("ы", 255)}, []string{strings.Repeat("ы", 255)}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ret, err = TagNames(test.names)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if !slices.Equal(ret, test.ret) {
+				t.Errorf("expected names %q, got %q", test.ret, ret)
+			}
+		})
+	}
+}
+
+func TestTagPathID(t *testing.T) {
+	var tests = []struct {
+		path string
+		tid  uint64
+		ok   bool
+	}{
+		{TagPath(1), 1, true},
+		{TagPath(1234567), 1234567, true},
+		{"<tag0>", 0, true},
+		{"<tag>", 0, false},
+		{"<tag12", 0, false},
+		{"tag12>", 0, false},
+		{"<tagx>", 0, false},
+		{"<tag-1>", 0, false},
+		{"<tag1>/file.jpg", 0, false},
+		{"<home>", 0, false},
+		{"/photo/<tag1>", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			var tid, ok = TagPathID(test.path)
+			if tid != test.tid || ok != test.ok {
+				t.Errorf("expected %d, %v, got %d, %v", test.tid, test.ok, tid, ok)
+			}
+		})
+	}
+}
+
+func TestTagCloud(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+
+	var dir = ToSlash(t.TempDir())
+	var prf = testProfile(t, "tagger", "secret")
+	prf.Local = []DiskPath{{Path: dir, Name: "local"}}
+
+	var list []Puid_t
+	for _, fpath := range []string{dir + "/a.jpg", dir + "/b.jpg", dir + "/c.mp3", "/outer/d.jpg"} {
+		var puid, err = PathStoreCache(session, fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, puid)
+	}
+	for _, tl := range []struct {
+		list []Puid_t
+		name string
+	}{
+		{list[:2], "sea"},
+		{list[3:], "sea"},
+		{list[2:3], "music"},
+		{list[3:], "outer"},
+	} {
+		if _, err := TagsAdd(session, tl.list, []string{tl.name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		name    string
+		isadmin bool
+		cloud   string // names and counts of tags
+	}{
+		{"admin", true, "music:1,sea:2"},
+		{"guest without shares", false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ret, err = TagCloud(session, prf, test.isadmin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cloud []string
+			for _, tc := range ret {
+				cloud = append(cloud, fmt.Sprintf("%s:%d", tc.Name, tc.Count))
+				// virtual folder of tag is created with tag
+				if fpath, ok := PathStorePath(session, tc.PUID); !ok || fpath != TagPath(tc.TID) {
+					t.Errorf("tag %s: expected folder %s, got %s", tc.Name, TagPath(tc.TID), fpath)
+				}
+			}
+			if s := strings.Join(cloud, ","); s != test.cloud {
+				t.Errorf("expected cloud %q, got %q", test.cloud, s)
+			}
+		})
+	}
+}
+
+// testJpegXmp returns JPEG image with XMP packet in APP1 segment.
+func testJpegXmp(t *testing.T, packet string) []byte {
+	t.Helper()
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	var seg = append([]byte("http://ns.adobe.com/xap/1.0/\x00"), packet...)
+	var data = append([]byte{}, img.Bytes()[:2]...) // SOI
+	data = append(data, 0xFF, 0xE1)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(seg)+2))
+	data = append(data, seg...)
+	return append(data, img.Bytes()[2:]...)
+}
+
+func TestTagsExtractXmp(t *testing.T) {
+	var engine = testStorage(t)
+	var session = engine.NewSession()
+	defer session.Close()
+
+	var fpath = ToSlash(t.TempDir()) + "/photo.jpg"
+	var subject = `<dc:subject><rdf:Bag><rdf:li>sea</rdf:li></rdf:Bag></dc:subject>`
+	if err := os.WriteFile(fpath, testJpegXmp(t, xmppacket(` xmp:Rating="4"`, subject)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var puid, err = PathStoreCache(session, fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// user changes are kept at next extractions
+	var tests = []struct {
+		name   string
+		edit   func() error
+		rating int
+		tags   []string
+	}{
+		{"first extraction", nil, 4, []string{"sea"}},
+		{"rating changed", func() error { return RateSet(session, []Puid_t{puid}, 2) }, 2, []string{"sea"}},
+		{"tag removed", func() error {
+			var _, err = TagsDel(session, []Puid_t{puid}, []string{"sea"})
+			return err
+		}, 2, nil},
+		{"rating removed", func() error { return RateSet(session, []Puid_t{puid}, 0) }, 0, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.edit != nil {
+				if err := test.edit(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var buf StoreBuf
+			buf.Init(4)
+			TagsExtract(fpath, session, &buf, &ExtStat{}, false) // image has no EXIF
+			if err := buf.Flush(session); err != nil {
+				t.Fatal(err)
+			}
+			var ft, err = TagsGet(session, []Puid_t{puid})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ft[0].Rating != test.rating || !slices.Equal(ft[0].Tags, test.tags) {
+				t.Errorf("expected rating %d and tags %q, got %d and %q", test.rating, test.tags, ft[0].Rating, ft[0].Tags)
+			}
+		})
+	}
+}
+
+// The End.
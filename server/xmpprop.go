@@ -0,0 +1,112 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// XMP namespaces.
+const (
+	nsXmp = "http://ns.adobe.com/xap/1.0/"
+	nsDc  = "http://purl.org/dc/elements/1.1/"
+	nsRdf = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
+// XmpScanLimit is size of file head where XMP packet is searched.
+const XmpScanLimit = 512 * 1024
+
+// XmpProp is rating and keywords from XMP metadata.
+type XmpProp struct {
+	Rating  int      // rating from 1 to 5, or zero if it is absent
+	Subject []string // keywords
+}
+
+// XmpStore is XMP metadata of file buffered for import into tags storage.
+type XmpStore Store[XmpProp]
+
+// IsZero checks that properties have no any data.
+func (xp *XmpProp) IsZero() bool {
+	return xp.Rating == 0 && len(xp.Subject) == 0
+}
+
+// xmprating converts XMP rating value to rating in range 1-5,
+// rejected and unrated values are returned as zero.
+func xmprating(s string) int {
+	var f, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return int(max(min(math.Round(f), 5), 0))
+}
+
+// XmpRead finds XMP packet at the head of file and extracts
+// rating and keywords from it. It returns io.EOF if there is no packet.
+func XmpRead(r io.Reader) (xp XmpProp, err error) {
+	var head []byte
+	if head, err = io.ReadAll(io.LimitReader(r, XmpScanLimit)); err != nil {
+		return
+	}
+	var pos = bytes.Index(head, []byte("<x:xmpmeta"))
+	if pos < 0 {
+		err = io.EOF
+		return
+	}
+	head = head[pos:]
+	const end = "</x:xmpmeta>"
+	if pos = bytes.Index(head, []byte(end)); pos < 0 {
+		err = io.EOF
+		return
+	}
+	head = head[:pos+len(end)]
+
+	var dec = xml.NewDecoder(bytes.NewReader(head))
+	var insubj, inli, inrate bool
+	var t xml.Token
+	for {
+		if t, err = dec.Token(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				if attr.Name.Space == nsXmp && attr.Name.Local == "Rating" {
+					xp.Rating = xmprating(attr.Value)
+				}
+			}
+			switch {
+			case t.Name.Space == nsXmp && t.Name.Local == "Rating":
+				inrate = true
+			case t.Name.Space == nsDc && t.Name.Local == "subject":
+				insubj = true
+			case insubj && t.Name.Space == nsRdf && t.Name.Local == "li":
+				inli = true
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == nsXmp && t.Name.Local == "Rating":
+				inrate = false
+			case t.Name.Space == nsDc && t.Name.Local == "subject":
+				insubj = false
+			case t.Name.Space == nsRdf && t.Name.Local == "li":
+				inli = false
+			}
+		case xml.CharData:
+			if inrate {
+				xp.Rating = xmprating(string(t))
+			} else if inli {
+				if s := strings.TrimSpace(string(t)); s != "" {
+					xp.Subject = append(xp.Subject, s)
+				}
+			}
+		}
+	}
+}
+
+// The End.
@@ -0,0 +1,59 @@
+package hms
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// xmppacket returns XMP packet with given description content.
+func xmppacket(attrs, content string) string {
+	return `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>` +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/">` +
+		`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/"` + attrs + `>` +
+		content +
+		`</rdf:Description></rdf:RDF></x:xmpmeta>` +
+		`<?xpacket end="w"?>`
+}
+
+func TestXmpRead(t *testing.T) {
+	var subject = `<dc:subject><rdf:Bag><rdf:li>sea</rdf:li><rdf:li> summer </rdf:li><rdf:li></rdf:li></rdf:Bag></dc:subject>`
+	var tests = []struct {
+		name    string
+		data    string
+		rating  int
+		subject []string
+		err     error
+	}{
+		{"attribute rating", xmppacket(` xmp:Rating="4"`, ""), 4, nil, nil},
+		{"element rating", xmppacket("", `<xmp:Rating>3</xmp:Rating>`), 3, nil, nil},
+		{"rounded rating", xmppacket(` xmp:Rating="2.6"`, ""), 3, nil, nil},
+		{"rejected rating", xmppacket(` xmp:Rating="-1"`, ""), 0, nil, nil},
+		{"large rating", xmppacket(` xmp:Rating="9"`, ""), 5, nil, nil},
+		{"keywords", xmppacket("", subject), 0, []string{"sea", "summer"}, nil},
+		{"in binary", "\xFF\xD8\xFF\xE1\x00\x10" + xmppacket(` xmp:Rating="5"`, subject) + "\xFF\xD9", 5, []string{"sea", "summer"}, nil},
+		{"no packet", "\xFF\xD8\xFF\xD9", 0, nil, io.EOF},
+		{"unclosed packet", `<x:xmpmeta xmlns:x="adobe:ns:meta/">`, 0, nil, io.EOF},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var xp, err = XmpRead(strings.NewReader(test.data))
+			if err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if xp.Rating != test.rating {
+				t.Errorf("expected rating %d, got %d", test.rating, xp.Rating)
+			}
+			if !slices.Equal(xp.Subject, test.subject) {
+				t.Errorf("expected keywords %q, got %q", test.subject, xp.Subject)
+			}
+			if xp.IsZero() != (test.rating == 0 && len(test.subject) == 0) {
+				t.Errorf("unexpected zero state %v", xp.IsZero())
+			}
+		})
+	}
+}
+
+// The End.